@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ajg/form"
@@ -100,16 +101,17 @@ func appDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 // miniApp is a minimal representation of the app, created to make appList
 // faster and transmit less data.
 type miniApp struct {
-	Name      string            `json:"name"`
-	Pool      string            `json:"pool"`
-	TeamOwner string            `json:"teamowner"`
-	Plan      app.Plan          `json:"plan"`
-	Units     []provision.Unit  `json:"units"`
-	CName     []string          `json:"cname"`
-	Ip        string            `json:"ip"`
-	Lock      provision.AppLock `json:"lock"`
-	Tags      []string          `json:"tags"`
-	Error     string            `json:"error,omitempty"`
+	Name      string                `json:"name"`
+	Pool      string                `json:"pool"`
+	TeamOwner string                `json:"teamowner"`
+	Plan      app.Plan              `json:"plan"`
+	Units     []provision.Unit      `json:"units"`
+	CName     []string              `json:"cname"`
+	Ip        string                `json:"ip"`
+	Lock      provision.AppLock     `json:"lock"`
+	Tags      []string              `json:"tags"`
+	Metadata  provision.AppMetadata `json:"metadata"`
+	Error     string                `json:"error,omitempty"`
 }
 
 func minifyApp(app app.App) (miniApp, error) {
@@ -128,6 +130,7 @@ func minifyApp(app app.App) (miniApp, error) {
 		Ip:        app.Ip,
 		Lock:      &app.Lock,
 		Tags:      app.Tags,
+		Metadata:  app.Metadata,
 		Error:     unitsError,
 	}, nil
 }
@@ -160,6 +163,7 @@ contextsLoop:
 // responses:
 //   200: List apps
 //   204: No content
+//   400: Invalid label filter
 //   401: Unauthorized
 func appList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	filter := &app.Filter{}
@@ -188,6 +192,13 @@ func appList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if tags, ok := r.URL.Query()["tag"]; ok {
 		filter.Tags = tags
 	}
+	if labels, ok := r.URL.Query()["label"]; ok {
+		items, err := provision.ParseMetadataItems(labels)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		filter.Labels = provision.AppMetadata{Labels: items}.LabelsMap()
+	}
 	contexts := permission.ContextsForPermission(t, permission.PermAppRead)
 	if len(contexts) == 0 {
 		w.WriteHeader(http.StatusNoContent)
@@ -244,6 +255,7 @@ type inputApp struct {
 	Pool        string
 	Router      string
 	RouterOpts  map[string]string
+	LogFormat   string
 }
 
 // title: app create
@@ -277,6 +289,11 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		RouterOpts:  ia.RouterOpts,
 		Router:      ia.Router,
 		Tags:        r.Form["tag"],
+		LogFormat:   ia.LogFormat,
+	}
+	a.Metadata, err = metadataFromForm(r)
+	if err != nil {
+		return err
 	}
 	if a.TeamOwner == "" {
 		a.TeamOwner, err = permission.TeamForPermission(t, permission.PermAppCreate)
@@ -380,6 +397,7 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 // produce: application/x-json-stream
 // responses:
 //   200: App updated
+//   400: Invalid data
 //   401: Unauthorized
 //   404: Not found
 func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
@@ -395,8 +413,17 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		Description:    r.FormValue("description"),
 		Router:         r.FormValue("router"),
 		Tags:           r.Form["tag"],
+		LogFormat:      r.FormValue("logFormat"),
 		UpdatePlatform: imageReset,
 	}
+	updateData.Metadata, err = metadataFromForm(r)
+	if err != nil {
+		return err
+	}
+	updateData.ProcessPlans, err = processPlansFromForm(r)
+	if err != nil {
+		return err
+	}
 	appName := r.URL.Query().Get(":appname")
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
@@ -409,7 +436,13 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	if len(updateData.Tags) > 0 {
 		wantedPerms = append(wantedPerms, permission.PermAppUpdateTags)
 	}
-	if updateData.Plan.Name != "" {
+	if updateData.Metadata.Labels != nil || updateData.Metadata.Annotations != nil {
+		wantedPerms = append(wantedPerms, permission.PermAppUpdateMetadata)
+	}
+	if updateData.LogFormat != "" {
+		wantedPerms = append(wantedPerms, permission.PermAppUpdateLogFormat)
+	}
+	if updateData.Plan.Name != "" || len(updateData.ProcessPlans) > 0 {
 		wantedPerms = append(wantedPerms, permission.PermAppUpdatePlan)
 	}
 	if updateData.Pool != "" {
@@ -451,16 +484,63 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	defer keepAliveWriter.Stop()
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	err = a.Update(updateData, writer)
+	err = a.Update(updateData, t.GetUserName(), writer)
 	if err == app.ErrPlanNotFound {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
 	if _, ok := err.(*router.ErrRouterNotFound); ok {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if _, ok := err.(*quota.QuotaExceededError); ok {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	}
 	return err
 }
 
+// metadataFromForm reads the "label" and "annotation" form values, both in
+// the name=value format. Kinds absent from the form are left nil, so updates
+// only replace the metadata that was sent.
+func metadataFromForm(r *http.Request) (provision.AppMetadata, error) {
+	var metadata provision.AppMetadata
+	var err error
+	if labels, ok := r.Form["label"]; ok {
+		metadata.Labels, err = provision.ParseMetadataItems(labels)
+		if err != nil {
+			return metadata, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
+	if annotations, ok := r.Form["annotation"]; ok {
+		metadata.Annotations, err = provision.ParseMetadataItems(annotations)
+		if err != nil {
+			return metadata, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
+	return metadata, nil
+}
+
+// processPlansFromForm reads the "processPlan" form values, in the
+// process=plan format. An empty plan makes the process use the plan of the
+// app again.
+func processPlansFromForm(r *http.Request) (map[string]app.Plan, error) {
+	items := r.Form["processPlan"]
+	if len(items) == 0 {
+		return nil, nil
+	}
+	processPlans := make(map[string]app.Plan, len(items))
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			msg := fmt.Sprintf("invalid process plan %q, it must be in the process=plan format", item)
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+		processPlans[parts[0]] = app.Plan{Name: parts[1]}
+	}
+	return processPlans, nil
+}
+
 func numberOfUnits(r *http.Request) (uint, error) {
 	unitsStr := r.FormValue("units")
 	if unitsStr == "" {
@@ -839,17 +919,44 @@ func writeEnvVars(w http.ResponseWriter, a *app.App, variables ...string) error
 	if len(variables) > 0 {
 		for _, variable := range variables {
 			if v, ok := a.Env[variable]; ok {
-				result = append(result, v)
+				result = append(result, maskSecretEnv(v))
 			}
 		}
 	} else {
 		for _, v := range a.Env {
-			result = append(result, v)
+			result = append(result, maskSecretEnv(v))
 		}
 	}
 	return json.NewEncoder(w).Encode(result)
 }
 
+const secretEnvMask = "*****"
+
+// maskSecretEnv hides the value of secret variables, which can only be
+// written through the API.
+func maskSecretEnv(env bind.EnvVar) bind.EnvVar {
+	if env.Secret {
+		env.Value = secretEnvMask
+	}
+	return env
+}
+
+// secretEnvsCustomData returns the event custom data for setting envs, without
+// the values of secret variables.
+func secretEnvsCustomData(form url.Values, secret bool) []map[string]interface{} {
+	if !secret {
+		return event.FormToCustomData(form)
+	}
+	masked := url.Values{}
+	for k, v := range form {
+		if strings.HasPrefix(k, "Envs.") && strings.HasSuffix(k, ".Value") {
+			v = []string{secretEnvMask}
+		}
+		masked[k] = v
+	}
+	return event.FormToCustomData(masked)
+}
+
 // title: set envs
 // path: /apps/{app}/env
 // method: POST
@@ -891,7 +998,7 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 		Target:     appTarget(appName),
 		Kind:       permission.PermAppUpdateEnvSet,
 		Owner:      t,
-		CustomData: event.FormToCustomData(r.Form),
+		CustomData: secretEnvsCustomData(r.Form, e.Secret),
 		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
 	})
 	if err != nil {
@@ -902,7 +1009,7 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	variables := []bind.EnvVar{}
 	for _, v := range e.Envs {
 		envs[v.Name] = v.Value
-		variables = append(variables, bind.EnvVar{Name: v.Name, Value: v.Value, Public: !e.Private})
+		variables = append(variables, bind.EnvVar{Name: v.Name, Value: v.Value, Public: !e.Private && !e.Secret, Secret: e.Secret})
 	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
@@ -913,6 +1020,7 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			Envs:          variables,
 			PublicOnly:    true,
 			ShouldRestart: !e.NoRestart,
+			Author:        t.GetUserName(),
 		}, writer,
 	)
 }
@@ -969,6 +1077,7 @@ func unsetEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 			VariableNames: variables,
 			PublicOnly:    true,
 			ShouldRestart: !noRestart,
+			Author:        t.GetUserName(),
 		}, writer,
 	)
 }
@@ -1091,11 +1200,13 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
-	source := r.URL.Query().Get("source")
-	unit := r.URL.Query().Get("unit")
+	query, err := logQueryFromRequest(r)
+	if err != nil {
+		return err
+	}
+	query.Limit = lines
 	follow := r.URL.Query().Get("follow")
 	appName := r.URL.Query().Get(":app")
-	filterLog := app.Applog{Source: source, Unit: unit}
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1106,10 +1217,16 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	page, err := a.SearchLogs(query)
 	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+		}
 		return err
 	}
+	logs := page.Logs
+	w.Header().Set("X-Tsuru-Log-Prev", page.Prev)
+	w.Header().Set("X-Tsuru-Log-Next", page.Next)
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(logs)
 	if err != nil {
@@ -1118,16 +1235,149 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if follow != "1" {
 		return nil
 	}
+	l, err := app.NewLogListener(&a, query.LogFilter)
+	if err != nil {
+		return err
+	}
+	return followLogs(w, encoder, l)
+}
+
+// title: multiple apps log
+// path: /logs/apps
+// method: GET
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appsLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	values := r.URL.Query()
+	if values.Get("lines") == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
+	}
+	lines, err := strconv.Atoi(values.Get("lines"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" must be an integer.`}
+	}
+	query, err := logQueryFromRequest(r)
+	if err != nil {
+		return err
+	}
+	query.Limit = lines
+	apps, err := logAppsFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	logs, err := app.SearchMultiAppLogs(apps, query)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(logs)
+	if err != nil {
+		return err
+	}
+	if values.Get("follow") != "1" {
+		return nil
+	}
+	l, err := app.NewMultiAppLogListener(apps, query.LogFilter)
+	if err != nil {
+		return err
+	}
+	return followLogs(w, encoder, l)
+}
+
+// logAppsFromRequest returns the apps selected by the app names and the
+// team, pool and tag filters in the query string of the request. The user
+// must be allowed to read the logs of every selected app.
+func logAppsFromRequest(r *http.Request, t auth.Token) ([]app.App, error) {
+	values := r.URL.Query()
+	filter := &app.Filter{
+		TeamOwner: values.Get("team"),
+		Pool:      values.Get("pool"),
+		Tags:      values["tag"],
+	}
+	names := values["app"]
+	hasFilter := filter.TeamOwner != "" || filter.Pool != "" || len(filter.Tags) > 0
+	if len(names) == 0 && !hasFilter {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "Either an app or an app filter is required."}
+	}
+	maxApps := app.MaxLogApps()
+	tooManyApps := &errors.HTTP{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("Logs from at most %d apps can be requested at once.", maxApps),
+	}
+	var apps []app.App
+	seen := make(map[string]bool)
+	if len(names) > 0 {
+		byName := &app.Filter{}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				byName.ExtraIn("name", name)
+			}
+		}
+		if len(seen) > maxApps {
+			return nil, tooManyApps
+		}
+		seen = make(map[string]bool)
+		found, err := app.List(byName)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range found {
+			seen[a.Name] = true
+		}
+		for _, name := range names {
+			if !seen[name] {
+				return nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", name)}
+			}
+		}
+		apps = found
+	}
+	if hasFilter {
+		contexts := permission.ContextsForPermission(t, permission.PermAppReadLog)
+		if len(contexts) > 0 {
+			filtered, err := app.List(appFilterByContext(contexts, filter))
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range filtered {
+				if !seen[a.Name] {
+					seen[a.Name] = true
+					apps = append(apps, a)
+				}
+			}
+		}
+	}
+	if len(apps) == 0 {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: "No apps found."}
+	}
+	if len(apps) > maxApps {
+		return nil, tooManyApps
+	}
+	for i := range apps {
+		if !permission.Check(t, permission.PermAppReadLog, contextsForApp(&apps[i])...) {
+			return nil, permission.ErrUnauthorized
+		}
+	}
+	return apps, nil
+}
+
+// followLogs sends the entries received by the listener to the client until
+// the connection is closed. The listener is tracked for clean shutdown.
+func followLogs(w http.ResponseWriter, encoder *json.Encoder, l *app.LogListener) error {
 	var closeChan <-chan bool
 	if notifier, ok := w.(http.CloseNotifier); ok {
 		closeChan = notifier.CloseNotify()
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
-	if err != nil {
-		return err
-	}
 	logTracker.add(l)
 	defer func() {
 		logTracker.remove(l)
@@ -1153,6 +1403,50 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// logQueryFromRequest reads the log filter and the pagination cursors from the
+// query string of the request. Times are expected in RFC3339 format.
+func logQueryFromRequest(r *http.Request) (app.LogQuery, error) {
+	values := r.URL.Query()
+	query := app.LogQuery{
+		LogFilter: app.LogFilter{
+			Sources: values["source"],
+			Units:   values["unit"],
+			Message: values.Get("message"),
+		},
+		Before: values.Get("before"),
+		After:  values.Get("after"),
+	}
+	var err error
+	for _, field := range values["field"] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return query, &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "field" must be in the format name=value.`}
+		}
+		if query.Fields == nil {
+			query.Fields = make(map[string]string)
+		}
+		query.Fields[parts[0]] = parts[1]
+	}
+	if regex := values.Get("regex"); regex != "" {
+		query.Regex, err = strconv.ParseBool(regex)
+		if err != nil {
+			return query, &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "regex" must be a boolean.`}
+		}
+	}
+	for name, dst := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		*dst, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			msg := fmt.Sprintf("Parameter %q must be a time in RFC3339 format.", name)
+			return query, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	return query, nil
+}
+
 func getServiceInstance(serviceName, instanceName, appName string) (*service.ServiceInstance, *app.App, error) {
 	var app app.App
 	conn, err := db.Conn()
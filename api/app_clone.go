@@ -0,0 +1,150 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/service"
+)
+
+// title: app clone
+// path: /apps/{app}/clone
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: App cloned
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Quota exceeded
+//   404: App not found
+//   409: App already exists
+func appClone(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	source, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	opts := app.CloneOptions{
+		Name:      r.FormValue("name"),
+		TeamOwner: r.FormValue("teamOwner"),
+		Binds:     r.FormValue("binds"),
+	}
+	if opts.Name == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the name of the new app."}
+	}
+	for name, value := range map[string]*bool{"envs": &opts.Envs, "units": &opts.Units, "deploy": &opts.Deploy} {
+		str := r.FormValue(name)
+		if str == "" {
+			continue
+		}
+		*value, err = strconv.ParseBool(str)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for " + name + ", it must be a boolean"}
+		}
+	}
+	if opts.TeamOwner == "" {
+		opts.TeamOwner = source.TeamOwner
+	}
+	allowed := permission.Check(t, permission.PermAppRead, contextsForApp(&source)...)
+	if opts.Envs {
+		allowed = allowed && permission.Check(t, permission.PermAppReadEnv, contextsForApp(&source)...)
+	}
+	allowed = allowed && permission.Check(t, permission.PermAppCreate,
+		permission.Context(permission.CtxTeam, opts.TeamOwner),
+	)
+	if opts.Deploy {
+		allowed = allowed && permission.Check(t, permission.PermAppDeploy,
+			permission.Context(permission.CtxTeam, opts.TeamOwner),
+		)
+	}
+	if allowed && (opts.Binds == app.CloneBindsSame || opts.Binds == app.CloneBindsNew) {
+		allowed, err = canBindClone(t, &source, &opts)
+		if err != nil {
+			return err
+		}
+	}
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	opts.User, err = t.User()
+	if err != nil {
+		return err
+	}
+	newApp := app.App{Name: opts.Name, TeamOwner: opts.TeamOwner, Pool: source.Pool, Teams: source.Teams}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(opts.Name),
+		Kind:       permission.PermAppCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&newApp)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	opts.Writer = &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	_, err = app.Clone(&source, opts)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *app.InvalidCloneOptionError:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Error()}
+	case *app.AppCreationError:
+		if e.Err == app.ErrAppAlreadyExists {
+			return &errors.HTTP{Code: http.StatusConflict, Message: e.Error()}
+		}
+		if _, ok := e.Err.(*quota.QuotaExceededError); ok {
+			return &errors.HTTP{Code: http.StatusForbidden, Message: "Quota exceeded"}
+		}
+	}
+	if err == app.ErrCloneUnitsWithoutDeploy {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// canBindClone checks whether the user is allowed to bind the clone to each
+// service instance it'll be bound to: the instances bound to the source app,
+// or new instances owned by the team owner of the clone.
+func canBindClone(t auth.Token, source *app.App, opts *app.CloneOptions) (bool, error) {
+	instances, err := service.GetServicesInstancesByTeamsAndNames(nil, nil, source.Name, "")
+	if err != nil {
+		return false, err
+	}
+	for i := range instances {
+		si := &instances[i]
+		if opts.Binds == app.CloneBindsNew {
+			ctx := permission.Context(permission.CtxTeam, opts.TeamOwner)
+			if !permission.Check(t, permission.PermServiceInstanceCreate, ctx) ||
+				!permission.Check(t, permission.PermServiceInstanceUpdateBind, ctx) {
+				return false, nil
+			}
+			continue
+		}
+		if !permission.Check(t, permission.PermServiceInstanceUpdateBind, contextsForServiceInstance(si, si.ServiceName)...) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createCloneSource(c *check.C) *app.App {
+	a := app.App{Name: "source", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	source, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = source.SetEnvs(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	return source
+}
+
+func (s *S) TestAppClone(c *check.C) {
+	source := s.createCloneSource(c)
+	body := strings.NewReader("name=cloned&envs=true")
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, source.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppReadEnv,
+		Context: permission.Context(permission.CtxApp, source.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*---- Creating app \\"cloned\\" from \\"source\\" ----.*`)
+	cloned, err := app.GetByName("cloned")
+	c.Assert(err, check.IsNil)
+	c.Assert(cloned.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(cloned.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("cloned"),
+		Owner:  token.GetUserName(),
+		Kind:   "app.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": source.Name},
+			{"name": "name", "value": "cloned"},
+			{"name": "envs", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppCloneWithoutName(c *check.C) {
+	source := s.createCloneSource(c)
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "You must provide the name of the new app.\n")
+}
+
+func (s *S) TestAppCloneInvalidOptions(c *check.C) {
+	source := s.createCloneSource(c)
+	body := strings.NewReader("name=cloned&units=true")
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrCloneUnitsWithoutDeploy.Error()+"\n")
+}
+
+func (s *S) TestAppCloneAlreadyExists(c *check.C) {
+	source := s.createCloneSource(c)
+	body := strings.NewReader("name=" + source.Name)
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAppCloneNoPermission(c *check.C) {
+	source := s.createCloneSource(c)
+	body := strings.NewReader("name=cloned&envs=true")
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, source.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = app.GetByName("cloned")
+	c.Assert(err, check.Equals, app.ErrAppNotFound)
+}
+
+func (s *S) TestAppCloneBindSameWithoutInstancePermission(c *check.C) {
+	source := s.createCloneSource(c)
+	instance := service.ServiceInstance{Name: "mydb", ServiceName: "mysql", Teams: []string{"otherteam"}, Apps: []string{source.Name}}
+	err := instance.Create()
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=cloned&binds=same")
+	request, err := http.NewRequest("POST", "/apps/"+source.Name+"/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, source.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = app.GetByName("cloned")
+	c.Assert(err, check.Equals, app.ErrAppNotFound)
+}
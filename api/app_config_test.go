@@ -0,0 +1,166 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createAppWithConfigRevisions(c *check.C) *app.App {
+	a := app.App{
+		Name:     "swift",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+		Env: map[string]bind.EnvVar{
+			"DATABASE_HOST":     {Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "encrypted", Secret: true},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env?noRestart=true&env=DATABASE_HOST", a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ConfigVersion, check.Equals, 2)
+	return dbApp
+}
+
+func (s *S) TestAppConfigRevisionList(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/config/revisions", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var revisions []app.ConfigRevision
+	err = json.NewDecoder(recorder.Body).Decode(&revisions)
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 2)
+	c.Assert(revisions[0].Version, check.Equals, 2)
+	c.Assert(revisions[0].Author, check.Equals, s.token.GetUserName())
+	c.Assert(revisions[0].Changes, check.DeepEquals, []app.ConfigChange{
+		{Action: app.ConfigChangeRemoved, Kind: "env", Name: "DATABASE_HOST", Old: "localhost"},
+	})
+	c.Assert(revisions[1].Env["DATABASE_PASSWORD"].Value, check.Equals, "*****")
+}
+
+func (s *S) TestAppConfigRevisionListEmpty(c *check.C) {
+	a := app.App{Name: "swift", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/config/revisions", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAppConfigRevisionListNoPermission(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermAppReadEnv,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/config/revisions", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppConfigRevisionDiff(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/config/diff?from=2&to=1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var changes []app.ConfigChange
+	err = json.NewDecoder(recorder.Body).Decode(&changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []app.ConfigChange{
+		{Action: app.ConfigChangeAdded, Kind: "env", Name: "DATABASE_HOST", New: "localhost"},
+	})
+}
+
+func (s *S) TestAppConfigRevisionDiffInvalidVersion(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/config/diff?from=x", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	request, err = http.NewRequest("GET", "/apps/"+a.Name+"/config/diff?from=9", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAppConfigRollback(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	body := strings.NewReader("version=1")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/config/rollback", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Equals,
+		`{"Message":"---- Configuration rolled back to version 1 ----\n"}
+`)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.ConfigVersion, check.Equals, 3)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.config.rollback",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "version", "value": "1"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppConfigRollbackNotFound(c *check.C) {
+	a := s.createAppWithConfigRevisions(c)
+	body := strings.NewReader("version=9")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/config/rollback", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, "config revision not found\n")
+}
@@ -0,0 +1,350 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/yaml.v2"
+)
+
+// title: export app manifest
+// path: /apps/{app}/manifest
+// method: GET
+// produce: application/json, application/x-yaml
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App not found
+func appManifestExport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadManifest, contextsForApp(&a)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	manifest, err := app.ExportManifest(&a)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppReadEnv, contextsForApp(&a)...) {
+		// Without envs the manifest doesn't manage them, so applying it
+		// again keeps the envs of the app.
+		manifest.Envs = nil
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/x-yaml") {
+		data, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		_, err = w.Write(data)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(manifest)
+}
+
+// readManifest parses the manifest in the request body, which may be either
+// in YAML or in JSON format, and checks whether the user is allowed to manage
+// the app described in it. The app is nil when it doesn't exist yet.
+func readManifest(r *http.Request, t auth.Token, perm *permission.PermissionScheme) (*app.Manifest, *app.App, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest app.Manifest
+	err = yaml.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid manifest: " + err.Error()}
+	}
+	if manifest.Name == "" {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "manifest must have the app name"}
+	}
+	a, err := app.GetByName(manifest.Name)
+	if err == app.ErrAppNotFound {
+		if manifest.TeamOwner == "" {
+			return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "manifest for a new app must have the team owner"}
+		}
+		allowed := permission.Check(t, permission.PermAppCreate,
+			permission.Context(permission.CtxTeam, manifest.TeamOwner),
+		)
+		if !allowed {
+			return nil, nil, permission.ErrUnauthorized
+		}
+		return &manifest, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !permission.Check(t, perm, contextsForApp(a)...) {
+		return nil, nil, permission.ErrUnauthorized
+	}
+	return &manifest, a, nil
+}
+
+// title: plan app manifest
+// path: /manifests/plan
+// method: POST
+// consume: application/x-yaml, application/json
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No changes
+//   400: Invalid manifest
+//   401: Unauthorized
+func appManifestPlan(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	manifest, a, err := readManifest(r, t, permission.PermAppReadManifest)
+	if err != nil {
+		return err
+	}
+	changes, err := app.PlanManifest(manifest)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+		}
+		return err
+	}
+	if a != nil && !permission.Check(t, permission.PermAppReadEnv, contextsForApp(a)...) {
+		changes = maskCurrentEnvs(changes)
+	}
+	if len(changes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(changes)
+}
+
+// title: apply app manifest
+// path: /manifests/apply
+// method: POST
+// consume: application/x-yaml, application/json
+// produce: application/x-json-stream
+// responses:
+//   200: Manifest applied
+//   400: Invalid manifest
+//   401: Unauthorized
+func appManifestApply(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	manifest, a, err := readManifest(r, t, permission.PermAppUpdateManifest)
+	if err != nil {
+		return err
+	}
+	user, err := t.User()
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		a = &app.App{Name: manifest.Name, TeamOwner: manifest.TeamOwner, Pool: manifest.Pool}
+	}
+	planned, err := app.PlanManifest(manifest)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+		}
+		return err
+	}
+	err = checkManifestChanges(t, a, planned)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(manifest.Name),
+		Kind:       permission.PermAppUpdateManifest,
+		Owner:      t,
+		CustomData: maskManifest(manifest),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+	})
+	if err != nil {
+		return err
+	}
+	var changes []app.ConfigChange
+	defer func() { evt.DoneCustomData(err, maskManifestChanges(manifest, a, changes)) }()
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	evt.SetLogWriter(writer)
+	changes, err = app.ApplyManifest(manifest, user, evt)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// checkManifestChanges checks whether the user is allowed to apply each of
+// the changes, with the same permissions required by the handlers that apply
+// them one by one.
+func checkManifestChanges(t auth.Token, a *app.App, changes []app.ConfigChange) error {
+	for _, change := range changes {
+		var perm *permission.PermissionScheme
+		added := change.Action != app.ConfigChangeRemoved
+		switch change.Kind {
+		case "description":
+			perm = permission.PermAppUpdateDescription
+		case "team-owner":
+			perm = permission.PermAppUpdateTeamowner
+		case "plan":
+			perm = permission.PermAppUpdatePlan
+		case "pool":
+			perm = permission.PermAppUpdatePool
+		case "router":
+			perm = permission.PermAppUpdateRouter
+		case "tags":
+			perm = permission.PermAppUpdateTags
+		case "team":
+			perm = permission.PermAppUpdateRevoke
+			if added {
+				perm = permission.PermAppUpdateGrant
+			}
+		case "env":
+			perm = permission.PermAppUpdateEnvUnset
+			if added {
+				perm = permission.PermAppUpdateEnvSet
+			}
+		case "cname":
+			perm = permission.PermAppUpdateCnameRemove
+			if added {
+				perm = permission.PermAppUpdateCnameAdd
+			}
+		case "units":
+			perm = permission.PermAppUpdateUnitRemove
+			old, _ := strconv.Atoi(change.Old)
+			wanted, _ := strconv.Atoi(change.New)
+			if wanted > old {
+				perm = permission.PermAppUpdateUnitAdd
+			}
+		case "service-instance":
+			err := checkManifestServiceCreate(t, a, change.Name)
+			if err != nil {
+				return err
+			}
+		case "bind":
+			err := checkManifestBind(t, a, change)
+			if err != nil {
+				return err
+			}
+		}
+		if perm != nil && !permission.Check(t, perm, contextsForApp(a)...) {
+			return permission.ErrUnauthorized
+		}
+	}
+	return nil
+}
+
+// checkManifestServiceCreate checks whether the user is allowed to create
+// the service instance, named service/instance, owned by the team owner of
+// the app.
+func checkManifestServiceCreate(t auth.Token, a *app.App, name string) error {
+	parts := strings.SplitN(name, "/", 2)
+	srv := service.Service{Name: parts[0]}
+	err := srv.Get()
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceInstanceCreate, permission.Context(permission.CtxTeam, a.TeamOwner)) {
+		return permission.ErrUnauthorized
+	}
+	if srv.IsRestricted && !permission.Check(t, permission.PermServiceRead, contextsForService(&srv)...) {
+		return permission.ErrUnauthorized
+	}
+	return nil
+}
+
+// checkManifestBind checks whether the user is allowed to bind or unbind the
+// app and the service instance, named service/instance. Instances created by
+// the manifest are owned by the team owner of the app and don't need to be
+// checked.
+func checkManifestBind(t auth.Token, a *app.App, change app.ConfigChange) error {
+	appPerm, instancePerm := permission.PermAppUpdateBind, permission.PermServiceInstanceUpdateBind
+	if change.Action == app.ConfigChangeRemoved {
+		appPerm, instancePerm = permission.PermAppUpdateUnbind, permission.PermServiceInstanceUpdateUnbind
+	}
+	if !permission.Check(t, appPerm, contextsForApp(a)...) {
+		return permission.ErrUnauthorized
+	}
+	parts := strings.SplitN(change.Name, "/", 2)
+	instance, err := service.GetServiceInstance(parts[0], parts[1])
+	if err == service.ErrServiceInstanceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, instancePerm, contextsForServiceInstance(instance, parts[0])...) {
+		return permission.ErrUnauthorized
+	}
+	return nil
+}
+
+// maskManifest returns a copy of the manifest without the values of private
+// envs, to be stored in events.
+func maskManifest(m *app.Manifest) *app.Manifest {
+	masked := *m
+	masked.Envs = make([]app.ManifestEnv, len(m.Envs))
+	for i, env := range m.Envs {
+		if env.Private {
+			env.Value = secretEnvMask
+		}
+		masked.Envs[i] = env
+	}
+	if m.Envs == nil {
+		masked.Envs = nil
+	}
+	return &masked
+}
+
+// maskCurrentEnvs returns the changes without the current values of the envs
+// of the app, for users not allowed to read them.
+func maskCurrentEnvs(changes []app.ConfigChange) []app.ConfigChange {
+	masked := make([]app.ConfigChange, len(changes))
+	for i, change := range changes {
+		if change.Kind == "env" && change.Old != "" {
+			change.Old = secretEnvMask
+		}
+		masked[i] = change
+	}
+	return masked
+}
+
+// maskManifestChanges returns the changes without the values of envs that
+// are private either in the manifest or in the app.
+func maskManifestChanges(m *app.Manifest, a *app.App, changes []app.ConfigChange) []app.ConfigChange {
+	private := map[string]bool{}
+	for name, env := range a.Env {
+		private[name] = !env.Public
+	}
+	for _, env := range m.Envs {
+		private[env.Name] = private[env.Name] || env.Private
+	}
+	masked := make([]app.ConfigChange, len(changes))
+	for i, change := range changes {
+		if change.Kind == "env" && private[change.Name] {
+			if change.Old != "" {
+				change.Old = secretEnvMask
+			}
+			if change.New != "" {
+				change.New = secretEnvMask
+			}
+		}
+		masked[i] = change
+	}
+	return masked
+}
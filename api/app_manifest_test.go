@@ -0,0 +1,334 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+func (s *S) createManifestApp(c *check.C) *app.App {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Description: "my app"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	return dbApp
+}
+
+func (s *S) TestAppManifestExport(c *check.C) {
+	a := s.createManifestApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/manifest", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var m app.Manifest
+	err = json.NewDecoder(recorder.Body).Decode(&m)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Name, check.Equals, a.Name)
+	c.Assert(m.Platform, check.Equals, "zend")
+	c.Assert(m.Description, check.Equals, "my app")
+	c.Assert(m.TeamOwner, check.Equals, s.team.Name)
+}
+
+func (s *S) TestAppManifestExportYAML(c *check.C) {
+	a := s.createManifestApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/manifest", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	request.Header.Set("Accept", "application/x-yaml")
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-yaml")
+	var m app.Manifest
+	err = yaml.Unmarshal(recorder.Body.Bytes(), &m)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Name, check.Equals, a.Name)
+	c.Assert(m.TeamOwner, check.Equals, s.team.Name)
+}
+
+func (s *S) TestAppManifestExportEnvs(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Env: map[string]bind.EnvVar{
+		"DB_PASSWORD": {Name: "DB_PASSWORD", Value: "s3cr3t"},
+	}}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	readManifest := permission.Permission{
+		Scheme:  permission.PermAppReadManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}
+	readEnv := permission.Permission{
+		Scheme:  permission.PermAppReadEnv,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}
+	var tests = []struct {
+		user     string
+		perms    []permission.Permission
+		expected []app.ManifestEnv
+	}{
+		{"reader", []permission.Permission{readManifest}, nil},
+		{"env-reader", []permission.Permission{readManifest, readEnv}, []app.ManifestEnv{{Name: "DB_PASSWORD", Value: "s3cr3t", Private: true}}},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/apps/"+a.Name+"/manifest", nil)
+		c.Assert(err, check.IsNil)
+		_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, tt.user, tt.perms...)
+		request.Header.Set("Authorization", "b "+token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusOK)
+		var m app.Manifest
+		err = json.NewDecoder(recorder.Body).Decode(&m)
+		c.Assert(err, check.IsNil)
+		c.Assert(m.Envs, check.DeepEquals, tt.expected)
+	}
+}
+
+func (s *S) TestAppManifestExportNoPermission(c *check.C) {
+	a := s.createManifestApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/manifest", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppManifestPlan(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader("name: myapp\ndescription: new description\nenvs:\n- name: LOG_LEVEL\n  value: debug\n")
+	request, err := http.NewRequest("POST", "/manifests/plan", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var changes []app.ConfigChange
+	err = json.NewDecoder(recorder.Body).Decode(&changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []app.ConfigChange{
+		{Action: app.ConfigChangeUpdated, Kind: "description", Name: "description", Old: "my app", New: "new description"},
+		{Action: app.ConfigChangeAdded, Kind: "env", Name: "LOG_LEVEL", New: "debug"},
+	})
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "my app")
+}
+
+func (s *S) TestAppManifestPlanMasksEnvsWithoutReadEnv(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Env: map[string]bind.EnvVar{
+		"DB_PASSWORD": {Name: "DB_PASSWORD", Value: "s3cr3t"},
+	}}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name: myapp\nenvs: []\n")
+	request, err := http.NewRequest("POST", "/manifests/plan", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var changes []app.ConfigChange
+	err = json.NewDecoder(recorder.Body).Decode(&changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []app.ConfigChange{
+		{Action: app.ConfigChangeRemoved, Kind: "env", Name: "DB_PASSWORD", Old: secretEnvMask},
+	})
+}
+
+func (s *S) TestAppManifestPlanNoChanges(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader(`{"name": "myapp", "description": "my app"}`)
+	request, err := http.NewRequest("POST", "/manifests/plan", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	c.Assert(a.Description, check.Equals, "my app")
+}
+
+func (s *S) TestAppManifestPlanInvalid(c *check.C) {
+	request, err := http.NewRequest("POST", "/manifests/plan", strings.NewReader("description: no name"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "manifest must have the app name\n")
+}
+
+func (s *S) TestAppManifestApply(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader("name: myapp\ndescription: new description\nenvs:\n- name: LOG_LEVEL\n  value: debug\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppUpdateDescription,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppUpdateEnvSet,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*---- Applying 2 changes to app \\"myapp\\" ----.*`)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "new description")
+	c.Assert(dbApp.Env["LOG_LEVEL"].Value, check.Equals, "debug")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.manifest",
+		StartCustomData: map[string]interface{}{
+			"name":        "myapp",
+			"description": "new description",
+		},
+		EndCustomData: []map[string]interface{}{
+			{"action": "updated", "kind": "description", "name": "description", "old": "my app", "new": "new description"},
+			{"action": "added", "kind": "env", "name": "LOG_LEVEL", "new": "debug"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppManifestApplyNewApp(c *check.C) {
+	body := strings.NewReader("name: newapp\nplatform: zend\nteam-owner: " + s.team.Name + "\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName("newapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.TeamOwner, check.Equals, s.team.Name)
+}
+
+func (s *S) TestAppManifestApplyNewAppWithoutTeamOwner(c *check.C) {
+	body := strings.NewReader("name: newapp\nplatform: zend\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	_, err = app.GetByName("newapp")
+	c.Assert(err, check.Equals, app.ErrAppNotFound)
+}
+
+func (s *S) TestAppManifestApplyNoPermission(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader("name: myapp\ndescription: new description\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "my app")
+}
+
+func (s *S) TestAppManifestApplyWithoutChangePermission(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader("name: myapp\ndescription: new description\nteam-owner: otherteam\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateManifest,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppUpdateDescription,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "my app")
+	c.Assert(dbApp.TeamOwner, check.Equals, s.team.Name)
+}
+
+func (s *S) TestAppManifestApplyMasksPrivateEnvs(c *check.C) {
+	a := s.createManifestApp(c)
+	body := strings.NewReader("name: myapp\nenvs:\n- name: PASSWORD\n  value: s3cr3t\n  private: true\n")
+	request, err := http.NewRequest("POST", "/manifests/apply", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-yaml")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["PASSWORD"].Value, check.Equals, "s3cr3t")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.manifest",
+		StartCustomData: map[string]interface{}{
+			"name": "myapp",
+			"envs": []interface{}{
+				map[string]interface{}{"name": "PASSWORD", "value": "*****", "private": true},
+			},
+		},
+		EndCustomData: []map[string]interface{}{
+			{"action": "added", "kind": "env", "name": "PASSWORD", "new": "*****"},
+		},
+	}, eventtest.HasEvent)
+}
@@ -6,6 +6,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -250,6 +251,41 @@ func (s *S) TestAppListFilteringByTags(c *check.C) {
 	c.Assert(apps[0].Tags, check.DeepEquals, app1.Tags)
 }
 
+func (s *S) TestAppListFilteringByLabels(c *check.C) {
+	app1 := app.App{Name: "app1", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "payments"}},
+	}}
+	err := app.CreateApp(&app1, s.user)
+	c.Assert(err, check.IsNil)
+	app2 := app.App{Name: "app2", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "core"}},
+	}}
+	err = app.CreateApp(&app2, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps?label=team%3Dcore", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	apps := []app.App{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &apps)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, app2.Name)
+	c.Assert(apps[0].Metadata, check.DeepEquals, app2.Metadata)
+}
+
+func (s *S) TestAppListFilteringByInvalidLabel(c *check.C) {
+	request, err := http.NewRequest("GET", "/apps?label=team", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid metadata item \"team\", it must be in the form name=value\n")
+}
+
 func (s *S) TestAppListFilteringByLockState(c *check.C) {
 	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&app1, s.user)
@@ -1045,6 +1081,36 @@ func (s *S) TestCreateAppWithTags(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestCreateAppWithMetadata(c *check.C) {
+	b := strings.NewReader("name=someapp&platform=zend&label=team%3Dpayments&annotation=example.com%2Fowner%3Dme")
+	request, err := http.NewRequest("POST", "/apps", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "someapp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.Metadata, check.DeepEquals, provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/owner", Value: "me"}},
+	})
+}
+
+func (s *S) TestCreateAppWithInvalidMetadata(c *check.C) {
+	b := strings.NewReader("name=someapp&platform=zend&label=app-name%3Dother")
+	request, err := http.NewRequest("POST", "/apps", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "label \"app-name\" is reserved for internal use\n")
+}
+
 func (s *S) TestCreateAppWithPool(c *check.C) {
 	err := provision.AddPool(provision.AddPoolOptions{Name: "mypool1", Public: true})
 	c.Assert(err, check.IsNil)
@@ -1382,6 +1448,45 @@ func (s *S) TestUpdateAppWithDescriptionOnly(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestUpdateAppWithLogFormat(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateLogFormat,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	b := strings.NewReader("logFormat=json")
+	request, err := http.NewRequest("PUT", "/apps/myapp", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "myapp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.LogFormat, check.Equals, app.LogFormatJSON)
+}
+
+func (s *S) TestUpdateAppWithInvalidLogFormat(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader("logFormat=xml")
+	request, err := http.NewRequest("PUT", "/apps/myapp", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, `invalid log format "xml", it must be "text" or "json"`+"\n")
+}
+
 func (s *S) TestUpdateAppWithTagsOnly(c *check.C) {
 	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -1436,6 +1541,57 @@ func (s *S) TestUpdateAppWithTagsWithoutPermission(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
 
+func (s *S) TestUpdateAppWithMetadataOnly(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateMetadata,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	b := strings.NewReader("label=tier%3Dbackend&label=team%3Dpayments")
+	request, err := http.NewRequest("PUT", "/apps/myapp", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "myapp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.Metadata, check.DeepEquals, provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "payments"}, {Name: "tier", Value: "backend"}},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":appname", "value": a.Name},
+			{"name": "label", "value": []string{"tier=backend", "team=payments"}},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUpdateAppWithMetadataWithoutPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateTags,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	b := strings.NewReader("annotation=owner%3Dme")
+	request, err := http.NewRequest("PUT", "/apps/myapp", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestUpdateAppWithRouterOnly(c *check.C) {
 	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
 	err := app.CreateApp(&a, s.user)
@@ -1594,6 +1750,52 @@ func (s *S) TestUpdateAppPlanNotFound(c *check.C) {
 	c.Check(recorder.Body.String(), check.Equals, app.ErrPlanNotFound.Error()+"\n")
 }
 
+func (s *S) TestUpdateAppProcessPlan(c *check.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	plans := []app.Plan{
+		{Name: "hiperplan", Memory: 536870912, Swap: 536870912, CpuShare: 100},
+		{Name: "superplan", Memory: 268435456, Swap: 268435456, CpuShare: 100},
+	}
+	for _, plan := range plans {
+		err := plan.Save()
+		c.Assert(err, check.IsNil)
+	}
+	a := app.App{Name: "someapp", Platform: "zend", TeamOwner: s.team.Name, Plan: plans[1]}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("processPlan=worker=hiperplan")
+	request, err := http.NewRequest("PUT", "/apps/someapp", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan, check.DeepEquals, plans[1])
+	c.Assert(dbApp.ProcessPlans, check.DeepEquals, map[string]app.Plan{"worker": plans[0]})
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 1)
+}
+
+func (s *S) TestUpdateAppProcessPlanInvalid(c *check.C) {
+	a := app.App{Name: "someapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("processPlan=hiperplan")
+	request, err := http.NewRequest("PUT", "/apps/someapp", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Check(recorder.Body.String(), check.Equals, "invalid process plan \"hiperplan\", it must be in the process=plan format\n")
+}
+
 func (s *S) TestUpdateAppWithoutFlag(c *check.C) {
 	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -2879,6 +3081,64 @@ func (s *S) TestSetEnvPublicEnvironmentVariableInTheApp(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestSetEnvSecretEnvironmentVariableInTheApp(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env", a.Name)
+	d := types.Envs{
+		Envs: []struct{ Name, Value string }{
+			{"DATABASE_PASSWORD", "123"},
+		},
+		NoRestart: true,
+		Secret:    true,
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", url, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_PASSWORD"].Secret, check.Equals, true)
+	c.Assert(dbApp.Env["DATABASE_PASSWORD"].Value, check.Not(check.Equals), "123")
+	envs, err := dbApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["DATABASE_PASSWORD"].Value, check.Equals, "123")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.env.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Envs.0.Name", "value": "DATABASE_PASSWORD"},
+			{"name": "Envs.0.Value", "value": "*****"},
+		},
+	}, eventtest.HasEvent)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	result := []map[string]interface{}{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []map[string]interface{}{{
+		"name":   "DATABASE_PASSWORD",
+		"value":  "*****",
+		"public": false,
+		"secret": true,
+	}})
+}
+
 func (s *S) TestSetEnvHandlerShouldSetAPrivateEnvironmentVariableInTheApp(c *check.C) {
 	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -3929,6 +4189,197 @@ func (s *S) TestAppLogSelectByUnit(c *check.C) {
 	c.Assert(logs[0].Unit, check.Equals, "caliban")
 }
 
+func (s *S) TestAppsLogMergesApps(c *check.C) {
+	a1 := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := app.App{Name: "lost2", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	a1.Log("1", "web", "")
+	a2.Log("2", "web", "")
+	a1.Log("3", "web", "")
+	a2.Log("4", "worker", "")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/logs/apps?app=lost1&app=lost2&lines=3&source=web", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appsLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	var got []string
+	for _, l := range logs {
+		got = append(got, l.AppName+":"+l.Message)
+	}
+	c.Assert(got, check.DeepEquals, []string{"lost1:1", "lost2:2", "lost1:3"})
+}
+
+func (s *S) TestAppsLogByTeam(c *check.C) {
+	a1 := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	team := auth.Team{Name: "other-team"}
+	err = s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	a2 := app.App{Name: "lost2", Platform: "zend", TeamOwner: team.Name}
+	err = app.CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	a1.Log("mine", "web", "")
+	a2.Log("other", "web", "")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/logs/apps?team="+s.team.Name+"&lines=10", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appsLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].AppName, check.Equals, "lost1")
+	c.Assert(logs[0].Message, check.Equals, "mine")
+	request, err = http.NewRequest("GET", "/logs/apps?team=other-team&lines=10", nil)
+	c.Assert(err, check.IsNil)
+	err = appsLog(httptest.NewRecorder(), request, token)
+	c.Assert(err, check.DeepEquals, &errors.HTTP{Code: http.StatusNotFound, Message: "No apps found."})
+}
+
+func (s *S) TestAppsLogForbiddenApp(c *check.C) {
+	a1 := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := app.App{Name: "lost2", Platform: "vougan"}
+	err = s.conn.Apps().Insert(a2)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/logs/apps?app=lost1&app=lost2&lines=10", nil)
+	c.Assert(err, check.IsNil)
+	err = appsLog(httptest.NewRecorder(), request, token)
+	c.Assert(err, check.Equals, permission.ErrUnauthorized)
+}
+
+func (s *S) TestAppsLogInvalidParams(c *check.C) {
+	a := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	tests := []struct {
+		query string
+		code  int
+		msg   string
+	}{
+		{"app=lost1", http.StatusBadRequest, `Parameter "lines" is mandatory.`},
+		{"app=lost1&lines=x", http.StatusBadRequest, `Parameter "lines" must be an integer.`},
+		{"lines=10", http.StatusBadRequest, "Either an app or an app filter is required."},
+		{"app=unknown&lines=10", http.StatusNotFound, "App unknown not found."},
+		{"app=lost1&lines=10&before=abc", http.StatusBadRequest, "log cursors are not supported when searching the logs of multiple apps"},
+	}
+	for i, tt := range tests {
+		request, err := http.NewRequest("GET", "/logs/apps?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		err = appsLog(httptest.NewRecorder(), request, token)
+		c.Check(err, check.DeepEquals, &errors.HTTP{Code: tt.code, Message: tt.msg}, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestAppsLogTooManyApps(c *check.C) {
+	config.Set("server:app-log-max-apps", 1)
+	defer config.Unset("server:app-log-max-apps")
+	a1 := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := app.App{Name: "lost2", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	expected := &errors.HTTP{Code: http.StatusBadRequest, Message: "Logs from at most 1 apps can be requested at once."}
+	for _, query := range []string{"app=lost1&app=lost2", "team=" + s.team.Name} {
+		request, err := http.NewRequest("GET", "/logs/apps?lines=10&"+query, nil)
+		c.Assert(err, check.IsNil)
+		err = appsLog(httptest.NewRecorder(), request, token)
+		c.Assert(err, check.DeepEquals, expected)
+	}
+	request, err := http.NewRequest("GET", "/logs/apps?lines=10&app=lost1&app=lost1", nil)
+	c.Assert(err, check.IsNil)
+	err = appsLog(httptest.NewRecorder(), request, token)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAppsLogFollow(c *check.C) {
+	a1 := app.App{Name: "lost1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := app.App{Name: "lost2", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/logs/apps?app=lost1&app=lost2&lines=10&follow=1", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := &closeableRecorder{httptest.NewRecorder(), make(chan bool)}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logErr := appsLog(recorder, request, token)
+		c.Assert(logErr, check.IsNil)
+		splitted := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		c.Assert(splitted, check.HasLen, 3)
+		c.Assert(splitted[0], check.Equals, "[]")
+		var got []string
+		for _, line := range splitted[1:] {
+			logs := []app.Applog{}
+			logErr = json.Unmarshal([]byte(line), &logs)
+			c.Assert(logErr, check.IsNil)
+			c.Assert(logs, check.HasLen, 1)
+			got = append(got, logs[0].AppName+":"+logs[0].Message)
+		}
+		c.Assert(got, check.DeepEquals, []string{"lost2:x", "lost1:y"})
+	}()
+	var listener *app.LogListener
+	timeout := time.After(5 * time.Second)
+	for listener == nil {
+		select {
+		case <-timeout:
+			c.Fatal("timeout after 5 seconds")
+		case <-time.After(50 * time.Millisecond):
+		}
+		logTracker.Lock()
+		for listener = range logTracker.conn {
+		}
+		logTracker.Unlock()
+	}
+	err = a2.Log("x", "", "")
+	c.Assert(err, check.IsNil)
+	err = a1.Log("y", "", "")
+	c.Assert(err, check.IsNil)
+	time.Sleep(1500 * time.Millisecond)
+	close(recorder.ch)
+	wg.Wait()
+}
+
 func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -3965,6 +4416,131 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	c.Assert(logs[2].Message, check.Equals, "14")
 }
 
+func (s *S) TestAppLogSearch(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	base := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	coll := s.logConn.Logs(a.Name)
+	for i := 0; i < 10; i++ {
+		source := "web"
+		if i%2 == 0 {
+			source = "worker"
+		}
+		l := app.Applog{
+			Date:    base.Add(time.Duration(i) * time.Hour),
+			Message: fmt.Sprintf("request %d done", i),
+			Source:  source,
+			AppName: a.Name,
+		}
+		coll.Insert(l)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	v := url.Values{}
+	v.Set(":app", a.Name)
+	v.Set("lines", "2")
+	v.Set("since", base.Add(2*time.Hour).Format(time.RFC3339))
+	v.Set("until", base.Add(8*time.Hour).Format(time.RFC3339))
+	v.Set("message", `request \d done`)
+	v.Set("regex", "true")
+	v.Add("source", "web")
+	v.Add("source", "worker")
+	request, err := http.NewRequest("GET", "/apps/lost/log?"+v.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 7 done")
+	c.Assert(logs[1].Message, check.Equals, "request 8 done")
+	prev := recorder.Header().Get("X-Tsuru-Log-Prev")
+	c.Assert(prev, check.Not(check.Equals), "")
+	c.Assert(recorder.Header().Get("X-Tsuru-Log-Next"), check.Not(check.Equals), "")
+	v.Set("before", prev)
+	request, err = http.NewRequest("GET", "/apps/lost/log?"+v.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs = nil
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 5 done")
+	c.Assert(logs[1].Message, check.Equals, "request 6 done")
+}
+
+func (s *S) TestAppLogSelectByField(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	coll := s.logConn.Logs(a.Name)
+	now := time.Now()
+	for _, level := range []string{"info", "error", "error"} {
+		l := app.Applog{
+			Date:    now,
+			Message: fmt.Sprintf(`{"level":%q,"request_id":"r1"}`, level),
+			Source:  "web",
+			AppName: a.Name,
+			Fields:  map[string]string{"level": level, "request_id": "r1"},
+		}
+		coll.Insert(l)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&field=level=error&field=request_id=r1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", u, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]string{"level": "error", "request_id": "r1"})
+}
+
+func (s *S) TestAppLogSearchInvalidParams(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	var tests = []struct {
+		query string
+		msg   string
+	}{
+		{"since=yesterday", `Parameter "since" must be a time in RFC3339 format.`},
+		{"until=2017-06-16", `Parameter "until" must be a time in RFC3339 format.`},
+		{"regex=maybe", `Parameter "regex" must be a boolean.`},
+		{"regex=true&message=a(b", "invalid message regular expression: .*"},
+		{"since=2017-06-16T15:00:00Z&until=2017-06-15T15:00:00Z", "until must not be before since"},
+		{"before=xyz", `invalid log cursor "xyz"`},
+		{"field=level", `Parameter "field" must be in the format name=value.`},
+		{"field=user.id=1", `invalid log field name "user.id"`},
+	}
+	for _, tt := range tests {
+		u := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&%s", a.Name, a.Name, tt.query)
+		request, err := http.NewRequest("GET", u, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appLog(recorder, request, s.token)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, check.Equals, true, check.Commentf("query %q", tt.query))
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, check.Matches, tt.msg)
+	}
+}
+
 func (s *S) TestAppLogShouldReturnLogByApp(c *check.C) {
 	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&app1, s.user)
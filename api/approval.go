@@ -0,0 +1,382 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// approvalReplayHandler is the complete API handler, used to run operations
+// once they're approved.
+var approvalReplayHandler http.Handler
+
+// maxApprovalBodySize is the largest request body kept to replay an
+// operation after it's approved.
+const maxApprovalBodySize = 1024 * 1024
+
+// bodyRecorder keeps a copy of the request body read by handlers, so requests
+// requiring approval can be replayed with their original payload.
+type bodyRecorder struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func recordRequestBody(r *http.Request) {
+	if r.Body == nil || strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return
+	}
+	r.Body = &bodyRecorder{ReadCloser: r.Body}
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.truncated {
+		if b.buf.Len()+n > maxApprovalBodySize {
+			b.truncated = true
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// recordedBody returns the complete request body, reading whatever handlers
+// left unread.
+func recordedBody(r *http.Request) (string, error) {
+	recorder, ok := r.Body.(*bodyRecorder)
+	if !ok {
+		return "", fmt.Errorf("request body is not available")
+	}
+	io.Copy(ioutil.Discard, recorder)
+	if recorder.truncated {
+		return "", fmt.Errorf("request body is larger than %d bytes", maxApprovalBodySize)
+	}
+	return recorder.buf.String(), nil
+}
+
+// approvalToken runs an approved operation on behalf of the user who
+// requested it.
+type approvalToken struct {
+	user       *auth.User
+	approvalID bson.ObjectId
+}
+
+func (t *approvalToken) GetValue() string {
+	return ""
+}
+
+func (t *approvalToken) GetAppName() string {
+	return ""
+}
+
+func (t *approvalToken) GetUserName() string {
+	return t.user.Email
+}
+
+func (t *approvalToken) IsAppToken() bool {
+	return false
+}
+
+func (t *approvalToken) User() (*auth.User, error) {
+	return t.user, nil
+}
+
+func (t *approvalToken) Permissions() ([]permission.Permission, error) {
+	return t.user.Permissions()
+}
+
+func (t *approvalToken) ApprovalID() bson.ObjectId {
+	return t.approvalID
+}
+
+// handleApprovalRequired stores the request of an operation that must be
+// approved before running, so it can be replayed later, and tells the client
+// about the pending approval. It returns false if err isn't an
+// ErrApprovalRequired.
+func handleApprovalRequired(w http.ResponseWriter, r *http.Request, err error) bool {
+	approvalErr, ok := err.(*event.ErrApprovalRequired)
+	if !ok {
+		return false
+	}
+	body, storeErr := recordedBody(r)
+	if storeErr == nil {
+		storeErr = event.SetApprovalRequest(approvalErr.ID, event.ApprovalRequest{
+			Method:      r.Method,
+			URL:         r.URL.RequestURI(),
+			Body:        body,
+			ContentType: r.Header.Get("Content-Type"),
+		})
+	}
+	if storeErr != nil {
+		log.Errorf("unable to store request for approval %s: %s", approvalErr.ID.Hex(), storeErr)
+		return false
+	}
+	if flushing, ok := w.(*tsuruIo.FlushingWriter); !ok || !flushing.Wrote() {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+	}
+	fmt.Fprintln(w, err)
+	return true
+}
+
+func findPendingApproval(r *http.Request, t auth.Token) (*event.Event, error) {
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		msg := fmt.Sprintf("uuid parameter is not ObjectId: %s", uuid)
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	e, err := event.GetByID(bson.ObjectIdHex(uuid))
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if e.Approval == nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "event does not require approval"}
+	}
+	scheme, err := permission.SafeGet(e.Kind.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !permission.Check(t, scheme, e.Allowed.Contexts...) {
+		return nil, permission.ErrUnauthorized
+	}
+	if !t.IsAppToken() && e.Owner.Type == event.OwnerTypeUser && e.Owner.Name == t.GetUserName() {
+		return nil, &errors.HTTP{Code: http.StatusForbidden, Message: "operations must be reviewed by another user"}
+	}
+	return e, nil
+}
+
+func handleReviewError(err error) error {
+	if err == event.ErrApprovalNotFound {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+// title: pending approval list
+// path: /events/approvals
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+func approvalList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	events, err := event.ListPendingApprovals(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+// title: approve operation
+// path: /events/{uuid}/approve
+// method: POST
+// responses:
+//   200: Operation approved and executed
+//   400: Invalid uuid
+//   401: Unauthorized
+//   403: Operation requested by the same user
+//   404: Not found
+//   409: Operation is not pending approval
+func eventApprove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	e, err := findPendingApproval(r, t)
+	if err != nil {
+		return err
+	}
+	user, err := auth.GetUserByEmail(e.Owner.Name)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to find requester: %s", err)}
+	}
+	e, err = event.Approve(e.UniqueID, t.GetUserName())
+	if err != nil {
+		return handleReviewError(err)
+	}
+	body, err := e.Approval.Request.DecryptBody()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(e.Approval.Request.Method, e.Approval.Request.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := e.Approval.Request.ContentType
+	if contentType == "" {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	req.Header.Set("Content-Type", contentType)
+	context.SetAuthToken(req, &approvalToken{user: user, approvalID: e.UniqueID})
+	approvalReplayHandler.ServeHTTP(w, req)
+	return nil
+}
+
+// title: reject operation
+// path: /events/{uuid}/reject
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   204: Operation rejected
+//   400: Invalid uuid
+//   401: Unauthorized
+//   403: Operation requested by the same user
+//   404: Not found
+//   409: Operation is not pending approval
+func eventReject(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	e, err := findPendingApproval(r, t)
+	if err != nil {
+		return err
+	}
+	_, err = event.Reject(e.UniqueID, t.GetUserName(), r.FormValue("reason"))
+	if err != nil {
+		return handleReviewError(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// title: approval rule list
+// path: /events/approvals/rules
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func approvalRuleList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventApprovalRuleRead) {
+		return permission.ErrUnauthorized
+	}
+	rules, err := event.ListApprovalRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rules)
+}
+
+// title: add approval rule
+// path: /events/approvals/rules
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func approvalRuleAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermEventApprovalRuleAdd) {
+		return permission.ErrUnauthorized
+	}
+	r.ParseForm()
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	var rule event.ApprovalRule
+	err = dec.DecodeValues(&rule, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse approval rule: %s", err)}
+	}
+	if expire := r.FormValue("expire"); expire != "" {
+		rule.Expire, err = time.ParseDuration(expire)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid expire: %s", err)}
+		}
+	}
+	for _, s := range rule.Schemes {
+		if _, err = permission.SafeGet(s); err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeApprovalRule},
+		Kind:       permission.PermEventApprovalRuleAdd,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermEventApprovalRuleReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		evt.Target.Value = rule.ID.Hex()
+		evt.Done(err)
+	}()
+	err = event.AddApprovalRule(&rule)
+	if _, ok := err.(event.ErrValidation); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rule)
+}
+
+// title: remove approval rule
+// path: /events/approvals/rules/{uuid}
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid uuid
+//   401: Unauthorized
+//   404: Not found
+func approvalRuleRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermEventApprovalRuleRemove) {
+		return permission.ErrUnauthorized
+	}
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		msg := fmt.Sprintf("uuid parameter is not ObjectId: %s", uuid)
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	objID := bson.ObjectIdHex(uuid)
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeApprovalRule, Value: objID.Hex()},
+		Kind:   permission.PermEventApprovalRuleRemove,
+		Owner:  t,
+		CustomData: []map[string]interface{}{
+			{"name": "ID", "value": objID.Hex()},
+		},
+		Allowed: event.Allowed(permission.PermEventApprovalRuleReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = event.RemoveApprovalRule(objID)
+	if err == event.ErrApprovalRuleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,244 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *EventSuite) requestBlockAdd(c *check.C, token string) *httptest.ResponseRecorder {
+	body := strings.NewReader("KindName=app.deploy&Reason=maintenance")
+	request, err := http.NewRequest("POST", "/events/blocks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *EventSuite) newPendingBlockAdd(c *check.C) (*event.Event, string) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	err := event.AddApprovalRule(&event.ApprovalRule{Schemes: []string{"event-block.add"}})
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "requester", permission.Permission{
+		Scheme:  permission.PermEventBlock,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	recorder := s.requestBlockAdd(c, token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	c.Assert(recorder.Body.String(), check.Matches, "event-block.add requires approval from another user, pending approval id: .*\n")
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 0)
+	evts, err := event.ListPendingApprovals(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Approval.Request.Method, check.Equals, "POST")
+	c.Assert(evts[0].Approval.Request.URL, check.Equals, "/events/blocks")
+	c.Assert(secret.IsEncrypted(evts[0].Approval.Request.Body), check.Equals, true)
+	body, err := evts[0].Approval.Request.DecryptBody()
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.Equals, "KindName=app.deploy&Reason=maintenance")
+	c.Assert(evts[0].Approval.Request.ContentType, check.Equals, "application/x-www-form-urlencoded")
+	return &evts[0], token.GetValue()
+}
+
+func (s *EventSuite) TestApprovalRuleAdd(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventApprovalRuleAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	body := strings.NewReader("Schemes.0=app.delete&ContextType=pool&ContextValue=prod&expire=2h")
+	request, err := http.NewRequest("POST", "/events/approvals/rules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := event.ListApprovalRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []event.ApprovalRule{
+		{ID: rules[0].ID, Schemes: []string{"app.delete"}, ContextType: "pool", ContextValue: "prod", Expire: 2 * time.Hour},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApprovalRule, Value: rules[0].ID.Hex()},
+		Owner:  token.GetUserName(),
+		Kind:   "event-approval-rule.add",
+	}, eventtest.HasEvent)
+}
+
+func (s *EventSuite) TestApprovalRuleAddInvalidScheme(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventApprovalRuleAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	body := strings.NewReader("Schemes.0=app.explode")
+	request, err := http.NewRequest("POST", "/events/approvals/rules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *EventSuite) TestApprovalRuleList(c *check.C) {
+	rule := event.ApprovalRule{Schemes: []string{"app.delete"}}
+	err := event.AddApprovalRule(&rule)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventApprovalRuleRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/events/approvals/rules", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var rules []event.ApprovalRule
+	err = json.NewDecoder(recorder.Body).Decode(&rules)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []event.ApprovalRule{rule})
+}
+
+func (s *EventSuite) TestApprovalRuleRemove(c *check.C) {
+	rule := event.ApprovalRule{Schemes: []string{"app.delete"}}
+	err := event.AddApprovalRule(&rule)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventApprovalRuleRemove,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("DELETE", "/events/approvals/rules/"+rule.ID.Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := event.ListApprovalRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	request, err = http.NewRequest("DELETE", "/events/approvals/rules/"+bson.NewObjectId().Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *EventSuite) TestApprovalList(c *check.C) {
+	pending, _ := s.newPendingBlockAdd(c)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "reviewer", permission.Permission{
+		Scheme:  permission.PermEventBlock,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/events/approvals", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var evts []event.Event
+	err = json.NewDecoder(recorder.Body).Decode(&evts)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, pending.UniqueID)
+	c.Assert(evts[0].Approval.Request, check.DeepEquals, event.ApprovalRequest{
+		Method:      "POST",
+		ContentType: "application/x-www-form-urlencoded",
+	})
+}
+
+func (s *EventSuite) TestEventApprove(c *check.C) {
+	pending, _ := s.newPendingBlockAdd(c)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "reviewer", permission.Permission{
+		Scheme:  permission.PermEventBlock,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("POST", "/events/"+pending.UniqueID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 1)
+	c.Assert(blocks[0].KindName, check.Equals, "app.deploy")
+	c.Assert(blocks[0].Reason, check.Equals, "maintenance")
+	approved, err := event.GetByID(pending.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(approved.Approval.Status, check.Equals, event.ApprovalApproved)
+	c.Assert(approved.Approval.Reviewer, check.Equals, token.GetUserName())
+	c.Assert(approved.Approval.ExecutionID, check.Not(check.Equals), bson.ObjectId(""))
+	executed, err := event.GetByID(approved.Approval.ExecutionID)
+	c.Assert(err, check.IsNil)
+	c.Assert(executed.Owner.Name, check.Equals, pending.Owner.Name)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *EventSuite) TestEventApproveBySameUser(c *check.C) {
+	pending, token := s.newPendingBlockAdd(c)
+	request, err := http.NewRequest("POST", "/events/"+pending.UniqueID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 0)
+}
+
+func (s *EventSuite) TestEventReject(c *check.C) {
+	pending, _ := s.newPendingBlockAdd(c)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "reviewer", permission.Permission{
+		Scheme:  permission.PermEventBlock,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("POST", "/events/"+pending.UniqueID.Hex()+"/reject", strings.NewReader("reason=not+now"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	rejected, err := event.GetByID(pending.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(rejected.Approval.Status, check.Equals, event.ApprovalRejected)
+	c.Assert(rejected.Approval.Reason, check.Equals, "not now")
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 0)
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
@@ -246,6 +247,15 @@ func createTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	if name == "" {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: auth.ErrInvalidTeamName.Error()}
 	}
+	metadata := auth.Team{
+		Name:        name,
+		Description: r.FormValue("description"),
+		Email:       r.FormValue("email"),
+		Tags:        r.Form["tag"],
+	}
+	if err = metadata.ValidateMetadata(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	evt, err := event.New(&event.Opts{
 		Target:     teamTarget(name),
 		Kind:       permission.PermTeamCreate,
@@ -268,10 +278,17 @@ func createTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	case auth.ErrTeamAlreadyExists:
 		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
 	}
-	if err == nil {
-		w.WriteHeader(http.StatusCreated)
+	if err != nil {
+		return err
 	}
-	return err
+	if metadata.Description != "" || metadata.Email != "" || len(metadata.Tags) > 0 {
+		err = auth.UpdateTeam(&metadata)
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
 }
 
 // title: remove team
@@ -316,6 +333,159 @@ func removeTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	return nil
 }
 
+// title: team info
+// path: /teams/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: Info about the team
+//   401: Unauthorized
+//   404: Not found
+func teamInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamRead,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	}
+	team, err := auth.GetTeam(name)
+	if err != nil {
+		if err == auth.ErrTeamNotFound {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(team)
+}
+
+// title: team update
+// path: /teams/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Team updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func updateTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateInfo,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateInfo,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.UpdateTeam(&auth.Team{
+		Name:        name,
+		Description: r.FormValue("description"),
+		Email:       r.FormValue("email"),
+		Tags:        r.Form["tag"],
+	})
+	switch err {
+	case auth.ErrInvalidTeamEmail:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	}
+	return err
+}
+
+// title: add team member
+// path: /teams/{name}/members
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Member added
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func addTeamMember(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	name := r.URL.Query().Get(":name")
+	email := r.FormValue("email")
+	admin, _ := strconv.ParseBool(r.FormValue("admin"))
+	allowed := permission.Check(t, permission.PermTeamUpdateMemberAdd,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateMemberAdd,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.AddTeamMember(name, email, admin)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	}
+	return handleAuthError(err)
+}
+
+// title: remove team member
+// path: /teams/{name}/members/{email}
+// method: DELETE
+// responses:
+//   200: Member removed
+//   401: Unauthorized
+//   404: Not found
+func removeTeamMember(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	email := r.URL.Query().Get(":email")
+	allowed := permission.Check(t, permission.PermTeamUpdateMemberRemove,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateMemberRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RemoveTeamMember(name, email)
+	switch err {
+	case auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	case auth.ErrMemberNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
 // title: team list
 // path: /teams
 // method: GET
@@ -584,6 +584,215 @@ Service instances: my_nosql, my_nosql-2`
 	c.Assert(e.Message, check.Equals, expected)
 }
 
+func (s *AuthSuite) TestRemoveTeamGives403WhenTeamHasMembers(c *check.C) {
+	err := auth.AddTeamMember(s.team.Name, s.user.Email, false)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("/teams/%s?:name=%s", s.team.Name, s.team.Name), nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeTeam(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusForbidden)
+	expected := fmt.Sprintf(`This team cannot be removed because there are still references to it:
+Members: %s`, s.user.Email)
+	c.Assert(e.Message, check.Equals, expected)
+}
+
+func (s *AuthSuite) TestCreateTeamWithMetadata(c *check.C) {
+	b := strings.NewReader("name=timeredbull&description=my+team&email=team@tsuru.io&tag=a&tag=b")
+	request, err := http.NewRequest("POST", "/teams", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	team, err := auth.GetTeam("timeredbull")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Description, check.Equals, "my team")
+	c.Assert(team.Email, check.Equals, "team@tsuru.io")
+	c.Assert(team.Tags, check.DeepEquals, []string{"a", "b"})
+}
+
+func (s *AuthSuite) TestCreateTeamInvalidEmail(c *check.C) {
+	b := strings.NewReader("name=timeredbull&email=invalid")
+	request, err := http.NewRequest("POST", "/teams", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrInvalidTeamEmail.Error()+"\n")
+	_, err = auth.GetTeam("timeredbull")
+	c.Assert(err, check.Equals, auth.ErrTeamNotFound)
+}
+
+func (s *AuthSuite) TestTeamInfo(c *check.C) {
+	err := auth.AddTeamMember(s.team.Name, s.user.Email, true)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/teams/"+s.team.Name, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var team auth.Team
+	err = json.Unmarshal(recorder.Body.Bytes(), &team)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Name, check.Equals, s.team.Name)
+	c.Assert(team.Members, check.DeepEquals, []auth.TeamMember{{Email: s.user.Email, Admin: true}})
+}
+
+func (s *AuthSuite) TestTeamInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/teams/unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestUpdateTeam(c *check.C) {
+	b := strings.NewReader("description=new+description&email=team@tsuru.io&tag=x")
+	request, err := http.NewRequest("PUT", "/teams/"+s.team.Name, b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Description, check.Equals, "new description")
+	c.Assert(team.Email, check.Equals, "team@tsuru.io")
+	c.Assert(team.Tags, check.DeepEquals, []string{"x"})
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update.info",
+		StartCustomData: []map[string]interface{}{
+			{"name": "description", "value": "new description"},
+			{"name": "email", "value": "team@tsuru.io"},
+			{"name": "tag", "value": "x"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestUpdateTeamInvalidEmail(c *check.C) {
+	b := strings.NewReader("email=invalid")
+	request, err := http.NewRequest("PUT", "/teams/"+s.team.Name, b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrInvalidTeamEmail.Error()+"\n")
+}
+
+func (s *AuthSuite) TestAddTeamMember(c *check.C) {
+	b := strings.NewReader("email=" + s.user.Email + "&admin=true")
+	request, err := http.NewRequest("POST", "/teams/"+s.team.Name+"/members", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Members, check.DeepEquals, []auth.TeamMember{{Email: s.user.Email, Admin: true}})
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update.member.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "email", "value": s.user.Email},
+			{"name": "admin", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestAddTeamMemberUserNotFound(c *check.C) {
+	b := strings.NewReader("email=unknown@tsuru.io")
+	request, err := http.NewRequest("POST", "/teams/"+s.team.Name+"/members", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestAddTeamMemberAsTeamAdmin(c *check.C) {
+	u, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamadmin")
+	err := auth.AddTeamMember(s.team.Name, u.Email, true)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader("email=" + s.user.Email)
+	request, err := http.NewRequest("POST", "/teams/"+s.team.Name+"/members", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	request, err = http.NewRequest("POST", "/teams/"+s.team2.Name+"/members", strings.NewReader("email="+s.user.Email))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestRemoveTeamMember(c *check.C) {
+	err := auth.AddTeamMember(s.team.Name, s.user.Email, false)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/teams/"+s.team.Name+"/members/"+s.user.Email, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Members, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update.member.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": ":email", "value": s.user.Email},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestRemoveTeamMemberNotMember(c *check.C) {
+	request, err := http.NewRequest("DELETE", "/teams/"+s.team.Name+"/members/"+s.user.Email, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrMemberNotFound.Error()+"\n")
+}
+
 func (s *AuthSuite) TestListTeamsListsAllTeamsThatTheUserHasAccess(c *check.C) {
 	token := userWithPermission(c, permission.Permission{
 		Scheme:  permission.PermAppCreate,
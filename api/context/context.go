@@ -11,6 +11,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
 )
 
 const (
@@ -19,6 +20,7 @@ const (
 	delayedHandlerKey
 	preventUnlockKey
 	appContextKey
+	requestIDKey
 )
 
 func Clear(r *http.Request) {
@@ -90,6 +92,7 @@ func IsPreventUnlock(r *http.Request) bool {
 
 func SetRequestID(r *http.Request, requestIDHeader, requestID string) {
 	context.Set(r, requestIDHeader, requestID)
+	context.Set(r, requestIDKey, requestID)
 }
 
 func GetRequestID(r *http.Request, requestIDHeader string) string {
@@ -99,3 +102,19 @@ func GetRequestID(r *http.Request, requestIDHeader string) string {
 	}
 	return requestID.(string)
 }
+
+// Logger returns a logger attaching the request ID, the user and the app of
+// the request to every entry.
+func Logger(r *http.Request) *log.FieldLogger {
+	fields := log.Fields{}
+	if requestID, ok := context.Get(r, requestIDKey).(string); ok {
+		fields["request_id"] = requestID
+	}
+	if t := GetAuthToken(r); t != nil {
+		fields["user"] = t.GetUserName()
+	}
+	if a := GetApp(r); a != nil {
+		fields["app"] = a.Name
+	}
+	return log.WithFields(fields)
+}
@@ -5,6 +5,8 @@
 package context
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"reflect"
@@ -17,6 +19,7 @@ import (
 	"github.com/tsuru/tsuru/auth/native"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"gopkg.in/check.v1"
 )
@@ -132,3 +135,22 @@ func (s *S) TestRequestID(c *check.C) {
 	id = GetRequestID(r, "Request-ID")
 	c.Assert(id, check.Equals, "test")
 }
+
+func (s *S) TestLogger(c *check.C) {
+	var buf bytes.Buffer
+	log.SetLogger(log.NewWriterLoggerWithFormat(&buf, false, log.FormatJSON))
+	defer log.SetLogger(nil)
+	r, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	SetRequestID(r, "Request-ID", "req1")
+	SetAuthToken(r, s.token)
+	SetApp(r, s.app)
+	Logger(r).Error("failure")
+	var entry map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry["msg"], check.Equals, "failure")
+	c.Assert(entry["request_id"], check.Equals, "req1")
+	c.Assert(entry["user"], check.Equals, "whydidifall@thewho.com")
+	c.Assert(entry["app"], check.Equals, "app")
+}
@@ -685,7 +685,7 @@ func insertDeploysAsEvents(data []app.DeployData, c *check.C) []*event.Event {
 		})
 		c.Assert(err, check.IsNil)
 		evt.StartTime = d.Timestamp
-		evt.Logf(d.Log)
+		evt.Logf("%s", d.Log)
 		err = evt.SetOtherCustomData(map[string]string{"diff": d.Diff})
 		c.Assert(err, check.IsNil)
 		err = evt.DoneCustomData(nil, map[string]string{"image": d.Image})
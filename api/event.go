@@ -18,14 +18,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
-// title: event list
-// path: /events
-// method: GET
-// produce: application/json
-// responses:
-//   200: OK
-//   204: No content
-func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+func eventFilterFromRequest(r *http.Request, t auth.Token) (*event.Filter, error) {
 	r.ParseForm()
 	filter := &event.Filter{}
 	dec := form.NewDecoder(nil)
@@ -33,10 +26,25 @@ func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	dec.IgnoreCase(true)
 	err := dec.DecodeValues(&filter, r.Form)
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	filter.PruneUserValues()
 	filter.Permissions, err = t.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// title: event list
+// path: /events
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
 	if err != nil {
 		return err
 	}
@@ -52,6 +60,78 @@ func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(events)
 }
 
+// title: event stream
+// path: /events/stream
+// method: GET
+// produce: text/event-stream
+// responses:
+//   200: OK
+//   400: Invalid filters
+func eventStream(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	watcher, err := event.Watch(filter)
+	if err != nil {
+		return err
+	}
+	eventTracker.add(watcher)
+	defer func() {
+		eventTracker.remove(watcher)
+		watcher.Close()
+	}()
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	msgChan := watcher.ListenChan()
+	for {
+		var msg event.WatchMessage
+		var chOpen bool
+		select {
+		case <-closeChan:
+			return nil
+		case msg, chOpen = <-msgChan:
+		}
+		if !chOpen {
+			return nil
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", msg.Type, msg.ID.Hex(), data)
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// title: event export
+// path: /events/export
+// method: GET
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   400: Invalid filters
+func eventExport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	encoder := json.NewEncoder(w)
+	return event.Export(filter, func(evt *event.Event) error {
+		return encoder.Encode(evt)
+	})
+}
+
 // title: kind list
 // path: /events/kinds
 // method: GET
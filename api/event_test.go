@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/config"
@@ -73,6 +75,22 @@ func (s *EventSuite) TearDownSuite(c *check.C) {
 	s.logConn.Close()
 }
 
+func (s *EventSuite) TearDownTest(c *check.C) {
+	config.Unset("secrets")
+	rules, err := event.ListApprovalRules()
+	c.Assert(err, check.IsNil)
+	for _, r := range rules {
+		err = event.RemoveApprovalRule(r.ID)
+		c.Assert(err, check.IsNil)
+	}
+	throttlingRules, err := event.ListThrottlingRules()
+	c.Assert(err, check.IsNil)
+	for _, r := range throttlingRules {
+		err = event.RemoveThrottlingRule(r.ID)
+		c.Assert(err, check.IsNil)
+	}
+}
+
 func (s *EventSuite) SetUpTest(c *check.C) {
 	repositorytest.Reset()
 	var err error
@@ -220,6 +238,104 @@ func (s *EventSuite) TestEventListFilterByKind(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
 }
 
+func (s *EventSuite) TestEventStream(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/stream?target.type=app", nil)
+	c.Assert(err, check.IsNil)
+	recorder := &closeableRecorder{httptest.NewRecorder(), make(chan bool)}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamErr := eventStream(recorder, request, s.token)
+		c.Assert(streamErr, check.IsNil)
+	}()
+	var watcher *event.Watcher
+	timeout := time.After(5 * time.Second)
+	for watcher == nil {
+		select {
+		case <-timeout:
+			c.Fatal("timeout after 5 seconds")
+		case <-time.After(50 * time.Millisecond):
+		}
+		eventTracker.Lock()
+		for watcher = range eventTracker.conn {
+		}
+		eventTracker.Unlock()
+	}
+	hidden, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "hidden"},
+		Owner:   s.token,
+		Kind:    permission.PermAppDeploy,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "other-team")),
+	})
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Owner:   s.token,
+		Kind:    permission.PermAppDeploy,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Write([]byte("deploying"))
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = hidden.Done(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(2500 * time.Millisecond)
+	close(recorder.ch)
+	wg.Wait()
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/event-stream")
+	var types []string
+	for _, block := range strings.Split(strings.TrimSpace(recorder.Body.String()), "\n\n") {
+		lines := strings.Split(block, "\n")
+		c.Assert(lines, check.HasLen, 3)
+		c.Assert(lines[1], check.Equals, "id: "+evt.UniqueID.Hex())
+		var msg event.WatchMessage
+		err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &msg)
+		c.Assert(err, check.IsNil)
+		c.Assert(lines[0], check.Equals, "event: "+msg.Type)
+		types = append(types, msg.Type)
+		if msg.Type == event.WatchMessageLog {
+			c.Assert(msg.Log, check.Equals, "deploying")
+		}
+	}
+	c.Assert(types, check.DeepEquals, []string{event.WatchMessageStart, event.WatchMessageLog, event.WatchMessageDone})
+}
+
+func (s *EventSuite) TestEventStreamInvalidFilter(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/stream?running=notbool", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *EventSuite) TestEventExport(c *check.C) {
+	_, err := s.insertEvents("app", c)
+	c.Assert(err, check.IsNil)
+	_, err = s.insertEvents("node", c)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/export?target.type=app&limit=2", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	c.Assert(lines, check.HasLen, 10)
+	for i, line := range lines {
+		var evt event.Event
+		err = json.Unmarshal([]byte(line), &evt)
+		c.Assert(err, check.IsNil)
+		c.Assert(evt.Target.Value, check.Equals, fmt.Sprintf("app-%d", i))
+	}
+}
+
 func (s *EventSuite) TestKindList(c *check.C) {
 	_, err := s.insertEvents("app", c)
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,169 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// logLimitOpts returns the event options for changing the log limit of the
+// given pool or app, checking whether the user is allowed to do it.
+func logLimitOpts(r *http.Request, t auth.Token, poolName, appName string) (*event.Opts, error) {
+	if (poolName == "") == (appName == "") {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "either a pool or an app is required"}
+	}
+	if appName != "" {
+		a, err := getAppFromContext(appName, r)
+		if err != nil {
+			return nil, err
+		}
+		if !permission.Check(t, permission.PermAppUpdateLogLimit, contextsForApp(&a)...) {
+			return nil, permission.ErrUnauthorized
+		}
+		return &event.Opts{
+			Target:  appTarget(a.Name),
+			Kind:    permission.PermAppUpdateLogLimit,
+			Allowed: event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		}, nil
+	}
+	_, err := provision.GetPoolByName(poolName)
+	if err == provision.ErrPoolNotFound {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	poolCtx := permission.Context(permission.CtxPool, poolName)
+	if !permission.Check(t, permission.PermPoolUpdateLogLimit, poolCtx) {
+		return nil, permission.ErrUnauthorized
+	}
+	return &event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: poolName},
+		Kind:    permission.PermPoolUpdateLogLimit,
+		Allowed: event.Allowed(permission.PermPoolReadEvents, poolCtx),
+	}, nil
+}
+
+// title: list log limits
+// path: /logs/limits
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func logLimitList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	limits, err := app.ListLogLimits()
+	if err != nil {
+		return err
+	}
+	var visible []app.LogLimit
+	for _, l := range limits {
+		var allowed bool
+		if l.App != "" {
+			allowed = permission.Check(t, permission.PermAppRead, permission.Context(permission.CtxApp, l.App))
+		} else {
+			allowed = permission.Check(t, permission.PermPoolReadLogLimit, permission.Context(permission.CtxPool, l.Pool))
+		}
+		if allowed {
+			visible = append(visible, l)
+		}
+	}
+	if len(visible) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(visible)
+}
+
+// title: set log limit
+// path: /logs/limits
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Pool or app not found
+func logLimitSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	limit := app.LogLimit{Pool: r.FormValue("pool"), App: r.FormValue("app")}
+	if str := r.FormValue("linesPerSecond"); str != "" {
+		limit.LinesPerSecond, err = strconv.Atoi(str)
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for linesPerSecond, it must be an integer"}
+		}
+	}
+	if str := r.FormValue("bytesPerDay"); str != "" {
+		limit.BytesPerDay = getSize(str)
+		if limit.BytesPerDay == 0 && str != "0" {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for bytesPerDay, it must be a size"}
+		}
+	}
+	if str := r.FormValue("sampleRate"); str != "" {
+		limit.SampleRate, err = strconv.Atoi(str)
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for sampleRate, it must be an integer"}
+		}
+	}
+	opts, err := logLimitOpts(r, t, limit.Pool, limit.App)
+	if err != nil {
+		return err
+	}
+	opts.Owner = t
+	opts.CustomData = event.FormToCustomData(r.Form)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.SetLogLimit(&limit)
+	if e, ok := err.(*tsuruErrors.ValidationError); ok {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// title: remove log limit
+// path: /logs/limits
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func logLimitDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	poolName, appName := r.FormValue("pool"), r.FormValue("app")
+	opts, err := logLimitOpts(r, t, poolName, appName)
+	if err != nil {
+		return err
+	}
+	opts.Owner = t
+	opts.CustomData = event.FormToCustomData(r.Form)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.DeleteLogLimit(poolName, appName)
+	if err == app.ErrLogLimitNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
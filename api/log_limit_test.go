@@ -0,0 +1,167 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogLimitSetForPool(c *check.C) {
+	body := strings.NewReader("pool=test1&linesPerSecond=100&bytesPerDay=1G&sampleRate=10")
+	request, err := http.NewRequest("POST", "/logs/limits", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolUpdateLogLimit,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	limits, err := app.ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []app.LogLimit{
+		{Pool: "test1", LinesPerSecond: 100, BytesPerDay: 1024 * 1024 * 1024, SampleRate: 10},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypePool, Value: "test1"},
+		Owner:  token.GetUserName(),
+		Kind:   "pool.update.log.limit",
+		StartCustomData: []map[string]interface{}{
+			{"name": "pool", "value": "test1"},
+			{"name": "linesPerSecond", "value": "100"},
+			{"name": "bytesPerDay", "value": "1G"},
+			{"name": "sampleRate", "value": "10"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestLogLimitSetForApp(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("app=myapp&linesPerSecond=50")
+	request, err := http.NewRequest("POST", "/logs/limits", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateLogLimit,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	limits, err := app.ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []app.LogLimit{
+		{App: "myapp", LinesPerSecond: 50},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.log.limit",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestLogLimitSetInvalid(c *check.C) {
+	tests := []struct {
+		body    string
+		code    int
+		message string
+	}{
+		{"linesPerSecond=10", http.StatusBadRequest, "either a pool or an app is required\n"},
+		{"pool=test1&linesPerSecond=abc", http.StatusBadRequest, "invalid value for linesPerSecond, it must be an integer\n"},
+		{"pool=test1&bytesPerDay=abc", http.StatusBadRequest, "invalid value for bytesPerDay, it must be a size\n"},
+		{"pool=test1&sampleRate=abc", http.StatusBadRequest, "invalid value for sampleRate, it must be an integer\n"},
+		{"pool=test1&linesPerSecond=-1", http.StatusBadRequest, "log limits must not be negative\n"},
+		{"pool=unknown&linesPerSecond=10", http.StatusNotFound, "Pool does not exist.\n"},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("POST", "/logs/limits", strings.NewReader(tt.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "b "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, tt.code, check.Commentf("body: %s", tt.body))
+		c.Assert(recorder.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *S) TestLogLimitSetNoPermission(c *check.C) {
+	body := strings.NewReader("pool=test1&linesPerSecond=10")
+	request, err := http.NewRequest("POST", "/logs/limits", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolReadLogLimit,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestLogLimitList(c *check.C) {
+	err := app.SetLogLimit(&app.LogLimit{Pool: "test1", LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	err = app.SetLogLimit(&app.LogLimit{Pool: "other", LinesPerSecond: 20})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/logs/limits", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolReadLogLimit,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var limits []app.LogLimit
+	err = json.NewDecoder(recorder.Body).Decode(&limits)
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []app.LogLimit{
+		{Pool: "test1", LinesPerSecond: 10},
+	})
+}
+
+func (s *S) TestLogLimitListEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/logs/limits", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestLogLimitDelete(c *check.C) {
+	err := app.SetLogLimit(&app.LogLimit{Pool: "test1", LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/logs/limits?pool=test1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	limits, err := app.ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
 )
 
 type logStreamTracker struct {
@@ -46,3 +47,37 @@ func (t *logStreamTracker) Shutdown() {
 }
 
 var logTracker logStreamTracker
+
+type eventStreamTracker struct {
+	sync.Mutex
+	conn map[*event.Watcher]struct{}
+}
+
+func (t *eventStreamTracker) add(w *event.Watcher) {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		t.conn = make(map[*event.Watcher]struct{})
+	}
+	t.conn[w] = struct{}{}
+}
+
+func (t *eventStreamTracker) remove(w *event.Watcher) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.conn, w)
+}
+
+func (t *eventStreamTracker) String() string {
+	return "event stream connections"
+}
+
+func (t *eventStreamTracker) Shutdown() {
+	t.Lock()
+	defer t.Unlock()
+	for w := range t.conn {
+		w.Close()
+	}
+}
+
+var eventTracker eventStreamTracker
@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	stdLog "log"
+	"math"
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -21,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/log"
 )
@@ -100,12 +103,20 @@ func setVersionHeadersMiddleware(w http.ResponseWriter, r *http.Request, next ht
 }
 
 func errorHandlingMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	recordRequestBody(r)
 	next(w, r)
 	err := context.GetRequestError(r)
 	if err != nil {
+		if handleApprovalRequired(w, r, err) {
+			return
+		}
 		code := http.StatusInternalServerError
-		if e, ok := err.(*tsuruErrors.HTTP); ok {
+		switch e := err.(type) {
+		case *tsuruErrors.HTTP:
 			code = e.Code
+		case event.ErrThrottled:
+			code = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.Reset.Seconds()))))
 		}
 		flushing, ok := w.(*io.FlushingWriter)
 		if ok && flushing.Wrote() {
@@ -120,7 +131,11 @@ func errorHandlingMiddleware(w http.ResponseWriter, r *http.Request, next http.H
 		} else {
 			http.Error(w, err.Error(), code)
 		}
-		log.Errorf("failure running HTTP request %s %s (%d): %s", r.Method, r.URL.Path, code, err)
+		context.Logger(r).WithFields(log.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": code,
+		}).Errorf("failure running HTTP request: %s", err)
 	}
 }
 
@@ -133,7 +148,7 @@ func authTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.Handl
 				context.AddRequestError(r, err)
 				return
 			}
-			log.Debugf("Ignored invalid token for %s: %s", r.URL.Path, err.Error())
+			context.Logger(r).WithField("path", r.URL.Path).Debugf("Ignored invalid token: %s", err)
 		} else {
 			context.SetAuthToken(r, t)
 		}
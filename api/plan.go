@@ -30,12 +30,32 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	isDefault, _ := strconv.ParseBool(r.FormValue("default"))
 	memory := getSize(r.FormValue("memory"))
 	swap := getSize(r.FormValue("swap"))
+	logLinesPerSecond, _ := strconv.Atoi(r.FormValue("logLinesPerSecond"))
+	var logBytesPerDay int64
+	if str := r.FormValue("logBytesPerDay"); str != "" {
+		logBytesPerDay = getSize(str)
+	}
+	cpuLimit, _ := strconv.Atoi(r.FormValue("cpuLimit"))
+	cpuRequest, _ := strconv.Atoi(r.FormValue("cpuRequest"))
+	var memoryRequest, ephemeralStorage int64
+	if str := r.FormValue("memoryRequest"); str != "" {
+		memoryRequest = getSize(str)
+	}
+	if str := r.FormValue("ephemeralStorage"); str != "" {
+		ephemeralStorage = getSize(str)
+	}
 	plan := app.Plan{
-		Name:     r.FormValue("name"),
-		Memory:   memory,
-		Swap:     swap,
-		CpuShare: cpuShare,
-		Default:  isDefault,
+		Name:              r.FormValue("name"),
+		Memory:            memory,
+		Swap:              swap,
+		CpuShare:          cpuShare,
+		CPULimit:          cpuLimit,
+		CPURequest:        cpuRequest,
+		MemoryRequest:     memoryRequest,
+		EphemeralStorage:  ephemeralStorage,
+		Default:           isDefault,
+		LogLinesPerSecond: logLinesPerSecond,
+		LogBytesPerDay:    logBytesPerDay,
 	}
 	allowed := permission.Check(t, permission.PermPlanCreate)
 	if !allowed {
@@ -65,7 +85,7 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			Message: err.Error(),
 		}
 	}
-	if err == app.ErrLimitOfMemory || err == app.ErrLimitOfCpuShare {
+	if err == app.ErrLimitOfMemory || err == app.ErrLimitOfCpuShare || err == app.ErrLimitOfCPU {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
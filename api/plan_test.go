@@ -47,6 +47,65 @@ func (s *S) TestPlanAdd(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestPlanAddWithLogLimits(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&swap=0&cpushare=100&logLinesPerSecond=200&logBytesPerDay=2G")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer s.conn.Plans().RemoveAll(nil)
+	var plans []app.Plan
+	err = s.conn.Plans().Find(nil).All(&plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []app.Plan{
+		{Name: "xyz", Memory: 512 * 1024 * 1024, CpuShare: 100, LogLinesPerSecond: 200, LogBytesPerDay: 2 * 1024 * 1024 * 1024},
+	})
+}
+
+func (s *S) TestPlanAddWithResources(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&swap=0&cpushare=100&cpuLimit=1500&cpuRequest=500&memoryRequest=256M&ephemeralStorage=1G")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer s.conn.Plans().RemoveAll(nil)
+	var plans []app.Plan
+	err = s.conn.Plans().Find(nil).All(&plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []app.Plan{
+		{
+			Name:             "xyz",
+			Memory:           512 * 1024 * 1024,
+			CpuShare:         100,
+			CPULimit:         1500,
+			CPURequest:       500,
+			MemoryRequest:    256 * 1024 * 1024,
+			EphemeralStorage: 1024 * 1024 * 1024,
+		},
+	})
+}
+
+func (s *S) TestPlanAddInvalidCPULimit(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&swap=0&cpushare=100&cpuLimit=5")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrLimitOfCPU.Error()+"\n")
+}
+
 func (s *S) TestPlanAddWithMegabyteAsMemoryUnit(c *check.C) {
 	recorder := httptest.NewRecorder()
 	body := strings.NewReader("name=xyz&memory=512M&swap=1024&cpushare=100")
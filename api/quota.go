@@ -14,6 +14,7 @@ import (
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
 )
 
 // title: user quota
@@ -151,3 +152,95 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamReadQuota, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	_, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	q, err := quota.GetTeamQuota(name)
+	if err != nil {
+		return err
+	}
+	result := make([]quota.ResourceUsage, len(quota.TeamResources))
+	for i, resource := range quota.TeamResources {
+		result[i] = quota.ResourceUsage{
+			Resource: resource,
+			Limit:    q.Limit(resource),
+			InUse:    q.InUse[resource],
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamAdminQuota)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	_, err = auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	resource := r.FormValue("resource")
+	limitValue := r.FormValue("limit")
+	if limitValue == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid limit"}
+	}
+	var limit int64
+	if resource == quota.ResourceMemory {
+		limit = getSize(limitValue)
+	} else {
+		limit, err = strconv.ParseInt(limitValue, 10, 64)
+	}
+	if err != nil || (limit == 0 && limitValue != "0") {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid limit"}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamAdminQuota,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = quota.SetTeamLimit(name, resource, limit)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
@@ -395,3 +395,114 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	err := quota.ReserveTeamResources(s.team.Name, map[string]int64{
+		quota.ResourceMemory:           2048,
+		quota.ResourceCPUShare:         20,
+		quota.ResourceServiceInstances: 1,
+	})
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit(s.team.Name, quota.ResourceMemory, 4096)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamReadQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []quota.ResourceUsage
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []quota.ResourceUsage{
+		{Resource: quota.ResourceMemory, Limit: 4096, InUse: 2048},
+		{Resource: quota.ResourceCPUShare, Limit: -1, InUse: 20},
+		{Resource: quota.ResourceServiceInstances, Limit: -1, InUse: 1},
+	})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaTeamNotFound(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamReadQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, _ := http.NewRequest("GET", "/teams/unknown/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := bytes.NewBufferString("resource=memory&limit=2G")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	q, err := quota.GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Limits, check.DeepEquals, map[string]int64{quota.ResourceMemory: 2 * 1024 * 1024 * 1024})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeTeam, Value: s.team.Name},
+		Owner:  token.GetUserName(),
+		Kind:   "team.admin.quota",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "resource", "value": "memory"},
+			{"name": "limit", "value": "2G"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaInvalid(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	tests := []struct {
+		body string
+		msg  string
+	}{
+		{"resource=memory", "Invalid limit\n"},
+		{"resource=cpushare&limit=abc", "Invalid limit\n"},
+		{"resource=disk&limit=10", "invalid quota resource \"disk\", it must be one of [memory cpushare service-instances]\n"},
+	}
+	for _, tt := range tests {
+		request, _ := http.NewRequest("PUT", "/teams/superteam/quota", bytes.NewBufferString(tt.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+token.GetValue())
+		recorder := httptest.NewRecorder()
+		handler := RunServer(true)
+		handler.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf(tt.body))
+		c.Check(recorder.Body.String(), check.Equals, tt.msg, check.Commentf(tt.body))
+	}
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresGlobalPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("resource=memory&limit=10")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
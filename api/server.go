@@ -5,6 +5,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -26,6 +27,8 @@ import (
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
 	"github.com/tsuru/tsuru/healer"
 	"github.com/tsuru/tsuru/log"
@@ -33,6 +36,7 @@ import (
 	"github.com/tsuru/tsuru/provision/nodecontainer"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/usage"
 	"golang.org/x/net/websocket"
 	"gopkg.in/tylerb/graceful.v1"
 )
@@ -145,12 +149,23 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/env", AuthorizationRequiredHandler(getEnv))
 	m.Add("1.0", "Post", "/apps/{app}/env", AuthorizationRequiredHandler(setEnv))
 	m.Add("1.0", "Delete", "/apps/{app}/env", AuthorizationRequiredHandler(unsetEnv))
+	m.Add("1.3", "Get", "/apps/{app}/config/revisions", AuthorizationRequiredHandler(appConfigRevisionList))
+	m.Add("1.3", "Get", "/apps/{app}/config/diff", AuthorizationRequiredHandler(appConfigRevisionDiff))
+	m.Add("1.3", "Post", "/apps/{app}/config/rollback", AuthorizationRequiredHandler(appConfigRollback))
+	m.Add("1.3", "Get", "/apps/{app}/manifest", AuthorizationRequiredHandler(appManifestExport))
+	m.Add("1.3", "Post", "/manifests/plan", AuthorizationRequiredHandler(appManifestPlan))
+	m.Add("1.3", "Post", "/manifests/apply", AuthorizationRequiredHandler(appManifestApply))
+	m.Add("1.3", "Post", "/apps/{app}/clone", AuthorizationRequiredHandler(appClone))
+	m.Add("1.3", "Post", "/apps/{app}/rename", AuthorizationRequiredHandler(appRename))
 	m.Add("1.0", "Get", "/apps", AuthorizationRequiredHandler(appList))
 	m.Add("1.0", "Post", "/apps", AuthorizationRequiredHandler(createApp))
 	forceDeleteLockHandler := AuthorizationRequiredHandler(forceDeleteLock)
 	m.Add("1.0", "Delete", "/apps/{app}/lock", forceDeleteLockHandler)
 	m.Add("1.0", "Put", "/apps/{app}/units", AuthorizationRequiredHandler(addUnits))
 	m.Add("1.0", "Delete", "/apps/{app}/units", AuthorizationRequiredHandler(removeUnits))
+	m.Add("1.3", "Get", "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(unitAutoScaleListRules))
+	m.Add("1.3", "Post", "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(unitAutoScaleSetRule))
+	m.Add("1.3", "Delete", "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(unitAutoScaleDeleteRule))
 	registerUnitHandler := AuthorizationRequiredHandler(registerUnit)
 	m.Add("1.0", "Post", "/apps/{app}/units/register", registerUnitHandler)
 	setUnitStatusHandler := AuthorizationRequiredHandler(setUnitStatus)
@@ -177,9 +192,26 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.3", "Get", "/events/blocks", AuthorizationRequiredHandler(eventBlockList))
 	m.Add("1.3", "Post", "/events/blocks", AuthorizationRequiredHandler(eventBlockAdd))
 	m.Add("1.3", "Delete", "/events/blocks/{uuid}", AuthorizationRequiredHandler(eventBlockRemove))
+	m.Add("1.3", "Get", "/events/throttling", AuthorizationRequiredHandler(throttlingRuleList))
+	m.Add("1.3", "Post", "/events/throttling", AuthorizationRequiredHandler(throttlingRuleAdd))
+	m.Add("1.3", "Delete", "/events/throttling/{uuid}", AuthorizationRequiredHandler(throttlingRuleRemove))
+	m.Add("1.3", "Get", "/events/stream", AuthorizationRequiredHandler(eventStream))
+	m.Add("1.3", "Get", "/events/export", AuthorizationRequiredHandler(eventExport))
+	m.Add("1.3", "Get", "/events/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.3", "Post", "/events/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.3", "Get", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.3", "Put", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.3", "Delete", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.3", "Get", "/events/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
+	m.Add("1.3", "Get", "/events/approvals", AuthorizationRequiredHandler(approvalList))
+	m.Add("1.3", "Get", "/events/approvals/rules", AuthorizationRequiredHandler(approvalRuleList))
+	m.Add("1.3", "Post", "/events/approvals/rules", AuthorizationRequiredHandler(approvalRuleAdd))
+	m.Add("1.3", "Delete", "/events/approvals/rules/{uuid}", AuthorizationRequiredHandler(approvalRuleRemove))
 	m.Add("1.1", "Get", "/events/kinds", AuthorizationRequiredHandler(kindList))
 	m.Add("1.1", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
 	m.Add("1.1", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
+	m.Add("1.3", "Post", "/events/{uuid}/approve", AuthorizationRequiredHandler(eventApprove))
+	m.Add("1.3", "Post", "/events/{uuid}/reject", AuthorizationRequiredHandler(eventReject))
 
 	m.Add("1.0", "Get", "/platforms", AuthorizationRequiredHandler(platformList))
 	m.Add("1.0", "Post", "/platforms", AuthorizationRequiredHandler(platformAdd))
@@ -225,6 +257,13 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
+	m.Add("1.0", "Get", "/teams/{name}", AuthorizationRequiredHandler(teamInfo))
+	m.Add("1.0", "Put", "/teams/{name}", AuthorizationRequiredHandler(updateTeam))
+	m.Add("1.0", "Post", "/teams/{name}/members", AuthorizationRequiredHandler(addTeamMember))
+	m.Add("1.0", "Delete", "/teams/{name}/members/{email}", AuthorizationRequiredHandler(removeTeamMember))
+	m.Add("1.3", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.3", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
+	m.Add("1.3", "Get", "/usage", AuthorizationRequiredHandler(usageReport))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -251,6 +290,14 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.3", "Get", "/constraints", AuthorizationRequiredHandler(poolConstraintList))
 	m.Add("1.3", "Put", "/constraints", AuthorizationRequiredHandler(poolConstraintSet))
+	m.Add("1.3", "Get", "/sleep/policies", AuthorizationRequiredHandler(sleepPolicyList))
+	m.Add("1.3", "Post", "/sleep/policies", AuthorizationRequiredHandler(sleepPolicySet))
+	m.Add("1.3", "Delete", "/sleep/policies", AuthorizationRequiredHandler(sleepPolicyDelete))
+
+	m.Add("1.3", "Get", "/logs/apps", AuthorizationRequiredHandler(appsLog))
+	m.Add("1.3", "Get", "/logs/limits", AuthorizationRequiredHandler(logLimitList))
+	m.Add("1.3", "Post", "/logs/limits", AuthorizationRequiredHandler(logLimitSet))
+	m.Add("1.3", "Delete", "/logs/limits", AuthorizationRequiredHandler(logLimitDelete))
 
 	m.Add("1.0", "Get", "/roles", AuthorizationRequiredHandler(listRoles))
 	m.Add("1.0", "Post", "/roles", AuthorizationRequiredHandler(addRole))
@@ -366,6 +413,7 @@ func RunServer(dry bool) http.Handler {
 		diffDeployHandler,
 	}})
 	n.UseHandler(http.HandlerFunc(runDelayedHandler))
+	approvalReplayHandler = n
 
 	if !dry {
 		startServer(n)
@@ -381,6 +429,23 @@ func appFinder(appName string) (rebuild.RebuildApp, error) {
 	return a, err
 }
 
+// wakeUpProxyServer serves the wake-up proxy of sleeping apps, waiting for
+// pending requests to finish when tsuru shuts down.
+type wakeUpProxyServer struct {
+	server  *http.Server
+	timeout time.Duration
+}
+
+func (s *wakeUpProxyServer) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+func (s *wakeUpProxyServer) String() string {
+	return "wake-up proxy"
+}
+
 func startServer(handler http.Handler) {
 	shutdownChan := make(chan bool)
 	shutdownTimeout, _ := config.GetInt("shutdown-timeout")
@@ -390,6 +455,7 @@ func startServer(handler http.Handler) {
 	idleTracker := newIdleTracker()
 	shutdown.Register(idleTracker)
 	shutdown.Register(&logTracker)
+	shutdown.Register(&eventTracker)
 	readTimeout, _ := config.GetInt("server:read-timeout")
 	writeTimeout, _ := config.GetInt("server:write-timeout")
 	listen, err := config.GetString("listen")
@@ -467,6 +533,14 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	err = webhook.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = event.InitializeRetention()
+	if err != nil {
+		fatal(err)
+	}
 	scheme, err := getAuthScheme()
 	if err != nil {
 		fmt.Printf("Warning: configuration didn't declare auth:scheme, using default scheme.\n")
@@ -492,6 +566,32 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	err = autoscale.InitializeUnitScaler()
+	if err != nil {
+		fatal(err)
+	}
+	err = autoscale.InitializeAppSleeper()
+	if err != nil {
+		fatal(err)
+	}
+	err = usage.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	if proxyListen, _ := config.GetString("autoscale:sleep:proxy-listen"); proxyListen != "" {
+		proxySrv := &wakeUpProxyServer{
+			server:  &http.Server{Addr: proxyListen, Handler: autoscale.NewWakeUpProxy()},
+			timeout: time.Duration(shutdownTimeout) * time.Second,
+		}
+		shutdown.Register(proxySrv)
+		go func() {
+			fmt.Printf("tsuru wake-up proxy listening at %s...\n", proxyListen)
+			proxyErr := proxySrv.server.ListenAndServe()
+			if proxyErr != nil && proxyErr != http.ErrServerClosed {
+				fmt.Printf("Wake-up proxy stopped: %s\n", proxyErr)
+			}
+		}()
+	}
 	fmt.Println("Checking components status:")
 	results := hc.Check()
 	for _, result := range results {
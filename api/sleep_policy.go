@@ -0,0 +1,162 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/autoscale"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// sleepPolicyOpts returns the event options for changing the sleep policy of
+// the given pool or app, checking whether the user is allowed to do it.
+func sleepPolicyOpts(r *http.Request, t auth.Token, poolName, appName string) (*event.Opts, error) {
+	if (poolName == "") == (appName == "") {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "either a pool or an app is required"}
+	}
+	if appName != "" {
+		a, err := getAppFromContext(appName, r)
+		if err != nil {
+			return nil, err
+		}
+		if !permission.Check(t, permission.PermAppUpdateSleepPolicy, contextsForApp(&a)...) {
+			return nil, permission.ErrUnauthorized
+		}
+		return &event.Opts{
+			Target:  appTarget(a.Name),
+			Kind:    permission.PermAppUpdateSleepPolicy,
+			Allowed: event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		}, nil
+	}
+	_, err := provision.GetPoolByName(poolName)
+	if err == provision.ErrPoolNotFound {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	poolCtx := permission.Context(permission.CtxPool, poolName)
+	if !permission.Check(t, permission.PermPoolUpdateSleepPolicy, poolCtx) {
+		return nil, permission.ErrUnauthorized
+	}
+	return &event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: poolName},
+		Kind:    permission.PermPoolUpdateSleepPolicy,
+		Allowed: event.Allowed(permission.PermPoolReadEvents, poolCtx),
+	}, nil
+}
+
+// title: list sleep policies
+// path: /sleep/policies
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func sleepPolicyList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	policies, err := autoscale.ListSleepPolicies()
+	if err != nil {
+		return err
+	}
+	var visible []autoscale.SleepPolicy
+	for _, p := range policies {
+		var allowed bool
+		if p.App != "" {
+			allowed = permission.Check(t, permission.PermAppRead, permission.Context(permission.CtxApp, p.App))
+		} else {
+			allowed = permission.Check(t, permission.PermPoolReadSleepPolicy, permission.Context(permission.CtxPool, p.Pool))
+		}
+		if allowed {
+			visible = append(visible, p)
+		}
+	}
+	if len(visible) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(visible)
+}
+
+// title: set sleep policy
+// path: /sleep/policies
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Pool or app not found
+func sleepPolicySet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	policy := autoscale.SleepPolicy{Pool: r.FormValue("pool"), App: r.FormValue("app"), Enabled: true}
+	policy.IdleTimeout, err = time.ParseDuration(r.FormValue("idleTimeout"))
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for idleTimeout, it must be a duration"}
+	}
+	if str := r.FormValue("enabled"); str != "" {
+		policy.Enabled, err = strconv.ParseBool(str)
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for enabled, it must be a boolean"}
+		}
+	}
+	opts, err := sleepPolicyOpts(r, t, policy.Pool, policy.App)
+	if err != nil {
+		return err
+	}
+	opts.Owner = t
+	opts.CustomData = event.FormToCustomData(r.Form)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.SetSleepPolicy(&policy)
+	if e, ok := err.(*tsuruErrors.ValidationError); ok {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// title: remove sleep policy
+// path: /sleep/policies
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func sleepPolicyDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	poolName, appName := r.FormValue("pool"), r.FormValue("app")
+	opts, err := sleepPolicyOpts(r, t, poolName, appName)
+	if err != nil {
+		return err
+	}
+	opts.Owner = t
+	opts.CustomData = event.FormToCustomData(r.Form)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.DeleteSleepPolicy(poolName, appName)
+	if err == autoscale.ErrSleepPolicyNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
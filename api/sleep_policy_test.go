@@ -0,0 +1,165 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/autoscale"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSleepPolicySetForPool(c *check.C) {
+	body := strings.NewReader("pool=test1&idleTimeout=30m")
+	request, err := http.NewRequest("POST", "/sleep/policies", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolUpdateSleepPolicy,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := autoscale.ListSleepPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []autoscale.SleepPolicy{
+		{Pool: "test1", IdleTimeout: 30 * time.Minute, Enabled: true},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypePool, Value: "test1"},
+		Owner:  token.GetUserName(),
+		Kind:   "pool.update.sleep.policy",
+		StartCustomData: []map[string]interface{}{
+			{"name": "pool", "value": "test1"},
+			{"name": "idleTimeout", "value": "30m"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSleepPolicySetForApp(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("app=myapp&idleTimeout=1h&enabled=false")
+	request, err := http.NewRequest("POST", "/sleep/policies", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateSleepPolicy,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := autoscale.ListSleepPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []autoscale.SleepPolicy{
+		{App: "myapp", IdleTimeout: time.Hour},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.sleep.policy",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSleepPolicySetInvalid(c *check.C) {
+	tests := []struct {
+		body    string
+		code    int
+		message string
+	}{
+		{"idleTimeout=1h", http.StatusBadRequest, "either a pool or an app is required\n"},
+		{"pool=test1&idleTimeout=abc", http.StatusBadRequest, "invalid value for idleTimeout, it must be a duration\n"},
+		{"pool=test1&idleTimeout=1s", http.StatusBadRequest, "idle timeout must be at least 1m0s\n"},
+		{"pool=unknown&idleTimeout=1h", http.StatusNotFound, "Pool does not exist.\n"},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("POST", "/sleep/policies", strings.NewReader(tt.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "b "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, tt.code, check.Commentf("body: %s", tt.body))
+		c.Assert(recorder.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *S) TestSleepPolicySetNoPermission(c *check.C) {
+	body := strings.NewReader("pool=test1&idleTimeout=30m")
+	request, err := http.NewRequest("POST", "/sleep/policies", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolReadSleepPolicy,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestSleepPolicyList(c *check.C) {
+	err := autoscale.SetSleepPolicy(&autoscale.SleepPolicy{Pool: "test1", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	err = autoscale.SetSleepPolicy(&autoscale.SleepPolicy{Pool: "other", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/sleep/policies", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPoolReadSleepPolicy,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var policies []autoscale.SleepPolicy
+	err = json.NewDecoder(recorder.Body).Decode(&policies)
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []autoscale.SleepPolicy{
+		{Pool: "test1", IdleTimeout: time.Hour, Enabled: true},
+	})
+}
+
+func (s *S) TestSleepPolicyListEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/sleep/policies", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestSleepPolicyDelete(c *check.C) {
+	err := autoscale.SetSleepPolicy(&autoscale.SleepPolicy{Pool: "test1", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/sleep/policies?pool=test1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := autoscale.ListSleepPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// title: throttling rule list
+// path: /events/throttling
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func throttlingRuleList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventThrottlingRead) {
+		return permission.ErrUnauthorized
+	}
+	rules, err := event.ListThrottlingRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rules)
+}
+
+// title: add throttling rule
+// path: /events/throttling
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func throttlingRuleAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermEventThrottlingAdd) {
+		return permission.ErrUnauthorized
+	}
+	r.ParseForm()
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	var rule event.ThrottlingSpec
+	err = dec.DecodeValues(&rule, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse throttling rule: %s", err)}
+	}
+	if ruleTime := r.FormValue("time"); ruleTime != "" {
+		rule.Time, err = time.ParseDuration(ruleTime)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid time: %s", err)}
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeEventThrottling},
+		Kind:       permission.PermEventThrottlingAdd,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermEventThrottlingReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		evt.Target.Value = rule.ID.Hex()
+		evt.Done(err)
+	}()
+	err = event.AddThrottlingRule(&rule)
+	if _, ok := err.(event.ErrValidation); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rule)
+}
+
+// title: remove throttling rule
+// path: /events/throttling/{uuid}
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid uuid
+//   401: Unauthorized
+//   404: Not found
+func throttlingRuleRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermEventThrottlingRemove) {
+		return permission.ErrUnauthorized
+	}
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		msg := fmt.Sprintf("uuid parameter is not ObjectId: %s", uuid)
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	objID := bson.ObjectIdHex(uuid)
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeEventThrottling, Value: objID.Hex()},
+		Kind:   permission.PermEventThrottlingRemove,
+		Owner:  t,
+		CustomData: []map[string]interface{}{
+			{"name": "ID", "value": objID.Hex()},
+		},
+		Allowed: event.Allowed(permission.PermEventThrottlingReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = event.RemoveThrottlingRule(objID)
+	if err == event.ErrThrottlingRuleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
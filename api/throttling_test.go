@@ -0,0 +1,129 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *EventSuite) TestThrottlingRuleAdd(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventThrottlingAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	body := strings.NewReader("KindName=app.update.restart&OwnerName=ci@example.com&AllTargets=true&Max=10&time=1m")
+	request, err := http.NewRequest("POST", "/events/throttling", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := event.ListThrottlingRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []event.ThrottlingSpec{
+		{ID: rules[0].ID, KindName: "app.update.restart", OwnerName: "ci@example.com", AllTargets: true, Max: 10, Time: time.Minute},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeEventThrottling, Value: rules[0].ID.Hex()},
+		Owner:  token.GetUserName(),
+		Kind:   "event-throttling.add",
+	}, eventtest.HasEvent)
+}
+
+func (s *EventSuite) TestThrottlingRuleAddInvalid(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventThrottlingAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("POST", "/events/throttling", strings.NewReader("KindName=app.update.restart&Max=10"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, event.ErrInvalidThrottlingRule.Error()+"\n")
+}
+
+func (s *EventSuite) TestThrottlingRuleList(c *check.C) {
+	rule := event.ThrottlingSpec{TargetType: event.TargetTypeApp, Max: 5, Time: time.Hour}
+	err := event.AddThrottlingRule(&rule)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventThrottlingRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/events/throttling", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var rules []event.ThrottlingSpec
+	err = json.NewDecoder(recorder.Body).Decode(&rules)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []event.ThrottlingSpec{rule})
+}
+
+func (s *EventSuite) TestThrottlingRuleRemove(c *check.C) {
+	rule := event.ThrottlingSpec{TargetType: event.TargetTypeApp, Max: 5, Time: time.Hour}
+	err := event.AddThrottlingRule(&rule)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventThrottlingRemove,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("DELETE", "/events/throttling/"+rule.ID.Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := event.ListThrottlingRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	request, err = http.NewRequest("DELETE", "/events/throttling/"+bson.NewObjectId().Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *EventSuite) TestThrottledRequest(c *check.C) {
+	err := event.AddThrottlingRule(&event.ThrottlingSpec{
+		KindName:   permission.PermEventBlockAdd.FullName(),
+		AllTargets: true,
+		Max:        1,
+		Time:       time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventBlock,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	recorder := s.requestBlockAdd(c, token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.requestBlockAdd(c, token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusTooManyRequests)
+	c.Assert(recorder.Header().Get("Retry-After"), check.Matches, "3[56][0-9]{2}")
+	c.Assert(recorder.Body.String(), check.Matches, "event throttled, limit for event-block.add on all targets is 1 every 1h0m0s, try again in .*\n")
+}
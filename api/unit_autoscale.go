@@ -0,0 +1,155 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/autoscale"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// title: list unit autoscale rules
+// path: /apps/{app}/units/autoscale
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func unitAutoScaleListRules(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppReadUnitAutoscale, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	rules, err := autoscale.ListUnitRules(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rules)
+}
+
+// title: set unit autoscale rule
+// path: /apps/{app}/units/autoscale
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func unitAutoScaleSetRule(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppUpdateUnitAutoscaleSet, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	rule := autoscale.UnitRule{App: a.Name, Process: r.FormValue("process"), Enabled: true}
+	for name, value := range map[string]*int{"min": &rule.MinUnits, "max": &rule.MaxUnits} {
+		if str := r.FormValue(name); str != "" {
+			*value, err = strconv.Atoi(str)
+			if err != nil {
+				return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid value for %s, it must be an integer", name)}
+			}
+		}
+	}
+	for name, value := range map[string]*float64{"cpu": &rule.TargetCPU, "memory": &rule.TargetMemory} {
+		if str := r.FormValue(name); str != "" {
+			*value, err = strconv.ParseFloat(str, 64)
+			if err != nil {
+				return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid value for %s, it must be a percentage", name)}
+			}
+		}
+	}
+	for name, value := range map[string]*time.Duration{"scaleUpCooldown": &rule.ScaleUpCooldown, "scaleDownCooldown": &rule.ScaleDownCooldown} {
+		if str := r.FormValue(name); str != "" {
+			*value, err = time.ParseDuration(str)
+			if err != nil {
+				return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid value for %s: %s", name, err)}
+			}
+		}
+	}
+	if str := r.FormValue("enabled"); str != "" {
+		rule.Enabled, err = strconv.ParseBool(str)
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for enabled, it must be a boolean"}
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateUnitAutoscaleSet,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.SetUnitRule(&rule)
+	if e, ok := err.(*tsuruErrors.ValidationError); ok {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// title: remove unit autoscale rule
+// path: /apps/{app}/units/autoscale
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func unitAutoScaleDeleteRule(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppUpdateUnitAutoscaleRemove, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateUnitAutoscaleRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.DeleteUnitRule(a.Name, r.FormValue("process"))
+	if err == autoscale.ErrUnitRuleNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
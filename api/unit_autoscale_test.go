@@ -0,0 +1,158 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/autoscale"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createUnitAutoScaleApp(c *check.C) *app.App {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestUnitAutoScaleSetRule(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	body := strings.NewReader("process=web&min=1&max=5&cpu=60&scaleUpCooldown=1m")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateUnitAutoscaleSet,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := autoscale.ListUnitRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].Process, check.Equals, "web")
+	c.Assert(rules[0].MinUnits, check.Equals, 1)
+	c.Assert(rules[0].MaxUnits, check.Equals, 5)
+	c.Assert(rules[0].TargetCPU, check.Equals, 60.0)
+	c.Assert(rules[0].ScaleUpCooldown, check.Equals, time.Minute)
+	c.Assert(rules[0].Enabled, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.unit.autoscale.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "web"},
+			{"name": "cpu", "value": "60"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnitAutoScaleSetRuleInvalid(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	body := strings.NewReader("process=web&min=3&max=2&cpu=60")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "max units must be greater than or equal to min units\n")
+}
+
+func (s *S) TestUnitAutoScaleSetRuleNoPermission(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	body := strings.NewReader("process=web&min=1&max=5&cpu=60")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadUnitAutoscale,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUnitAutoScaleListRules(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	err := autoscale.SetUnitRule(&autoscale.UnitRule{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 60})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/units/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadUnitAutoscale,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var rules []autoscale.UnitRule
+	err = json.NewDecoder(recorder.Body).Decode(&rules)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].Process, check.Equals, "web")
+}
+
+func (s *S) TestUnitAutoScaleListRulesEmpty(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/units/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestUnitAutoScaleDeleteRule(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	err := autoscale.SetUnitRule(&autoscale.UnitRule{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 60})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/units/autoscale?process=web", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateUnitAutoscaleRemove,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := autoscale.ListUnitRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.unit.autoscale.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "web"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnitAutoScaleDeleteRuleNotFound(c *check.C) {
+	a := s.createUnitAutoScaleApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/units/autoscale?process=web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
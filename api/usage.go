@@ -0,0 +1,92 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/usage"
+)
+
+const usageDateFormat = "2006-01-02"
+
+// title: usage report
+// path: /usage
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func usageReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermUsageRead)
+	if len(contexts) == 0 {
+		return permission.ErrUnauthorized
+	}
+	query := r.URL.Query()
+	opts := usage.ReportOptions{GroupBy: query["group"]}
+	var err error
+	opts.Start, err = time.Parse(usageDateFormat, query.Get("start"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid start date, it must be in the YYYY-MM-DD format"}
+	}
+	opts.End, err = time.Parse(usageDateFormat, query.Get("end"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid end date, it must be in the YYYY-MM-DD format"}
+	}
+	opts.Teams, err = usageTeams(contexts, query["team"])
+	if err != nil {
+		return err
+	}
+	prices, err := usage.ConfiguredPrices()
+	if err != nil {
+		return err
+	}
+	report, err := usage.GenerateReport(opts, prices)
+	if err != nil {
+		if _, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		return report.WriteCSV(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
+// usageTeams returns the teams whose usage is included in a report, nil
+// meaning all teams. Users allowed to read the usage of specific teams only
+// get the usage of these teams.
+func usageTeams(contexts []permission.PermissionContext, requested []string) ([]string, error) {
+	allowed := map[string]bool{}
+	for _, c := range contexts {
+		if c.CtxType == permission.CtxGlobal {
+			return requested, nil
+		}
+		allowed[c.Value] = true
+	}
+	if len(requested) == 0 {
+		teams := make([]string, 0, len(allowed))
+		for team := range allowed {
+			teams = append(teams, team)
+		}
+		return teams, nil
+	}
+	for _, team := range requested {
+		if !allowed[team] {
+			return nil, permission.ErrUnauthorized
+		}
+	}
+	return requested, nil
+}
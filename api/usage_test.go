@@ -0,0 +1,111 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/usage"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) insertDailyUsage(c *check.C) {
+	d := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	coll := s.conn.Collection("usage_daily")
+	err := coll.Insert(
+		usage.DailyUsage{Day: d, Kind: usage.KindApp, Team: "team1", App: "app1", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 24, MemoryGBHours: 12},
+		usage.DailyUsage{Day: d, Kind: usage.KindApp, Team: "team2", App: "app2", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 2, MemoryGBHours: 1},
+	)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUsageReport(c *check.C) {
+	s.insertDailyUsage(c)
+	config.Set("usage:prices:plans:c1:unit-hour", 0.5)
+	defer config.Unset("usage")
+	request, err := http.NewRequest("GET", "/usage?start=2017-06-01&end=2017-06-30&group=team", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report usage.Report
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Rows, check.DeepEquals, []usage.ReportRow{
+		{Team: "team1", UnitHours: 24, MemoryGBHours: 12, Cost: 12},
+		{Team: "team2", UnitHours: 2, MemoryGBHours: 1, Cost: 1},
+	})
+	c.Assert(report.Cost, check.Equals, 13.0)
+}
+
+func (s *S) TestUsageReportCSV(c *check.C) {
+	s.insertDailyUsage(c)
+	request, err := http.NewRequest("GET", "/usage?start=2017-06-01&end=2017-06-01&group=pool&format=csv", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/csv")
+	c.Assert(recorder.Body.String(), check.Equals, `team,app,pool,service,service_plan,unit_hours,memory_gb_hours,cpushare_hours,instance_hours,cost
+,,pool1,,,26.0000,13.0000,0.0000,0.0000,0.0000
+`)
+}
+
+func (s *S) TestUsageReportTeamPermission(c *check.C) {
+	s.insertDailyUsage(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermUsageRead,
+		Context: permission.Context(permission.CtxTeam, "team2"),
+	})
+	request, err := http.NewRequest("GET", "/usage?start=2017-06-01&end=2017-06-01&group=team", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var report usage.Report
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Rows, check.DeepEquals, []usage.ReportRow{
+		{Team: "team2", UnitHours: 2, MemoryGBHours: 1},
+	})
+	request, err = http.NewRequest("GET", "/usage?start=2017-06-01&end=2017-06-01&team=team1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUsageReportInvalidDate(c *check.C) {
+	request, err := http.NewRequest("GET", "/usage?start=06/01/2017&end=2017-06-30", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid start date, it must be in the YYYY-MM-DD format\n")
+}
+
+func (s *S) TestUsageReportWithoutPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/usage?start=2017-06-01&end=2017-06-30", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
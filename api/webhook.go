@@ -0,0 +1,258 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func webhookTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeWebhook, Value: name}
+}
+
+func decodeWebhook(r *http.Request) (*webhook.Webhook, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	var w webhook.Webhook
+	err = dec.DecodeValues(&w, r.Form)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse webhook: %s", err)}
+	}
+	return &w, nil
+}
+
+// removeSecret removes the webhook secret from the form, so it's not stored
+// in the event custom data, returning whether it was present.
+func removeSecret(f url.Values) bool {
+	var found bool
+	for k := range f {
+		if strings.EqualFold(k, "secret") {
+			found = true
+			delete(f, k)
+		}
+	}
+	return found
+}
+
+func handleWebhookError(err error) error {
+	switch err {
+	case webhook.ErrWebhookNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case webhook.ErrWebhookAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case webhook.ErrInvalidName, webhook.ErrInvalidTeamOwner, webhook.ErrInvalidURL:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func findAllowedWebhook(t auth.Token, name string, scheme *permission.PermissionScheme) (*webhook.Webhook, error) {
+	w, err := webhook.Find(name)
+	if err != nil {
+		return nil, handleWebhookError(err)
+	}
+	if !permission.Check(t, scheme, permission.Context(permission.CtxTeam, w.TeamOwner)) {
+		return nil, permission.ErrUnauthorized
+	}
+	return w, nil
+}
+
+// title: webhook list
+// path: /events/webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teams, err := permission.ListContextValues(t, permission.PermWebhookRead, true)
+	if err != nil {
+		return err
+	}
+	webhooks, err := webhook.List(teams)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(webhooks)
+}
+
+// title: webhook info
+// path: /events/webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	webhookName := r.URL.Query().Get(":name")
+	wh, err := findAllowedWebhook(t, webhookName, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(wh)
+}
+
+// title: webhook create
+// path: /events/webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook created
+//   400: Invalid webhook
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	if wh.TeamOwner == "" {
+		wh.TeamOwner, err = permission.TeamForPermission(t, permission.PermWebhookCreate)
+		if err == permission.ErrTooManyTeams {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !permission.Check(t, permission.PermWebhookCreate, permission.Context(permission.CtxTeam, wh.TeamOwner)) {
+		return permission.ErrUnauthorized
+	}
+	removeSecret(r.Form)
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(wh.Name),
+		Kind:       permission.PermWebhookCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, wh.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return handleWebhookError(webhook.Create(*wh))
+}
+
+// title: webhook update
+// path: /events/webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid webhook
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	webhookName := r.URL.Query().Get(":name")
+	current, err := findAllowedWebhook(t, webhookName, permission.PermWebhookUpdate)
+	if err != nil {
+		return err
+	}
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	wh.Name = webhookName
+	if wh.TeamOwner == "" {
+		wh.TeamOwner = current.TeamOwner
+	}
+	if wh.TeamOwner != current.TeamOwner &&
+		!permission.Check(t, permission.PermWebhookUpdate, permission.Context(permission.CtxTeam, wh.TeamOwner)) {
+		return permission.ErrUnauthorized
+	}
+	if !removeSecret(r.Form) {
+		wh.Secret = current.Secret
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(webhookName),
+		Kind:       permission.PermWebhookUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, current.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return handleWebhookError(webhook.Update(*wh))
+}
+
+// title: webhook delete
+// path: /events/webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook deleted
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	webhookName := r.URL.Query().Get(":name")
+	wh, err := findAllowedWebhook(t, webhookName, permission.PermWebhookDelete)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(webhookName),
+		Kind:       permission.PermWebhookDelete,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, wh.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return handleWebhookError(webhook.Delete(webhookName))
+}
+
+// title: webhook deliveries
+// path: /events/webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	webhookName := r.URL.Query().Get(":name")
+	_, err := findAllowedWebhook(t, webhookName, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	deliveries, err := webhook.ListDeliveries(webhookName)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
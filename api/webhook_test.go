@@ -0,0 +1,212 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestWebhookList(c *check.C) {
+	err := webhook.Create(webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(webhook.Webhook{Name: "wh2", TeamOwner: "other-team", URL: "http://b.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var webhooks []webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &webhooks)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 1)
+	c.Assert(webhooks[0].Name, check.Equals, "wh1")
+}
+
+func (s *S) TestWebhookListEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestWebhookInfoHidesSecret(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	err := webhook.Create(webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Not(check.Matches), "(?s).*abc.*")
+	var result map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["Name"], check.Equals, "wh1")
+}
+
+func (s *S) TestWebhookInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/webhooks/unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookCreate(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	body := strings.NewReader("name=wh1&url=http://a.com/hook&secret=abc&eventfilter.kindnames.0=app.deploy&headers.X-Token.0=val")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	w, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(w.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(w.URL, check.Equals, "http://a.com/hook")
+	c.Assert(w.Secret, check.Equals, "abc")
+	c.Assert(w.EventFilter.KindNames, check.DeepEquals, []string{"app.deploy"})
+	c.Assert(w.Headers.Get("X-Token"), check.Equals, "val")
+	c.Assert(eventtest.EventDesc{
+		Target: webhookTarget("wh1"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "webhook.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "wh1"},
+			{"name": "url", "value": "http://a.com/hook"},
+			{"name": "eventfilter.kindnames.0", "value": "app.deploy"},
+			{"name": "headers.X-Token.0", "value": "val"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookCreateInvalid(c *check.C) {
+	body := strings.NewReader("name=wh1&url=invalid&teamowner=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, webhook.ErrInvalidURL.Error()+"\n")
+}
+
+func (s *S) TestWebhookCreateForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, "other-team"),
+	})
+	body := strings.NewReader("name=wh1&url=http://a.com&teamowner=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookUpdateKeepsSecret(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	err := webhook.Create(webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("url=http://b.com&eventfilter.erroronly=true")
+	request, err := http.NewRequest("PUT", "/events/webhooks/wh1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	w, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(w.URL, check.Equals, "http://b.com")
+	c.Assert(w.Secret, check.Equals, "abc")
+	c.Assert(w.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(w.EventFilter.ErrorOnly, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: webhookTarget("wh1"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "webhook.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "wh1"},
+			{"name": "url", "value": "http://b.com"},
+			{"name": "eventfilter.erroronly", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookDelete(c *check.C) {
+	err := webhook.Create(webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Find("wh1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: webhookTarget("wh1"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "webhook.delete",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "wh1"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookDeliveriesEmpty(c *check.C) {
+	err := webhook.Create(webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/webhooks/wh1/deliveries", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
@@ -348,7 +348,11 @@ var reserveUnitsToAdd = action.Action{
 		if err != nil {
 			return nil, ErrAppNotFound
 		}
-		err = reserveUnits(app, n)
+		var process string
+		if len(ctx.Params) > 3 {
+			process, _ = ctx.Params[3].(string)
+		}
+		err = reserveUnits(app, n, process)
 		if err != nil {
 			return nil, err
 		}
@@ -361,7 +365,11 @@ var reserveUnitsToAdd = action.Action{
 			app = ctx.Params[0].(*App)
 		}
 		qty := ctx.FWResult.(int)
-		err := releaseUnits(app, qty)
+		var process string
+		if len(ctx.Params) > 3 {
+			process, _ = ctx.Params[3].(string)
+		}
+		err := releaseUnits(app, qty, process)
 		if err != nil {
 			log.Errorf("Failed to rollback reserveUnitsToAdd: %s", err)
 		}
@@ -392,11 +400,12 @@ var provisionAddUnits = action.Action{
 }
 
 type updateAppPipelineResult struct {
-	changedRouter bool
-	oldPlan       *Plan
-	oldIp         string
-	oldRouter     string
-	app           *App
+	changedRouter   bool
+	oldPlan         *Plan
+	oldProcessPlans map[string]Plan
+	oldIp           string
+	oldRouter       string
+	app             *App
 }
 
 var moveRouterUnits = action.Action{
@@ -416,6 +425,11 @@ var moveRouterUnits = action.Action{
 		}
 		newRouter := app.Router
 		result := updateAppPipelineResult{oldPlan: oldPlan, oldRouter: oldRouter, app: app, oldIp: app.Ip}
+		if len(ctx.Params) > 4 {
+			result.oldProcessPlans, _ = ctx.Params[4].(map[string]Plan)
+		} else {
+			result.oldProcessPlans = app.ProcessPlans
+		}
 		if newRouter != oldRouter {
 			_, err := rebuild.RebuildRoutes(app)
 			if err != nil {
@@ -429,6 +443,7 @@ var moveRouterUnits = action.Action{
 		result := ctx.FWResult.(*updateAppPipelineResult)
 		defer func() {
 			result.app.Plan = *result.oldPlan
+			result.app.ProcessPlans = result.oldProcessPlans
 			result.app.Router = result.oldRouter
 		}()
 		if result.changedRouter {
@@ -466,7 +481,7 @@ var saveApp = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
-		update := bson.M{"$set": bson.M{"plan": result.app.Plan, "routername": result.app.Router}}
+		update := bson.M{"$set": bson.M{"plan": result.app.Plan, "processplans": result.app.ProcessPlans, "routername": result.app.Router}}
 		err = conn.Apps().Update(bson.M{"name": result.app.Name}, update)
 		if err != nil {
 			return nil, err
@@ -481,7 +496,7 @@ var saveApp = action.Action{
 			return
 		}
 		defer conn.Close()
-		update := bson.M{"$set": bson.M{"plan": *result.oldPlan, "routername": result.oldRouter}}
+		update := bson.M{"$set": bson.M{"plan": *result.oldPlan, "processplans": result.oldProcessPlans, "routername": result.oldRouter}}
 		err = conn.Apps().Update(bson.M{"name": result.app.Name}, update)
 		if err != nil {
 			log.Errorf("BACKWARD save app - failed to update app: %s", err)
@@ -12,7 +12,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,6 +36,7 @@ import (
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/secret"
 	"github.com/tsuru/tsuru/service"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -122,6 +125,7 @@ type App struct {
 	TeamOwner      string
 	Owner          string
 	Plan           Plan
+	ProcessPlans   map[string]Plan
 	UpdatePlatform bool
 	Lock           AppLock
 	Pool           string
@@ -130,7 +134,10 @@ type App struct {
 	RouterOpts     map[string]string
 	Deploys        uint
 	Tags           []string
+	Metadata       provision.AppMetadata
+	LogFormat      string
 	Error          string
+	ConfigVersion  int
 
 	quota.Quota
 	builder     builder.Builder
@@ -179,6 +186,11 @@ func (app *App) getProvisioner() (provision.Provisioner, error) {
 	return app.provisioner, nil
 }
 
+// GetProvisioner returns the provisioner responsible for the pool of the app.
+func (app *App) GetProvisioner() (provision.Provisioner, error) {
+	return app.getProvisioner()
+}
+
 // Units returns the list of units.
 func (app *App) Units() ([]provision.Unit, error) {
 	prov, err := app.getProvisioner()
@@ -219,20 +231,48 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["description"] = app.Description
 	result["deploys"] = app.Deploys
 	result["teamowner"] = app.TeamOwner
-	result["plan"] = map[string]interface{}{
-		"name":     app.Plan.Name,
-		"memory":   app.Plan.Memory,
-		"swap":     app.Plan.Swap,
-		"cpushare": app.Plan.CpuShare,
-		"router":   app.Router,
+	plan := planInfo(&app.Plan)
+	plan["router"] = app.Router
+	result["plan"] = plan
+	if len(app.ProcessPlans) > 0 {
+		processPlans := make(map[string]interface{}, len(app.ProcessPlans))
+		for process, p := range app.ProcessPlans {
+			processPlans[process] = planInfo(&p)
+		}
+		result["processPlans"] = processPlans
 	}
 	result["router"] = app.Router
 	result["lock"] = app.Lock
 	result["tags"] = app.Tags
+	result["metadata"] = app.Metadata
+	result["logFormat"] = app.LogFormat
 	return json.Marshal(&result)
 }
 
-// Applog represents a log entry.
+func planInfo(p *Plan) map[string]interface{} {
+	info := map[string]interface{}{
+		"name":     p.Name,
+		"memory":   p.Memory,
+		"swap":     p.Swap,
+		"cpushare": p.CpuShare,
+	}
+	if p.CPULimit != 0 {
+		info["cpuLimit"] = p.CPULimit
+	}
+	if p.CPURequest != 0 {
+		info["cpuRequest"] = p.CPURequest
+	}
+	if p.MemoryRequest != 0 {
+		info["memoryRequest"] = p.MemoryRequest
+	}
+	if p.EphemeralStorage != 0 {
+		info["ephemeralStorage"] = p.EphemeralStorage
+	}
+	return info
+}
+
+// Applog represents a log entry. Fields holds the keys of messages parsed
+// according to the log format of the app.
 type Applog struct {
 	MongoID bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	Date    time.Time
@@ -240,6 +280,7 @@ type Applog struct {
 	Source  string
 	AppName string
 	Unit    string
+	Fields  map[string]string `bson:",omitempty" json:",omitempty"`
 }
 
 // AcquireApplicationLock acquires an application lock by setting the lock
@@ -311,6 +352,22 @@ func GetByName(name string) (*App, error) {
 	return &app, err
 }
 
+// GetByAddr queries the database to find an app by one of its addresses,
+// which may be the address given by the router or one of its cnames.
+func GetByAddr(addr string) (*App, error) {
+	var app App
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.Apps().Find(bson.M{"$or": []bson.M{{"ip": addr}, {"cname": addr}}}).One(&app)
+	if err == mgo.ErrNotFound {
+		return nil, ErrAppNotFound
+	}
+	return &app, err
+}
+
 // CreateApp creates a new app.
 //
 // Creating a new app is a process composed of the following steps:
@@ -370,21 +427,30 @@ func CreateApp(app *App, user *auth.User) error {
 	return nil
 }
 
-// Update changes informations of the application.
-func (app *App) Update(updateData App, w io.Writer) (err error) {
+// Update changes informations of the application. Changes to the plan are
+// recorded as a new configuration revision authored by author.
+func (app *App) Update(updateData App, author string, w io.Writer) (err error) {
 	description := updateData.Description
 	planName := updateData.Plan.Name
+	processPlans := updateData.ProcessPlans
 	poolName := updateData.Pool
 	teamOwner := updateData.TeamOwner
 	routerName := updateData.Router
 	platformUpdate := updateData.UpdatePlatform
 	tags := processTags(updateData.Tags)
+	labels := updateData.Metadata.Labels
+	annotations := updateData.Metadata.Annotations
+	logFormat := updateData.LogFormat
 	if platformUpdate {
 		app.UpdatePlatform = platformUpdate
 	}
 	if description != "" {
 		app.Description = description
 	}
+	if logFormat != "" {
+		app.LogFormat = logFormat
+	}
+	oldPool := app.Pool
 	if poolName != "" {
 		app.Pool = poolName
 		_, err = app.getPoolForApp(app.Pool)
@@ -394,6 +460,8 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	}
 	oldPlan := app.Plan
 	oldRouter := app.Router
+	oldTeamOwner := app.TeamOwner
+	prevConfig := app.configSnapshot()
 	if routerName != "" {
 		_, err = router.Get(routerName)
 		if err != nil {
@@ -408,6 +476,13 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 		}
 		app.Plan = *plan
 	}
+	oldProcessPlans := app.ProcessPlans
+	if len(processPlans) > 0 {
+		err = app.setProcessPlans(processPlans)
+		if err != nil {
+			return err
+		}
+	}
 	if teamOwner != "" {
 		team, errTeam := auth.GetTeam(teamOwner)
 		if errTeam != nil {
@@ -423,18 +498,35 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	if tags != nil {
 		app.Tags = tags
 	}
-	err = app.validate()
+	oldMetadata := app.Metadata
+	if labels != nil {
+		app.Metadata.Labels = labels
+	}
+	if annotations != nil {
+		app.Metadata.Annotations = annotations
+	}
+	err = app.validateChanges(app.changedPlanNames(oldPool, oldPlan, oldProcessPlans))
 	if err != nil {
 		return err
 	}
-	if app.Router != oldRouter || app.Plan != oldPlan {
+	err = app.reserveTeamAllocationChange(oldTeamOwner, oldPlan, oldProcessPlans)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			app.revertTeamAllocationChange(oldTeamOwner, oldPlan, oldProcessPlans)
+		}
+	}()
+	if app.Router != oldRouter || app.Plan != oldPlan || !reflect.DeepEqual(app.ProcessPlans, oldProcessPlans) ||
+		!reflect.DeepEqual(app.Metadata, oldMetadata) {
 		actions := []*action.Action{
 			&moveRouterUnits,
 			&saveApp,
 			&restartApp,
 			&removeOldBackend,
 		}
-		err = action.NewPipeline(actions...).Execute(app, &oldPlan, oldRouter, w)
+		err = action.NewPipeline(actions...).Execute(app, &oldPlan, oldRouter, w, oldProcessPlans)
 		if err != nil {
 			return err
 		}
@@ -444,7 +536,54 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 		return err
 	}
 	defer conn.Close()
-	return conn.Apps().Update(bson.M{"name": app.Name}, app)
+	// Only the fields changed here are set, the env and the config version
+	// may have been changed concurrently.
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{
+		"updateplatform": app.UpdatePlatform,
+		"description":    app.Description,
+		"logformat":      app.LogFormat,
+		"pool":           app.Pool,
+		"router":         app.Router,
+		"plan":           app.Plan,
+		"processplans":   app.ProcessPlans,
+		"teamowner":      app.TeamOwner,
+		"tags":           app.Tags,
+		"metadata":       app.Metadata,
+	}})
+	if err != nil {
+		return err
+	}
+	app.logConfigRevisionError(app.recordConfigRevision(prevConfig, author, "app update"))
+	return nil
+}
+
+// setProcessPlans sets the plans of the given processes, replacing the map of
+// process plans. Processes with an empty plan name fall back to the plan of
+// the app.
+func (app *App) setProcessPlans(processPlans map[string]Plan) error {
+	newPlans := make(map[string]Plan, len(app.ProcessPlans)+len(processPlans))
+	for process, p := range app.ProcessPlans {
+		newPlans[process] = p
+	}
+	for process, p := range processPlans {
+		if process == "" {
+			return &tsuruErrors.ValidationError{Message: "process name is required to set a process plan"}
+		}
+		if p.Name == "" {
+			delete(newPlans, process)
+			continue
+		}
+		plan, err := findPlanByName(p.Name)
+		if err != nil {
+			return err
+		}
+		newPlans[process] = *plan
+	}
+	if len(newPlans) == 0 {
+		newPlans = nil
+	}
+	app.ProcessPlans = newPlans
+	return nil
 }
 
 func processTags(tags []string) []string {
@@ -490,6 +629,17 @@ func (app *App) unbind() error {
 	return nil
 }
 
+// DeleteHook is called by Delete to remove the records kept by other packages
+// under the name of an app.
+type DeleteHook func(appName string) error
+
+var deleteHooks []DeleteHook
+
+// AddDeleteHook registers a hook to be called when an app is deleted.
+func AddDeleteHook(hook DeleteHook) {
+	deleteHooks = append(deleteHooks, hook)
+}
+
 // Delete deletes an app.
 func Delete(app *App, w io.Writer) error {
 	isSwapped, swappedWith, err := router.IsSwapped(app.GetName())
@@ -522,6 +672,7 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	allocated, allocationErr := app.allocation()
 	err = prov.Destroy(app)
 	if err != nil {
 		logErr("Unable to destroy app in provisioner", err)
@@ -561,6 +712,13 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
+	err = allocationErr
+	if err == nil {
+		err = quota.ReleaseTeamResources(app.TeamOwner, allocated)
+	}
+	if err != nil {
+		logErr("Unable to release team quota", err)
+	}
 	logConn, err := db.LogConn()
 	if err == nil {
 		defer logConn.Close()
@@ -569,6 +727,12 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to remove logs collection", err)
 	}
+	for _, hook := range deleteHooks {
+		err = hook(appName)
+		if err != nil {
+			logErr("Unable to remove app records", err)
+		}
+	}
 	conn, err := db.Conn()
 	if err == nil {
 		defer conn.Close()
@@ -679,6 +843,7 @@ func (app *App) RemoveUnits(n uint, process string, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	releaseTeamResources(app.TeamOwner, teamResources(app.PlanForProcess(process), int64(n)))
 	units, err := app.Units()
 	if err != nil {
 		return err
@@ -955,16 +1120,47 @@ func (app *App) getEnv(name string) (bind.EnvVar, error) {
 
 // validate checks app name format
 func (app *App) validate() error {
+	return app.validateChanges(app.planNames())
+}
+
+// validateChanges is like validate, but only checks whether the given plans
+// are available for the pool of the app. Plans no longer available for the
+// pool are kept by the app until they're changed.
+func (app *App) validateChanges(plans []string) error {
 	if app.Name == InternalAppName || !nameRegexp.MatchString(app.Name) {
 		msg := "Invalid app name, your app should have at most 63 " +
 			"characters, containing only lower case letters, numbers or dashes, " +
 			"starting with a letter."
 		return &tsuruErrors.ValidationError{Message: msg}
 	}
-	return app.validatePool()
+	err := app.validatePool(plans)
+	if err != nil {
+		return err
+	}
+	err = validateLogFormat(app.LogFormat)
+	if err != nil {
+		return err
+	}
+	return app.validateMetadata()
 }
 
-func (app *App) validatePool() error {
+func (app *App) validateMetadata() error {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	if validator, ok := prov.(provision.MetadataValidatorProvisioner); ok {
+		err = validator.ValidateMetadata(app.Metadata)
+	} else {
+		err = app.Metadata.Validate("")
+	}
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	return nil
+}
+
+func (app *App) validatePool(plans []string) error {
 	pool, err := provision.GetPoolByName(app.Pool)
 	if err != nil {
 		return err
@@ -973,9 +1169,66 @@ func (app *App) validatePool() error {
 	if err != nil {
 		return err
 	}
+	err = app.validatePlans(pool, plans)
+	if err != nil {
+		return err
+	}
 	return app.validateRouter(pool)
 }
 
+// planNames returns the name of the plan of the app followed by the names of
+// the plans of its processes, sorted by process.
+func (app *App) planNames() []string {
+	plans := []string{app.Plan.Name}
+	for _, process := range sortedProcesses(app.ProcessPlans) {
+		plans = append(plans, app.ProcessPlans[process].Name)
+	}
+	return plans
+}
+
+func sortedProcesses(processPlans map[string]Plan) []string {
+	processes := make([]string, 0, len(processPlans))
+	for process := range processPlans {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	return processes
+}
+
+// changedPlanNames returns the names of the plans of the app changed since
+// it used the given pool and plans. Every plan is returned when the pool
+// changed.
+func (app *App) changedPlanNames(oldPool string, oldPlan Plan, oldProcessPlans map[string]Plan) []string {
+	if app.Pool != oldPool {
+		return app.planNames()
+	}
+	var plans []string
+	if app.Plan.Name != oldPlan.Name {
+		plans = append(plans, app.Plan.Name)
+	}
+	for _, process := range sortedProcesses(app.ProcessPlans) {
+		p := app.ProcessPlans[process]
+		if old, ok := oldProcessPlans[process]; !ok || old.Name != p.Name {
+			plans = append(plans, p.Name)
+		}
+	}
+	return plans
+}
+
+func (app *App) validatePlans(pool *provision.Pool, plans []string) error {
+	for _, plan := range plans {
+		allowed, err := pool.AllowsPlan(plan)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			msg := fmt.Sprintf("plan %q is not available for pool %q", plan, app.Pool)
+			return &tsuruErrors.ValidationError{Message: msg}
+		}
+	}
+	return nil
+}
+
 func (app *App) validateTeamOwner(pool *provision.Pool) error {
 	_, err := auth.GetTeam(app.TeamOwner)
 	if err != nil {
@@ -1173,6 +1426,11 @@ func (app *App) GetPool() string {
 	return app.Pool
 }
 
+// GetMetadata returns the custom labels and annotations of the app.
+func (app *App) GetMetadata() provision.AppMetadata {
+	return app.Metadata
+}
+
 // GetTeamOwner returns the team owner of the app.
 func (app *App) GetTeamOwner() string {
 	return app.TeamOwner
@@ -1198,6 +1456,30 @@ func (app *App) GetCpuShare() int {
 	return app.Plan.CpuShare
 }
 
+// PlanForProcess returns the plan of the given process, falling back to the
+// plan of the app.
+func (app *App) PlanForProcess(process string) Plan {
+	if p, ok := app.ProcessPlans[process]; ok {
+		return p
+	}
+	return app.Plan
+}
+
+// GetUnitResources returns the resources allocated to each unit of the given
+// process, according to its plan.
+func (app *App) GetUnitResources(process string) provision.UnitResources {
+	p := app.PlanForProcess(process)
+	return provision.UnitResources{
+		Memory:           p.Memory,
+		Swap:             p.Swap,
+		CPUShare:         p.CpuShare,
+		CPULimit:         p.CPULimit,
+		CPURequest:       p.CPURequest,
+		MemoryRequest:    p.MemoryRequest,
+		EphemeralStorage: p.EphemeralStorage,
+	}
+}
+
 // GetIp returns the ip of the app.
 func (app *App) GetIp() string {
 	return app.Ip
@@ -1249,9 +1531,31 @@ func (app *App) GetDeploys() uint {
 	return app.Deploys
 }
 
-// Envs returns a map representing the apps environment variables.
-func (app *App) Envs() map[string]bind.EnvVar {
-	return app.Env
+// Envs returns a map representing the apps environment variables, with
+// secret variables decrypted.
+func (app *App) Envs() (map[string]bind.EnvVar, error) {
+	var hasSecrets bool
+	for _, env := range app.Env {
+		if env.Secret {
+			hasSecrets = true
+			break
+		}
+	}
+	if !hasSecrets {
+		return app.Env, nil
+	}
+	envs := make(map[string]bind.EnvVar, len(app.Env))
+	for name, env := range app.Env {
+		if env.Secret {
+			value, err := secret.Decrypt(env.Value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to decrypt secret env %s of app %s", name, app.Name)
+			}
+			env.Value = value
+		}
+		envs[name] = env
+	}
+	return envs, nil
 }
 
 // SetEnvs saves a list of environment variables in the app. The publicOnly
@@ -1285,6 +1589,7 @@ func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
 	if w != nil {
 		fmt.Fprintf(w, "---- Setting %d new environment variables ----\n", len(setEnvs.Envs))
 	}
+	prevConfig := app.configSnapshot()
 	for _, env := range setEnvs.Envs {
 		set := true
 		if setEnvs.PublicOnly {
@@ -1293,9 +1598,18 @@ func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
 				set = false
 			}
 		}
-		if set {
-			app.setEnv(env)
+		if !set {
+			continue
 		}
+		if env.Secret {
+			var err error
+			env.Public = false
+			env.Value, err = secret.Encrypt(env.Value)
+			if err != nil {
+				return errors.Wrapf(err, "unable to encrypt secret env %s", env.Name)
+			}
+		}
+		app.setEnv(env)
 	}
 	conn, err := db.Conn()
 	if err != nil {
@@ -1306,6 +1620,7 @@ func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	app.logConfigRevisionError(app.recordConfigRevision(prevConfig, setEnvs.Author, "env set"))
 	if !setEnvs.ShouldRestart {
 		return nil
 	}
@@ -1341,6 +1656,7 @@ func (app *App) unsetEnvsToApp(unsetEnvs bind.UnsetEnvApp, w io.Writer) error {
 	if w != nil {
 		fmt.Fprintf(w, "---- Unsetting %d environment variables ----\n", len(unsetEnvs.VariableNames))
 	}
+	prevConfig := app.configSnapshot()
 	for _, name := range unsetEnvs.VariableNames {
 		var unset bool
 		e, err := app.getEnv(name)
@@ -1360,6 +1676,7 @@ func (app *App) unsetEnvsToApp(unsetEnvs bind.UnsetEnvApp, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	app.logConfigRevisionError(app.recordConfigRevision(prevConfig, unsetEnvs.Author, "env unset"))
 	if !unsetEnvs.ShouldRestart {
 		return nil
 	}
@@ -1546,7 +1863,7 @@ func (app *App) RemoveInstance(instanceApp bind.InstanceApp, writer io.Writer) e
 // user can filter where the message come from.
 func (app *App) Log(message, source, unit string) error {
 	messages := strings.Split(message, "\n")
-	logs := make([]interface{}, 0, len(messages))
+	logs := make([]*Applog, 0, len(messages))
 	for _, msg := range messages {
 		if msg != "" {
 			l := Applog{
@@ -1556,16 +1873,15 @@ func (app *App) Log(message, source, unit string) error {
 				AppName: app.Name,
 				Unit:    unit,
 			}
-			logs = append(logs, l)
+			logs = append(logs, &l)
 		}
 	}
 	if len(logs) > 0 {
-		conn, err := db.LogConn()
+		sinks, err := app.logSinks()
 		if err != nil {
 			return err
 		}
-		defer conn.Close()
-		return conn.Logs(app.Name).Insert(logs...)
+		return writeToSinks(sinks, app.Name, logs)
 	}
 	return nil
 }
@@ -1573,6 +1889,20 @@ func (app *App) Log(message, source, unit string) error {
 // LastLogs returns a list of the last `lines` log of the app, matching the
 // fields in the log instance received as an example.
 func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+	page, err := app.SearchLogs(LogQuery{LogFilter: filterFromApplog(filterLog), Limit: lines})
+	if err != nil {
+		return nil, err
+	}
+	return page.Logs, nil
+}
+
+// SearchLogs returns a page of the logs of the app matching the query.
+func (app *App) SearchLogs(query LogQuery) (*LogPage, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	query.boundMessageSearch(time.Now().UTC())
 	prov, err := app.getProvisioner()
 	if err != nil {
 		return nil, err
@@ -1589,28 +1919,11 @@ func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
 			return nil, errors.New(doc)
 		}
 	}
-	conn, err := db.LogConn()
+	reader, err := app.logReader()
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
-	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
-	if err != nil {
-		return nil, err
-	}
-	l := len(logs)
-	for i := 0; i < l/2; i++ {
-		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
-	}
-	return logs, nil
+	return reader.SearchLogs(app.Name, query)
 }
 
 type Filter struct {
@@ -1624,6 +1937,7 @@ type Filter struct {
 	Statuses    []string
 	Locked      bool
 	Tags        []string
+	Labels      map[string]string
 	Extra       map[string][]string
 }
 
@@ -1676,6 +1990,13 @@ func (f *Filter) Query() bson.M {
 	if len(tags) > 0 {
 		query["tags"] = bson.M{"$all": tags}
 	}
+	if len(f.Labels) > 0 {
+		var labels []bson.M
+		for k, v := range f.Labels {
+			labels = append(labels, bson.M{"$elemMatch": bson.M{"name": k, "value": v}})
+		}
+		query["metadata.labels"] = bson.M{"$all": labels}
+	}
 	return query
 }
 
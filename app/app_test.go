@@ -61,6 +61,20 @@ func (s *S) TestGetAppByNameNotFound(c *check.C) {
 	c.Assert(app, check.IsNil)
 }
 
+func (s *S) TestGetAppByAddr(c *check.C) {
+	newApp := App{Name: "my-app", Platform: "Django", TeamOwner: s.team.Name, CName: []string{"my-app.example.com"}}
+	err := CreateApp(&newApp, s.user)
+	c.Assert(err, check.IsNil)
+	myApp, err := GetByAddr("my-app.fakerouter.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(myApp.Name, check.Equals, newApp.Name)
+	myApp, err = GetByAddr("my-app.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(myApp.Name, check.Equals, newApp.Name)
+	_, err = GetByAddr("other.example.com")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
 func (s *S) TestDelete(c *check.C) {
 	a := App{
 		Name:      "ritual",
@@ -97,6 +111,26 @@ func (s *S) TestDelete(c *check.C) {
 	c.Assert(imgs, check.HasLen, 0)
 }
 
+func (s *S) TestDeleteCallsHooks(c *check.C) {
+	var deleted []string
+	defer func(hooks []DeleteHook) { deleteHooks = hooks }(deleteHooks)
+	AddDeleteHook(func(appName string) error {
+		deleted = append(deleted, appName)
+		return nil
+	})
+	a := App{
+		Name:      "ritual",
+		Platform:  "ruby",
+		Owner:     s.user.Email,
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = Delete(&a, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.DeepEquals, []string{"ritual"})
+}
+
 func (s *S) TestDeleteWithEvents(c *check.C) {
 	a := App{
 		Name:      "ritual",
@@ -335,6 +369,29 @@ func (s *S) TestCreateAppTeamOwner(c *check.C) {
 	c.Assert(app.TeamOwner, check.Equals, "tsuruteam")
 }
 
+func (s *S) TestCreateAppWithMetadata(c *check.C) {
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/owner", Value: "me"}},
+	}}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GetMetadata(), check.DeepEquals, app.Metadata)
+}
+
+func (s *S) TestCreateAppWithInvalidMetadata(c *check.C) {
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "app-name", Value: "other"}},
+	}}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `label "app-name" is reserved for internal use`)
+	_, err = GetByName(app.Name)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
 func (s *S) TestCreateAppTeamOwnerTeamNotFound(c *check.C) {
 	app := App{
 		Name:      "someapp",
@@ -622,7 +679,7 @@ func (s *S) TestAddUnitsQuota(c *check.C) {
 	c.Assert(err, check.IsNil)
 	units = s.provisioner.GetUnits(&app)
 	c.Assert(units, check.HasLen, 7)
-	err = reserveUnits(&app, 1)
+	err = reserveUnits(&app, 1, "")
 	_, ok := err.(*quota.QuotaExceededError)
 	c.Assert(ok, check.Equals, true)
 }
@@ -2380,7 +2437,7 @@ func (s *S) TestLogWithListeners(c *check.C) {
 	}
 	err := CreateApp(&a, s.user)
 	c.Assert(err, check.IsNil)
-	l, err := NewLogListener(&a, Applog{})
+	l, err := NewLogListener(&a, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -2551,6 +2608,10 @@ func (s *S) TestAppMarshalJSON(c *check.C) {
 		TeamOwner:   "myteam",
 		Router:      "fake",
 		Tags:        []string{"tag a", "tag b"},
+		Metadata: provision.AppMetadata{
+			Labels: []provision.MetadataItem{{Name: "team", Value: "payments"}},
+		},
+		LogFormat: LogFormatJSON,
 	}
 	expected := map[string]interface{}{
 		"name":        "name",
@@ -2575,6 +2636,12 @@ func (s *S) TestAppMarshalJSON(c *check.C) {
 		},
 		"router": "fake",
 		"tags":   []interface{}{"tag a", "tag b"},
+		"metadata": map[string]interface{}{
+			"labels": []interface{}{
+				map[string]interface{}{"name": "team", "value": "payments"},
+			},
+		},
+		"logFormat": "json",
 	}
 	data, err := app.MarshalJSON()
 	c.Assert(err, check.IsNil)
@@ -2584,6 +2651,30 @@ func (s *S) TestAppMarshalJSON(c *check.C) {
 	c.Assert(result, check.DeepEquals, expected)
 }
 
+func (s *S) TestAppMarshalJSONProcessPlans(c *check.C) {
+	app := App{
+		Name: "name",
+		Plan: Plan{Name: "small", Memory: 64, CpuShare: 100},
+		ProcessPlans: map[string]Plan{
+			"worker": {Name: "large", Memory: 256, CpuShare: 200, CPULimit: 1000},
+		},
+	}
+	data, err := app.MarshalJSON()
+	c.Assert(err, check.IsNil)
+	result := make(map[string]interface{})
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["processPlans"], check.DeepEquals, map[string]interface{}{
+		"worker": map[string]interface{}{
+			"name":     "large",
+			"memory":   float64(256),
+			"swap":     float64(0),
+			"cpushare": float64(200),
+			"cpuLimit": float64(1000),
+		},
+	})
+}
+
 func (s *S) TestAppMarshalJSONWithoutRepository(c *check.C) {
 	app := App{
 		Name:        "name",
@@ -2621,8 +2712,10 @@ func (s *S) TestAppMarshalJSONWithoutRepository(c *check.C) {
 			"cpushare": float64(100),
 			"router":   "fake",
 		},
-		"router": "fake",
-		"tags":   []interface{}{},
+		"router":    "fake",
+		"tags":      []interface{}{},
+		"metadata":  map[string]interface{}{},
+		"logFormat": "",
 	}
 	data, err := app.MarshalJSON()
 	c.Assert(err, check.IsNil)
@@ -2659,8 +2752,9 @@ func (s *S) TestAppMarshalJSONUnitsError(c *check.C) {
 			"cpushare": float64(0),
 			"router":   "",
 		},
-		"router": "",
-		"tags":   nil,
+		"router":   "",
+		"tags":     nil,
+		"metadata": map[string]interface{}{},
 	}
 	data, err := app.MarshalJSON()
 	c.Assert(err, check.IsNil)
@@ -2807,7 +2901,8 @@ func (s *S) TestEnvs(c *check.C) {
 			},
 		},
 	}
-	env := app.Envs()
+	env, err := app.Envs()
+	c.Assert(err, check.IsNil)
 	c.Assert(env, check.DeepEquals, app.Env)
 }
 
@@ -3238,6 +3333,36 @@ func (s *S) TestListFilteringByTag(c *check.C) {
 	c.Assert(resultApps, check.HasLen, 0)
 }
 
+func (s *S) TestListFilteringByLabels(c *check.C) {
+	app1 := App{Name: "app1", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "payments"}},
+	}}
+	err := CreateApp(&app1, s.user)
+	c.Assert(err, check.IsNil)
+	app2 := App{Name: "app2", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "payments"}, {Name: "example.com/tier", Value: "backend"}},
+	}}
+	err = CreateApp(&app2, s.user)
+	c.Assert(err, check.IsNil)
+	app3 := App{Name: "app3", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "core"}},
+	}}
+	err = CreateApp(&app3, s.user)
+	c.Assert(err, check.IsNil)
+	resultApps, err := List(&Filter{Labels: map[string]string{"team": "payments"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(resultApps, check.HasLen, 2)
+	c.Assert(resultApps[0].Name, check.Equals, app1.Name)
+	c.Assert(resultApps[1].Name, check.Equals, app2.Name)
+	resultApps, err = List(&Filter{Labels: map[string]string{"team": "payments", "example.com/tier": "backend"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(resultApps, check.HasLen, 1)
+	c.Assert(resultApps[0].Name, check.Equals, app2.Name)
+	resultApps, err = List(&Filter{Labels: map[string]string{"team": "backend"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(resultApps, check.HasLen, 0)
+}
+
 func (s *S) TestListReturnsEmptyAppArrayWhenUserHasNoAccessToAnyApp(c *check.C) {
 	apps, err := List(nil)
 	c.Assert(err, check.IsNil)
@@ -3397,6 +3522,38 @@ func (s *S) TestGetSwap(c *check.C) {
 	c.Assert(a.GetSwap(), check.Equals, a.Plan.Swap)
 }
 
+func (s *S) TestPlanForProcess(c *check.C) {
+	a := App{
+		Plan:         Plan{Name: "small", Memory: 10},
+		ProcessPlans: map[string]Plan{"worker": {Name: "large", Memory: 100}},
+	}
+	c.Assert(a.PlanForProcess("web"), check.DeepEquals, a.Plan)
+	c.Assert(a.PlanForProcess(""), check.DeepEquals, a.Plan)
+	c.Assert(a.PlanForProcess("worker"), check.DeepEquals, Plan{Name: "large", Memory: 100})
+}
+
+func (s *S) TestGetUnitResources(c *check.C) {
+	a := App{
+		Plan: Plan{Memory: 10, Swap: 20, CpuShare: 30, CPULimit: 500, MemoryRequest: 5},
+		ProcessPlans: map[string]Plan{
+			"worker": {Memory: 100, CpuShare: 60, CPURequest: 250, EphemeralStorage: 1024},
+		},
+	}
+	c.Assert(a.GetUnitResources("web"), check.DeepEquals, provision.UnitResources{
+		Memory:        10,
+		Swap:          20,
+		CPUShare:      30,
+		CPULimit:      500,
+		MemoryRequest: 5,
+	})
+	c.Assert(a.GetUnitResources("worker"), check.DeepEquals, provision.UnitResources{
+		Memory:           100,
+		CPUShare:         60,
+		CPURequest:       250,
+		EphemeralStorage: 1024,
+	})
+}
+
 func (s *S) TestAppUnits(c *check.C) {
 	a := App{Name: "anycolor", TeamOwner: s.team.Name}
 	err := CreateApp(&a, s.user)
@@ -3743,6 +3900,21 @@ func (s *S) TestAppCreateValidateRouterNotAvailableForPool(c *check.C) {
 	})
 }
 
+func (s *S) TestAppCreateValidatePlanNotAvailableForPool(c *check.C) {
+	err := provision.SetPoolConstraint(&provision.PoolConstraint{
+		PoolExpr:  "pool1",
+		Field:     "plan",
+		Values:    []string{s.defaultPlan.Name},
+		Blacklist: true,
+	})
+	c.Assert(err, check.IsNil)
+	a := App{Name: "test", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.DeepEquals, &errors.ValidationError{
+		Message: fmt.Sprintf("plan %q is not available for pool \"pool1\"", s.defaultPlan.Name),
+	})
+}
+
 func (s *S) TestAppSetPoolByTeamOwner(c *check.C) {
 	opts := provision.AddPoolOptions{Name: "test"}
 	err := provision.AddPool(opts)
@@ -4058,7 +4230,7 @@ func (s *S) TestUpdateDescription(c *check.C) {
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "example", Description: "bleble"}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4074,7 +4246,7 @@ func (s *S) TestUpdateTeamOwner(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.Teams().Remove(bson.M{"_id": team.Name})
 	updateData := App{Name: "example", TeamOwner: "newowner"}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4086,7 +4258,7 @@ func (s *S) TestUpdateTeamOwnerNotExists(c *check.C) {
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "example", TeamOwner: "newowner"}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "team not found")
 	dbApp, err := GetByName(app.Name)
@@ -4109,7 +4281,7 @@ func (s *S) TestUpdatePool(c *check.C) {
 	err = CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "test", Pool: "test2"}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4126,7 +4298,7 @@ func (s *S) TestUpdatePoolNotExists(c *check.C) {
 	err = CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "test", Pool: "test2"}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.Equals, provision.ErrPoolNotFound)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4144,7 +4316,7 @@ func (s *S) TestUpdatePlan(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
 	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
 	updateData := App{Name: "my-test-app", Plan: Plan{Name: "something"}}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4162,7 +4334,7 @@ func (s *S) TestUpdatePlanNoRouteChange(c *check.C) {
 	s.provisioner.AddUnits(&a, 3, "web", nil)
 	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
 	updateData := App{Name: "my-test-app", Plan: Plan{Name: "something"}}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4189,10 +4361,103 @@ func (s *S) TestUpdatePlanNoRouteChange(c *check.C) {
 func (s *S) TestUpdatePlanNotFound(c *check.C) {
 	var app App
 	updateData := App{Name: "my-test-app", Plan: Plan{Name: "some-unknown-plan"}}
-	err := app.Update(updateData, new(bytes.Buffer))
+	err := app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.Equals, ErrPlanNotFound)
 }
 
+func (s *S) TestUpdateProcessPlans(c *check.C) {
+	plan := Plan{Name: "large", CpuShare: 100, Memory: 1073741824}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "my-test-app", Router: "fake", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	updateData := App{ProcessPlans: map[string]Plan{"worker": {Name: "large"}}}
+	err = a.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan, check.DeepEquals, s.defaultPlan)
+	c.Assert(dbApp.ProcessPlans, check.DeepEquals, map[string]Plan{"worker": plan})
+	c.Assert(dbApp.PlanForProcess("worker"), check.DeepEquals, plan)
+	c.Assert(dbApp.PlanForProcess("web"), check.DeepEquals, s.defaultPlan)
+	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 1)
+	updateData = App{ProcessPlans: map[string]Plan{"worker": {}}}
+	err = dbApp.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessPlans, check.IsNil)
+	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 2)
+}
+
+func (s *S) TestUpdateProcessPlanNotFound(c *check.C) {
+	a := App{Name: "my-test-app", Router: "fake", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	updateData := App{ProcessPlans: map[string]Plan{"worker": {Name: "some-unknown-plan"}}}
+	err = a.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.Equals, ErrPlanNotFound)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessPlans, check.IsNil)
+}
+
+func (s *S) TestUpdateKeepsPlanNotAvailableForPool(c *check.C) {
+	a := App{Name: "my-test-app", Router: "fake", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provision.SetPoolConstraint(&provision.PoolConstraint{
+		PoolExpr:  a.Pool,
+		Field:     "plan",
+		Values:    []string{s.defaultPlan.Name},
+		Blacklist: true,
+	})
+	c.Assert(err, check.IsNil)
+	updateData := App{Description: "updated description"}
+	err = a.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "updated description")
+	c.Assert(dbApp.Plan.Name, check.Equals, s.defaultPlan.Name)
+}
+
+func (s *S) TestAppChangedPlanNames(c *check.C) {
+	small := Plan{Name: "small"}
+	large := Plan{Name: "large"}
+	a := App{Pool: "pool1", Plan: small, ProcessPlans: map[string]Plan{"web": small, "worker": large}}
+	c.Assert(a.changedPlanNames("pool1", small, map[string]Plan{"web": small, "worker": large}), check.IsNil)
+	c.Assert(a.changedPlanNames("pool1", large, map[string]Plan{"web": small, "worker": large}), check.DeepEquals, []string{"small"})
+	c.Assert(a.changedPlanNames("pool1", small, map[string]Plan{"web": small}), check.DeepEquals, []string{"large"})
+	c.Assert(a.changedPlanNames("pool2", small, map[string]Plan{"web": small, "worker": large}), check.DeepEquals, []string{"small", "small", "large"})
+}
+
+func (s *S) TestUpdateProcessPlanNotAvailableForPool(c *check.C) {
+	plan := Plan{Name: "large", CpuShare: 100, Memory: 1073741824}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "my-test-app", Router: "fake", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provision.SetPoolConstraint(&provision.PoolConstraint{
+		PoolExpr:  a.Pool,
+		Field:     "plan",
+		Values:    []string{"large"},
+		Blacklist: true,
+	})
+	c.Assert(err, check.IsNil)
+	updateData := App{ProcessPlans: map[string]Plan{"worker": {Name: "large"}}}
+	err = a.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.DeepEquals, &errors.ValidationError{
+		Message: fmt.Sprintf("plan \"large\" is not available for pool %q", a.Pool),
+	})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessPlans, check.IsNil)
+}
+
 func (s *S) TestUpdateRouterBackendRemovalFailure(c *check.C) {
 	plan := Plan{Name: "something", CpuShare: 100, Memory: 268435456}
 	err := s.conn.Plans().Insert(plan)
@@ -4208,7 +4473,7 @@ func (s *S) TestUpdateRouterBackendRemovalFailure(c *check.C) {
 	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
 	routertest.FakeRouter.FailForIp("my-test-app")
 	updateData := App{Name: "my-test-app", Router: "fake-hc", Plan: Plan{Name: "something"}}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4252,7 +4517,7 @@ func (s *S) TestUpdatePlanRestartFailure(c *check.C) {
 	c.Assert(err, check.IsNil)
 	s.provisioner.PrepareFailure("Restart", fmt.Errorf("cannot restart app, I'm sorry"))
 	updateData := App{Name: "my-test-app", Router: "fake-hc", Plan: Plan{Name: "something"}}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.NotNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4283,19 +4548,55 @@ func (s *S) TestUpdateIgnoresEmptyAndDuplicatedTags(c *check.C) {
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Tags: []string{"tag2 ", "  tag3  ", "", " tag3", "  "}}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
 	c.Assert(dbApp.Tags, check.DeepEquals, []string{"tag2", "tag3"})
 }
 
+func (s *S) TestUpdateMetadata(c *check.C) {
+	app := App{Name: "example", Platform: "python", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/owner", Value: "me"}},
+	}}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&app, 1, "web", nil)
+	updateData := App{Metadata: provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "core"}, {Name: "tier", Value: "backend"}},
+	}}
+	err = app.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Metadata, check.DeepEquals, provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "team", Value: "core"}, {Name: "tier", Value: "backend"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/owner", Value: "me"}},
+	})
+	c.Assert(s.provisioner.Restarts(&app, ""), check.Equals, 1)
+}
+
+func (s *S) TestUpdateInvalidMetadata(c *check.C) {
+	app := App{Name: "example", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	updateData := App{Metadata: provision.AppMetadata{
+		Annotations: []provision.MetadataItem{{Name: "", Value: "x"}},
+	}}
+	err = app.Update(updateData, "", new(bytes.Buffer))
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	dbApp, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Metadata, check.DeepEquals, provision.AppMetadata{})
+}
+
 func (s *S) TestUpdatePlatform(c *check.C) {
 	app := App{Name: "example", Platform: "python", TeamOwner: s.team.Name, Description: "blabla"}
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{UpdatePlatform: true}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4307,7 +4608,7 @@ func (s *S) TestUpdateWithEmptyTagsRemovesAllTags(c *check.C) {
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Description: "ble", Tags: []string{}}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4319,7 +4620,7 @@ func (s *S) TestUpdateWithoutTagsKeepsOriginalTags(c *check.C) {
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Description: "ble", Tags: nil}
-	err = app.Update(updateData, new(bytes.Buffer))
+	err = app.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -4347,7 +4648,7 @@ func (s *S) TestUpdateDescriptionPoolPlanAndRouter(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
 	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
 	updateData := App{Name: "my-test-app", Router: "fake-hc", Plan: Plan{Name: "something"}, Description: "bleble", Pool: "test2"}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4379,7 +4680,7 @@ func (s *S) TestUpdateRouter(c *check.C) {
 	err := CreateApp(&a, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "my-test-app", Router: "fake-hc"}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.IsNil)
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4409,7 +4710,7 @@ func (s *S) TestUpdateRouterNotFound(c *check.C) {
 	err := CreateApp(&a, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "my-test-app", Router: "invalid-router"}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.DeepEquals, &router.ErrRouterNotFound{Name: "invalid-router"})
 	dbApp, err := GetByName(a.Name)
 	c.Assert(err, check.IsNil)
@@ -4427,7 +4728,7 @@ func (s *S) TestAppUpdateRouterNotAvailableForPool(c *check.C) {
 	err := CreateApp(&a, s.user)
 	c.Assert(err, check.IsNil)
 	updateData := App{Name: "test", Router: "fake-tls"}
-	err = a.Update(updateData, new(bytes.Buffer))
+	err = a.Update(updateData, "", new(bytes.Buffer))
 	c.Assert(err, check.DeepEquals, &errors.ValidationError{
 		Message: "router \"fake-tls\" is not available for pool \"pool1\". Available routers are: \"fake, fake-hc\"",
 	})
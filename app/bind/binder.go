@@ -13,6 +13,7 @@ type EnvVar struct {
 	Name         string `json:"name"`
 	Value        string `json:"value"`
 	Public       bool   `json:"public"`
+	Secret       bool   `json:"secret,omitempty"`
 	InstanceName string `json:"-"`
 }
 
@@ -57,12 +58,14 @@ type SetEnvApp struct {
 	Envs          []EnvVar
 	PublicOnly    bool
 	ShouldRestart bool
+	Author        string
 }
 
 type UnsetEnvApp struct {
 	VariableNames []string
 	PublicOnly    bool
 	ShouldRestart bool
+	Author        string
 }
 
 type InstanceApp struct {
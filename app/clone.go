@@ -0,0 +1,376 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/service"
+)
+
+const (
+	// CloneBindsNone doesn't bind the clone to any service instance.
+	CloneBindsNone = "none"
+	// CloneBindsSame binds the clone to the same service instances bound to
+	// the source app.
+	CloneBindsSame = "same"
+	// CloneBindsNew creates a new service instance, with the same service and
+	// plan, for each instance bound to the source app and binds the clone to
+	// it.
+	CloneBindsNew = "new"
+)
+
+var ErrCloneUnitsWithoutDeploy = errors.New("units can only be cloned when the source image is deployed")
+
+// CloneOptions holds what should be copied from the source app when cloning
+// it. CNames are never copied, as they must be unique across apps.
+type CloneOptions struct {
+	Name      string
+	TeamOwner string
+	Envs      bool
+	Binds     string
+	Units     bool
+	Deploy    bool
+	User      *auth.User
+	Writer    io.Writer
+}
+
+type clonePipelineArgs struct {
+	source  *App
+	app     *App
+	opts    CloneOptions
+	writer  io.Writer
+	bound   []service.ServiceInstance
+	created []service.ServiceInstance
+}
+
+// Clone creates a new app from source, copying its plan, pool, router, router
+// options, description, tags and team grants. Depending on opts it'll also
+// copy environment variables, service instance binds and the number of units
+// of each process, and deploy the current image of the source app. If any step
+// fails, the ones already executed are rolled back and the new app is
+// removed.
+func Clone(source *App, opts CloneOptions) (*App, error) {
+	if opts.Binds == "" {
+		opts.Binds = CloneBindsNone
+	}
+	if opts.Binds != CloneBindsNone && opts.Binds != CloneBindsSame && opts.Binds != CloneBindsNew {
+		return nil, &InvalidCloneOptionError{Message: fmt.Sprintf("invalid binds option %q, it must be one of %q, %q or %q", opts.Binds, CloneBindsNone, CloneBindsSame, CloneBindsNew)}
+	}
+	if opts.Units && !opts.Deploy {
+		return nil, ErrCloneUnitsWithoutDeploy
+	}
+	if opts.User == nil {
+		return nil, errors.New("missing user in clone options")
+	}
+	args := clonePipelineArgs{
+		source: source,
+		opts:   opts,
+		writer: opts.Writer,
+	}
+	if args.writer == nil {
+		args.writer = ioutil.Discard
+	}
+	actions := []*action.Action{
+		&createClonedApp,
+		&grantClonedTeams,
+		&copyClonedEnvs,
+		&bindClonedServices,
+		&deployClonedImage,
+		&copyClonedUnits,
+	}
+	err := action.NewPipeline(actions...).Execute(&args)
+	if err != nil {
+		return nil, err
+	}
+	return args.app, nil
+}
+
+// InvalidCloneOptionError is returned by Clone when the options are not
+// valid.
+type InvalidCloneOptionError struct {
+	Message string
+}
+
+func (e *InvalidCloneOptionError) Error() string {
+	return e.Message
+}
+
+var createClonedApp = action.Action{
+	Name: "create-cloned-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		source := args.source
+		teamOwner := args.opts.TeamOwner
+		if teamOwner == "" {
+			teamOwner = source.TeamOwner
+		}
+		newApp := App{
+			Name:        args.opts.Name,
+			Platform:    source.Platform,
+			TeamOwner:   teamOwner,
+			Plan:        Plan{Name: source.Plan.Name},
+			Pool:        source.Pool,
+			Router:      source.Router,
+			Description: source.Description,
+			Tags:        source.Tags,
+		}
+		if source.RouterOpts != nil {
+			newApp.RouterOpts = make(map[string]string, len(source.RouterOpts))
+			for k, v := range source.RouterOpts {
+				newApp.RouterOpts[k] = v
+			}
+		}
+		fmt.Fprintf(args.writer, "---- Creating app %q from %q ----\n", newApp.Name, source.Name)
+		err := CreateApp(&newApp, args.opts.User)
+		if err != nil {
+			return nil, err
+		}
+		args.app, err = GetByName(newApp.Name)
+		if err != nil {
+			return nil, err
+		}
+		return args.app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		err := Delete(args.app, nil)
+		if err != nil {
+			log.Errorf("[clone-app: %s] unable to remove cloned app: %s", args.app.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+var grantClonedTeams = action.Action{
+	Name: "grant-cloned-teams",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		for _, teamName := range args.source.Teams {
+			team, err := auth.GetTeam(teamName)
+			if err != nil {
+				return nil, err
+			}
+			err = args.app.Grant(team)
+			if err != nil && err != ErrAlreadyHaveAccess {
+				return nil, err
+			}
+		}
+		return nil, nil
+	},
+	MinParams: 1,
+}
+
+var copyClonedEnvs = action.Action{
+	Name: "copy-cloned-envs",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		if !args.opts.Envs {
+			return nil, nil
+		}
+		serviceEnvs := args.source.serviceEnvNames()
+		sourceEnvs, err := args.source.Envs()
+		if err != nil {
+			return nil, err
+		}
+		var envs []bind.EnvVar
+		for name, env := range sourceEnvs {
+			if isManagedEnv(name, env, serviceEnvs) {
+				continue
+			}
+			if _, ok := args.app.Env[name]; ok {
+				continue
+			}
+			envs = append(envs, env)
+		}
+		err = args.app.setEnvsToApp(bind.SetEnvApp{
+			Envs:   envs,
+			Author: args.opts.User.Email,
+		}, args.writer)
+		return nil, err
+	},
+	MinParams: 1,
+}
+
+// serviceEnvNames returns the names of the variables exported by the service
+// instances bound to the app, according to TSURU_SERVICES.
+func (app *App) serviceEnvNames() map[string]bool {
+	names := map[string]bool{}
+	for _, instances := range app.parsedTsuruServices() {
+		for _, instance := range instances {
+			for name := range instance.Envs {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+var bindClonedServices = action.Action{
+	Name: "bind-cloned-services",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		if args.opts.Binds == CloneBindsNone {
+			return nil, nil
+		}
+		err := args.bindServices()
+		if err != nil {
+			args.unbindServices()
+			return nil, err
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		args.unbindServices()
+	},
+	MinParams: 1,
+}
+
+func (args *clonePipelineArgs) bindServices() error {
+	instances, err := args.source.serviceInstances()
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if args.opts.Binds == CloneBindsNew {
+			newInstance := service.ServiceInstance{
+				Name:        fmt.Sprintf("%s-%s", instance.Name, args.app.Name),
+				PlanName:    instance.PlanName,
+				TeamOwner:   args.app.TeamOwner,
+				Description: instance.Description,
+				Tags:        instance.Tags,
+			}
+			err = service.CreateServiceInstance(newInstance, instance.Service(), args.opts.User, "")
+			if err != nil {
+				return errors.Wrapf(err, "unable to create service instance %q", newInstance.Name)
+			}
+			created, err := service.GetServiceInstance(instance.ServiceName, newInstance.Name)
+			if err != nil {
+				return err
+			}
+			args.created = append(args.created, *created)
+			instance = *created
+		}
+		err = instance.BindApp(args.app, false, args.writer)
+		if err != nil {
+			return errors.Wrapf(err, "unable to bind service instance %q", instance.Name)
+		}
+		args.bound = append(args.bound, instance)
+	}
+	return nil
+}
+
+func (args *clonePipelineArgs) unbindServices() {
+	for i := range args.bound {
+		err := args.bound[i].UnbindApp(args.app, false, nil)
+		if err != nil {
+			log.Errorf("[clone-app: %s] unable to unbind service instance %q: %s", args.app.Name, args.bound[i].Name, err)
+		}
+	}
+	args.bound = nil
+	for _, instance := range args.created {
+		si, err := service.GetServiceInstance(instance.ServiceName, instance.Name)
+		if err == nil {
+			err = service.DeleteInstance(si, "")
+		}
+		if err != nil {
+			log.Errorf("[clone-app: %s] unable to remove service instance %q: %s", args.app.Name, instance.Name, err)
+		}
+	}
+	args.created = nil
+}
+
+var deployClonedImage = action.Action{
+	Name: "deploy-cloned-image",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		if !args.opts.Deploy {
+			return nil, nil
+		}
+		img, err := image.AppCurrentImageName(args.source.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find the current image of app %q", args.source.Name)
+		}
+		opts := DeployOptions{
+			App:          args.app,
+			Image:        img,
+			OutputStream: args.writer,
+			User:         args.opts.User.Email,
+			Origin:       "image",
+		}
+		opts.GetKind()
+		evt, err := event.New(&event.Opts{
+			Target:     event.Target{Type: event.TargetTypeApp, Value: args.app.Name},
+			Kind:       permission.PermAppDeploy,
+			RawOwner:   event.Owner{Type: event.OwnerTypeUser, Name: args.opts.User.Email},
+			CustomData: opts,
+			Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, args.app.Teams),
+				permission.Context(permission.CtxApp, args.app.Name),
+				permission.Context(permission.CtxPool, args.app.Pool),
+			)...),
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts.Event = evt
+		imageID, err := Deploy(opts)
+		evt.DoneCustomData(err, map[string]string{"image": imageID})
+		return nil, err
+	},
+	MinParams: 1,
+}
+
+var copyClonedUnits = action.Action{
+	Name: "copy-cloned-units",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*clonePipelineArgs)
+		if !args.opts.Units {
+			return nil, nil
+		}
+		wanted, err := unitsByProcess(args.source)
+		if err != nil {
+			return nil, err
+		}
+		current, err := unitsByProcess(args.app)
+		if err != nil {
+			return nil, err
+		}
+		for process, n := range wanted {
+			if n > current[process] {
+				err = args.app.AddUnits(uint(n-current[process]), process, args.writer)
+			} else if n < current[process] {
+				err = args.app.RemoveUnits(uint(current[process]-n), process, args.writer)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	},
+	MinParams: 1,
+}
+
+func unitsByProcess(app *App) (map[string]int, error) {
+	units, err := app.Units()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]int{}
+	for _, u := range units {
+		result[u.ProcessName]++
+	}
+	return result, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) createCloneSource(c *check.C) *App {
+	a := App{Name: "source", Platform: "python", TeamOwner: s.team.Name, Description: "my app", Tags: []string{"tag1"}}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	source, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = source.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	otherTeam := auth.Team{Name: "other-team"}
+	err = s.conn.Teams().Insert(otherTeam)
+	c.Assert(err, check.IsNil)
+	err = source.Grant(&otherTeam)
+	c.Assert(err, check.IsNil)
+	return source
+}
+
+func (s *S) TestClone(c *check.C) {
+	source := s.createCloneSource(c)
+	s.provisioner.AddUnits(source, 2, "web", nil)
+	s.provisioner.AddUnits(source, 1, "worker", nil)
+	err := image.AppendAppImageName(source.Name, "registry.tsuru.io/tsuru/app-source:v1")
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	cloned, err := Clone(source, CloneOptions{
+		Name:   "cloned",
+		Envs:   true,
+		Units:  true,
+		Deploy: true,
+		User:   s.user,
+		Writer: &buf,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(cloned.Name, check.Equals, "cloned")
+	dbApp, err := GetByName("cloned")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan, check.DeepEquals, source.Plan)
+	c.Assert(dbApp.Pool, check.Equals, source.Pool)
+	c.Assert(dbApp.Router, check.Equals, source.Router)
+	c.Assert(dbApp.Description, check.Equals, "my app")
+	c.Assert(dbApp.Tags, check.DeepEquals, []string{"tag1"})
+	c.Assert(dbApp.Teams, check.DeepEquals, []string{s.team.Name, "other-team"})
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.Env["TSURU_APPNAME"].Value, check.Equals, "cloned")
+	c.Assert(dbApp.Env["TSURU_APP_TOKEN"].Value, check.Not(check.Equals), source.Env["TSURU_APP_TOKEN"].Value)
+	units, err := unitsByProcess(dbApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.DeepEquals, map[string]int{"web": 2, "worker": 1})
+	c.Assert(buf.String(), check.Matches, `(?s)---- Creating app "cloned" from "source" ----.*Builder deploy called.*`)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "cloned"},
+		Owner:  s.user.Email,
+		Kind:   "app.deploy",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestCloneWithoutEnvs(c *check.C) {
+	source := s.createCloneSource(c)
+	_, err := Clone(source, CloneOptions{Name: "cloned", User: s.user})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName("cloned")
+	c.Assert(err, check.IsNil)
+	_, ok := dbApp.Env["DATABASE_HOST"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestCloneEnvsSkipsServiceEnvs(c *check.C) {
+	source := s.createCloneSource(c)
+	err := source.AddInstance(bind.InstanceApp{
+		ServiceName: "mysql",
+		Instance: bind.ServiceInstance{
+			Name: "mydb",
+			Envs: map[string]string{"DATABASE_PASSWORD": "s3cr3t"},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	source, err = GetByName(source.Name)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": source.Name}, bson.M{"$set": bson.M{"env.DATABASE_PASSWORD.instancename": ""}})
+	c.Assert(err, check.IsNil)
+	source, err = GetByName(source.Name)
+	c.Assert(err, check.IsNil)
+	_, err = Clone(source, CloneOptions{Name: "cloned", Envs: true, User: s.user})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName("cloned")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	_, ok := dbApp.Env["DATABASE_PASSWORD"]
+	c.Assert(ok, check.Equals, false)
+	_, ok = dbApp.Env[TsuruServicesEnvVar]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestCloneBindSameInstances(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer server.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": server.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	source := s.createCloneSource(c)
+	instance := service.ServiceInstance{Name: "mydb", ServiceName: "mysql", Teams: []string{s.team.Name}, Apps: []string{source.Name}}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	_, err = Clone(source, CloneOptions{Name: "cloned", Binds: CloneBindsSame, User: s.user})
+	c.Assert(err, check.IsNil)
+	si, err := service.GetServiceInstance("mysql", "mydb")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Apps, check.DeepEquals, []string{source.Name, "cloned"})
+	dbApp, err := GetByName("cloned")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_USER"].InstanceName, check.Equals, "mydb")
+}
+
+func (s *S) TestCloneBindNewInstances(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": server.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	source := s.createCloneSource(c)
+	instance := service.ServiceInstance{Name: "mydb", ServiceName: "mysql", PlanName: "small", Teams: []string{s.team.Name}, Apps: []string{source.Name}}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	_, err = Clone(source, CloneOptions{Name: "cloned", Binds: CloneBindsNew, User: s.user})
+	c.Assert(err, check.IsNil)
+	si, err := service.GetServiceInstance("mysql", "mydb-cloned")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.PlanName, check.Equals, "small")
+	c.Assert(si.Apps, check.DeepEquals, []string{"cloned"})
+	si, err = service.GetServiceInstance("mysql", "mydb")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Apps, check.DeepEquals, []string{source.Name})
+}
+
+func (s *S) TestCloneRollbackOnFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": server.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	source := s.createCloneSource(c)
+	instance := service.ServiceInstance{Name: "mydb", ServiceName: "mysql", Teams: []string{s.team.Name}, Apps: []string{source.Name}}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(source.Name, "registry.tsuru.io/tsuru/app-source:v1")
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("Deploy", errors.New("deploy failed"))
+	_, err = Clone(source, CloneOptions{Name: "cloned", Binds: CloneBindsNew, Deploy: true, User: s.user})
+	c.Assert(err, check.ErrorMatches, "deploy failed")
+	_, err = GetByName("cloned")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+	count, err := s.conn.ServiceInstances().Find(bson.M{"name": "mydb-cloned"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+}
+
+func (s *S) TestCloneInvalidOptions(c *check.C) {
+	source := s.createCloneSource(c)
+	_, err := Clone(source, CloneOptions{Name: "cloned", Binds: "other", User: s.user})
+	c.Assert(err, check.FitsTypeOf, &InvalidCloneOptionError{})
+	_, err = Clone(source, CloneOptions{Name: "cloned", Units: true, User: s.user})
+	c.Assert(err, check.Equals, ErrCloneUnitsWithoutDeploy)
+	_, err = GetByName("cloned")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestCloneExistingName(c *check.C) {
+	source := s.createCloneSource(c)
+	_, err := Clone(source, CloneOptions{Name: source.Name, User: s.user})
+	c.Assert(err, check.FitsTypeOf, &AppCreationError{})
+}
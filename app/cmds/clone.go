@@ -0,0 +1,95 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+func init() {
+	cmd.RegisterExtraCmd(&appClone{})
+}
+
+type appClone struct {
+	cmd.GuessingCommand
+	fs        *gnuflag.FlagSet
+	teamOwner string
+	binds     string
+	noEnvs    bool
+	units     bool
+	deploy    bool
+}
+
+func (c *appClone) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-clone",
+		Usage: "app-clone <new-app-name> [-a/--app appname] [-t/--team-owner team] [--no-envs] [--binds none|same|new] [--units] [--deploy]",
+		Desc: `Creates a new app from an existing one, copying its platform, plan, pool,
+router, router options, description, tags, team grants and environment
+variables. CNames are not copied.
+
+The --binds flag controls what is done with service instances bound to the
+source app: "none" (the default) skips them, "same" binds the new app to the
+same instances and "new" creates a new instance, of the same service and plan,
+for each of them.
+
+The --deploy flag deploys the image currently running in the source app to the
+new app, and --units, which requires --deploy, also copies the number of units
+of each process.
+
+If any step fails, the new app is removed.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *appClone) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		desc := "Team owner of the new app, defaults to the team owner of the source app."
+		c.fs.StringVar(&c.teamOwner, "team-owner", "", desc)
+		c.fs.StringVar(&c.teamOwner, "t", "", desc)
+		c.fs.StringVar(&c.binds, "binds", "none", `What to do with service instance binds: "none", "same" or "new".`)
+		c.fs.BoolVar(&c.noEnvs, "no-envs", false, "Don't copy environment variables.")
+		c.fs.BoolVar(&c.units, "units", false, "Copy the number of units of each process.")
+		c.fs.BoolVar(&c.deploy, "deploy", false, "Deploy the current image of the source app.")
+	}
+	return c.fs
+}
+
+func (c *appClone) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/apps/%s/clone", appName))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("name", context.Args[0])
+	v.Set("teamOwner", c.teamOwner)
+	v.Set("binds", c.binds)
+	v.Set("envs", strconv.FormatBool(!c.noEnvs))
+	v.Set("units", strconv.FormatBool(c.units))
+	v.Set("deploy", strconv.FormatBool(c.deploy))
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(context.Stdout, response)
+}
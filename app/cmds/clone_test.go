@@ -0,0 +1,77 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(&S{})
+
+type S struct{}
+
+func (s *S) SetUpSuite(c *check.C) {
+	os.Setenv("TSURU_TARGET", "http://localhost")
+}
+
+func (s *S) TestAppCloneRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"cloned"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	msg := tsuruIo.SimpleJsonMessage{Message: "app cloned"}
+	result, _ := json.Marshal(msg)
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			err := req.ParseForm()
+			c.Assert(err, check.IsNil)
+			c.Assert(req.Form, check.DeepEquals, url.Values{
+				"name":      []string{"cloned"},
+				"teamOwner": []string{""},
+				"binds":     []string{"new"},
+				"envs":      []string{"false"},
+				"units":     []string{"true"},
+				"deploy":    []string{"true"},
+			})
+			return req.URL.Path == "/1.3/apps/source/clone" && req.Method == "POST"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := appClone{}
+	err := command.Flags().Parse(true, []string{"-a", "source", "--binds", "new", "--no-envs", "--units", "--deploy"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "app cloned")
+}
+
+func (s *S) TestAppCloneFlags(c *check.C) {
+	command := appClone{}
+	flagset := command.Flags()
+	c.Assert(flagset.Lookup("app"), check.NotNil)
+	c.Assert(flagset.Lookup("team-owner"), check.NotNil)
+	c.Assert(flagset.Lookup("t"), check.NotNil)
+	flag := flagset.Lookup("binds")
+	c.Assert(flag, check.NotNil)
+	c.Assert(flag.DefValue, check.Equals, "none")
+}
@@ -0,0 +1,264 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+// logEntry is the subset of the app log fields shown by app-log-search.
+type logEntry struct {
+	Date    time.Time
+	Message string
+	Source  string
+	Unit    string
+	Fields  map[string]string
+}
+
+var (
+	logLevelFields   = []string{"level", "severity", "lvl"}
+	logMessageFields = []string{"msg", "message"}
+	logLevelColors   = map[string]string{
+		"panic":    "red",
+		"fatal":    "red",
+		"critical": "red",
+		"error":    "red",
+		"warn":     "yellow",
+		"warning":  "yellow",
+	}
+)
+
+// now is used to resolve relative times in --since and --until.
+var now = time.Now
+
+func init() {
+	cmd.RegisterExtraCmd(&appLogSearch{})
+}
+
+type appLogSearch struct {
+	cmd.GuessingCommand
+	fs      *gnuflag.FlagSet
+	lines   int
+	sources []string
+	units   []string
+	since   string
+	until   string
+	message string
+	regex   bool
+	before  string
+	after   string
+	fields  cmd.MapFlag
+	pretty  bool
+}
+
+func (c *appLogSearch) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-log-search",
+		Usage: "app-log-search [-a/--app appname] [-l/--lines numberOfLines] [-s/--source source]... [-u/--unit unit]... [--since time] [--until time] [-m/--message text] [--regex] [-f/--field name=value]... [--pretty] [--before cursor|--after cursor]",
+		Desc: `Searches the logs of an app.
+
+The --since and --until flags accept either a time in RFC3339 format, like
+2017-06-16T15:00:00Z, or a duration relative to the current time, like 90m or
+24h. The --source and --unit flags may be used multiple times, selecting logs
+from any of the given sources and units.
+
+Logs whose message contain the text given in --message are shown. With --regex,
+the text is used as a regular expression the message must match instead.
+Message searches cover at most 24 hours, ending at --until, or now when --until
+is not given.
+
+Apps using the json log format have their JSON messages parsed into fields,
+which can be filtered with --field, like --field level=error. The --pretty flag
+shows these logs with the level and the message first, followed by the other
+fields.
+
+At most --lines entries are shown, the newest ones matching the search. The
+cursors printed after the logs can be used with --before to see older entries
+and with --after to see newer ones.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *appLogSearch) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		desc := "The number of log lines to display."
+		c.fs.IntVar(&c.lines, "lines", 10, desc)
+		c.fs.IntVar(&c.lines, "l", 10, desc)
+		desc = "Show only logs from the given source. May be used multiple times."
+		c.fs.Var(cmd.StringSliceFlagWrapper{Dst: &c.sources}, "source", desc)
+		c.fs.Var(cmd.StringSliceFlagWrapper{Dst: &c.sources}, "s", desc)
+		desc = "Show only logs from the given unit. May be used multiple times."
+		c.fs.Var(cmd.StringSliceFlagWrapper{Dst: &c.units}, "unit", desc)
+		c.fs.Var(cmd.StringSliceFlagWrapper{Dst: &c.units}, "u", desc)
+		c.fs.StringVar(&c.since, "since", "", "Show only logs at or after the given time.")
+		c.fs.StringVar(&c.until, "until", "", "Show only logs at or before the given time.")
+		desc = "Show only logs whose message contain the given text."
+		c.fs.StringVar(&c.message, "message", "", desc)
+		c.fs.StringVar(&c.message, "m", "", desc)
+		c.fs.BoolVar(&c.regex, "regex", false, "Use the message as a regular expression.")
+		desc = "Show only logs having the given field, in the format name=value. May be used multiple times."
+		c.fs.Var(&c.fields, "field", desc)
+		c.fs.Var(&c.fields, "f", desc)
+		c.fs.BoolVar(&c.pretty, "pretty", false, "Pretty print the fields of structured logs.")
+		c.fs.StringVar(&c.before, "before", "", "Show logs older than the given cursor.")
+		c.fs.StringVar(&c.after, "after", "", "Show logs newer than the given cursor.")
+	}
+	return c.fs
+}
+
+func (c *appLogSearch) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("lines", strconv.Itoa(c.lines))
+	for _, s := range c.sources {
+		v.Add("source", s)
+	}
+	for _, u := range c.units {
+		v.Add("unit", u)
+	}
+	for name, value := range map[string]string{"since": c.since, "until": c.until} {
+		if value == "" {
+			continue
+		}
+		var t time.Time
+		t, err = parseLogTime(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --%s", name)
+		}
+		v.Set(name, t.Format(time.RFC3339))
+	}
+	fieldNames := make([]string, 0, len(c.fields))
+	for name := range c.fields {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+	for _, name := range fieldNames {
+		v.Add("field", name+"="+c.fields[name])
+	}
+	if c.message != "" {
+		v.Set("message", c.message)
+		v.Set("regex", strconv.FormatBool(c.regex))
+	}
+	if c.before != "" {
+		v.Set("before", c.before)
+	}
+	if c.after != "" {
+		v.Set("after", c.after)
+	}
+	u, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/apps/%s/log?%s", appName, v.Encode()))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var logs []logEntry
+		err = decoder.Decode(&logs)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, l := range logs {
+			msg := l.Message
+			if c.pretty && len(l.Fields) > 0 {
+				msg = prettyLogMessage(l.Fields)
+			}
+			date := l.Date.In(now().Location()).Format("2006-01-02 15:04:05 -0700")
+			fmt.Fprintf(context.Stdout, "%s [%s][%s]: %s\n", date, l.Source, l.Unit, msg)
+		}
+	}
+	prev := response.Header.Get("X-Tsuru-Log-Prev")
+	next := response.Header.Get("X-Tsuru-Log-Next")
+	if prev != "" || next != "" {
+		fmt.Fprintln(context.Stdout)
+	}
+	if prev != "" {
+		fmt.Fprintf(context.Stdout, "Older logs: --before %s\n", prev)
+	}
+	if next != "" {
+		fmt.Fprintf(context.Stdout, "Newer logs: --after %s\n", next)
+	}
+	return nil
+}
+
+// parseLogTime parses either a RFC3339 time or a duration, which is
+// subtracted from the current time.
+func parseLogTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// prettyLogMessage renders the fields of a structured log entry as the
+// level, colored when it indicates a problem, and the message, followed by the
+// remaining fields in the name=value format, sorted by name.
+func prettyLogMessage(fields map[string]string) string {
+	remaining := make(map[string]string, len(fields))
+	for k, v := range fields {
+		remaining[k] = v
+	}
+	var parts []string
+	if name, level := firstLogField(remaining, logLevelFields); name != "" {
+		delete(remaining, name)
+		level = strings.ToUpper(level)
+		if color, ok := logLevelColors[strings.ToLower(level)]; ok {
+			level = cmd.Colorfy(level, color, "", "bold")
+		}
+		parts = append(parts, level)
+	}
+	if name, msg := firstLogField(remaining, logMessageFields); name != "" {
+		delete(remaining, name)
+		parts = append(parts, msg)
+	}
+	names := make([]string, 0, len(remaining))
+	for name := range remaining {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := remaining[name]
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func firstLogField(fields map[string]string, names []string) (string, string) {
+	for _, name := range names {
+		if value, ok := fields[name]; ok {
+			return name, value
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmds
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppLogSearchRun(c *check.C) {
+	current := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `[{"Date":"2017-06-16T14:10:00Z","Message":"GET / 500","Source":"web","AppName":"myapp","Unit":"u1"},` +
+		`{"Date":"2017-06-16T14:20:00Z","Message":"GET /x 500","Source":"worker","AppName":"myapp","Unit":"u2"}]` + "\n"
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{
+			Message: result,
+			Status:  http.StatusOK,
+			Headers: map[string][]string{
+				"X-Tsuru-Log-Prev": {"prevcursor"},
+				"X-Tsuru-Log-Next": {"nextcursor"},
+			},
+		},
+		CondFunc: func(req *http.Request) bool {
+			c.Assert(req.URL.Query(), check.DeepEquals, url.Values{
+				"lines":   {"5"},
+				"source":  {"web", "worker"},
+				"unit":    {"u1"},
+				"since":   {"2017-06-16T14:00:00Z"},
+				"until":   {"2017-06-16T14:30:00Z"},
+				"message": {"500$"},
+				"regex":   {"true"},
+				"before":  {"cursor"},
+			})
+			return req.URL.Path == "/1.3/apps/myapp/log" && req.Method == "GET"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := appLogSearch{}
+	err := command.Flags().Parse(true, []string{
+		"-a", "myapp", "-l", "5", "-s", "web", "--source", "worker", "-u", "u1",
+		"--since", "1h", "--until", "2017-06-16T14:30:00Z", "-m", "500$", "--regex",
+		"--before", "cursor",
+	})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, `2017-06-16 14:10:00 +0000 [web][u1]: GET / 500
+2017-06-16 14:20:00 +0000 [worker][u2]: GET /x 500
+
+Older logs: --before prevcursor
+Newer logs: --after nextcursor
+`)
+}
+
+func (s *S) TestAppLogSearchRunInvalidTime(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := appLogSearch{}
+	err := command.Flags().Parse(true, []string{"-a", "myapp", "--since", "yesterday"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, `invalid --since: .*`)
+}
+
+func (s *S) TestAppLogSearchRunFieldsPretty(c *check.C) {
+	os.Setenv("TSURU_DISABLE_COLORS", "1")
+	defer os.Unsetenv("TSURU_DISABLE_COLORS")
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `[{"Date":"2017-06-16T14:10:00Z","Message":"{}","Source":"web","AppName":"myapp","Unit":"u1",` +
+		`"Fields":{"level":"error","msg":"request failed","status":"500","path":"/a b"}},` +
+		`{"Date":"2017-06-16T14:20:00Z","Message":"plain","Source":"web","AppName":"myapp","Unit":"u1"}]` + "\n"
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			c.Assert(req.URL.Query(), check.DeepEquals, url.Values{
+				"lines": {"10"},
+				"field": {"level=error", "status=500"},
+			})
+			return req.URL.Path == "/1.3/apps/myapp/log" && req.Method == "GET"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := appLogSearch{}
+	err := command.Flags().Parse(true, []string{"-a", "myapp", "--field", "status=500", "-f", "level=error", "--pretty"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, `2017-06-16 14:10:00 +0000 [web][u1]: ERROR request failed path="/a b" status=500
+2017-06-16 14:20:00 +0000 [web][u1]: plain
+`)
+}
+
+func (s *S) TestPrettyLogMessage(c *check.C) {
+	os.Setenv("TSURU_DISABLE_COLORS", "1")
+	defer os.Unsetenv("TSURU_DISABLE_COLORS")
+	c.Assert(prettyLogMessage(map[string]string{"severity": "info", "message": "ok"}), check.Equals, "INFO ok")
+	c.Assert(prettyLogMessage(map[string]string{"a": "", "b": "x=y"}), check.Equals, `a="" b="x=y"`)
+}
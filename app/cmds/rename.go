@@ -0,0 +1,59 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+)
+
+func init() {
+	cmd.RegisterExtraCmd(&appRename{})
+}
+
+type appRename struct {
+	cmd.GuessingCommand
+}
+
+func (c *appRename) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-rename",
+		Usage: "app-rename <new-app-name> [-a/--app appname]",
+		Desc: `Renames an app. The router backend, repository, images, units, service
+instance binds, logs and events of the app are moved to the new name. The units
+are recreated under the new name before the old ones are removed.
+
+If any step fails, the app is left with its old name.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *appRename) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/apps/%s/rename", appName))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("name", context.Args[0])
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(context.Stdout, response)
+}
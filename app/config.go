@@ -0,0 +1,349 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeRemoved = "removed"
+	ConfigChangeUpdated = "updated"
+
+	secretValueMask = "*****"
+)
+
+var ErrConfigRevisionNotFound = errors.New("config revision not found")
+
+// ConfigRevision is an immutable snapshot of the configuration of an app,
+// created every time its environment variables, plan or router options
+// change. Changes lists what changed since the previous revision.
+type ConfigRevision struct {
+	ID         bson.ObjectId `bson:"_id"`
+	App        string
+	Version    int
+	Author     string
+	Reason     string
+	Timestamp  time.Time
+	Env        map[string]bind.EnvVar
+	Plan       Plan
+	RouterOpts map[string]string
+	Changes    []ConfigChange
+}
+
+// ConfigChange describes a single change between two configuration
+// revisions. Values of secret environment variables are never included.
+type ConfigChange struct {
+	Action string
+	Kind   string
+	Name   string
+	Old    string `json:",omitempty"`
+	New    string `json:",omitempty"`
+}
+
+type appConfig struct {
+	Env        map[string]bind.EnvVar
+	Plan       Plan
+	RouterOpts map[string]string
+}
+
+func (c *appConfig) isEmpty() bool {
+	return len(c.Env) == 0 && c.Plan == Plan{} && len(c.RouterOpts) == 0
+}
+
+func (app *App) configSnapshot() appConfig {
+	cfg := appConfig{Plan: app.Plan}
+	if app.Env != nil {
+		cfg.Env = make(map[string]bind.EnvVar, len(app.Env))
+		for k, v := range app.Env {
+			cfg.Env[k] = v
+		}
+	}
+	if app.RouterOpts != nil {
+		cfg.RouterOpts = make(map[string]string, len(app.RouterOpts))
+		for k, v := range app.RouterOpts {
+			cfg.RouterOpts[k] = v
+		}
+	}
+	return cfg
+}
+
+func (r *ConfigRevision) config() appConfig {
+	return appConfig{Env: r.Env, Plan: r.Plan, RouterOpts: r.RouterOpts}
+}
+
+func envDisplayValue(env bind.EnvVar) string {
+	if env.Secret {
+		return secretValueMask
+	}
+	return env.Value
+}
+
+func diffConfig(old, new appConfig) []ConfigChange {
+	var changes []ConfigChange
+	for name, env := range new.Env {
+		oldEnv, ok := old.Env[name]
+		if !ok {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "env", Name: name, New: envDisplayValue(env)})
+		} else if oldEnv != env {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "env", Name: name, Old: envDisplayValue(oldEnv), New: envDisplayValue(env)})
+		}
+	}
+	for name, env := range old.Env {
+		if _, ok := new.Env[name]; !ok {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "env", Name: name, Old: envDisplayValue(env)})
+		}
+	}
+	if old.Plan != new.Plan {
+		changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "plan", Name: "plan", Old: old.Plan.Name, New: new.Plan.Name})
+	}
+	for name, value := range new.RouterOpts {
+		oldValue, ok := old.RouterOpts[name]
+		if !ok {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "router-opts", Name: name, New: value})
+		} else if oldValue != value {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "router-opts", Name: name, Old: oldValue, New: value})
+		}
+	}
+	for name, value := range old.RouterOpts {
+		if _, ok := new.RouterOpts[name]; !ok {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "router-opts", Name: name, Old: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// recordConfigRevision stores a new configuration revision if the current
+// configuration differs from prev. The first time the configuration of an
+// existing app changes, prev is also stored as a revision, so it's possible
+// to roll back to it.
+func (app *App) recordConfigRevision(prev appConfig, author, reason string) error {
+	current := app.configSnapshot()
+	changes := diffConfig(prev, current)
+	if len(changes) == 0 {
+		return nil
+	}
+	if app.ConfigVersion == 0 && !prev.isEmpty() {
+		err := app.insertConfigRevision(prev, diffConfig(appConfig{}, prev), "", "initial configuration")
+		if err != nil {
+			return err
+		}
+	}
+	return app.insertConfigRevision(current, changes, author, reason)
+}
+
+func (app *App) insertConfigRevision(cfg appConfig, changes []ConfigChange, author, reason string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var result struct{ ConfigVersion int }
+	_, err = conn.Apps().Find(bson.M{"name": app.Name}).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"configversion": 1}},
+		ReturnNew: true,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	app.ConfigVersion = result.ConfigVersion
+	return conn.AppConfigRevisions().Insert(ConfigRevision{
+		ID:         bson.NewObjectId(),
+		App:        app.Name,
+		Version:    result.ConfigVersion,
+		Author:     author,
+		Reason:     reason,
+		Timestamp:  time.Now().UTC(),
+		Env:        cfg.Env,
+		Plan:       cfg.Plan,
+		RouterOpts: cfg.RouterOpts,
+		Changes:    changes,
+	})
+}
+
+func (app *App) logConfigRevisionError(err error) {
+	if err != nil {
+		log.Errorf("unable to record config revision for app %s: %s", app.Name, err)
+	}
+}
+
+// ListConfigRevisions returns the configuration revisions of the app, newest
+// first.
+func ListConfigRevisions(appName string) ([]ConfigRevision, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var revisions []ConfigRevision
+	err = conn.AppConfigRevisions().Find(bson.M{"app": appName}).Sort("-version").All(&revisions)
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func GetConfigRevision(appName string, version int) (*ConfigRevision, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var revision ConfigRevision
+	err = conn.AppConfigRevisions().Find(bson.M{"app": appName, "version": version}).One(&revision)
+	if err == mgo.ErrNotFound {
+		return nil, ErrConfigRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// DiffConfigRevisions returns the changes needed to go from one configuration
+// revision to another.
+func DiffConfigRevisions(appName string, from, to int) ([]ConfigChange, error) {
+	fromRevision, err := GetConfigRevision(appName, from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := GetConfigRevision(appName, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffConfig(fromRevision.config(), toRevision.config()), nil
+}
+
+// ErrConfigChanged is returned by RollbackConfig when the configuration of the
+// app changes while it's being rolled back.
+var ErrConfigChanged = errors.New("app configuration changed during the rollback, please try again")
+
+// isManagedEnv returns whether the env is managed by tsuru or by a service
+// bind, instead of being set by users. These envs are never restored from a
+// configuration revision.
+func isManagedEnv(name string, env bind.EnvVar, serviceEnvs map[string]bool) bool {
+	return env.InstanceName != "" || serviceEnvs[name] || strings.HasPrefix(name, "TSURU_")
+}
+
+// rollbackEnvs returns the envs of the app with the user envs replaced by the
+// ones in cfg, keeping the private envs and the envs of service binds.
+func (app *App) rollbackEnvs(cfg appConfig) map[string]bind.EnvVar {
+	serviceEnvs := app.serviceEnvNames()
+	envs := make(map[string]bind.EnvVar, len(cfg.Env))
+	for name, env := range app.Env {
+		if isManagedEnv(name, env, serviceEnvs) {
+			envs[name] = env
+		}
+	}
+	for name, env := range cfg.Env {
+		if _, ok := envs[name]; !ok && !isManagedEnv(name, env, serviceEnvs) {
+			envs[name] = env
+		}
+	}
+	return envs
+}
+
+// RollbackConfig restores the user envs and the plan stored in the given
+// revision, creating a new revision, and restarts the app. The private envs
+// and the envs of service binds are kept as they are. Router options can't be
+// updated in existing router backends, so revisions with different router
+// options are rejected.
+func (app *App) RollbackConfig(version int, author string, w io.Writer) (err error) {
+	revision, err := GetConfigRevision(app.Name, version)
+	if err != nil {
+		return err
+	}
+	cfg := revision.config()
+	if !reflect.DeepEqual(cfg.RouterOpts, app.RouterOpts) && (len(cfg.RouterOpts) > 0 || len(app.RouterOpts) > 0) {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("router options of version %d differ from the current ones and can't be rolled back", version)}
+	}
+	prev := app.configSnapshot()
+	update := bson.M{}
+	envs := app.rollbackEnvs(cfg)
+	if !reflect.DeepEqual(envs, app.Env) {
+		update["env"] = envs
+	}
+	oldPlan := app.Plan
+	if cfg.Plan != oldPlan {
+		app.Plan = cfg.Plan
+		defer func() {
+			if err != nil {
+				app.Plan = oldPlan
+			}
+		}()
+		var pool *provision.Pool
+		pool, err = provision.GetPoolByName(app.Pool)
+		if err != nil {
+			return err
+		}
+		err = app.validatePlans(pool, []string{app.Plan.Name})
+		if err != nil {
+			return err
+		}
+		err = app.reserveTeamAllocationChange(app.TeamOwner, oldPlan, app.ProcessPlans)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				app.revertTeamAllocationChange(app.TeamOwner, oldPlan, app.ProcessPlans)
+			}
+		}()
+		update["plan"] = app.Plan
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name, "configversion": app.ConfigVersion}, bson.M{"$set": update})
+	if err == mgo.ErrNotFound {
+		return ErrConfigChanged
+	}
+	if err != nil {
+		return err
+	}
+	app.Env = envs
+	err = app.recordConfigRevision(prev, author, fmt.Sprintf("rollback to version %d", version))
+	if err != nil {
+		return err
+	}
+	if w != nil {
+		fmt.Fprintf(w, "---- Configuration rolled back to version %d ----\n", version)
+	}
+	units, err := app.GetUnits()
+	if err != nil || len(units) == 0 {
+		return err
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	return prov.Restart(app, "", w)
+}
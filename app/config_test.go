@@ -0,0 +1,242 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/bind"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) createConfigRevisionsApp(c *check.C) *App {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ConfigVersion, check.Equals, 2)
+	return dbApp
+}
+
+func (s *S) TestSetEnvsRecordsConfigRevision(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	err := a.setEnvsToApp(bind.SetEnvApp{
+		Envs:   []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+		Author: "me@tsuru.io",
+	}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.ConfigVersion, check.Equals, 3)
+	revisions, err := ListConfigRevisions(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 3)
+	c.Assert(revisions[0].Version, check.Equals, 3)
+	c.Assert(revisions[0].Author, check.Equals, "me@tsuru.io")
+	c.Assert(revisions[0].Reason, check.Equals, "env set")
+	c.Assert(revisions[0].Changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeAdded, Kind: "env", Name: "DATABASE_HOST", New: "localhost"},
+	})
+	c.Assert(revisions[0].Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(revisions[1].Version, check.Equals, 2)
+	c.Assert(revisions[1].Reason, check.Equals, "env set")
+	c.Assert(revisions[2].Version, check.Equals, 1)
+	c.Assert(revisions[2].Reason, check.Equals, "initial configuration")
+	c.Assert(revisions[2].Env, check.HasLen, 0)
+	c.Assert(revisions[2].Plan, check.DeepEquals, s.defaultPlan)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ConfigVersion, check.Equals, 3)
+}
+
+func (s *S) TestSetEnvsNoChangesDoesNotRecordConfigRevision(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	envs := bind.SetEnvApp{Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}}}
+	err := a.setEnvsToApp(envs, nil)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(envs, nil)
+	c.Assert(err, check.IsNil)
+	revisions, err := ListConfigRevisions(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 3)
+}
+
+func (s *S) TestConfigRevisionMasksSecretChanges(c *check.C) {
+	setSecretKeys()
+	defer config.Unset("secrets")
+	a := s.createConfigRevisionsApp(c)
+	err := a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_PASSWORD", Value: "123", Secret: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	revision, err := GetConfigRevision(a.Name, a.ConfigVersion)
+	c.Assert(err, check.IsNil)
+	c.Assert(revision.Changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeAdded, Kind: "env", Name: "DATABASE_PASSWORD", New: "*****"},
+	})
+	c.Assert(revision.Env["DATABASE_PASSWORD"].Value, check.Not(check.Equals), "123")
+}
+
+func (s *S) TestUnsetEnvsAndUpdateRecordConfigRevision(c *check.C) {
+	plan := Plan{Name: "something", CpuShare: 100, Memory: 268435456}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := s.createConfigRevisionsApp(c)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.unsetEnvsToApp(bind.UnsetEnvApp{VariableNames: []string{"DATABASE_HOST"}, Author: "me@tsuru.io"}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.Update(App{Plan: Plan{Name: "something"}}, "other@tsuru.io", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	revisions, err := ListConfigRevisions(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 5)
+	c.Assert(revisions[1].Author, check.Equals, "me@tsuru.io")
+	c.Assert(revisions[1].Changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeRemoved, Kind: "env", Name: "DATABASE_HOST", Old: "localhost"},
+	})
+	c.Assert(revisions[0].Author, check.Equals, "other@tsuru.io")
+	c.Assert(revisions[0].Reason, check.Equals, "app update")
+	c.Assert(revisions[0].Changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeUpdated, Kind: "plan", Name: "plan", Old: s.defaultPlan.Name, New: "something"},
+	})
+	changes, err := DiffConfigRevisions(a.Name, 4, 5)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, revisions[0].Changes)
+	err = a.Update(App{Description: "my app"}, "other@tsuru.io", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	c.Assert(a.ConfigVersion, check.Equals, 5)
+}
+
+func (s *S) TestDiffConfigRevisionsNotFound(c *check.C) {
+	_, err := DiffConfigRevisions("myapp", 1, 2)
+	c.Assert(err, check.Equals, ErrConfigRevisionNotFound)
+}
+
+func (s *S) TestRollbackConfig(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	s.provisioner.AddUnits(a, 1, "web", nil)
+	err := a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "remotehost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.RollbackConfig(3, "me@tsuru.io", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, "(?s)---- Configuration rolled back to version 3 ----\n.*")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.ConfigVersion, check.Equals, 5)
+	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 1)
+	revision, err := GetConfigRevision(a.Name, 5)
+	c.Assert(err, check.IsNil)
+	c.Assert(revision.Author, check.Equals, "me@tsuru.io")
+	c.Assert(revision.Reason, check.Equals, "rollback to version 3")
+	c.Assert(revision.Changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeUpdated, Kind: "env", Name: "DATABASE_HOST", Old: "remotehost", New: "localhost"},
+	})
+}
+
+func (s *S) TestRollbackConfigKeepsManagedEnvs(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	err := a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	version := a.ConfigVersion
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "LOG_LEVEL", Value: "debug", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	serviceEnv := bind.EnvVar{Name: "MYSQL_HOST", Value: "mysql.tsuru.io", InstanceName: "mydb"}
+	tokenEnv := bind.EnvVar{Name: "TSURU_APP_TOKEN", Value: "newtoken"}
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{
+		"env.MYSQL_HOST":      serviceEnv,
+		"env.TSURU_APP_TOKEN": tokenEnv,
+	}})
+	c.Assert(err, check.IsNil)
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = a.RollbackConfig(version, "me@tsuru.io", nil)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	_, ok := dbApp.Env["LOG_LEVEL"]
+	c.Assert(ok, check.Equals, false)
+	c.Assert(dbApp.Env["MYSQL_HOST"], check.DeepEquals, serviceEnv)
+	c.Assert(dbApp.Env["TSURU_APP_TOKEN"], check.DeepEquals, tokenEnv)
+}
+
+func (s *S) TestRollbackConfigPlanNotAvailableForPool(c *check.C) {
+	plan := Plan{Name: "large", CpuShare: 100, Memory: 1073741824}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := s.createConfigRevisionsApp(c)
+	err = a.Update(App{Plan: Plan{Name: "large"}}, "me@tsuru.io", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	version := a.ConfigVersion
+	err = a.Update(App{Plan: Plan{Name: s.defaultPlan.Name}}, "me@tsuru.io", new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	err = provision.SetPoolConstraint(&provision.PoolConstraint{
+		PoolExpr:  a.Pool,
+		Field:     "plan",
+		Values:    []string{"large"},
+		Blacklist: true,
+	})
+	c.Assert(err, check.IsNil)
+	err = a.RollbackConfig(version, "me@tsuru.io", nil)
+	c.Assert(err, check.DeepEquals, &tsuruErrors.ValidationError{
+		Message: fmt.Sprintf("plan \"large\" is not available for pool %q", a.Pool),
+	})
+	c.Assert(a.Plan.Name, check.Equals, s.defaultPlan.Name)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan.Name, check.Equals, s.defaultPlan.Name)
+}
+
+func (s *S) TestRollbackConfigRouterOptsChanged(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	err := s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"routeropts": map[string]string{"opt": "value"}}})
+	c.Assert(err, check.IsNil)
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = a.RollbackConfig(1, "me@tsuru.io", nil)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+}
+
+func (s *S) TestRollbackConfigChangedConcurrently(c *check.C) {
+	a := s.createConfigRevisionsApp(c)
+	err := a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_HOST", Value: "localhost", Public: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	a.ConfigVersion--
+	err = a.RollbackConfig(2, "me@tsuru.io", nil)
+	c.Assert(err, check.Equals, ErrConfigChanged)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	c.Assert(dbApp.ConfigVersion, check.Equals, 3)
+}
+
+func (s *S) TestRollbackConfigNotFound(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.RollbackConfig(10, "me@tsuru.io", nil)
+	c.Assert(err, check.Equals, ErrConfigRevisionNotFound)
+}
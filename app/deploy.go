@@ -41,19 +41,20 @@ const (
 var reImageVersion = regexp.MustCompile("v[0-9]+$")
 
 type DeployData struct {
-	ID          bson.ObjectId `bson:"_id,omitempty"`
-	App         string
-	Timestamp   time.Time
-	Duration    time.Duration
-	Commit      string
-	Error       string
-	Image       string
-	Log         string
-	User        string
-	Origin      string
-	CanRollback bool
-	RemoveDate  time.Time `bson:",omitempty"`
-	Diff        string
+	ID            bson.ObjectId `bson:"_id,omitempty"`
+	App           string
+	Timestamp     time.Time
+	Duration      time.Duration
+	Commit        string
+	Error         string
+	Image         string
+	Log           string
+	User          string
+	Origin        string
+	CanRollback   bool
+	RemoveDate    time.Time `bson:",omitempty"`
+	Diff          string
+	ConfigVersion int
 }
 
 func findValidImages(apps ...App) (set.Set, error) {
@@ -131,6 +132,9 @@ func eventToDeployData(evt *event.Event, validImages set.Set, full bool) *Deploy
 	if err == nil {
 		data.Commit = startOpts.Commit
 		data.Origin = startOpts.GetOrigin()
+		if startOpts.App != nil {
+			data.ConfigVersion = startOpts.App.ConfigVersion
+		}
 	}
 	if full {
 		data.Log = evt.Log
@@ -38,7 +38,7 @@ func insertDeploysAsEvents(data []DeployData, c *check.C) []*event.Event {
 		})
 		evt.StartTime = d.Timestamp
 		c.Assert(err, check.IsNil)
-		evt.Logf(d.Log)
+		evt.Logf("%s", d.Log)
 		err = evt.SetOtherCustomData(map[string]string{"diff": d.Diff})
 		c.Assert(err, check.IsNil)
 		err = evt.DoneCustomData(nil, map[string]string{"image": d.Image})
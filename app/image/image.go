@@ -303,6 +303,54 @@ func DeleteAllAppImageNames(appName string) error {
 	return coll.RemoveId(appName)
 }
 
+// CopyAppImageNames copies the image and builder image lists of appName to
+// newAppName. The image names themselves are kept, so newAppName keeps being
+// able to deploy and rollback to the images built for appName.
+func CopyAppImageNames(appName, newAppName string) error {
+	colls := []func() (*storage.Collection, error){appImagesColl, appBuilderImagesColl}
+	for _, getColl := range colls {
+		coll, err := getColl()
+		if err != nil {
+			return err
+		}
+		var imgs bson.M
+		err = coll.FindId(appName).One(&imgs)
+		if err != nil {
+			coll.Close()
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return err
+		}
+		delete(imgs, "_id")
+		_, err = coll.UpsertId(newAppName, imgs)
+		coll.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveAppImageNames removes the image and builder image lists of appName,
+// without touching the images custom data. It's the counterpart of
+// CopyAppImageNames.
+func RemoveAppImageNames(appName string) error {
+	colls := []func() (*storage.Collection, error){appImagesColl, appBuilderImagesColl}
+	for _, getColl := range colls {
+		coll, err := getColl()
+		if err != nil {
+			return err
+		}
+		err = coll.RemoveId(appName)
+		coll.Close()
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
 func PullAppImageNames(appName string, images []string) error {
 	dataColl, err := imageCustomDataColl()
 	if err != nil {
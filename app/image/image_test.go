@@ -170,6 +170,42 @@ func (s *S) TestDeleteAllAppImageNamesRemovesCustomDataWithoutImages(c *check.C)
 	c.Assert(yamlData, check.DeepEquals, provision.TsuruYamlData{})
 }
 
+func (s *S) TestCopyAppImageNames(c *check.C) {
+	err := image.AppendAppImageName("myapp", "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName("myapp", "tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppBuilderImageName("myapp", "tsuru/app-myapp:v2-builder")
+	c.Assert(err, check.IsNil)
+	err = image.CopyAppImageNames("myapp", "yourapp")
+	c.Assert(err, check.IsNil)
+	imgs, err := image.ListAppImages("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(imgs, check.DeepEquals, []string{"tsuru/app-myapp:v1", "tsuru/app-myapp:v2"})
+	imgs, err = image.ListAppBuilderImages("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(imgs, check.DeepEquals, []string{"tsuru/app-myapp:v2-builder"})
+	current, err := image.AppCurrentImageName("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(current, check.Equals, "tsuru/app-myapp:v2")
+	newImg, err := image.AppNewImageName("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(newImg, check.Equals, "tsuru/app-yourapp:v1")
+	err = image.RemoveAppImageNames("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = image.ListAppImages("myapp")
+	c.Assert(err, check.ErrorMatches, "not found")
+	_, err = image.ListAppBuilderImages("myapp")
+	c.Assert(err, check.ErrorMatches, "not found")
+}
+
+func (s *S) TestCopyAppImageNamesWithoutImages(c *check.C) {
+	err := image.CopyAppImageNames("myapp", "yourapp")
+	c.Assert(err, check.IsNil)
+	_, err = image.ListAppImages("yourapp")
+	c.Assert(err, check.ErrorMatches, "not found")
+}
+
 func (s *S) TestDeleteAllAppImageNamesSimilarApps(c *check.C) {
 	data := map[string]interface{}{"healthcheck": map[string]interface{}{"path": "/test"}}
 	err := image.AppendAppImageName("myapp", "tsuru/app-myapp:v1")
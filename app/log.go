@@ -5,8 +5,6 @@
 package app
 
 import (
-	"fmt"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,10 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tsuru/tsuru/api/shutdown"
-	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
 var (
@@ -54,7 +49,7 @@ var (
 
 	logsWritten = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "tsuru_logs_write_total",
-		Help: "The number of log entries written to mongo.",
+		Help: "The number of log entries written to the log sinks.",
 	})
 
 	logsDropped = prometheus.NewCounter(prometheus.CounterOpts{
@@ -89,99 +84,22 @@ func init() {
 
 type LogListener struct {
 	c       <-chan Applog
-	logConn *db.LogStorage
 	quit    chan struct{}
+	closeFn func()
 }
 
-func isCappedPositionLost(err error) bool {
-	if err == nil {
-		return false
-	}
-	return strings.Contains(err.Error(), "CappedPositionLost")
-}
-
-func isSessionClosed(r interface{}) bool {
-	return fmt.Sprintf("%v", r) == "Session already closed"
-}
-
-func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
-	conn, err := db.LogConn()
+// NewLogListener follows the logs of the app using the first log sink
+// configured for its pool that is able to read logs.
+func NewLogListener(a *App, filter LogFilter) (*LogListener, error) {
+	err := filter.Validate()
 	if err != nil {
 		return nil, err
 	}
-	c := make(chan Applog, 10)
-	quit := make(chan struct{})
-	coll := conn.Logs(a.Name)
-	var lastLog Applog
-	err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
-	if err == mgo.ErrNotFound {
-		// Tail cursors do not work correctly if the collection is empty (the
-		// Next() call wouldn't block). So if the collection is empty we insert
-		// the very first log line in it. This is quite rare in the real world
-		// though so the impact of this extra log message is really small.
-		err = a.Log("Logs initialization", "tsuru", "")
-		if err != nil {
-			return nil, err
-		}
-		err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
-	}
+	reader, err := a.logReader()
 	if err != nil {
 		return nil, err
 	}
-	lastId := lastLog.MongoID
-	mkQuery := func() bson.M {
-		m := bson.M{
-			"_id": bson.M{"$gt": lastId},
-		}
-		if filterLog.Source != "" {
-			m["source"] = filterLog.Source
-		}
-		if filterLog.Unit != "" {
-			m["unit"] = filterLog.Unit
-		}
-		return m
-	}
-	query := coll.Find(mkQuery())
-	tailTimeout := 10 * time.Second
-	iter := query.Sort("$natural").Tail(tailTimeout)
-	go func() {
-		defer close(c)
-		defer func() {
-			if r := recover(); r != nil {
-				if isSessionClosed(r) {
-					return
-				}
-				panic(err)
-			}
-		}()
-		for {
-			var applog Applog
-			for iter.Next(&applog) {
-				lastId = applog.MongoID
-				select {
-				case c <- applog:
-				case <-quit:
-					iter.Close()
-					return
-				}
-			}
-			if iter.Timeout() {
-				continue
-			}
-			if err := iter.Err(); err != nil {
-				if !isCappedPositionLost(err) {
-					log.Errorf("error tailing logs: %v", err)
-					iter.Close()
-					return
-				}
-			}
-			iter.Close()
-			query = coll.Find(mkQuery())
-			iter = query.Sort("$natural").Tail(tailTimeout)
-		}
-	}()
-	l := LogListener{c: c, logConn: conn, quit: quit}
-	return &l, nil
+	return reader.Listen(a.Name, filter)
 }
 
 func (l *LogListener) ListenChan() <-chan Applog {
@@ -189,7 +107,9 @@ func (l *LogListener) ListenChan() <-chan Applog {
 }
 
 func (l *LogListener) Close() {
-	l.logConn.Close()
+	if l.closeFn != nil {
+		l.closeFn()
+	}
 	if l.quit != nil {
 		close(l.quit)
 		l.quit = nil
@@ -199,6 +119,8 @@ func (l *LogListener) Close() {
 type LogDispatcher struct {
 	mu             sync.RWMutex
 	dispatchers    map[string]*appLogDispatcher
+	limitersMu     sync.RWMutex
+	limiters       map[string]*logLimiter
 	msgCh          chan *msgWithTS
 	shuttingDown   int32
 	doneProcessing chan struct{}
@@ -212,6 +134,7 @@ type msgWithTS struct {
 func NewlogDispatcher(chanSize int) *LogDispatcher {
 	d := &LogDispatcher{
 		dispatchers:    make(map[string]*appLogDispatcher),
+		limiters:       make(map[string]*logLimiter),
 		msgCh:          make(chan *msgWithTS, chanSize),
 		doneProcessing: make(chan struct{}),
 	}
@@ -252,10 +175,45 @@ func (d *LogDispatcher) runWriter() {
 	}
 }
 
+func (d *LogDispatcher) getLimiter(appName string) *logLimiter {
+	d.limitersMu.RLock()
+	limiter, ok := d.limiters[appName]
+	d.limitersMu.RUnlock()
+	if ok {
+		return limiter
+	}
+	d.limitersMu.Lock()
+	defer d.limitersMu.Unlock()
+	limiter, ok = d.limiters[appName]
+	if !ok {
+		limiter = newLogLimiter(appName)
+		d.limiters[appName] = limiter
+	}
+	return limiter
+}
+
+// Send enqueues the log entry to be written, unless it exceeds the log
+// limits of the app, in which case it's silently dropped. Entries with
+// invalid app names are also dropped, as app names are used as metric labels.
 func (d *LogDispatcher) Send(msg *Applog) error {
 	if atomic.LoadInt32(&d.shuttingDown) == 1 {
 		return errors.New("log dispatcher is shutting down")
 	}
+	if !nameRegexp.MatchString(msg.AppName) {
+		logsInvalidAppDropped.Inc()
+		return nil
+	}
+	allowed, notice := d.getLimiter(msg.AppName).check(msg, time.Now())
+	if notice != nil {
+		d.enqueue(notice)
+	}
+	if allowed {
+		d.enqueue(msg)
+	}
+	return nil
+}
+
+func (d *LogDispatcher) enqueue(msg *Applog) {
 	logsInQueue.Inc()
 	logsEnqueued.Inc()
 	msgExtra := &msgWithTS{msg: msg, arriveTime: time.Now()}
@@ -266,7 +224,6 @@ func (d *LogDispatcher) Send(msg *Applog) error {
 		d.msgCh <- msgExtra
 		logsQueueBlockedTotal.Add(time.Since(t0).Seconds())
 	}
-	return nil
 }
 
 func (a *LogDispatcher) String() string {
@@ -281,10 +238,13 @@ func (d *LogDispatcher) Shutdown() {
 	for _, appD := range d.dispatchers {
 		appD.stopWait()
 	}
+	closeLogSinks()
 }
 
 type appLogDispatcher struct {
-	appName string
+	appName          string
+	settings         appLogSettings
+	settingsLoadedAt time.Time
 	*bulkProcessor
 }
 
@@ -298,15 +258,50 @@ func newAppLogDispatcher(appName string) *appLogDispatcher {
 	return d
 }
 
+func (d *appLogDispatcher) refreshSettings() error {
+	if time.Since(d.settingsLoadedAt) <= appLogSettingsRefreshInterval {
+		return nil
+	}
+	settings, err := loadAppLogSettings(d.appName)
+	if err != nil {
+		return err
+	}
+	d.settings = settings
+	d.settingsLoadedAt = time.Now()
+	return nil
+}
+
+// sinks returns the log sinks for the app, according to its pool.
+func (d *appLogDispatcher) sinks() ([]*configuredLogSink, error) {
+	sinks, err := getLogSinks()
+	if err != nil {
+		return nil, err
+	}
+	if !sinksUsePools(sinks) {
+		return sinks, nil
+	}
+	return sinksForPool(sinks, d.settings.Pool), nil
+}
+
 func (d *appLogDispatcher) flush(msgs []interface{}, lastMessage *msgWithTS) bool {
-	conn, err := db.LogConn()
+	err := d.refreshSettings()
 	if err != nil {
-		log.Errorf("[log flusher] unable to connect to mongodb: %s", err)
+		log.Errorf("[log flusher] unable to load log settings for app %q: %s", d.appName, err)
 		return false
 	}
-	coll := conn.Logs(d.appName)
-	err = coll.Insert(msgs...)
-	coll.Close()
+	sinks, err := d.sinks()
+	if err != nil {
+		log.Errorf("[log flusher] unable to find log sinks for app %q: %s", d.appName, err)
+		return false
+	}
+	logs := make([]*Applog, len(msgs))
+	for i := range msgs {
+		logs[i] = msgs[i].(*Applog)
+		if d.settings.LogFormat == LogFormatJSON && logs[i].Fields == nil {
+			parseLogFields(logs[i])
+		}
+	}
+	err = writeToSinks(sinks, d.appName, logs)
 	if err != nil {
 		log.Errorf("[log flusher] unable to insert logs: %s", err)
 		return false
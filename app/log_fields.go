@@ -0,0 +1,72 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+const (
+	// LogFormatText stores log messages as they are received. It's the
+	// default log format of apps.
+	LogFormatText = "text"
+
+	// LogFormatJSON parses log messages that are JSON objects, storing their
+	// top level keys as the fields of the log entry.
+	LogFormatJSON = "json"
+)
+
+func validateLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+		return nil
+	}
+	msg := fmt.Sprintf("invalid log format %q, it must be %q or %q", format, LogFormatText, LogFormatJSON)
+	return &tsuruErrors.ValidationError{Message: msg}
+}
+
+// logFieldName returns the name used to store a key of a JSON message as a
+// log field. Dots are replaced by underscores, and keys that can't be stored
+// result in an empty name.
+func logFieldName(key string) string {
+	if key == "" || strings.HasPrefix(key, "$") {
+		return ""
+	}
+	return strings.Replace(key, ".", "_", -1)
+}
+
+// parseLogFields fills the fields of the log entry when its message is a JSON
+// object. String values are stored unquoted, other values are stored as JSON
+// and null values are ignored.
+func parseLogFields(l *Applog) {
+	msg := strings.TrimSpace(l.Message)
+	if !strings.HasPrefix(msg, "{") {
+		return
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &data); err != nil {
+		return
+	}
+	fields := make(map[string]string, len(data))
+	for key, raw := range data {
+		name := logFieldName(key)
+		if name == "" || string(raw) == "null" {
+			continue
+		}
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			fields[name] = str
+			continue
+		}
+		fields[name] = string(raw)
+	}
+	if len(fields) > 0 {
+		l.Fields = fields
+	}
+}
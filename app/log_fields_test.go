@@ -0,0 +1,109 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestParseLogFields(c *check.C) {
+	tests := []struct {
+		message string
+		fields  map[string]string
+	}{
+		{"plain message", nil},
+		{"{not json", nil},
+		{`["a", "b"]`, nil},
+		{`{}`, nil},
+		{`{"level": "error"} trailing`, nil},
+		{
+			`  {"level": "error", "request_id": "abc", "status": 500, "ok": false, "user.id": 1, "$x": 1, "none": null, "ctx": {"a": 1}}`,
+			map[string]string{
+				"level":      "error",
+				"request_id": "abc",
+				"status":     "500",
+				"ok":         "false",
+				"user_id":    "1",
+				"ctx":        `{"a": 1}`,
+			},
+		},
+	}
+	for i, tt := range tests {
+		l := Applog{Message: tt.message}
+		parseLogFields(&l)
+		c.Check(l.Fields, check.DeepEquals, tt.fields, check.Commentf("test %d", i))
+		c.Check(l.Message, check.Equals, tt.message, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestValidateLogFormat(c *check.C) {
+	c.Assert(validateLogFormat(""), check.IsNil)
+	c.Assert(validateLogFormat(LogFormatText), check.IsNil)
+	c.Assert(validateLogFormat(LogFormatJSON), check.IsNil)
+	err := validateLogFormat("xml")
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `invalid log format "xml", it must be "text" or "json"`)
+}
+
+func (s *S) TestLogFilterValidateFields(c *check.C) {
+	f := LogFilter{Fields: map[string]string{"level": "error"}}
+	c.Assert(f.Validate(), check.IsNil)
+	f = LogFilter{Fields: map[string]string{"user.id": "1"}}
+	c.Assert(f.Validate(), check.ErrorMatches, `invalid log field name "user.id"`)
+	f = LogFilter{Fields: map[string]string{"$where": "1"}}
+	c.Assert(f.Validate(), check.ErrorMatches, `invalid log field name "\$where"`)
+}
+
+func (s *S) TestLogDispatcherParsesJSONLogs(c *check.C) {
+	a := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name, LogFormat: LogFormatJSON}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dispatcher := NewlogDispatcher(2000000)
+	now := time.Now()
+	err = dispatcher.Send(&Applog{Date: now, Message: `{"level":"error","msg":"failed"}`, Source: "web", AppName: a.Name, Unit: "u1"})
+	c.Assert(err, check.IsNil)
+	err = dispatcher.Send(&Applog{Date: now, Message: "plain", Source: "web", AppName: a.Name, Unit: "u1"})
+	c.Assert(err, check.IsNil)
+	dispatcher.Shutdown()
+	logs, err := a.LastLogs(10, Applog{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]string{"level": "error", "msg": "failed"})
+	c.Assert(logs[1].Fields, check.IsNil)
+	page, err := a.SearchLogs(LogQuery{LogFilter: LogFilter{Fields: map[string]string{"level": "error"}}})
+	c.Assert(err, check.IsNil)
+	c.Assert(page.Logs, check.HasLen, 1)
+	c.Assert(page.Logs[0].Message, check.Equals, `{"level":"error","msg":"failed"}`)
+}
+
+func (s *S) TestLogDispatcherDoesNotParseTextLogs(c *check.C) {
+	a := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dispatcher := NewlogDispatcher(2000000)
+	err = dispatcher.Send(&Applog{Date: time.Now(), Message: `{"level":"error"}`, Source: "web", AppName: a.Name})
+	c.Assert(err, check.IsNil)
+	dispatcher.Shutdown()
+	logs, err := a.LastLogs(10, Applog{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Fields, check.IsNil)
+}
+
+func (s *S) TestUpdateLogFormat(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.Update(App{LogFormat: "xml"}, "admin@example.com", nil)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	err = a.Update(App{LogFormat: LogFormatJSON}, "admin@example.com", nil)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogFormat, check.Equals, LogFormatJSON)
+}
@@ -0,0 +1,289 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrLogLimitNotFound = errors.New("log limit not found")
+
+	// logLimitRefreshInterval is how long the log dispatcher trusts the
+	// limit it has loaded for an app before looking it up again.
+	logLimitRefreshInterval = time.Minute
+
+	// logLimitNoticeInterval is the minimum interval between two messages
+	// about dropped lines written to the log of an app.
+	logLimitNoticeInterval = 10 * time.Second
+
+	logsAppReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_app_received_total",
+		Help: "The number of log entries received for each app.",
+	}, []string{"app"})
+
+	logsAppReceivedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_app_received_bytes_total",
+		Help: "The size of the messages of the log entries received for each app.",
+	}, []string{"app"})
+
+	logsAppLimitDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_app_limit_dropped_total",
+		Help: "The number of log entries dropped for exceeding the log limits of each app.",
+	}, []string{"app"})
+
+	logsInvalidAppDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_logs_invalid_app_dropped_total",
+		Help: "The number of log entries dropped for having an invalid app name.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(logsAppReceived)
+	prometheus.MustRegister(logsAppReceivedBytes)
+	prometheus.MustRegister(logsAppLimitDropped)
+	prometheus.MustRegister(logsInvalidAppDropped)
+}
+
+// LogLimit restricts the ingestion of app logs received by the log
+// dispatcher. A zero value in any of the fields means no limit.
+//
+// LinesPerSecond limits the number of lines accepted in each second. Lines
+// over it are dropped, unless SampleRate is greater than one, in which case
+// one in every SampleRate lines over the limit is kept. BytesPerDay limits the
+// size of the messages accepted in each day, in UTC, and every line over it is
+// dropped.
+//
+// A limit is set either for a pool or for a single app. Each field set in the
+// limit of an app takes precedence over the same field in the limits of its
+// plan, which take precedence over the limit of its pool. Limits are enforced
+// by each tsurud instance.
+type LogLimit struct {
+	Pool           string `json:",omitempty"`
+	App            string `json:",omitempty"`
+	LinesPerSecond int
+	BytesPerDay    int64
+	SampleRate     int
+}
+
+func (l *LogLimit) validate() error {
+	if (l.Pool == "") == (l.App == "") {
+		return &tsuruErrors.ValidationError{Message: "either a pool or an app is required"}
+	}
+	if l.LinesPerSecond < 0 || l.BytesPerDay < 0 || l.SampleRate < 0 {
+		return &tsuruErrors.ValidationError{Message: "log limits must not be negative"}
+	}
+	return nil
+}
+
+func (l *LogLimit) isZero() bool {
+	return l.LinesPerSecond == 0 && l.BytesPerDay == 0
+}
+
+func logLimitCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("log_limits")
+	coll.EnsureIndex(mgo.Index{Key: []string{"pool", "app"}, Unique: true})
+	return coll, nil
+}
+
+// SetLogLimit creates or replaces the log limit of a pool or app.
+func SetLogLimit(limit *LogLimit) error {
+	err := limit.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := logLimitCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"pool": limit.Pool, "app": limit.App}, limit)
+	return err
+}
+
+// ListLogLimits returns all log limits, pool limits first.
+func ListLogLimits() ([]LogLimit, error) {
+	coll, err := logLimitCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var limits []LogLimit
+	err = coll.Find(nil).Sort("app", "pool").All(&limits)
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// DeleteLogLimit removes the log limit of a pool or app.
+func DeleteLogLimit(pool, appName string) error {
+	coll, err := logLimitCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Remove(bson.M{"pool": pool, "app": appName})
+	if err == mgo.ErrNotFound {
+		return ErrLogLimitNotFound
+	}
+	return err
+}
+
+// effectiveLogLimit returns the log limit applied to the app, merging the
+// limits of the app, its plan and its pool field by field. Apps that do not
+// exist have no limit.
+func effectiveLogLimit(appName string) (LogLimit, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return LogLimit{}, err
+	}
+	var a struct {
+		Pool string
+		Plan Plan
+	}
+	err = conn.Apps().Find(bson.M{"name": appName}).Select(bson.M{"pool": 1, "plan": 1}).One(&a)
+	conn.Close()
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return LogLimit{}, nil
+		}
+		return LogLimit{}, err
+	}
+	coll, err := logLimitCollection()
+	if err != nil {
+		return LogLimit{}, err
+	}
+	defer coll.Close()
+	var limits []LogLimit
+	query := bson.M{"$or": []bson.M{{"app": appName}, {"pool": a.Pool, "app": ""}}}
+	err = coll.Find(query).All(&limits)
+	if err != nil {
+		return LogLimit{}, err
+	}
+	var appLimit, poolLimit LogLimit
+	for _, l := range limits {
+		if l.App != "" {
+			appLimit = l
+		} else {
+			poolLimit = l
+		}
+	}
+	planLimit := LogLimit{
+		LinesPerSecond: a.Plan.LogLinesPerSecond,
+		BytesPerDay:    a.Plan.LogBytesPerDay,
+	}
+	effective := LogLimit{App: appName}
+	for _, l := range []LogLimit{appLimit, planLimit, poolLimit} {
+		if effective.LinesPerSecond == 0 {
+			effective.LinesPerSecond = l.LinesPerSecond
+		}
+		if effective.BytesPerDay == 0 {
+			effective.BytesPerDay = l.BytesPerDay
+		}
+		if effective.SampleRate == 0 {
+			effective.SampleRate = l.SampleRate
+		}
+	}
+	return effective, nil
+}
+
+// logLimiter applies the log limit of an app to the entries received by the
+// log dispatcher, counting lines in fixed windows of one second.
+type logLimiter struct {
+	appName       string
+	received      prometheus.Counter
+	receivedBytes prometheus.Counter
+	limitDropped  prometheus.Counter
+	mu            sync.Mutex
+	limit         LogLimit
+	loadedAt      time.Time
+	second        int64
+	lines         int
+	excess        int
+	day           string
+	bytes         int64
+	dropped       int
+	lastNotice    time.Time
+}
+
+func newLogLimiter(appName string) *logLimiter {
+	return &logLimiter{
+		appName:       appName,
+		received:      logsAppReceived.WithLabelValues(appName),
+		receivedBytes: logsAppReceivedBytes.WithLabelValues(appName),
+		limitDropped:  logsAppLimitDropped.WithLabelValues(appName),
+	}
+}
+
+// check reports whether the entry is within the limits of the app. When
+// lines were dropped, it also returns an entry telling so, to be written to
+// the log of the app regardless of the limits.
+func (l *logLimiter) check(msg *Applog, now time.Time) (bool, *Applog) {
+	size := int64(len(msg.Message))
+	l.received.Inc()
+	l.receivedBytes.Add(float64(size))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.loadedAt) > logLimitRefreshInterval {
+		limit, err := effectiveLogLimit(l.appName)
+		if err != nil {
+			log.Errorf("[log limiter] unable to load log limits for app %q: %s", l.appName, err)
+		} else {
+			l.limit = limit
+		}
+		l.loadedAt = now
+	}
+	if second := now.Unix(); second != l.second {
+		l.second = second
+		l.lines = 0
+		l.excess = 0
+	}
+	if day := now.UTC().Format("2006-01-02"); day != l.day {
+		l.day = day
+		l.bytes = 0
+	}
+	allowed := true
+	if l.limit.BytesPerDay > 0 && l.bytes+size > l.limit.BytesPerDay {
+		allowed = false
+	} else if l.limit.LinesPerSecond > 0 && l.lines >= l.limit.LinesPerSecond {
+		l.excess++
+		allowed = l.limit.SampleRate > 1 && l.excess%l.limit.SampleRate == 0
+	}
+	if allowed {
+		l.lines++
+		l.bytes += size
+	} else {
+		l.dropped++
+		l.limitDropped.Inc()
+	}
+	if l.dropped == 0 || now.Sub(l.lastNotice) < logLimitNoticeInterval {
+		return allowed, nil
+	}
+	notice := &Applog{
+		Date:    now.UTC(),
+		Message: fmt.Sprintf("%d log lines dropped for exceeding the log limits of the app", l.dropped),
+		Source:  "tsuru",
+		AppName: l.appName,
+	}
+	l.dropped = 0
+	l.lastNotice = now
+	return allowed, notice
+}
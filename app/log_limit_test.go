@@ -0,0 +1,205 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestLogLimitValidate(c *check.C) {
+	tests := []struct {
+		limit LogLimit
+		err   string
+	}{
+		{LogLimit{Pool: "pool1", LinesPerSecond: 10}, ""},
+		{LogLimit{App: "myapp", BytesPerDay: 10, SampleRate: 5}, ""},
+		{LogLimit{LinesPerSecond: 10}, "either a pool or an app is required"},
+		{LogLimit{Pool: "pool1", App: "myapp"}, "either a pool or an app is required"},
+		{LogLimit{Pool: "pool1", LinesPerSecond: -1}, "log limits must not be negative"},
+		{LogLimit{Pool: "pool1", SampleRate: -1}, "log limits must not be negative"},
+	}
+	for i, tt := range tests {
+		err := tt.limit.validate()
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+			continue
+		}
+		c.Check(err, check.FitsTypeOf, &errors.ValidationError{}, check.Commentf("test %d", i))
+		c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestLogLimiterLinesPerSecond(c *check.C) {
+	now := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	l := &logLimiter{appName: "myapp", limit: LogLimit{LinesPerSecond: 2}, loadedAt: now}
+	msg := &Applog{Message: "hello", AppName: "myapp"}
+	allowed, notice := l.check(msg, now)
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(notice, check.IsNil)
+	allowed, _ = l.check(msg, now.Add(100*time.Millisecond))
+	c.Assert(allowed, check.Equals, true)
+	allowed, notice = l.check(msg, now.Add(200*time.Millisecond))
+	c.Assert(allowed, check.Equals, false)
+	c.Assert(notice, check.DeepEquals, &Applog{
+		Date:    now.Add(200 * time.Millisecond),
+		Message: "1 log lines dropped for exceeding the log limits of the app",
+		Source:  "tsuru",
+		AppName: "myapp",
+	})
+	allowed, notice = l.check(msg, now.Add(300*time.Millisecond))
+	c.Assert(allowed, check.Equals, false)
+	c.Assert(notice, check.IsNil)
+	allowed, notice = l.check(msg, now.Add(time.Second))
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(notice, check.IsNil)
+	for i := 0; i < 3; i++ {
+		l.check(msg, now.Add(time.Second+time.Duration(i)*time.Millisecond))
+	}
+	allowed, notice = l.check(msg, now.Add(logLimitNoticeInterval+time.Second))
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(notice, check.NotNil)
+	c.Assert(notice.Message, check.Equals, "3 log lines dropped for exceeding the log limits of the app")
+}
+
+func (s *S) TestLogLimiterSampling(c *check.C) {
+	now := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	l := &logLimiter{appName: "myapp", limit: LogLimit{LinesPerSecond: 1, SampleRate: 3}, loadedAt: now}
+	msg := &Applog{Message: "hello", AppName: "myapp"}
+	var results []bool
+	for i := 0; i < 7; i++ {
+		allowed, _ := l.check(msg, now)
+		results = append(results, allowed)
+	}
+	c.Assert(results, check.DeepEquals, []bool{true, false, false, true, false, false, true})
+}
+
+func (s *S) TestLogLimiterBytesPerDay(c *check.C) {
+	now := time.Date(2017, 6, 16, 23, 59, 0, 0, time.UTC)
+	l := &logLimiter{appName: "myapp", limit: LogLimit{BytesPerDay: 10, SampleRate: 2}, loadedAt: now}
+	msg := &Applog{Message: strings.Repeat("x", 4), AppName: "myapp"}
+	allowed, _ := l.check(msg, now)
+	c.Assert(allowed, check.Equals, true)
+	allowed, _ = l.check(msg, now.Add(time.Second))
+	c.Assert(allowed, check.Equals, true)
+	allowed, _ = l.check(msg, now.Add(2*time.Second))
+	c.Assert(allowed, check.Equals, false)
+	allowed, _ = l.check(msg, now.Add(3*time.Second))
+	c.Assert(allowed, check.Equals, false)
+	allowed, notice := l.check(msg, now.Add(time.Minute))
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(notice, check.NotNil)
+	c.Assert(notice.Message, check.Equals, "1 log lines dropped for exceeding the log limits of the app")
+}
+
+func (s *S) TestLogLimitsStorage(c *check.C) {
+	err := SetLogLimit(&LogLimit{Pool: "pool1", LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	err = SetLogLimit(&LogLimit{App: "myapp", BytesPerDay: 100})
+	c.Assert(err, check.IsNil)
+	err = SetLogLimit(&LogLimit{Pool: "pool1", LinesPerSecond: 20})
+	c.Assert(err, check.IsNil)
+	limits, err := ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []LogLimit{
+		{Pool: "pool1", LinesPerSecond: 20},
+		{App: "myapp", BytesPerDay: 100},
+	})
+	err = DeleteLogLimit("pool1", "")
+	c.Assert(err, check.IsNil)
+	err = DeleteLogLimit("pool1", "")
+	c.Assert(err, check.Equals, ErrLogLimitNotFound)
+	limits, err = ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []LogLimit{{App: "myapp", BytesPerDay: 100}})
+}
+
+func (s *S) TestEffectiveLogLimit(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	limit, err := effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit.isZero(), check.Equals, true)
+	err = SetLogLimit(&LogLimit{Pool: a.Pool, LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	limit, err = effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{App: a.Name, LinesPerSecond: 10})
+	err = s.conn.Apps().Update(
+		bson.M{"name": a.Name},
+		bson.M{"$set": bson.M{"plan.loglinespersecond": 50}},
+	)
+	c.Assert(err, check.IsNil)
+	limit, err = effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{App: a.Name, LinesPerSecond: 50})
+	err = SetLogLimit(&LogLimit{App: a.Name, LinesPerSecond: 100, SampleRate: 10})
+	c.Assert(err, check.IsNil)
+	limit, err = effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{App: a.Name, LinesPerSecond: 100, SampleRate: 10})
+	limit, err = effectiveLogLimit("unknown")
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{})
+}
+
+func (s *S) TestEffectiveLogLimitMergesFields(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = SetLogLimit(&LogLimit{Pool: a.Pool, LinesPerSecond: 10, BytesPerDay: 1000, SampleRate: 5})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(
+		bson.M{"name": a.Name},
+		bson.M{"$set": bson.M{"plan.loglinespersecond": 50}},
+	)
+	c.Assert(err, check.IsNil)
+	limit, err := effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{App: a.Name, LinesPerSecond: 50, BytesPerDay: 1000, SampleRate: 5})
+	err = SetLogLimit(&LogLimit{App: a.Name, BytesPerDay: 2000})
+	c.Assert(err, check.IsNil)
+	limit, err = effectiveLogLimit(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(limit, check.DeepEquals, LogLimit{App: a.Name, LinesPerSecond: 50, BytesPerDay: 2000, SampleRate: 5})
+}
+
+func (s *S) TestLogDispatcherDropsInvalidAppNames(c *check.C) {
+	dispatcher := NewlogDispatcher(10)
+	err := dispatcher.Send(&Applog{Date: time.Now(), Message: "msg", Source: "web", AppName: "Invalid/App", Unit: "unit1"})
+	c.Assert(err, check.IsNil)
+	dispatcher.Shutdown()
+	c.Assert(dispatcher.limiters, check.HasLen, 0)
+	c.Assert(dispatcher.dispatchers, check.HasLen, 0)
+}
+
+func (s *S) TestLogDispatcherAppliesLogLimit(c *check.C) {
+	a := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = SetLogLimit(&LogLimit{App: a.Name, LinesPerSecond: 1})
+	c.Assert(err, check.IsNil)
+	dispatcher := NewlogDispatcher(2000000)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		err = dispatcher.Send(&Applog{Date: now, Message: "msg", Source: "web", AppName: a.Name, Unit: "unit1"})
+		c.Assert(err, check.IsNil)
+	}
+	dispatcher.Shutdown()
+	logs, err := a.LastLogs(10, Applog{})
+	c.Assert(err, check.IsNil)
+	var messages []string
+	for _, l := range logs {
+		messages = append(messages, l.Message)
+	}
+	c.Assert(len(messages) < 5, check.Equals, true)
+	c.Assert(messages[0], check.Equals, "msg")
+	c.Assert(messages[1], check.Equals, "1 log lines dropped for exceeding the log limits of the app")
+}
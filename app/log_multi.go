@@ -0,0 +1,178 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+const (
+	defaultMaxLogApps = 20
+	// maxConcurrentLogSearches limits how many apps have their logs searched
+	// at the same time by SearchMultiAppLogs.
+	maxConcurrentLogSearches = 5
+)
+
+// logMergeWindow is how long entries followed from multiple apps are held
+// before being sent, so entries received in the same window are sent in
+// timestamp order.
+var logMergeWindow = time.Second
+
+// MaxLogApps returns the maximum number of apps whose logs may be searched or
+// followed at once.
+func MaxLogApps() int {
+	max, err := config.GetInt("server:app-log-max-apps")
+	if err != nil || max <= 0 {
+		return defaultMaxLogApps
+	}
+	return max
+}
+
+func validateLogApps(apps []App) error {
+	if max := MaxLogApps(); len(apps) > max {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("logs from at most %d apps can be requested at once", max)}
+	}
+	return nil
+}
+
+// SearchMultiAppLogs searches the logs of all the given apps, returning the
+// newest query.Limit entries, in timestamp order. The name of the app is set
+// in each entry. Pagination cursors are not supported. As logs are stored
+// per app, apps are searched concurrently.
+func SearchMultiAppLogs(apps []App, query LogQuery) ([]Applog, error) {
+	if query.Before != "" || query.After != "" {
+		return nil, &tsuruErrors.ValidationError{Message: "log cursors are not supported when searching the logs of multiple apps"}
+	}
+	err := validateLogApps(apps)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]*LogPage, len(apps))
+	errs := make([]error, len(apps))
+	limiter := make(chan struct{}, maxConcurrentLogSearches)
+	var wg sync.WaitGroup
+	for i := range apps {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			pages[i], errs[i] = apps[i].SearchLogs(query)
+		}(i)
+	}
+	wg.Wait()
+	logs := []Applog{}
+	for i := range apps {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, l := range pages[i].Logs {
+			l.AppName = apps[i].Name
+			logs = append(logs, l)
+		}
+	}
+	sortLogsByDate(logs)
+	if query.Limit > 0 && len(logs) > query.Limit {
+		logs = logs[len(logs)-query.Limit:]
+	}
+	return logs, nil
+}
+
+// NewMultiAppLogListener follows the logs of all the given apps, merging them
+// in a single listener. Entries are sent in timestamp order within each
+// logMergeWindow, with the name of the app set.
+func NewMultiAppLogListener(apps []App, filter LogFilter) (*LogListener, error) {
+	err := validateLogApps(apps)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]*LogListener, 0, len(apps))
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	for i := range apps {
+		l, err := NewLogListener(&apps[i], filter)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	in := make(chan Applog, 10*len(listeners))
+	out := make(chan Applog, 10)
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func(appName string, c <-chan Applog) {
+			defer wg.Done()
+			for msg := range c {
+				msg.AppName = appName
+				select {
+				case in <- msg:
+				case <-quit:
+					return
+				}
+			}
+		}(apps[i].Name, l.ListenChan())
+	}
+	go func() {
+		wg.Wait()
+		close(in)
+	}()
+	go mergeLogs(in, out, quit)
+	return &LogListener{c: out, quit: quit, closeFn: closeAll}, nil
+}
+
+func mergeLogs(in <-chan Applog, out chan<- Applog, quit <-chan struct{}) {
+	defer close(out)
+	ticker := time.NewTicker(logMergeWindow)
+	defer ticker.Stop()
+	var pending []Applog
+	flush := func() bool {
+		sortLogsByDate(pending)
+		for _, msg := range pending {
+			select {
+			case out <- msg:
+			case <-quit:
+				return false
+			}
+		}
+		pending = pending[:0]
+		return true
+	}
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				flush()
+				return
+			}
+			pending = append(pending, msg)
+		case <-ticker.C:
+			if !flush() {
+				return
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func sortLogsByDate(logs []Applog) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Date.Before(logs[j].Date)
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestMergeLogs(c *check.C) {
+	original := logMergeWindow
+	logMergeWindow = time.Hour
+	defer func() { logMergeWindow = original }()
+	base := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	in := make(chan Applog, 3)
+	out := make(chan Applog, 3)
+	in <- Applog{Date: base.Add(2 * time.Second), Message: "3", AppName: "app1"}
+	in <- Applog{Date: base, Message: "1", AppName: "app2"}
+	in <- Applog{Date: base.Add(time.Second), Message: "2", AppName: "app1"}
+	close(in)
+	mergeLogs(in, out, make(chan struct{}))
+	var messages []string
+	for msg := range out {
+		messages = append(messages, msg.Message)
+	}
+	c.Assert(messages, check.DeepEquals, []string{"1", "2", "3"})
+}
+
+func (s *S) TestMergeLogsQuit(c *check.C) {
+	in := make(chan Applog)
+	out := make(chan Applog)
+	quit := make(chan struct{})
+	close(quit)
+	mergeLogs(in, out, quit)
+	_, ok := <-out
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSearchMultiAppLogs(c *check.C) {
+	a1 := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "myapp2", Platform: "zend", TeamOwner: s.team.Name}
+	err = CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	base := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	s.insertLogs(c, a1.Name,
+		Applog{Date: base, Message: "0", Source: "web"},
+		Applog{Date: base.Add(2 * time.Second), Message: "2", Source: "web"},
+	)
+	s.insertLogs(c, a2.Name,
+		Applog{Date: base.Add(time.Second), Message: "1", Source: "web"},
+		Applog{Date: base.Add(3 * time.Second), Message: "3", Source: "web"},
+	)
+	logs, err := SearchMultiAppLogs([]App{a1, a2}, LogQuery{Limit: 3})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(logs), check.DeepEquals, []string{"1", "2", "3"})
+	c.Assert(logs[0].AppName, check.Equals, a2.Name)
+	c.Assert(logs[1].AppName, check.Equals, a1.Name)
+	_, err = SearchMultiAppLogs([]App{a1, a2}, LogQuery{After: "abc"})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+}
+
+func (s *S) TestNewMultiAppLogListener(c *check.C) {
+	original := logMergeWindow
+	logMergeWindow = 100 * time.Millisecond
+	defer func() { logMergeWindow = original }()
+	apps := []App{{Name: "myapp1"}, {Name: "myapp2"}}
+	l, err := NewMultiAppLogListener(apps, LogFilter{Sources: []string{"web"}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	base := time.Now().UTC()
+	err = insertLogs("myapp1", []interface{}{
+		Applog{Date: base, Message: "1", Source: "web"},
+		Applog{Date: base, Message: "x", Source: "worker"},
+	})
+	c.Assert(err, check.IsNil)
+	err = insertLogs("myapp2", []interface{}{Applog{Date: base.Add(time.Second), Message: "2", Source: "web"}})
+	c.Assert(err, check.IsNil)
+	var received []string
+	timeout := time.After(5 * time.Second)
+	for len(received) < 2 {
+		select {
+		case msg := <-l.ListenChan():
+			received = append(received, msg.AppName+":"+msg.Message)
+		case <-timeout:
+			c.Fatalf("timeout waiting for logs, received: %v", received)
+		}
+	}
+	c.Assert(received, check.DeepEquals, []string{"myapp1:1", "myapp2:2"})
+	l.Close()
+	for range l.ListenChan() {
+	}
+}
+
+func (s *S) TestMultiAppLogsTooManyApps(c *check.C) {
+	config.Set("server:app-log-max-apps", 1)
+	defer config.Unset("server:app-log-max-apps")
+	apps := []App{{Name: "app1"}, {Name: "app2"}}
+	_, err := SearchMultiAppLogs(apps, LogQuery{Limit: 10})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	_, err = NewMultiAppLogListener(apps, LogFilter{})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+}
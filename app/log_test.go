@@ -38,7 +38,7 @@ func compareLogs(c *check.C, logs1 []Applog, logs2 []Applog) {
 
 func (s *S) TestNewLogListener(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
@@ -55,7 +55,7 @@ func (s *S) TestNewLogListener(c *check.C) {
 
 func (s *S) TestNewLogListenerFiltered(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{Source: "web", Unit: "u1"})
+	l, err := NewLogListener(&app, LogFilter{Sources: []string{"web"}, Units: []string{"u1"}})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
@@ -78,7 +78,7 @@ func (s *S) TestNewLogListenerFiltered(c *check.C) {
 
 func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	c.Assert(l.quit, check.NotNil)
 	c.Assert(l.c, check.NotNil)
@@ -89,7 +89,7 @@ func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 
 func (s *S) TestLogListenerClose(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	_, ok := <-l.c
@@ -101,7 +101,7 @@ func (s *S) TestLogListenerDoubleClose(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "yourapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	l.Close()
@@ -113,7 +113,7 @@ func (s *S) TestNotify(c *check.C) {
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -164,7 +164,7 @@ func (s *S) TestNotifyFiltered(c *check.C) {
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{Source: "tsuru", Unit: "unit1"})
+	l, err := NewLogListener(&app, LogFilter{Sources: []string{"tsuru"}, Units: []string{"unit1"}})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -217,7 +217,7 @@ func (s *S) TestNotifySendOnClosedChannel(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	ms := []interface{}{
@@ -231,7 +231,7 @@ func (s *S) TestLogDispatcherSend(c *check.C) {
 	app := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
-	listener, err := NewLogListener(&app, Applog{})
+	listener, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer listener.Close()
 	dispatcher := NewlogDispatcher(2000000)
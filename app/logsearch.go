@@ -0,0 +1,122 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+const (
+	// maxLogMessageFilterSize is the maximum size of the text or regular
+	// expression used to search log messages.
+	maxLogMessageFilterSize = 256
+
+	// logMessageSearchRange is the maximum time range covered by a search on
+	// log messages. Messages are not indexed, so a search scans every entry in
+	// its time range.
+	logMessageSearchRange = 24 * time.Hour
+)
+
+// LogFilter selects app log entries. Empty fields match every entry, and
+// entries matching any of the Sources and any of the Units are selected.
+type LogFilter struct {
+	Sources []string
+	Units   []string
+	Since   time.Time
+	Until   time.Time
+	// Message selects entries whose message contains it. When Regex is set,
+	// Message is a regular expression the message must match instead.
+	Message string
+	Regex   bool
+	// Fields selects entries having all the given fields, see Applog.
+	Fields map[string]string
+}
+
+// LogQuery is a LogFilter with pagination. Before and After are cursors
+// taken from a previous LogPage: Before returns entries older than the
+// cursor and After returns entries newer than it. Without cursors, the
+// newest entries are returned.
+type LogQuery struct {
+	LogFilter
+	Limit  int
+	Before string
+	After  string
+}
+
+// LogPage is a page of log entries, in chronological order. Prev is the
+// cursor used to get older entries, it's empty when there are no older
+// entries. Next is the cursor used to get entries newer than the ones in the
+// page.
+type LogPage struct {
+	Logs []Applog
+	Prev string
+	Next string
+}
+
+func filterFromApplog(filterLog Applog) LogFilter {
+	var f LogFilter
+	if filterLog.Source != "" {
+		f.Sources = []string{filterLog.Source}
+	}
+	if filterLog.Unit != "" {
+		f.Units = []string{filterLog.Unit}
+	}
+	return f
+}
+
+// Validate checks whether the filter is valid, returning a ValidationError
+// when it's not.
+func (f *LogFilter) Validate() error {
+	if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+		return &tsuruErrors.ValidationError{Message: "until must not be before since"}
+	}
+	if len(f.Message) > maxLogMessageFilterSize {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("message must not be longer than %d characters", maxLogMessageFilterSize)}
+	}
+	if f.Regex {
+		if _, err := regexp.Compile(f.Message); err != nil {
+			return &tsuruErrors.ValidationError{Message: "invalid message regular expression: " + err.Error()}
+		}
+	}
+	for name := range f.Fields {
+		if logFieldName(name) != name {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid log field name %q", name)}
+		}
+	}
+	return nil
+}
+
+// Validate checks whether the query is valid, returning a ValidationError
+// when it's not.
+func (q *LogQuery) Validate() error {
+	if q.Before != "" && q.After != "" {
+		return &tsuruErrors.ValidationError{Message: "before and after cannot be used together"}
+	}
+	if q.Limit < 0 {
+		return &tsuruErrors.ValidationError{Message: "limit must not be negative"}
+	}
+	if q.Message != "" && !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Sub(q.Since) > logMessageSearchRange {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("message searches must not cover more than %v", logMessageSearchRange)}
+	}
+	return q.LogFilter.Validate()
+}
+
+// boundMessageSearch limits the time range of a search on log messages when
+// since is not given, covering the logMessageSearchRange before until, or
+// before now when until is not given either.
+func (q *LogQuery) boundMessageSearch(now time.Time) {
+	if q.Message == "" || !q.Since.IsZero() {
+		return
+	}
+	until := q.Until
+	if until.IsZero() {
+		until = now
+	}
+	q.Since = until.Add(-logMessageSearchRange)
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertLogs(c *check.C, appName string, logs ...Applog) {
+	coll := s.logConn.Logs(appName)
+	for _, l := range logs {
+		l.AppName = appName
+		err := coll.Insert(l)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func logMessages(logs []Applog) []string {
+	msgs := make([]string, len(logs))
+	for i := range logs {
+		msgs[i] = logs[i].Message
+	}
+	return msgs
+}
+
+func (s *S) TestLogQueryValidate(c *check.C) {
+	now := time.Now()
+	var tests = []struct {
+		query LogQuery
+		err   string
+	}{
+		{LogQuery{}, ""},
+		{LogQuery{LogFilter: LogFilter{Since: now, Until: now.Add(time.Hour)}}, ""},
+		{LogQuery{LogFilter: LogFilter{Since: now, Until: now.Add(-time.Hour)}}, "until must not be before since"},
+		{LogQuery{LogFilter: LogFilter{Message: "a(b", Regex: false}}, ""},
+		{LogQuery{LogFilter: LogFilter{Message: "a(b", Regex: true}}, "invalid message regular expression: .*"},
+		{LogQuery{LogFilter: LogFilter{Message: strings.Repeat("a", 257)}}, "message must not be longer than 256 characters"},
+		{LogQuery{LogFilter: LogFilter{Message: "a", Since: now, Until: now.Add(24 * time.Hour)}}, ""},
+		{LogQuery{LogFilter: LogFilter{Message: "a", Since: now, Until: now.Add(25 * time.Hour)}}, "message searches must not cover more than 24h0m0s"},
+		{LogQuery{Before: "a", After: "b"}, "before and after cannot be used together"},
+		{LogQuery{Limit: -1}, "limit must not be negative"},
+	}
+	for i, tt := range tests {
+		err := tt.query.Validate()
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+			continue
+		}
+		c.Check(err, check.FitsTypeOf, &errors.ValidationError{}, check.Commentf("test %d", i))
+		c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestLogQueryBoundMessageSearch(c *check.C) {
+	now := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	q := LogQuery{}
+	q.boundMessageSearch(now)
+	c.Assert(q.Since.IsZero(), check.Equals, true)
+	q = LogQuery{LogFilter: LogFilter{Message: "a"}}
+	q.boundMessageSearch(now)
+	c.Assert(q.Since, check.DeepEquals, now.Add(-24*time.Hour))
+	q = LogQuery{LogFilter: LogFilter{Message: "a", Until: now.Add(-time.Hour)}}
+	q.boundMessageSearch(now)
+	c.Assert(q.Since, check.DeepEquals, now.Add(-25*time.Hour))
+	q = LogQuery{LogFilter: LogFilter{Message: "a", Since: now.Add(-time.Hour)}}
+	q.boundMessageSearch(now)
+	c.Assert(q.Since, check.DeepEquals, now.Add(-time.Hour))
+}
+
+func (s *S) TestSearchLogsMessageOutsideRange(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	s.insertLogs(c, a.Name,
+		Applog{Date: now.Add(-48 * time.Hour), Message: "old 500", Source: "web"},
+		Applog{Date: now, Message: "new 500", Source: "web"},
+	)
+	page, err := a.SearchLogs(LogQuery{LogFilter: LogFilter{Message: "500"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"new 500"})
+	page, err = a.SearchLogs(LogQuery{LogFilter: LogFilter{Message: "500", Until: now.Add(-24 * time.Hour)}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"old 500"})
+}
+
+func (s *S) TestMongodbLogQuery(c *check.C) {
+	since := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	q := mongodbLogQuery(LogFilter{})
+	c.Assert(q, check.DeepEquals, bson.M{})
+	q = mongodbLogQuery(LogFilter{Sources: []string{"web"}, Units: []string{"u1", "u2"}, Since: since, Message: "a.b"})
+	c.Assert(q, check.DeepEquals, bson.M{
+		"source":  "web",
+		"unit":    bson.M{"$in": []string{"u1", "u2"}},
+		"date":    bson.M{"$gte": since},
+		"message": bson.RegEx{Pattern: `a\.b`},
+	})
+	q = mongodbLogQuery(LogFilter{Until: since, Message: "a.b", Regex: true})
+	c.Assert(q, check.DeepEquals, bson.M{
+		"date":    bson.M{"$lte": since},
+		"message": bson.RegEx{Pattern: "a.b"},
+	})
+	q = mongodbLogQuery(LogFilter{Fields: map[string]string{"level": "error", "request_id": "abc"}})
+	c.Assert(q, check.DeepEquals, bson.M{
+		"fields.level":      "error",
+		"fields.request_id": "abc",
+	})
+}
+
+func (s *S) TestSearchLogsTimeRange(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	base := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		s.insertLogs(c, a.Name, Applog{Date: base.Add(time.Duration(i) * time.Hour), Message: strconv.Itoa(i), Source: "web"})
+	}
+	page, err := a.SearchLogs(LogQuery{LogFilter: LogFilter{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"1", "2", "3"})
+	page, err = a.SearchLogs(LogQuery{LogFilter: LogFilter{Since: base.Add(3 * time.Hour)}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"3", "4"})
+}
+
+func (s *S) TestSearchLogsMessageAndSources(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	s.insertLogs(c, a.Name,
+		Applog{Date: now, Message: "GET /index 200", Source: "web", Unit: "u1"},
+		Applog{Date: now, Message: "GET /admin 500", Source: "web", Unit: "u2"},
+		Applog{Date: now, Message: "job failed with 500", Source: "worker", Unit: "u3"},
+		Applog{Date: now, Message: "restarting 500", Source: "tsuru", Unit: "u1"},
+	)
+	page, err := a.SearchLogs(LogQuery{LogFilter: LogFilter{Message: "500", Sources: []string{"web", "worker"}}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"GET /admin 500", "job failed with 500"})
+	page, err = a.SearchLogs(LogQuery{LogFilter: LogFilter{Message: `^GET /\w+ \d00$`, Regex: true, Units: []string{"u1", "u2"}}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"GET /index 200", "GET /admin 500"})
+	page, err = a.SearchLogs(LogQuery{LogFilter: LogFilter{Message: "/index ("}})
+	c.Assert(err, check.IsNil)
+	c.Assert(page.Logs, check.DeepEquals, []Applog{})
+}
+
+func (s *S) TestSearchLogsPagination(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	for i := 0; i < 7; i++ {
+		s.insertLogs(c, a.Name, Applog{Date: now, Message: strconv.Itoa(i), Source: "web"})
+	}
+	page, err := a.SearchLogs(LogQuery{Limit: 3})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"4", "5", "6"})
+	c.Assert(page.Prev, check.Equals, page.Logs[0].MongoID.Hex())
+	c.Assert(page.Next, check.Equals, page.Logs[2].MongoID.Hex())
+	page, err = a.SearchLogs(LogQuery{Limit: 3, Before: page.Prev})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"1", "2", "3"})
+	c.Assert(page.Prev, check.Not(check.Equals), "")
+	page, err = a.SearchLogs(LogQuery{Limit: 3, Before: page.Prev})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"0"})
+	c.Assert(page.Prev, check.Equals, "")
+	page, err = a.SearchLogs(LogQuery{Limit: 3, After: page.Next})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"1", "2", "3"})
+	c.Assert(page.Prev, check.Equals, page.Logs[0].MongoID.Hex())
+	last := page.Next
+	page, err = a.SearchLogs(LogQuery{Limit: 10, After: last})
+	c.Assert(err, check.IsNil)
+	c.Assert(logMessages(page.Logs), check.DeepEquals, []string{"4", "5", "6"})
+	page, err = a.SearchLogs(LogQuery{Limit: 10, After: page.Next})
+	c.Assert(err, check.IsNil)
+	c.Assert(page.Logs, check.DeepEquals, []Applog{})
+	c.Assert(page.Next, check.Not(check.Equals), "")
+	c.Assert(page.Prev, check.Equals, "")
+}
+
+func (s *S) TestSearchLogsInvalidCursor(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = a.SearchLogs(LogQuery{Before: "xyz"})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `invalid log cursor "xyz"`)
+}
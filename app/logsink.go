@@ -0,0 +1,322 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLogSinkName      = "mongodb"
+	defaultLogSinkQueueSize = 100
+)
+
+var (
+	// appLogSettingsRefreshInterval is how long a log dispatcher trusts the
+	// pool and the log format it has seen for its app before looking them up
+	// again.
+	appLogSettingsRefreshInterval = time.Minute
+
+	logSinkFactories = map[string]logSinkFactory{}
+
+	logSinksMu sync.Mutex
+	logSinks   []*configuredLogSink
+
+	logsSinkWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_write_total",
+		Help: "The number of log entries written to each log sink.",
+	}, []string{"sink"})
+
+	logsSinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_errors_total",
+		Help: "The number of failed writes to each log sink.",
+	}, []string{"sink"})
+
+	logsSinkDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_dropped_total",
+		Help: "The number of log entries dropped because the queue of the log sink was full.",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(logsSinkWritten)
+	prometheus.MustRegister(logsSinkErrors)
+	prometheus.MustRegister(logsSinkDropped)
+	RegisterLogSink("mongodb", newMongodbLogSink)
+}
+
+// LogSink is a destination for app logs. Write receives batches of entries
+// that always belong to the same app.
+type LogSink interface {
+	Write(appName string, logs []*Applog) error
+}
+
+// LogReader is a LogSink that is also able to read back the logs it stores.
+// Only sinks implementing it can be used to show, search and follow app logs.
+type LogReader interface {
+	SearchLogs(appName string, query LogQuery) (*LogPage, error)
+	Listen(appName string, filter LogFilter) (*LogListener, error)
+}
+
+type logSinkFactory func(sinkName, configPrefix string) (LogSink, error)
+
+// RegisterLogSink makes a log sink type available to be used in the
+// "log-sinks" configuration entry.
+func RegisterLogSink(sinkType string, factory logSinkFactory) {
+	logSinkFactories[sinkType] = factory
+}
+
+// configuredLogSink is a sink loaded from the configuration. Sinks able to
+// read logs are written synchronously by the app log dispatchers, so failed
+// batches are retried. Every other sink has its own queue of batches, written
+// by a single goroutine, so a slow or unavailable sink doesn't delay the logs
+// sent to other sinks.
+type configuredLogSink struct {
+	name  string
+	pools []string
+	sink  LogSink
+	queue chan logSinkBatch
+	done  chan struct{}
+}
+
+type logSinkBatch struct {
+	appName string
+	logs    []*Applog
+}
+
+func (s *configuredLogSink) startQueue(size int) {
+	s.queue = make(chan logSinkBatch, size)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for batch := range s.queue {
+			s.write(batch.appName, batch.logs)
+		}
+	}()
+}
+
+// stopQueue waits for the queued batches to be written.
+func (s *configuredLogSink) stopQueue() {
+	if s.queue == nil {
+		return
+	}
+	close(s.queue)
+	<-s.done
+	s.queue = nil
+}
+
+func (s *configuredLogSink) write(appName string, logs []*Applog) error {
+	err := s.sink.Write(appName, logs)
+	if err != nil {
+		logsSinkErrors.WithLabelValues(s.name).Inc()
+		log.Errorf("[log sinks] unable to write logs for app %q to sink %q: %s", appName, s.name, err)
+		return err
+	}
+	logsSinkWritten.WithLabelValues(s.name).Add(float64(len(logs)))
+	return nil
+}
+
+// send writes the logs to the sink, or adds them to the queue of the sink,
+// dropping them when the queue is full.
+func (s *configuredLogSink) send(appName string, logs []*Applog) error {
+	if s.queue == nil {
+		return s.write(appName, logs)
+	}
+	select {
+	case s.queue <- logSinkBatch{appName: appName, logs: logs}:
+	default:
+		logsSinkDropped.WithLabelValues(s.name).Add(float64(len(logs)))
+	}
+	return nil
+}
+
+func (s *configuredLogSink) acceptsPool(pool string) bool {
+	if len(s.pools) == 0 {
+		return true
+	}
+	for _, p := range s.pools {
+		if p == pool {
+			return true
+		}
+	}
+	return false
+}
+
+// getLogSinks returns the log sinks defined in the configuration file, loading
+// them in the first call. When no sinks are configured, every app log is
+// stored in MongoDB.
+func getLogSinks() ([]*configuredLogSink, error) {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	if logSinks != nil {
+		return logSinks, nil
+	}
+	sinks, err := loadLogSinks()
+	if err != nil {
+		return nil, err
+	}
+	logSinks = sinks
+	return logSinks, nil
+}
+
+func loadLogSinks() ([]*configuredLogSink, error) {
+	sinksConf, err := config.Get("log-sinks")
+	if err != nil {
+		sink, _ := newMongodbLogSink(defaultLogSinkName, "")
+		return []*configuredLogSink{{name: defaultLogSinkName, sink: sink}}, nil
+	}
+	sinksMap, ok := sinksConf.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid log-sinks config, it must be a map of sink names")
+	}
+	var names []string
+	for name := range sinksMap {
+		names = append(names, fmt.Sprintf("%v", name))
+	}
+	sort.Strings(names)
+	var sinks []*configuredLogSink
+	for _, name := range names {
+		prefix := "log-sinks:" + name
+		sinkType, err := config.GetString(prefix + ":type")
+		if err != nil {
+			return nil, errors.Errorf("config key '%s:type' not found", prefix)
+		}
+		factory, ok := logSinkFactories[sinkType]
+		if !ok {
+			return nil, errors.Errorf("unknown log sink type %q for sink %q", sinkType, name)
+		}
+		sink, err := factory(name, prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to initialize log sink %q", name)
+		}
+		pools, _ := config.GetList(prefix + ":pools")
+		configured := &configuredLogSink{name: name, pools: pools, sink: sink}
+		if _, ok := sink.(LogReader); !ok {
+			queueSize, _ := config.GetInt(prefix + ":queue-size")
+			if queueSize <= 0 {
+				queueSize = defaultLogSinkQueueSize
+			}
+			configured.startQueue(queueSize)
+		}
+		sinks = append(sinks, configured)
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("invalid log-sinks config, at least one sink must be defined")
+	}
+	return sinks, nil
+}
+
+// closeLogSinks writes the queued logs and closes the loaded sinks that hold
+// resources, making the next call to getLogSinks read the configuration
+// again.
+func closeLogSinks() {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	for _, s := range logSinks {
+		s.stopQueue()
+		if closer, ok := s.sink.(io.Closer); ok {
+			err := closer.Close()
+			if err != nil {
+				log.Errorf("[log sinks] unable to close sink %q: %s", s.name, err)
+			}
+		}
+	}
+	logSinks = nil
+}
+
+func sinksUsePools(sinks []*configuredLogSink) bool {
+	for _, s := range sinks {
+		if len(s.pools) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sinksForPool(sinks []*configuredLogSink, pool string) []*configuredLogSink {
+	var result []*configuredLogSink
+	for _, s := range sinks {
+		if s.acceptsPool(pool) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// appLogSettings holds the fields of an app used when writing its logs.
+type appLogSettings struct {
+	Pool      string
+	LogFormat string
+}
+
+// loadAppLogSettings returns the log settings of the app. Apps that do not
+// exist have empty settings.
+func loadAppLogSettings(appName string) (appLogSettings, error) {
+	var result appLogSettings
+	conn, err := db.Conn()
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	err = conn.Apps().Find(bson.M{"name": appName}).Select(bson.M{"pool": 1, "logformat": 1}).One(&result)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+// writeToSinks sends logs to every sink in the list. It only fails when no
+// sink was able to store the logs, so that a retry does not duplicate the
+// entries in the sinks that succeeded. Logs added to the queue of a sink are
+// considered stored.
+func writeToSinks(sinks []*configuredLogSink, appName string, logs []*Applog) error {
+	var lastErr error
+	written := false
+	for _, s := range sinks {
+		err := s.send(appName, logs)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		written = true
+	}
+	if !written && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+func (app *App) logSinks() ([]*configuredLogSink, error) {
+	sinks, err := getLogSinks()
+	if err != nil {
+		return nil, err
+	}
+	return sinksForPool(sinks, app.Pool), nil
+}
+
+func (app *App) logReader() (LogReader, error) {
+	sinks, err := app.logSinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sinks {
+		if reader, ok := s.sink.(LogReader); ok {
+			return reader, nil
+		}
+	}
+	return nil, errors.Errorf("no log sink able to read logs is configured for pool %q", app.Pool)
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+const (
+	fileSinkDefaultMaxSize  = 100 * 1024 * 1024
+	fileSinkDefaultMaxFiles = 5
+)
+
+func init() {
+	RegisterLogSink("file", newFileLogSink)
+}
+
+// fileLogSink appends logs to one file per app, with one JSON encoded entry
+// per line. Files are rotated when they reach max-size, keeping at most
+// max-files old files named <app>.log.1 to <app>.log.<max-files>.
+type fileLogSink struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	mu       sync.Mutex
+}
+
+func newFileLogSink(sinkName, configPrefix string) (LogSink, error) {
+	dir, err := config.GetString(configPrefix + ":path")
+	if err != nil {
+		return nil, errors.Errorf("config key '%s:path' not found", configPrefix)
+	}
+	maxSize, err := config.GetInt(configPrefix + ":max-size")
+	if err != nil {
+		maxSize = fileSinkDefaultMaxSize
+	}
+	maxFiles, err := config.GetInt(configPrefix + ":max-files")
+	if err != nil {
+		maxFiles = fileSinkDefaultMaxFiles
+	}
+	if maxSize <= 0 || maxFiles < 0 {
+		return nil, errors.New("max-size must be greater than 0 and max-files must not be negative")
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &fileLogSink{dir: dir, maxSize: int64(maxSize), maxFiles: maxFiles}, nil
+}
+
+func (s *fileLogSink) Write(appName string, logs []*Applog) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, l := range logs {
+		err := encoder.Encode(l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.logPath(appName)
+	info, err := os.Stat(path)
+	if err == nil && info.Size() > 0 && info.Size()+int64(buf.Len()) > s.maxSize {
+		err = s.rotate(path)
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(f.Close())
+}
+
+func (s *fileLogSink) logPath(appName string) string {
+	return filepath.Join(s.dir, appName+".log")
+}
+
+func (s *fileLogSink) rotate(path string) error {
+	if s.maxFiles == 0 {
+		return errors.WithStack(os.Remove(path))
+	}
+	err := os.Remove(fmt.Sprintf("%s.%d", path, s.maxFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	for i := s.maxFiles - 1; i > 0; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(os.Rename(path, path+".1"))
+}
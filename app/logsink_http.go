@@ -0,0 +1,64 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+func init() {
+	RegisterLogSink("http", newHTTPLogSink)
+}
+
+// httpLogSink sends each batch of logs as a JSON array in the body of a POST
+// request to the configured URL.
+type httpLogSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPLogSink(sinkName, configPrefix string) (LogSink, error) {
+	url, err := config.GetString(configPrefix + ":url")
+	if err != nil {
+		return nil, errors.Errorf("config key '%s:url' not found", configPrefix)
+	}
+	timeout, err := config.GetInt(configPrefix + ":timeout")
+	if err != nil {
+		timeout = 10
+	}
+	client := *tsuruNet.Dial5FullUnlimitedClient
+	client.Timeout = time.Duration(timeout) * time.Second
+	return &httpLogSink{url: url, client: &client}, nil
+}
+
+func (s *httpLogSink) Write(appName string, logs []*Applog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(rsp.Body)
+		return errors.Errorf("invalid response from log endpoint %q: %d - %s", s.url, rsp.StatusCode, data)
+	}
+	return nil
+}
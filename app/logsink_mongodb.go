@@ -0,0 +1,228 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mongodbLogSink stores logs in one capped collection per app. It's the
+// default sink and the only one able to follow logs.
+type mongodbLogSink struct{}
+
+var _ LogReader = &mongodbLogSink{}
+
+func isCappedPositionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "CappedPositionLost")
+}
+
+func isSessionClosed(r interface{}) bool {
+	return fmt.Sprintf("%v", r) == "Session already closed"
+}
+
+func newMongodbLogSink(sinkName, configPrefix string) (LogSink, error) {
+	return &mongodbLogSink{}, nil
+}
+
+func (s *mongodbLogSink) Write(appName string, logs []*Applog) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	docs := make([]interface{}, len(logs))
+	for i := range logs {
+		docs[i] = logs[i]
+	}
+	return conn.Logs(appName).Insert(docs...)
+}
+
+// mongodbLogQuery returns the MongoDB query selecting the log entries
+// matching the filter.
+func mongodbLogQuery(filter LogFilter) bson.M {
+	q := bson.M{}
+	if len(filter.Sources) == 1 {
+		q["source"] = filter.Sources[0]
+	} else if len(filter.Sources) > 1 {
+		q["source"] = bson.M{"$in": filter.Sources}
+	}
+	if len(filter.Units) == 1 {
+		q["unit"] = filter.Units[0]
+	} else if len(filter.Units) > 1 {
+		q["unit"] = bson.M{"$in": filter.Units}
+	}
+	date := bson.M{}
+	if !filter.Since.IsZero() {
+		date["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		date["$lte"] = filter.Until
+	}
+	if len(date) > 0 {
+		q["date"] = date
+	}
+	if filter.Message != "" {
+		pattern := filter.Message
+		if !filter.Regex {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		q["message"] = bson.RegEx{Pattern: pattern}
+	}
+	for name, value := range filter.Fields {
+		q["fields."+name] = value
+	}
+	return q
+}
+
+// logSearchMaxTime is the maximum time MongoDB spends running a log search.
+var logSearchMaxTime = 30 * time.Second
+
+// SearchLogs pages through the logs of the app using the ids of the entries
+// as cursors.
+func (s *mongodbLogSink) SearchLogs(appName string, query LogQuery) (*LogPage, error) {
+	for _, cursor := range []string{query.Before, query.After} {
+		if cursor != "" && !bson.IsObjectIdHex(cursor) {
+			return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid log cursor %q", cursor)}
+		}
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	coll := conn.Logs(appName)
+	q := mongodbLogQuery(query.LogFilter)
+	sort := "-_id"
+	if query.After != "" {
+		q["_id"] = bson.M{"$gt": bson.ObjectIdHex(query.After)}
+		sort = "_id"
+	} else if query.Before != "" {
+		q["_id"] = bson.M{"$lt": bson.ObjectIdHex(query.Before)}
+	}
+	find := coll.Find(q).Sort(sort).SetMaxTime(logSearchMaxTime)
+	if query.Limit > 0 {
+		find = find.Limit(query.Limit + 1)
+	}
+	logs := []Applog{}
+	err = find.All(&logs)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := query.Limit > 0 && len(logs) > query.Limit
+	if hasMore {
+		logs = logs[:query.Limit]
+	}
+	if query.After == "" {
+		l := len(logs)
+		for i := 0; i < l/2; i++ {
+			logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+		}
+	}
+	page := &LogPage{Logs: logs}
+	if len(logs) == 0 {
+		page.Next = query.After
+		if page.Next == "" {
+			page.Next = query.Before
+		}
+		return page, nil
+	}
+	page.Next = logs[len(logs)-1].MongoID.Hex()
+	if hasMore || query.After != "" {
+		page.Prev = logs[0].MongoID.Hex()
+	}
+	return page, nil
+}
+
+func (s *mongodbLogSink) Listen(appName string, filter LogFilter) (*LogListener, error) {
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan Applog, 10)
+	quit := make(chan struct{})
+	coll := conn.Logs(appName)
+	var lastLog Applog
+	err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
+	if err == mgo.ErrNotFound {
+		// Tail cursors do not work correctly if the collection is empty (the
+		// Next() call wouldn't block). So if the collection is empty we insert
+		// the very first log line in it. This is quite rare in the real world
+		// though so the impact of this extra log message is really small.
+		err = coll.Insert(Applog{
+			Date:    time.Now().In(time.UTC),
+			Message: "Logs initialization",
+			Source:  "tsuru",
+			AppName: appName,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	lastId := lastLog.MongoID
+	mkQuery := func() bson.M {
+		m := mongodbLogQuery(filter)
+		m["_id"] = bson.M{"$gt": lastId}
+		return m
+	}
+	query := coll.Find(mkQuery())
+	tailTimeout := 10 * time.Second
+	iter := query.Sort("$natural").Tail(tailTimeout)
+	go func() {
+		defer close(c)
+		defer func() {
+			if r := recover(); r != nil {
+				if isSessionClosed(r) {
+					return
+				}
+				panic(err)
+			}
+		}()
+		for {
+			var applog Applog
+			for iter.Next(&applog) {
+				lastId = applog.MongoID
+				select {
+				case c <- applog:
+				case <-quit:
+					iter.Close()
+					return
+				}
+			}
+			if iter.Timeout() {
+				continue
+			}
+			if err := iter.Err(); err != nil {
+				if !isCappedPositionLost(err) {
+					log.Errorf("error tailing logs: %v", err)
+					iter.Close()
+					return
+				}
+			}
+			iter.Close()
+			query = coll.Find(mkQuery())
+			iter = query.Sort("$natural").Tail(tailTimeout)
+		}
+	}()
+	l := LogListener{c: c, quit: quit, closeFn: conn.Close}
+	return &l, nil
+}
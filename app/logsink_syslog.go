@@ -0,0 +1,148 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+const (
+	syslogDefaultFacility = 16 // local0
+	syslogSeverityInfo    = 6
+	syslogTimeFormat      = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+func init() {
+	RegisterLogSink("syslog", newSyslogLogSink)
+}
+
+// syslogLogSink forwards logs to a remote syslog server, formatted according
+// to RFC5424. Messages sent over TCP use octet counting framing, as described
+// in RFC6587.
+type syslogLogSink struct {
+	network  string
+	address  string
+	facility int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogLogSink(sinkName, configPrefix string) (LogSink, error) {
+	address, err := config.GetString(configPrefix + ":address")
+	if err != nil {
+		return nil, errors.Errorf("config key '%s:address' not found", configPrefix)
+	}
+	network, _ := config.GetString(configPrefix + ":network")
+	if network == "" {
+		network = "udp"
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, errors.Errorf("invalid syslog network %q, it must be udp or tcp", network)
+	}
+	facility, err := config.GetInt(configPrefix + ":facility")
+	if err != nil {
+		facility = syslogDefaultFacility
+	}
+	if facility < 0 || facility > 23 {
+		return nil, errors.Errorf("invalid syslog facility %d, it must be between 0 and 23", facility)
+	}
+	timeout, err := config.GetInt(configPrefix + ":timeout")
+	if err != nil {
+		timeout = 10
+	}
+	return &syslogLogSink{
+		network:  network,
+		address:  address,
+		facility: facility,
+		timeout:  time.Duration(timeout) * time.Second,
+	}, nil
+}
+
+func (s *syslogLogSink) Write(appName string, logs []*Applog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	var err error
+	if s.network == "tcp" {
+		var buf bytes.Buffer
+		for _, l := range logs {
+			msg := s.format(l)
+			fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+		}
+		_, err = s.conn.Write(buf.Bytes())
+	} else {
+		for _, l := range logs {
+			_, err = s.conn.Write([]byte(s.format(l)))
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *syslogLogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// format returns the log entry as a RFC5424 message. The app name is used as
+// APP-NAME, the unit as HOSTNAME and the source as PROCID.
+func (s *syslogLogSink) format(l *Applog) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		s.facility*8+syslogSeverityInfo,
+		l.Date.UTC().Format(syslogTimeFormat),
+		syslogHeaderField(l.Unit, 255),
+		syslogHeaderField(l.AppName, 48),
+		syslogHeaderField(l.Source, 128),
+		l.Message,
+	)
+}
+
+// syslogHeaderField makes value safe to be used in a syslog header field,
+// which only allows printable US-ASCII characters without spaces.
+func syslogHeaderField(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	return value
+}
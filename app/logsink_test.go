@@ -0,0 +1,311 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+type fakeLogSink struct {
+	mu   sync.Mutex
+	logs map[string][]Applog
+	err  error
+}
+
+func (s *fakeLogSink) Write(appName string, logs []*Applog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.logs == nil {
+		s.logs = make(map[string][]Applog)
+	}
+	for _, l := range logs {
+		s.logs[appName] = append(s.logs[appName], *l)
+	}
+	return nil
+}
+
+func (s *fakeLogSink) appLogs(appName string) []Applog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logs[appName]
+}
+
+var fakeLogSinks = map[string]*fakeLogSink{}
+
+func init() {
+	RegisterLogSink("fake", func(sinkName, configPrefix string) (LogSink, error) {
+		sink := &fakeLogSink{}
+		fakeLogSinks[sinkName] = sink
+		return sink, nil
+	})
+}
+
+func resetLogSinksConfig() {
+	config.Unset("log-sinks")
+	closeLogSinks()
+}
+
+func (s *S) TestGetLogSinksDefault(c *check.C) {
+	resetLogSinksConfig()
+	sinks, err := getLogSinks()
+	c.Assert(err, check.IsNil)
+	c.Assert(sinks, check.HasLen, 1)
+	c.Assert(sinks[0].name, check.Equals, "mongodb")
+	c.Assert(sinks[0].pools, check.IsNil)
+	c.Assert(sinks[0].sink, check.FitsTypeOf, &mongodbLogSink{})
+}
+
+func (s *S) TestGetLogSinksFromConfig(c *check.C) {
+	defer resetLogSinksConfig()
+	closeLogSinks()
+	config.Set("log-sinks:remote:type", "syslog")
+	config.Set("log-sinks:remote:address", "127.0.0.1:514")
+	config.Set("log-sinks:remote:pools", []interface{}{"pool1", "pool2"})
+	config.Set("log-sinks:db:type", "mongodb")
+	sinks, err := getLogSinks()
+	c.Assert(err, check.IsNil)
+	c.Assert(sinks, check.HasLen, 2)
+	c.Assert(sinks[0].name, check.Equals, "db")
+	c.Assert(sinks[0].pools, check.IsNil)
+	c.Assert(sinks[1].name, check.Equals, "remote")
+	c.Assert(sinks[1].pools, check.DeepEquals, []string{"pool1", "pool2"})
+	c.Assert(sinks[1].sink, check.DeepEquals, &syslogLogSink{
+		network:  "udp",
+		address:  "127.0.0.1:514",
+		facility: 16,
+		timeout:  10 * time.Second,
+	})
+	c.Assert(sinksForPool(sinks, "pool1"), check.HasLen, 2)
+	c.Assert(sinksForPool(sinks, "other"), check.DeepEquals, []*configuredLogSink{sinks[0]})
+}
+
+func (s *S) TestGetLogSinksInvalidConfig(c *check.C) {
+	defer resetLogSinksConfig()
+	closeLogSinks()
+	config.Set("log-sinks:mine:type", "unknown")
+	_, err := getLogSinks()
+	c.Assert(err, check.ErrorMatches, `unknown log sink type "unknown" for sink "mine"`)
+	config.Set("log-sinks:mine:type", "http")
+	_, err = getLogSinks()
+	c.Assert(err, check.ErrorMatches, `unable to initialize log sink "mine": config key 'log-sinks:mine:url' not found`)
+}
+
+func (s *S) TestAppLogWritesToPoolSinks(c *check.C) {
+	defer resetLogSinksConfig()
+	closeLogSinks()
+	config.Set("log-sinks:all:type", "fake")
+	config.Set("log-sinks:restricted:type", "fake")
+	config.Set("log-sinks:restricted:pools", []interface{}{"other"})
+	a := App{Name: "myapp", Pool: "pool1"}
+	err := a.Log("last log msg", "tsuru", "outermachine")
+	c.Assert(err, check.IsNil)
+	closeLogSinks()
+	logs := fakeLogSinks["all"].appLogs("myapp")
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "last log msg")
+	c.Assert(fakeLogSinks["restricted"].appLogs("myapp"), check.HasLen, 0)
+	_, err = a.LastLogs(10, Applog{})
+	c.Assert(err, check.ErrorMatches, `no log sink able to read logs is configured for pool "pool1"`)
+}
+
+func (s *S) TestLogDispatcherWritesToSinks(c *check.C) {
+	defer resetLogSinksConfig()
+	closeLogSinks()
+	config.Set("log-sinks:all:type", "fake")
+	config.Set("log-sinks:restricted:type", "fake")
+	config.Set("log-sinks:restricted:pools", []interface{}{s.Pool})
+	a := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dispatcher := NewlogDispatcher(2000000)
+	logMsg := Applog{Date: time.Now(), Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1"}
+	dispatcher.Send(&logMsg)
+	dispatcher.Shutdown()
+	c.Assert(fakeLogSinks["all"].appLogs("myapp1"), check.DeepEquals, []Applog{logMsg})
+	c.Assert(fakeLogSinks["restricted"].appLogs("myapp1"), check.DeepEquals, []Applog{logMsg})
+}
+
+func (s *S) TestWriteToSinksPartialFailure(c *check.C) {
+	failing := &configuredLogSink{name: "failing", sink: &fakeLogSink{err: errors.New("my error")}}
+	working := &configuredLogSink{name: "working", sink: &fakeLogSink{}}
+	logs := []*Applog{{Message: "msg1", AppName: "myapp"}}
+	err := writeToSinks([]*configuredLogSink{failing, working}, "myapp", logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(working.sink.(*fakeLogSink).appLogs("myapp"), check.HasLen, 1)
+	err = writeToSinks([]*configuredLogSink{failing}, "myapp", logs)
+	c.Assert(err, check.ErrorMatches, "my error")
+}
+
+type blockingLogSink struct {
+	fakeLogSink
+	release chan struct{}
+}
+
+func (s *blockingLogSink) Write(appName string, logs []*Applog) error {
+	<-s.release
+	return s.fakeLogSink.Write(appName, logs)
+}
+
+func (s *S) TestWriteToSinksSlowSinkDoesNotBlockOthers(c *check.C) {
+	blocking := &blockingLogSink{release: make(chan struct{})}
+	slow := &configuredLogSink{name: "slow", sink: blocking}
+	slow.startQueue(1)
+	working := &configuredLogSink{name: "working", sink: &fakeLogSink{}}
+	working.startQueue(10)
+	sinks := []*configuredLogSink{slow, working}
+	for i := 0; i < 3; i++ {
+		err := writeToSinks(sinks, "myapp", []*Applog{{Message: "msg", AppName: "myapp"}})
+		c.Assert(err, check.IsNil)
+	}
+	working.stopQueue()
+	c.Assert(working.sink.(*fakeLogSink).appLogs("myapp"), check.HasLen, 3)
+	close(blocking.release)
+	slow.stopQueue()
+	logs := blocking.appLogs("myapp")
+	c.Assert(len(logs) >= 1 && len(logs) <= 2, check.Equals, true)
+}
+
+func (s *S) TestGetLogSinksQueueSize(c *check.C) {
+	defer resetLogSinksConfig()
+	closeLogSinks()
+	config.Set("log-sinks:db:type", "mongodb")
+	config.Set("log-sinks:remote:type", "fake")
+	config.Set("log-sinks:remote:queue-size", 5)
+	sinks, err := getLogSinks()
+	c.Assert(err, check.IsNil)
+	c.Assert(sinks, check.HasLen, 2)
+	c.Assert(sinks[0].queue, check.IsNil)
+	c.Assert(cap(sinks[1].queue), check.Equals, 5)
+}
+
+func (s *S) TestSyslogLogSinkFormat(c *check.C) {
+	sink := &syslogLogSink{facility: 16}
+	date := time.Date(2017, 6, 16, 15, 0, 0, 123000000, time.UTC)
+	msg := sink.format(&Applog{Date: date, Message: "my message", Source: "web", AppName: "myapp", Unit: "unit 1"})
+	c.Assert(msg, check.Equals, "<134>1 2017-06-16T15:00:00.123000Z unit_1 myapp web - - my message")
+	msg = sink.format(&Applog{Date: date, Message: "other", AppName: "myapp"})
+	c.Assert(msg, check.Equals, "<134>1 2017-06-16T15:00:00.123000Z - myapp - - - other")
+}
+
+func (s *S) TestSyslogLogSinkUDP(c *check.C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	sink := &syslogLogSink{network: "udp", address: conn.LocalAddr().String(), facility: 1, timeout: time.Second}
+	defer sink.Close()
+	date := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	err = sink.Write("myapp", []*Applog{{Date: date, Message: "msg1", AppName: "myapp"}})
+	c.Assert(err, check.IsNil)
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buf[:n]), check.Equals, "<14>1 2017-06-16T15:00:00.000000Z - myapp - - - msg1")
+}
+
+func (s *S) TestSyslogLogSinkTCP(c *check.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer listener.Close()
+	received := make(chan string)
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+	sink := &syslogLogSink{network: "tcp", address: listener.Addr().String(), facility: 1, timeout: time.Second}
+	date := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	err = sink.Write("myapp", []*Applog{
+		{Date: date, Message: "msg1", AppName: "myapp"},
+		{Date: date, Message: "msg2", AppName: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	sink.Close()
+	msg := "<14>1 2017-06-16T15:00:00.000000Z - myapp - - - "
+	select {
+	case data := <-received:
+		c.Assert(data, check.Equals, "52 "+msg+"msg152 "+msg+"msg2")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for syslog messages")
+	}
+}
+
+func (s *S) TestHTTPLogSink(c *check.C) {
+	var received []Applog
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+	defer config.Unset("log-sinks")
+	config.Set("log-sinks:remote:url", srv.URL)
+	sink, err := newHTTPLogSink("remote", "log-sinks:remote")
+	c.Assert(err, check.IsNil)
+	date := time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC)
+	logs := []*Applog{{Date: date, Message: "msg1", Source: "web", AppName: "myapp", Unit: "u1"}}
+	err = sink.Write("myapp", logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, []Applog{*logs[0]})
+}
+
+func (s *S) TestHTTPLogSinkInvalidResponse(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "full", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	sink := &httpLogSink{url: srv.URL, client: http.DefaultClient}
+	err := sink.Write("myapp", []*Applog{{Message: "msg1", AppName: "myapp"}})
+	c.Assert(err, check.ErrorMatches, `invalid response from log endpoint ".*": 503 - full\n`)
+}
+
+func (s *S) TestFileLogSinkRotation(c *check.C) {
+	dir, err := ioutil.TempDir("", "logsink")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	sink := &fileLogSink{dir: dir, maxSize: 150, maxFiles: 2}
+	for i := 0; i < 5; i++ {
+		err = sink.Write("myapp", []*Applog{{Message: strings.Repeat("x", 10), AppName: "myapp"}})
+		c.Assert(err, check.IsNil)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "myapp.log*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.DeepEquals, []string{
+		filepath.Join(dir, "myapp.log"),
+		filepath.Join(dir, "myapp.log.1"),
+		filepath.Join(dir, "myapp.log.2"),
+	})
+	f, err := os.Open(filepath.Join(dir, "myapp.log"))
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	c.Assert(scanner.Scan(), check.Equals, true)
+	var entry Applog
+	err = json.Unmarshal(scanner.Bytes(), &entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.Message, check.Equals, strings.Repeat("x", 10))
+	c.Assert(scanner.Scan(), check.Equals, false)
+}
@@ -0,0 +1,551 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/service"
+)
+
+const ConfigChangeCreated = "created"
+
+// Manifest is the declarative description of an app. Empty fields are not
+// managed by the manifest, so applying it keeps their current values. A
+// non-nil but empty list or map means that nothing should be there, e.g. an
+// empty list of CNames removes every CName of the app.
+//
+// Envs only manage the variables set by users: variables exported by tsuru
+// (named TSURU_*), by service binds and secret variables are never changed.
+type Manifest struct {
+	Name        string            `json:"name" yaml:"name"`
+	Platform    string            `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	TeamOwner   string            `json:"team-owner,omitempty" yaml:"team-owner,omitempty"`
+	Teams       []string          `json:"teams,omitempty" yaml:"teams,omitempty"`
+	Plan        string            `json:"plan,omitempty" yaml:"plan,omitempty"`
+	Pool        string            `json:"pool,omitempty" yaml:"pool,omitempty"`
+	Router      string            `json:"router,omitempty" yaml:"router,omitempty"`
+	RouterOpts  map[string]string `json:"router-opts,omitempty" yaml:"router-opts,omitempty"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CNames      []string          `json:"cnames,omitempty" yaml:"cnames,omitempty"`
+	Envs        []ManifestEnv     `json:"envs,omitempty" yaml:"envs,omitempty"`
+	Units       map[string]int    `json:"units,omitempty" yaml:"units,omitempty"`
+	Services    []ManifestService `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+type ManifestEnv struct {
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+	Private bool   `json:"private,omitempty" yaml:"private,omitempty"`
+}
+
+// ManifestService is a service instance that must be bound to the app. It's
+// created, using the team owner of the app, if it doesn't exist.
+type ManifestService struct {
+	Service  string `json:"service" yaml:"service"`
+	Instance string `json:"instance" yaml:"instance"`
+	Plan     string `json:"plan,omitempty" yaml:"plan,omitempty"`
+}
+
+func (s *ManifestService) key() string {
+	return s.Service + "/" + s.Instance
+}
+
+func (m *Manifest) validate() error {
+	if m.Name == "" {
+		return &tsuruErrors.ValidationError{Message: "manifest must have the app name"}
+	}
+	for _, env := range m.Envs {
+		if env.Name == "" {
+			return &tsuruErrors.ValidationError{Message: "manifest envs must have a name"}
+		}
+		if strings.HasPrefix(env.Name, "TSURU_") {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("env %s is managed by tsuru and can't be set in the manifest", env.Name)}
+		}
+	}
+	for process, n := range m.Units {
+		if n < 0 {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid number of units for process %q", process)}
+		}
+	}
+	for _, s := range m.Services {
+		if s.Service == "" || s.Instance == "" {
+			return &tsuruErrors.ValidationError{Message: "manifest services must have the service and instance names"}
+		}
+	}
+	return nil
+}
+
+func isManifestEnv(env bind.EnvVar) bool {
+	return env.InstanceName == "" && !env.Secret && !strings.HasPrefix(env.Name, "TSURU_")
+}
+
+// ExportManifest describes the current state of the app as a manifest.
+func ExportManifest(app *App) (*Manifest, error) {
+	m := Manifest{
+		Name:        app.Name,
+		Platform:    app.Platform,
+		Description: app.Description,
+		TeamOwner:   app.TeamOwner,
+		Teams:       app.Teams,
+		Plan:        app.Plan.Name,
+		Pool:        app.Pool,
+		Router:      app.Router,
+		RouterOpts:  app.RouterOpts,
+		Tags:        app.Tags,
+		CNames:      app.CName,
+	}
+	for _, env := range app.Env {
+		if isManifestEnv(env) {
+			m.Envs = append(m.Envs, ManifestEnv{Name: env.Name, Value: env.Value, Private: !env.Public})
+		}
+	}
+	sort.Slice(m.Envs, func(i, j int) bool { return m.Envs[i].Name < m.Envs[j].Name })
+	units, err := unitsByProcess(app)
+	if err != nil {
+		return nil, err
+	}
+	if len(units) > 0 {
+		m.Units = units
+	}
+	instances, err := app.serviceInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, si := range instances {
+		m.Services = append(m.Services, ManifestService{Service: si.ServiceName, Instance: si.Name, Plan: si.PlanName})
+	}
+	return &m, nil
+}
+
+// PlanManifest returns the changes needed to converge the app to the state
+// described in the manifest.
+func PlanManifest(m *Manifest) ([]ConfigChange, error) {
+	_, changes, err := planManifest(m)
+	return changes, err
+}
+
+func planManifest(m *Manifest) (*App, []ConfigChange, error) {
+	err := m.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	var changes []ConfigChange
+	app, err := GetByName(m.Name)
+	if err == ErrAppNotFound {
+		app = nil
+		changes = append(changes, ConfigChange{Action: ConfigChangeCreated, Kind: "app", Name: m.Name})
+	} else if err != nil {
+		return nil, nil, err
+	} else {
+		changes = append(changes, app.planMetadata(m)...)
+	}
+	current := App{Name: m.Name, TeamOwner: m.TeamOwner}
+	if app != nil {
+		current = *app
+	}
+	changes = append(changes, current.planTeams(m)...)
+	changes = append(changes, current.planEnvs(m)...)
+	serviceChanges, err := current.planServices(m, app == nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes = append(changes, serviceChanges...)
+	changes = append(changes, current.planCNames(m)...)
+	if app != nil {
+		unitChanges, err := app.planUnits(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, unitChanges...)
+	}
+	return app, changes, nil
+}
+
+func (app *App) planMetadata(m *Manifest) []ConfigChange {
+	var changes []ConfigChange
+	fields := []struct {
+		kind    string
+		current string
+		wanted  string
+	}{
+		{"platform", app.Platform, m.Platform},
+		{"description", app.Description, m.Description},
+		{"team-owner", app.TeamOwner, m.TeamOwner},
+		{"plan", app.Plan.Name, m.Plan},
+		{"pool", app.Pool, m.Pool},
+		{"router", app.Router, m.Router},
+	}
+	for _, f := range fields {
+		if f.wanted != "" && f.wanted != f.current {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: f.kind, Name: f.kind, Old: f.current, New: f.wanted})
+		}
+	}
+	if m.RouterOpts != nil && !(len(m.RouterOpts) == 0 && len(app.RouterOpts) == 0) && !reflect.DeepEqual(m.RouterOpts, app.RouterOpts) {
+		changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "router-opts", Name: "router-opts", Old: fmt.Sprint(app.RouterOpts), New: fmt.Sprint(m.RouterOpts)})
+	}
+	if m.Tags != nil {
+		tags := processTags(m.Tags)
+		if !(len(tags) == 0 && len(app.Tags) == 0) && !reflect.DeepEqual(tags, app.Tags) {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "tags", Name: "tags", Old: strings.Join(app.Tags, ","), New: strings.Join(tags, ",")})
+		}
+	}
+	return changes
+}
+
+func (app *App) planTeams(m *Manifest) []ConfigChange {
+	if m.Teams == nil {
+		return nil
+	}
+	owner := app.TeamOwner
+	if m.TeamOwner != "" {
+		owner = m.TeamOwner
+	}
+	var changes []ConfigChange
+	wanted := map[string]bool{owner: true}
+	for _, team := range m.Teams {
+		wanted[team] = true
+		if team != owner && !app.hasTeam(team) {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "team", Name: team})
+		}
+	}
+	for _, team := range app.Teams {
+		if !wanted[team] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "team", Name: team})
+		}
+	}
+	return changes
+}
+
+func (app *App) hasTeam(name string) bool {
+	for _, team := range app.Teams {
+		if team == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *App) planEnvs(m *Manifest) []ConfigChange {
+	if m.Envs == nil {
+		return nil
+	}
+	var changes []ConfigChange
+	wanted := map[string]bool{}
+	for _, env := range m.Envs {
+		wanted[env.Name] = true
+		current, ok := app.Env[env.Name]
+		if !ok || !isManifestEnv(current) {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "env", Name: env.Name, New: env.Value})
+		} else if current.Value != env.Value || current.Public == env.Private {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "env", Name: env.Name, Old: current.Value, New: env.Value})
+		}
+	}
+	for name, env := range app.Env {
+		if isManifestEnv(env) && !wanted[name] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "env", Name: name, Old: env.Value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+func (app *App) planServices(m *Manifest, newApp bool) ([]ConfigChange, error) {
+	if m.Services == nil {
+		return nil, nil
+	}
+	var bound []service.ServiceInstance
+	if !newApp {
+		var err error
+		bound, err = app.serviceInstances()
+		if err != nil {
+			return nil, err
+		}
+	}
+	boundKeys := map[string]bool{}
+	for _, si := range bound {
+		boundKeys[si.ServiceName+"/"+si.Name] = true
+	}
+	var changes []ConfigChange
+	wanted := map[string]bool{}
+	for _, s := range m.Services {
+		key := s.key()
+		wanted[key] = true
+		_, err := service.GetServiceInstance(s.Service, s.Instance)
+		if err == service.ErrServiceInstanceNotFound {
+			changes = append(changes, ConfigChange{Action: ConfigChangeCreated, Kind: "service-instance", Name: key, New: s.Plan})
+		} else if err != nil {
+			return nil, err
+		}
+		if !boundKeys[key] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "bind", Name: key})
+		}
+	}
+	for _, si := range bound {
+		key := si.ServiceName + "/" + si.Name
+		if !wanted[key] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "bind", Name: key})
+		}
+	}
+	return changes, nil
+}
+
+func (app *App) planCNames(m *Manifest) []ConfigChange {
+	if m.CNames == nil {
+		return nil
+	}
+	var changes []ConfigChange
+	current := map[string]bool{}
+	for _, cname := range app.CName {
+		current[cname] = true
+	}
+	wanted := map[string]bool{}
+	for _, cname := range m.CNames {
+		wanted[cname] = true
+		if !current[cname] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdded, Kind: "cname", Name: cname})
+		}
+	}
+	for _, cname := range app.CName {
+		if !wanted[cname] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeRemoved, Kind: "cname", Name: cname})
+		}
+	}
+	return changes
+}
+
+// planUnits compares the units of each process. Units are only managed in
+// existing apps, as new apps must be deployed before adding units.
+func (app *App) planUnits(m *Manifest) ([]ConfigChange, error) {
+	if m.Units == nil {
+		return nil, nil
+	}
+	current, err := unitsByProcess(app)
+	if err != nil {
+		return nil, err
+	}
+	var changes []ConfigChange
+	for process, n := range m.Units {
+		if n != current[process] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdated, Kind: "units", Name: process, Old: strconv.Itoa(current[process]), New: strconv.Itoa(n)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
+
+// manifestChangeGroup returns the group of changes that are applied together
+// with the given kind.
+func manifestChangeGroup(kind string) string {
+	switch kind {
+	case "description", "team-owner", "plan", "pool", "router", "tags":
+		return "metadata"
+	}
+	return kind
+}
+
+// ApplyManifest converges the app to the state described in the manifest,
+// creating it if it doesn't exist, and returns the changes applied. Changes are
+// not rolled back if a step fails: applying the manifest again continues from
+// where it stopped.
+func ApplyManifest(m *Manifest, user *auth.User, w io.Writer) ([]ConfigChange, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	app, changes, err := planManifest(m)
+	if err != nil {
+		return nil, err
+	}
+	if app != nil {
+		for _, change := range changes {
+			if change.Kind == "platform" || change.Kind == "router-opts" {
+				return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("%s can't be changed in an existing app", change.Kind)}
+			}
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "---- App %q is up to date ----\n", m.Name)
+		return nil, nil
+	}
+	fmt.Fprintf(w, "---- Applying %d changes to app %q ----\n", len(changes), m.Name)
+	var applied []ConfigChange
+	var updateData App
+	var setEnvs []bind.EnvVar
+	var unsetEnvs, addCNames, removeCNames []string
+	for i, change := range changes {
+		switch change.Kind {
+		case "app":
+			app = &App{
+				Name:        m.Name,
+				Platform:    m.Platform,
+				Description: m.Description,
+				TeamOwner:   m.TeamOwner,
+				Plan:        Plan{Name: m.Plan},
+				Pool:        m.Pool,
+				Router:      m.Router,
+				RouterOpts:  m.RouterOpts,
+				Tags:        m.Tags,
+			}
+			err = CreateApp(app, user)
+			if err == nil {
+				app, err = GetByName(m.Name)
+			}
+		case "description":
+			updateData.Description = m.Description
+		case "team-owner":
+			updateData.TeamOwner = m.TeamOwner
+		case "plan":
+			updateData.Plan.Name = m.Plan
+		case "pool":
+			updateData.Pool = m.Pool
+		case "router":
+			updateData.Router = m.Router
+		case "tags":
+			updateData.Tags = m.Tags
+		case "team":
+			err = app.applyTeamChange(change)
+		case "env":
+			if change.Action == ConfigChangeRemoved {
+				unsetEnvs = append(unsetEnvs, change.Name)
+			} else {
+				setEnvs = append(setEnvs, m.env(change.Name))
+			}
+		case "service-instance":
+			err = app.createManifestService(m, change.Name, user)
+		case "bind":
+			err = app.applyBindChange(change, w)
+		case "cname":
+			if change.Action == ConfigChangeAdded {
+				addCNames = append(addCNames, change.Name)
+			} else {
+				removeCNames = append(removeCNames, change.Name)
+			}
+		case "units":
+			err = app.applyUnitsChange(change, w)
+		}
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, change)
+		if i+1 < len(changes) && manifestChangeGroup(changes[i+1].Kind) == manifestChangeGroup(change.Kind) {
+			continue
+		}
+		err = app.flushManifestChanges(&updateData, &setEnvs, &unsetEnvs, &addCNames, &removeCNames, user, w)
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// flushManifestChanges applies the changes that are better done at once, like
+// setting many environment variables with a single restart.
+func (app *App) flushManifestChanges(updateData *App, setEnvs *[]bind.EnvVar, unsetEnvs, addCNames, removeCNames *[]string, user *auth.User, w io.Writer) error {
+	var err error
+	if !reflect.DeepEqual(*updateData, App{}) {
+		err = app.Update(*updateData, user.Email, w)
+		*updateData = App{}
+		if err != nil {
+			return err
+		}
+	}
+	if len(*setEnvs) > 0 {
+		err = app.SetEnvs(bind.SetEnvApp{Envs: *setEnvs, ShouldRestart: true, Author: user.Email}, w)
+		*setEnvs = nil
+		if err != nil {
+			return err
+		}
+	}
+	if len(*unsetEnvs) > 0 {
+		err = app.UnsetEnvs(bind.UnsetEnvApp{VariableNames: *unsetEnvs, ShouldRestart: true, Author: user.Email}, w)
+		*unsetEnvs = nil
+		if err != nil {
+			return err
+		}
+	}
+	if len(*addCNames) > 0 {
+		err = app.AddCName(*addCNames...)
+		*addCNames = nil
+		if err != nil {
+			return err
+		}
+	}
+	if len(*removeCNames) > 0 {
+		err = app.RemoveCName(*removeCNames...)
+		*removeCNames = nil
+	}
+	return err
+}
+
+func (m *Manifest) env(name string) bind.EnvVar {
+	for _, env := range m.Envs {
+		if env.Name == name {
+			return bind.EnvVar{Name: env.Name, Value: env.Value, Public: !env.Private}
+		}
+	}
+	return bind.EnvVar{Name: name}
+}
+
+func (app *App) applyTeamChange(change ConfigChange) error {
+	team, err := auth.GetTeam(change.Name)
+	if err != nil {
+		return err
+	}
+	if change.Action == ConfigChangeAdded {
+		err = app.Grant(team)
+		if err == ErrAlreadyHaveAccess {
+			return nil
+		}
+		return err
+	}
+	return app.Revoke(team)
+}
+
+func (app *App) createManifestService(m *Manifest, key string, user *auth.User) error {
+	for _, s := range m.Services {
+		if s.key() != key {
+			continue
+		}
+		srv := service.Service{Name: s.Service}
+		err := srv.Get()
+		if err != nil {
+			return err
+		}
+		instance := service.ServiceInstance{Name: s.Instance, PlanName: s.Plan, TeamOwner: app.TeamOwner}
+		return service.CreateServiceInstance(instance, &srv, user, "")
+	}
+	return nil
+}
+
+func (app *App) applyBindChange(change ConfigChange, w io.Writer) error {
+	parts := strings.SplitN(change.Name, "/", 2)
+	instance, err := service.GetServiceInstance(parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	if change.Action == ConfigChangeAdded {
+		return instance.BindApp(app, true, w)
+	}
+	return instance.UnbindApp(app, true, w)
+}
+
+func (app *App) applyUnitsChange(change ConfigChange, w io.Writer) error {
+	old, _ := strconv.Atoi(change.Old)
+	wanted, _ := strconv.Atoi(change.New)
+	if wanted > old {
+		return app.AddUnits(uint(wanted-old), change.Name, w)
+	}
+	return app.RemoveUnits(uint(old-wanted), change.Name, w)
+}
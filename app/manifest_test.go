@@ -0,0 +1,201 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createManifestApp(c *check.C) *App {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Description: "my app"}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = dbApp.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+			{Name: "DATABASE_PASSWORD", Value: "secret"},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	return dbApp
+}
+
+func (s *S) TestExportManifest(c *check.C) {
+	a := s.createManifestApp(c)
+	s.provisioner.AddUnits(a, 2, "web", nil)
+	err := a.AddCName("myapp.tsuru.io")
+	c.Assert(err, check.IsNil)
+	m, err := ExportManifest(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &Manifest{
+		Name:        "myapp",
+		Platform:    "python",
+		Description: "my app",
+		TeamOwner:   s.team.Name,
+		Teams:       []string{s.team.Name},
+		Plan:        a.Plan.Name,
+		Pool:        a.Pool,
+		Router:      a.Router,
+		CNames:      []string{"myapp.tsuru.io"},
+		Envs: []ManifestEnv{
+			{Name: "DATABASE_HOST", Value: "localhost"},
+			{Name: "DATABASE_PASSWORD", Value: "secret", Private: true},
+		},
+		Units: map[string]int{"web": 2},
+	})
+}
+
+func (s *S) TestPlanManifestUpToDate(c *check.C) {
+	a := s.createManifestApp(c)
+	m, err := ExportManifest(a)
+	c.Assert(err, check.IsNil)
+	changes, err := PlanManifest(m)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 0)
+}
+
+func (s *S) TestPlanManifest(c *check.C) {
+	a := s.createManifestApp(c)
+	s.provisioner.AddUnits(a, 1, "web", nil)
+	otherTeam := auth.Team{Name: "other-team"}
+	err := s.conn.Teams().Insert(otherTeam)
+	c.Assert(err, check.IsNil)
+	changes, err := PlanManifest(&Manifest{
+		Name:        "myapp",
+		Description: "new description",
+		Teams:       []string{s.team.Name, "other-team"},
+		CNames:      []string{"myapp.tsuru.io"},
+		Envs: []ManifestEnv{
+			{Name: "DATABASE_HOST", Value: "db.tsuru.io"},
+			{Name: "LOG_LEVEL", Value: "debug"},
+		},
+		Units: map[string]int{"web": 3},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeUpdated, Kind: "description", Name: "description", Old: "my app", New: "new description"},
+		{Action: ConfigChangeAdded, Kind: "team", Name: "other-team"},
+		{Action: ConfigChangeUpdated, Kind: "env", Name: "DATABASE_HOST", Old: "localhost", New: "db.tsuru.io"},
+		{Action: ConfigChangeRemoved, Kind: "env", Name: "DATABASE_PASSWORD", Old: "secret"},
+		{Action: ConfigChangeAdded, Kind: "env", Name: "LOG_LEVEL", New: "debug"},
+		{Action: ConfigChangeAdded, Kind: "cname", Name: "myapp.tsuru.io"},
+		{Action: ConfigChangeUpdated, Kind: "units", Name: "web", Old: "1", New: "3"},
+	})
+}
+
+func (s *S) TestPlanManifestNewApp(c *check.C) {
+	changes, err := PlanManifest(&Manifest{
+		Name:      "newapp",
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+		Envs:      []ManifestEnv{{Name: "LOG_LEVEL", Value: "debug"}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeCreated, Kind: "app", Name: "newapp"},
+		{Action: ConfigChangeAdded, Kind: "env", Name: "LOG_LEVEL", New: "debug"},
+	})
+}
+
+func (s *S) TestPlanManifestInvalid(c *check.C) {
+	_, err := PlanManifest(&Manifest{})
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	_, err = PlanManifest(&Manifest{Name: "myapp", Envs: []ManifestEnv{{Name: "TSURU_APPNAME", Value: "x"}}})
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	_, err = PlanManifest(&Manifest{Name: "myapp", Units: map[string]int{"web": -1}})
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+}
+
+func (s *S) TestApplyManifest(c *check.C) {
+	a := s.createManifestApp(c)
+	s.provisioner.AddUnits(a, 1, "web", nil)
+	m := Manifest{
+		Name:        "myapp",
+		Description: "new description",
+		Tags:        []string{"tag1"},
+		CNames:      []string{"myapp.tsuru.io"},
+		Envs:        []ManifestEnv{{Name: "LOG_LEVEL", Value: "debug"}},
+		Units:       map[string]int{"web": 3},
+	}
+	var buf bytes.Buffer
+	changes, err := ApplyManifest(&m, s.user, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 7)
+	c.Assert(buf.String(), check.Matches, `(?s)---- Applying 7 changes to app "myapp" ----.*`)
+	dbApp, err := GetByName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "new description")
+	c.Assert(dbApp.Tags, check.DeepEquals, []string{"tag1"})
+	c.Assert(dbApp.CName, check.DeepEquals, []string{"myapp.tsuru.io"})
+	c.Assert(dbApp.Env["LOG_LEVEL"].Value, check.Equals, "debug")
+	_, ok := dbApp.Env["DATABASE_HOST"]
+	c.Assert(ok, check.Equals, false)
+	c.Assert(dbApp.Env["TSURU_APPNAME"].Value, check.Equals, "myapp")
+	units, err := unitsByProcess(dbApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.DeepEquals, map[string]int{"web": 3})
+	changes, err = PlanManifest(&m)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 0)
+	buf.Reset()
+	changes, err = ApplyManifest(&m, s.user, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 0)
+	c.Assert(buf.String(), check.Equals, "---- App \"myapp\" is up to date ----\n")
+}
+
+func (s *S) TestApplyManifestCreatesApp(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer server.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": server.URL}, OwnerTeams: []string{s.team.Name}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	m := Manifest{
+		Name:      "newapp",
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+		Envs:      []ManifestEnv{{Name: "LOG_LEVEL", Value: "debug"}},
+		Services:  []ManifestService{{Service: "mysql", Instance: "mydb"}},
+	}
+	changes, err := ApplyManifest(&m, s.user, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []ConfigChange{
+		{Action: ConfigChangeCreated, Kind: "app", Name: "newapp"},
+		{Action: ConfigChangeAdded, Kind: "env", Name: "LOG_LEVEL", New: "debug"},
+		{Action: ConfigChangeCreated, Kind: "service-instance", Name: "mysql/mydb"},
+		{Action: ConfigChangeAdded, Kind: "bind", Name: "mysql/mydb"},
+	})
+	dbApp, err := GetByName("newapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Platform, check.Equals, "python")
+	c.Assert(dbApp.Env["LOG_LEVEL"].Value, check.Equals, "debug")
+	c.Assert(dbApp.Env["DATABASE_USER"].InstanceName, check.Equals, "mydb")
+	si, err := service.GetServiceInstance("mysql", "mydb")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(si.Apps, check.DeepEquals, []string{"newapp"})
+}
+
+func (s *S) TestApplyManifestCantChangePlatform(c *check.C) {
+	s.createManifestApp(c)
+	_, err := ApplyManifest(&Manifest{Name: "myapp", Platform: "ruby"}, s.user, nil)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	dbApp, err := GetByName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Platform, check.Equals, "python")
+}
@@ -21,6 +21,22 @@ type Plan struct {
 	Swap     int64  `json:"swap"`
 	CpuShare int    `json:"cpushare"`
 	Default  bool   `json:"default,omitempty"`
+	// CPULimit is the maximum CPU used by each unit, in millicores, 1000
+	// being a whole CPU. Unlike CpuShare, it's an absolute limit, enforced
+	// even when the node has idle CPU. Zero means no limit.
+	CPULimit int `json:"cpuLimit,omitempty"`
+	// CPURequest and MemoryRequest are the CPU, in millicores, and memory,
+	// in bytes, reserved for each unit. They must not be greater than the
+	// respective limits.
+	CPURequest    int   `json:"cpuRequest,omitempty"`
+	MemoryRequest int64 `json:"memoryRequest,omitempty"`
+	// EphemeralStorage is the maximum size, in bytes, of the local disk
+	// written by each unit. Zero means no limit.
+	EphemeralStorage int64 `json:"ephemeralStorage,omitempty"`
+	// LogLinesPerSecond and LogBytesPerDay are the log limits of apps using
+	// the plan, see LogLimit.
+	LogLinesPerSecond int   `json:"logLinesPerSecond,omitempty"`
+	LogBytesPerDay    int64 `json:"logBytesPerDay,omitempty"`
 }
 
 type PlanValidationError struct{ field string }
@@ -35,8 +51,13 @@ var (
 	ErrPlanDefaultAmbiguous = errors.New("more than one default plan found")
 	ErrLimitOfCpuShare      = errors.New("The minimum allowed cpu-shares is 2")
 	ErrLimitOfMemory        = errors.New("The minimum allowed memory is 4MB")
+	ErrLimitOfCPU           = errors.New("The minimum allowed cpu limit is 10 millicores")
 )
 
+// minCPULimit is the minimum CPU limit, in millicores, matching the minimum
+// CPU quota of one millisecond per 100ms period accepted by docker.
+const minCPULimit = 10
+
 func (plan *Plan) Save() error {
 	if plan.Name == "" {
 		return PlanValidationError{"name"}
@@ -47,6 +68,16 @@ func (plan *Plan) Save() error {
 	if plan.Memory > 0 && plan.Memory < 4194304 {
 		return ErrLimitOfMemory
 	}
+	err := plan.validateResources()
+	if err != nil {
+		return err
+	}
+	if plan.LogLinesPerSecond < 0 {
+		return PlanValidationError{"logLinesPerSecond"}
+	}
+	if plan.LogBytesPerDay < 0 {
+		return PlanValidationError{"logBytesPerDay"}
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -65,6 +96,25 @@ func (plan *Plan) Save() error {
 	return err
 }
 
+func (plan *Plan) validateResources() error {
+	if plan.CPULimit < 0 {
+		return PlanValidationError{"cpuLimit"}
+	}
+	if plan.CPULimit > 0 && plan.CPULimit < minCPULimit {
+		return ErrLimitOfCPU
+	}
+	if plan.CPURequest < 0 || (plan.CPULimit > 0 && plan.CPURequest > plan.CPULimit) {
+		return PlanValidationError{"cpuRequest"}
+	}
+	if plan.MemoryRequest < 0 || (plan.Memory > 0 && plan.MemoryRequest > plan.Memory) {
+		return PlanValidationError{"memoryRequest"}
+	}
+	if plan.EphemeralStorage < 0 {
+		return PlanValidationError{"ephemeralStorage"}
+	}
+	return nil
+}
+
 func PlansList() ([]Plan, error) {
 	conn, err := db.Conn()
 	if err != nil {
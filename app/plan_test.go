@@ -46,11 +46,54 @@ func (s *S) TestPlanAddInvalid(c *check.C) {
 			Swap:     1024,
 			CpuShare: 100,
 		},
+		{
+			Name:              "plan1",
+			CpuShare:          100,
+			LogLinesPerSecond: -1,
+		},
+		{
+			Name:           "plan1",
+			CpuShare:       100,
+			LogBytesPerDay: -1,
+		},
+		{
+			Name:     "plan1",
+			CpuShare: 100,
+			CPULimit: 5,
+		},
+		{
+			Name:       "plan1",
+			CpuShare:   100,
+			CPULimit:   500,
+			CPURequest: 1000,
+		},
+		{
+			Name:          "plan1",
+			CpuShare:      100,
+			Memory:        4194304,
+			MemoryRequest: 8388608,
+		},
+		{
+			Name:             "plan1",
+			CpuShare:         100,
+			EphemeralStorage: -1,
+		},
+	}
+	expectedError := []error{
+		PlanValidationError{"name"},
+		ErrLimitOfCpuShare,
+		ErrLimitOfMemory,
+		PlanValidationError{"logLinesPerSecond"},
+		PlanValidationError{"logBytesPerDay"},
+		ErrLimitOfCPU,
+		PlanValidationError{"cpuRequest"},
+		PlanValidationError{"memoryRequest"},
+		PlanValidationError{"ephemeralStorage"},
 	}
-	expectedError := []error{PlanValidationError{"name"}, ErrLimitOfCpuShare, ErrLimitOfMemory}
 	for i, p := range invalidPlans {
 		err := p.Save()
 		c.Assert(err, check.FitsTypeOf, expectedError[i])
+		c.Assert(err, check.Equals, expectedError[i])
 	}
 }
 
@@ -5,20 +5,32 @@
 package app
 
 import (
+	"reflect"
+
 	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/service"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-func reserveUnits(app *App, quantity int) error {
+func reserveUnits(app *App, quantity int, process string) error {
 	app, err := checkAppLimit(app.Name, quantity)
 	if err != nil {
 		return err
 	}
+	resources := teamResources(app.PlanForProcess(process), int64(quantity))
+	err = quota.ReserveTeamResources(app.TeamOwner, resources)
+	if err != nil {
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
+		releaseTeamResources(app.TeamOwner, resources)
 		return err
 	}
 	defer conn.Close()
@@ -29,13 +41,16 @@ func reserveUnits(app *App, quantity int) error {
 	for err == mgo.ErrNotFound {
 		app, err = checkAppLimit(app.Name, quantity)
 		if err != nil {
-			return err
+			break
 		}
 		err = conn.Apps().Update(
 			bson.M{"name": app.Name, "quota.inuse": app.Quota.InUse},
 			bson.M{"$inc": bson.M{"quota.inuse": quantity}},
 		)
 	}
+	if err != nil {
+		releaseTeamResources(app.TeamOwner, resources)
+	}
 	return err
 }
 
@@ -53,7 +68,7 @@ func checkAppLimit(name string, quantity int) (*App, error) {
 	return app, nil
 }
 
-func releaseUnits(app *App, quantity int) error {
+func releaseUnits(app *App, quantity int, process string) error {
 	app, err := checkAppUsage(app.Name, quantity)
 	if err != nil {
 		return err
@@ -77,7 +92,10 @@ func releaseUnits(app *App, quantity int) error {
 			bson.M{"$inc": bson.M{"quota.inuse": -1 * quantity}},
 		)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return quota.ReleaseTeamResources(app.TeamOwner, teamResources(app.PlanForProcess(process), int64(quantity)))
 }
 
 func checkAppUsage(name string, quantity int) (*App, error) {
@@ -116,3 +134,165 @@ func ChangeQuota(app *App, limit int) error {
 	app.Quota.Limit = limit
 	return nil
 }
+
+// TeamUsage returns the amount of memory and CPU shares allocated by the
+// units of the apps of the team, according to their plans.
+func TeamUsage(team string) (map[string]int64, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{"teamowner": team}).Select(bson.M{"name": 1, "pool": 1, "plan": 1, "processplans": 1, "quota": 1}).All(&apps)
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]int64{quota.ResourceMemory: 0, quota.ResourceCPUShare: 0}
+	for i := range apps {
+		resources, err := apps[i].allocation()
+		if err != nil {
+			return nil, err
+		}
+		usage[quota.ResourceMemory] += resources[quota.ResourceMemory]
+		usage[quota.ResourceCPUShare] += resources[quota.ResourceCPUShare]
+	}
+	return usage, nil
+}
+
+// MigrateTeamQuotaUsage stores, in the quota of every team, the resources
+// allocated by its apps and service instances. Team quotas keep track of the
+// resources in use as they're reserved and released, so the amounts must be
+// initialized from the resources allocated before.
+func MigrateTeamQuotaUsage() error {
+	teams, err := auth.ListTeams()
+	if err != nil {
+		return err
+	}
+	for _, team := range teams {
+		usage, err := TeamUsage(team.Name)
+		if err != nil {
+			return err
+		}
+		instances, err := service.CountTeamInstances(team.Name)
+		if err != nil {
+			return err
+		}
+		usage[quota.ResourceServiceInstances] = int64(instances)
+		err = quota.SetTeamUsage(team.Name, usage)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teamResources returns the resources of team quotas allocated by the given
+// number of units with the plan.
+func teamResources(plan Plan, units int64) map[string]int64 {
+	return map[string]int64{
+		quota.ResourceMemory:   plan.Memory * units,
+		quota.ResourceCPUShare: int64(plan.CpuShare) * units,
+	}
+}
+
+func releaseTeamResources(team string, resources map[string]int64) {
+	err := quota.ReleaseTeamResources(team, resources)
+	if err != nil {
+		log.Errorf("unable to release resources of team %q: %s", team, err)
+	}
+}
+
+// allocation returns the resources allocated by the units of the app. Units
+// of apps with process plans are listed in the provisioner, so each one is
+// accounted with the plan of its process, others are accounted with the plan
+// of the app.
+func (app *App) allocation() (map[string]int64, error) {
+	if len(app.ProcessPlans) == 0 {
+		return teamResources(app.Plan, int64(app.Quota.InUse)), nil
+	}
+	units, err := app.Units()
+	if err != nil {
+		return nil, err
+	}
+	return app.unitsAllocation(units), nil
+}
+
+// unitsAllocation returns the resources allocated by the given units,
+// according to the plans of their processes.
+func (app *App) unitsAllocation(units []provision.Unit) map[string]int64 {
+	resources := teamResources(Plan{}, 0)
+	for _, u := range units {
+		for resource, amount := range teamResources(app.PlanForProcess(u.ProcessName), 1) {
+			resources[resource] += amount
+		}
+	}
+	return resources
+}
+
+// allocationChange returns the resources allocated by the units of the app
+// and the ones they allocated with the old plans.
+func (app *App) allocationChange(oldPlan Plan, oldProcessPlans map[string]Plan) (current, previous map[string]int64, err error) {
+	if len(app.ProcessPlans) == 0 && len(oldProcessPlans) == 0 {
+		units := int64(app.Quota.InUse)
+		return teamResources(app.Plan, units), teamResources(oldPlan, units), nil
+	}
+	units, err := app.Units()
+	if err != nil {
+		return nil, nil, err
+	}
+	old := App{Plan: oldPlan, ProcessPlans: oldProcessPlans}
+	return app.unitsAllocation(units), old.unitsAllocation(units), nil
+}
+
+// reserveTeamAllocationChange reserves, in the quota of the team owning the
+// app, the resources allocated by its units after a change of its plans or of
+// its team owner, releasing the ones allocated before the change.
+func (app *App) reserveTeamAllocationChange(oldTeam string, oldPlan Plan, oldProcessPlans map[string]Plan) error {
+	if app.TeamOwner == oldTeam && app.Plan == oldPlan && reflect.DeepEqual(app.ProcessPlans, oldProcessPlans) {
+		return nil
+	}
+	current, previous, err := app.allocationChange(oldPlan, oldProcessPlans)
+	if err != nil {
+		return err
+	}
+	if app.TeamOwner == oldTeam {
+		return quota.ReserveTeamResources(app.TeamOwner, subtractResources(current, previous))
+	}
+	err = quota.ReserveTeamResources(app.TeamOwner, current)
+	if err != nil {
+		return err
+	}
+	releaseTeamResources(oldTeam, previous)
+	return nil
+}
+
+// revertTeamAllocationChange gives back the resources changed by
+// reserveTeamAllocationChange when the app could not be updated.
+func (app *App) revertTeamAllocationChange(oldTeam string, oldPlan Plan, oldProcessPlans map[string]Plan) {
+	if app.TeamOwner == oldTeam && app.Plan == oldPlan && reflect.DeepEqual(app.ProcessPlans, oldProcessPlans) {
+		return
+	}
+	current, previous, err := app.allocationChange(oldPlan, oldProcessPlans)
+	if err != nil {
+		log.Errorf("unable to revert resources allocated by app %q: %s", app.Name, err)
+		return
+	}
+	if app.TeamOwner == oldTeam {
+		releaseTeamResources(app.TeamOwner, subtractResources(current, previous))
+		return
+	}
+	releaseTeamResources(app.TeamOwner, current)
+	releaseTeamResources(oldTeam, subtractResources(nil, previous))
+}
+
+func subtractResources(a, b map[string]int64) map[string]int64 {
+	result := make(map[string]int64, len(a))
+	for resource, amount := range a {
+		result[resource] = amount
+	}
+	for resource, amount := range b {
+		result[resource] -= amount
+	}
+	return result
+}
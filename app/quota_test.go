@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"sync"
 
+	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
@@ -22,7 +23,7 @@ func (s *S) TestReserveUnits(c *check.C) {
 	}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := reserveUnits(app, 6)
+	err := reserveUnits(app, 6, "")
 	c.Assert(err, check.IsNil)
 	app, err = GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -35,7 +36,7 @@ func (s *S) TestReserveUnitsAppNotFound(c *check.C) {
 		Quota:  quota.Quota{Limit: 7},
 		Router: "fake",
 	}
-	err := reserveUnits(&app, 6)
+	err := reserveUnits(&app, 6, "")
 	c.Assert(err, check.Equals, ErrAppNotFound)
 }
 
@@ -47,9 +48,9 @@ func (s *S) TestReserveUnitsQuotaExceeded(c *check.C) {
 	}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := reserveUnits(&app, 6)
+	err := reserveUnits(&app, 6, "")
 	c.Assert(err, check.IsNil)
-	err = reserveUnits(&app, 2)
+	err = reserveUnits(&app, 2, "")
 	c.Assert(err, check.NotNil)
 	e, ok := err.(*quota.QuotaExceededError)
 	c.Assert(ok, check.Equals, true)
@@ -61,7 +62,7 @@ func (s *S) TestReserveUnitsUnlimitedQuota(c *check.C) {
 	app := &App{Name: "together", Quota: quota.Unlimited, Router: "fake"}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := reserveUnits(app, 6)
+	err := reserveUnits(app, 6, "")
 	c.Assert(err, check.IsNil)
 	app, err = GetByName(app.Name)
 	c.Assert(err, check.IsNil)
@@ -83,7 +84,7 @@ func (s *S) TestReserveUnitsIsAtomic(c *check.C) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			reserveUnits(app, 3)
+			reserveUnits(app, 3, "")
 		}()
 	}
 	wg.Wait()
@@ -100,13 +101,34 @@ func (s *S) TestReleaseUnits(c *check.C) {
 	}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := releaseUnits(app, 6)
+	err := releaseUnits(app, 6, "")
 	c.Assert(err, check.IsNil)
 	app, err = GetByName(app.Name)
 	c.Assert(err, check.IsNil)
 	c.Assert(app.Quota.InUse, check.Equals, 1)
 }
 
+func (s *S) TestReleaseUnitsReleasesTeamResources(c *check.C) {
+	app := &App{
+		Name:         "together",
+		TeamOwner:    "team1",
+		Plan:         Plan{Memory: 100, CpuShare: 10},
+		ProcessPlans: map[string]Plan{"worker": {Memory: 200, CpuShare: 20}},
+		Quota:        quota.Unlimited,
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 2, "worker")
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 1, "web")
+	c.Assert(err, check.IsNil)
+	err = releaseUnits(app, 1, "worker")
+	c.Assert(err, check.IsNil)
+	q, err := quota.GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{quota.ResourceMemory: 300, quota.ResourceCPUShare: 30})
+}
+
 func (s *S) TestReleaseUnreservedUnits(c *check.C) {
 	app := App{
 		Name:   "together",
@@ -115,7 +137,7 @@ func (s *S) TestReleaseUnreservedUnits(c *check.C) {
 	}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := releaseUnits(&app, 8)
+	err := releaseUnits(&app, 8, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Not enough reserved units")
 }
@@ -135,7 +157,7 @@ func (s *S) TestReleaseUnitsIsAtomic(c *check.C) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			releaseUnits(app, 3)
+			releaseUnits(app, 3, "")
 		}()
 	}
 	wg.Wait()
@@ -150,7 +172,7 @@ func (s *S) TestReleaseUnitsAppNotFound(c *check.C) {
 		Quota:  quota.Quota{Limit: 7, InUse: 7},
 		Router: "fake",
 	}
-	err := releaseUnits(&app, 6)
+	err := releaseUnits(&app, 6, "")
 	c.Assert(err, check.Equals, ErrAppNotFound)
 }
 
@@ -209,3 +231,183 @@ func (s *S) TestChangeQuotaAppNotFound(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.Equals, mgo.ErrNotFound)
 }
+
+func (s *S) TestTeamUsage(c *check.C) {
+	apps := []App{
+		{Name: "app1", TeamOwner: "team1", Plan: Plan{Memory: 100, CpuShare: 10}, Quota: quota.Quota{InUse: 2}},
+		{Name: "app2", TeamOwner: "team1", Plan: Plan{Memory: 50, CpuShare: 5}, Quota: quota.Quota{InUse: 1}},
+		{Name: "app3", TeamOwner: "team2", Plan: Plan{Memory: 1000, CpuShare: 100}, Quota: quota.Quota{InUse: 1}},
+	}
+	for _, a := range apps {
+		err := s.conn.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	usage, err := TeamUsage("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, map[string]int64{quota.ResourceMemory: 250, quota.ResourceCPUShare: 25})
+	usage, err = TeamUsage("team3")
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, map[string]int64{quota.ResourceMemory: 0, quota.ResourceCPUShare: 0})
+}
+
+func (s *S) TestTeamUsageProcessPlans(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{
+		"plan":         Plan{Name: "small", Memory: 100, CpuShare: 10},
+		"processplans": map[string]Plan{"worker": {Name: "large", Memory: 1000, CpuShare: 50}},
+	}})
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 2, "web", nil)
+	s.provisioner.AddUnits(&a, 1, "worker", nil)
+	usage, err := TeamUsage(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, map[string]int64{quota.ResourceMemory: 1200, quota.ResourceCPUShare: 70})
+}
+
+func (s *S) TestReserveUnitsTeamQuotaExceeded(c *check.C) {
+	app := &App{
+		Name:      "together",
+		TeamOwner: "team1",
+		Plan:      Plan{Memory: 100, CpuShare: 10},
+		Quota:     quota.Unlimited,
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit("team1", quota.ResourceMemory, 250)
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 2, "")
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 1, "")
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: quota.ResourceMemory, Available: 50, Requested: 100})
+	err = quota.SetTeamLimit("team1", quota.ResourceCPUShare, 25)
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit("team1", quota.ResourceMemory, -1)
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 1, "")
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: quota.ResourceCPUShare, Available: 5, Requested: 10})
+	app, err = GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Quota.InUse, check.Equals, 2)
+}
+
+func (s *S) TestReserveUnitsProcessPlanTeamQuotaExceeded(c *check.C) {
+	app := &App{
+		Name:         "together",
+		TeamOwner:    "team1",
+		Plan:         Plan{Memory: 100, CpuShare: 10},
+		ProcessPlans: map[string]Plan{"worker": {Memory: 200, CpuShare: 20}},
+		Quota:        quota.Unlimited,
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit("team1", quota.ResourceMemory, 250)
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 1, "worker")
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(app, 1, "worker")
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: quota.ResourceMemory, Available: 50, Requested: 200})
+}
+
+func (s *S) TestUpdatePlanTeamQuotaExceeded(c *check.C) {
+	plan := Plan{Name: "large", Memory: 4096, CpuShare: 100}
+	err := plan.Save()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"quota.inuse": 2}})
+	c.Assert(err, check.IsNil)
+	app, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	inUse := app.Plan.Memory * 2
+	err = quota.SetTeamUsage(s.team.Name, map[string]int64{quota.ResourceMemory: inUse})
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit(s.team.Name, quota.ResourceMemory, inUse+100)
+	c.Assert(err, check.IsNil)
+	err = app.Update(App{Plan: Plan{Name: "large"}}, "admin@example.com", nil)
+	c.Assert(err, check.FitsTypeOf, &quota.QuotaExceededError{})
+	c.Assert(err.(*quota.QuotaExceededError).Resource, check.Equals, quota.ResourceMemory)
+	app, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Plan.Name, check.Not(check.Equals), "large")
+}
+
+func (s *S) TestUpdateProcessPlanTeamQuotaExceeded(c *check.C) {
+	plan := Plan{Name: "large", Memory: 4096, CpuShare: 100}
+	err := plan.Save()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 2, "web", nil)
+	s.provisioner.AddUnits(&a, 1, "worker", nil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"quota.inuse": 3}})
+	c.Assert(err, check.IsNil)
+	app, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	inUse := app.Plan.Memory * 3
+	err = quota.SetTeamUsage(s.team.Name, map[string]int64{quota.ResourceMemory: inUse})
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit(s.team.Name, quota.ResourceMemory, inUse+100)
+	c.Assert(err, check.IsNil)
+	err = app.Update(App{ProcessPlans: map[string]Plan{"worker": {Name: "large"}}}, "admin@example.com", nil)
+	c.Assert(err, check.FitsTypeOf, &quota.QuotaExceededError{})
+	c.Assert(err.(*quota.QuotaExceededError).Resource, check.Equals, quota.ResourceMemory)
+	app, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.ProcessPlans, check.IsNil)
+}
+
+func (s *S) TestUpdateTeamOwnerMovesTeamResources(c *check.C) {
+	team := auth.Team{Name: "other-team"}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = reserveUnits(&a, 2, "")
+	c.Assert(err, check.IsNil)
+	app, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	resources := teamResources(app.Plan, 2)
+	err = quota.SetTeamLimit(team.Name, quota.ResourceMemory, resources[quota.ResourceMemory]-1)
+	c.Assert(err, check.IsNil)
+	err = app.Update(App{TeamOwner: team.Name}, "admin@example.com", nil)
+	c.Assert(err, check.FitsTypeOf, &quota.QuotaExceededError{})
+	err = quota.SetTeamLimit(team.Name, quota.ResourceMemory, -1)
+	c.Assert(err, check.IsNil)
+	app, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = app.Update(App{TeamOwner: team.Name}, "admin@example.com", nil)
+	c.Assert(err, check.IsNil)
+	q, err := quota.GetTeamQuota(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, resources)
+	q, err = quota.GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{quota.ResourceMemory: 0, quota.ResourceCPUShare: 0})
+}
+
+func (s *S) TestMigrateTeamQuotaUsage(c *check.C) {
+	apps := []App{
+		{Name: "app1", TeamOwner: s.team.Name, Plan: Plan{Memory: 100, CpuShare: 10}, Quota: quota.Quota{InUse: 2}},
+		{Name: "app2", TeamOwner: s.team.Name, Plan: Plan{Memory: 50, CpuShare: 5}, Quota: quota.Quota{InUse: 1}},
+	}
+	for _, a := range apps {
+		err := s.conn.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	err := s.conn.ServiceInstances().Insert(bson.M{"name": "mydb", "service_name": "mysql", "teamowner": s.team.Name})
+	c.Assert(err, check.IsNil)
+	err = MigrateTeamQuotaUsage()
+	c.Assert(err, check.IsNil)
+	q, err := quota.GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{
+		quota.ResourceMemory:           250,
+		quota.ResourceCPUShare:         25,
+		quota.ResourceServiceInstances: 1,
+	})
+}
@@ -0,0 +1,603 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type renamePipelineArgs struct {
+	old       *App
+	app       *App
+	writer    io.Writer
+	oldToken  string
+	units     map[string]int
+	instances []service.ServiceInstance
+}
+
+// RenameHook is called by Rename to move the records kept by other packages
+// under the name of an app. If the rename is rolled back, the hook is called
+// again with the names swapped.
+type RenameHook func(oldName, newName string) error
+
+var renameHooks []RenameHook
+
+// AddRenameHook registers a hook to be called when an app is renamed.
+func AddRenameHook(hook RenameHook) {
+	renameHooks = append(renameHooks, hook)
+}
+
+// Rename changes the name of the app to newName. As the name is the key used
+// by routers, repositories, images, logs, events and service binds, all of
+// them are moved to the new name: a new router backend is created with the
+// routes of the old one, the units are recreated under the new name using the
+// images already built for the app and, once they're routed, the cnames are
+// swapped to the new backend and the binds with service instances are moved to
+// the new name. The old backend and units are only removed after everything
+// else succeeded, if any step fails the ones already executed are rolled back.
+func Rename(app *App, newName string, w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	if newName == app.Name {
+		return &tsuruErrors.ValidationError{Message: "the new name must be different from the current one"}
+	}
+	if newName == InternalAppName || !nameRegexp.MatchString(newName) {
+		return &tsuruErrors.ValidationError{Message: "Invalid app name, your app should have at most 63 " +
+			"characters, containing only lower case letters, numbers or dashes, " +
+			"starting with a letter."}
+	}
+	if _, err := GetByName(newName); err != ErrAppNotFound {
+		if err != nil {
+			return err
+		}
+		return ErrAppAlreadyExists
+	}
+	isSwapped, swappedWith, err := router.IsSwapped(app.Name)
+	if err != nil {
+		return errors.Wrap(err, "unable to check if app is swapped")
+	}
+	if isSwapped {
+		return errors.Errorf("application is swapped with %q, cannot rename it", swappedWith)
+	}
+	old := *app
+	old.Env = make(map[string]bind.EnvVar, len(app.Env))
+	for k, v := range app.Env {
+		old.Env[k] = v
+	}
+	args := renamePipelineArgs{
+		old:    &old,
+		app:    app,
+		writer: w,
+	}
+	fmt.Fprintf(w, "---- Renaming app %q to %q ----\n", old.Name, newName)
+	actions := []*action.Action{
+		&renameAppInDB,
+		&renameAppRepository,
+		&copyRenamedRouterBackend,
+		&provisionRenamedApp,
+		&swapRenamedRouterCNames,
+		&renameAppServiceBinds,
+		&renameAppRoles,
+		&retargetAppEvents,
+		&renameAppRecords,
+		&renameAppLogs,
+		&removeOldAppResources,
+	}
+	return action.NewPipeline(actions...).Execute(&args, newName)
+}
+
+func (args *renamePipelineArgs) updateDB(name string, envs map[string]bind.EnvVar, ip string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": args.app.Name}, bson.M{"$set": bson.M{
+		"name": name,
+		"env":  envs,
+		"ip":   ip,
+	}})
+	if mgo.IsDup(err) {
+		return ErrAppAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	args.app.Name = name
+	args.app.Env = envs
+	args.app.Ip = ip
+	return nil
+}
+
+var renameAppInDB = action.Action{
+	Name: "rename-app-db",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		newName := ctx.Params[1].(string)
+		t, err := AuthScheme.AppLogin(newName)
+		if err != nil {
+			return nil, err
+		}
+		envs := make(map[string]bind.EnvVar, len(args.old.Env))
+		for k, v := range args.old.Env {
+			envs[k] = v
+		}
+		envs["TSURU_APPNAME"] = bind.EnvVar{Name: "TSURU_APPNAME", Value: newName}
+		envs["TSURU_APP_TOKEN"] = bind.EnvVar{Name: "TSURU_APP_TOKEN", Value: t.GetValue()}
+		err = args.updateDB(newName, envs, args.old.Ip)
+		if err != nil {
+			AuthScheme.AppLogout(t.GetValue())
+			return nil, err
+		}
+		args.oldToken = args.old.Env["TSURU_APP_TOKEN"].Value
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		token := args.app.Env["TSURU_APP_TOKEN"].Value
+		err := args.updateDB(args.old.Name, args.old.Env, args.old.Ip)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore app name: %s", args.old.Name, err)
+			return
+		}
+		AuthScheme.AppLogout(token)
+	},
+	MinParams: 2,
+}
+
+var renameAppRepository = action.Action{
+	Name: "rename-app-repository",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		return nil, repository.Manager().RenameRepository(args.old.Name, args.app.Name)
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := repository.Manager().RenameRepository(args.app.Name, args.old.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore repository name: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+var copyRenamedRouterBackend = action.Action{
+	Name: "copy-renamed-router-backend",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		r, err := args.app.GetRouter()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, "---- Copying router backend %q to %q ----\n", args.old.Name, args.app.Name)
+		if optsRouter, ok := r.(router.OptsRouter); ok {
+			err = optsRouter.AddBackendOpts(args.app.Name, args.app.RouterOpts)
+		} else {
+			err = r.AddBackend(args.app.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = args.copyRoutes(r)
+		if err != nil {
+			args.removeNewBackend(r)
+			return nil, err
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		r, err := args.app.GetRouter()
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to get router: %s", args.old.Name, err)
+			return
+		}
+		args.removeNewBackend(r)
+	},
+	MinParams: 1,
+}
+
+func (args *renamePipelineArgs) copyRoutes(r router.Router) error {
+	routes, err := r.Routes(args.old.Name)
+	if err != nil {
+		return err
+	}
+	err = r.AddRoutes(args.app.Name, routes)
+	if err != nil {
+		return err
+	}
+	return args.app.UpdateAddr()
+}
+
+func (args *renamePipelineArgs) removeNewBackend(r router.Router) {
+	err := r.RemoveBackend(args.app.Name)
+	if err != nil && err != router.ErrBackendNotFound {
+		log.Errorf("[rename-app: %s] unable to remove router backend %q: %s", args.old.Name, args.app.Name, err)
+	}
+	err = router.Remove(args.app.Name)
+	if err != nil {
+		log.Errorf("[rename-app: %s] unable to remove router backend %q from database: %s", args.old.Name, args.app.Name, err)
+	}
+	args.app.Ip = args.old.Ip
+}
+
+var provisionRenamedApp = action.Action{
+	Name: "provision-renamed-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := args.provisionUnits()
+		if err != nil {
+			args.destroyNewUnits()
+			return nil, err
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		args.destroyNewUnits()
+	},
+	MinParams: 1,
+}
+
+func (args *renamePipelineArgs) provisionUnits() error {
+	var err error
+	args.units, err = unitsByProcess(args.old)
+	if err != nil {
+		return err
+	}
+	err = image.CopyAppImageNames(args.old.Name, args.app.Name)
+	if err != nil {
+		return err
+	}
+	prov, err := args.app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	err = prov.Provision(args.app)
+	if err != nil {
+		return err
+	}
+	for process, n := range args.units {
+		fmt.Fprintf(args.writer, "---- Adding %d units to process %q of %q ----\n", n, process, args.app.Name)
+		err = prov.AddUnits(args.app, uint(n), process, args.writer)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = rebuild.RebuildRoutes(args.app)
+	return err
+}
+
+func (args *renamePipelineArgs) destroyNewUnits() {
+	// The image names must be removed before destroying the app in the
+	// provisioner, otherwise the images still used by the old name would be
+	// removed too.
+	err := image.RemoveAppImageNames(args.app.Name)
+	if err != nil {
+		log.Errorf("[rename-app: %s] unable to remove image names of %q: %s", args.old.Name, args.app.Name, err)
+	}
+	prov, err := args.app.getProvisioner()
+	if err == nil {
+		err = prov.Destroy(args.app)
+	}
+	if err != nil {
+		log.Errorf("[rename-app: %s] unable to destroy %q in provisioner: %s", args.old.Name, args.app.Name, err)
+	}
+}
+
+// swapRenamedRouterCNames moves the cnames to the new backend only after the
+// new units are routed, so they never point to a backend without routes.
+var swapRenamedRouterCNames = action.Action{
+	Name: "swap-renamed-router-cnames",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		r, err := args.app.GetRouter()
+		if err != nil {
+			return nil, err
+		}
+		return nil, router.Swap(r, args.old.Name, args.app.Name, true)
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		r, err := args.app.GetRouter()
+		if err == nil {
+			err = router.Swap(r, args.app.Name, args.old.Name, true)
+		}
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore cnames: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+var renameAppServiceBinds = action.Action{
+	Name: "rename-app-service-binds",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		instances, err := args.old.serviceInstances()
+		if err != nil {
+			return nil, err
+		}
+		for i := range instances {
+			err = args.moveServiceBind(&instances[i], args.old, args.app)
+			if err != nil {
+				args.restoreServiceBinds()
+				return nil, errors.Wrapf(err, "unable to move bind of service instance %q", instances[i].Name)
+			}
+			args.instances = append(args.instances, instances[i])
+		}
+		if len(args.instances) > 0 && len(args.units) > 0 {
+			err = args.app.Restart("", args.writer)
+			if err != nil {
+				args.restoreServiceBinds()
+				return nil, err
+			}
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		args.restoreServiceBinds()
+	},
+	MinParams: 1,
+}
+
+// moveServiceBind moves the bind of si from the app named from to the app
+// named to, including the binds of their units. The environment variables
+// returned by the service are stored in args.app, which is the record of the
+// app in the database during the whole pipeline.
+func (args *renamePipelineArgs) moveServiceBind(si *service.ServiceInstance, from, to *App) error {
+	envs, err := si.RenameApp(from, to)
+	if err != nil {
+		return err
+	}
+	toUnits, err := to.Units()
+	if err != nil {
+		return err
+	}
+	for i := range toUnits {
+		err = si.BindUnit(to, &toUnits[i])
+		if err != nil && err != service.ErrUnitAlreadyBound {
+			return err
+		}
+	}
+	fromUnits, err := from.Units()
+	if err != nil {
+		return err
+	}
+	for i := range fromUnits {
+		err = si.UnbindUnit(from, &fromUnits[i])
+		if err != nil && err != service.ErrUnitNotBound {
+			log.Errorf("[rename-app: %s] unable to unbind unit %q from service instance %q: %s", args.old.Name, fromUnits[i].ID, si.Name, err)
+		}
+	}
+	return args.app.AddInstance(bind.InstanceApp{
+		ServiceName: si.ServiceName,
+		Instance:    bind.ServiceInstance{Name: si.Name, Envs: envs},
+	}, args.writer)
+}
+
+func (args *renamePipelineArgs) restoreServiceBinds() {
+	for i := len(args.instances) - 1; i >= 0; i-- {
+		err := args.moveServiceBind(&args.instances[i], args.app, args.old)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore bind of service instance %q: %s", args.old.Name, args.instances[i].Name, err)
+		}
+	}
+	args.instances = nil
+}
+
+var renameAppRoles = action.Action{
+	Name: "rename-app-roles",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		return nil, updateAppRoles(args.old.Name, args.app.Name)
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := updateAppRoles(args.app.Name, args.old.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore user roles: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+func updateAppRoles(oldName, newName string) error {
+	roles, err := permission.ListRoles()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.ContextType != permission.CtxApp {
+			continue
+		}
+		err = auth.UpdateRoleContextFromAllUsers(role.Name, oldName, newName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var retargetAppEvents = action.Action{
+	Name: "retarget-app-events",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		return nil, retargetEvents(args.old.Name, args.app.Name)
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := retargetEvents(args.app.Name, args.old.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore events target: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+func retargetEvents(oldName, newName string) error {
+	return event.Retarget(
+		event.Target{Type: event.TargetTypeApp, Value: oldName},
+		event.Target{Type: event.TargetTypeApp, Value: newName},
+		permission.Context(permission.CtxApp, oldName),
+		permission.Context(permission.CtxApp, newName),
+	)
+}
+
+// renameAppRecords moves the config revisions and log limits of the app, and
+// the records kept by packages registered with AddRenameHook, to the new name.
+var renameAppRecords = action.Action{
+	Name: "rename-app-records",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := renameRecords(args.old.Name, args.app.Name)
+		if err != nil {
+			restoreErr := renameRecords(args.app.Name, args.old.Name)
+			if restoreErr != nil {
+				log.Errorf("[rename-app: %s] unable to restore app records: %s", args.old.Name, restoreErr)
+			}
+			return nil, err
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := renameRecords(args.app.Name, args.old.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore app records: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+func renameRecords(oldName, newName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.AppConfigRevisions().UpdateAll(bson.M{"app": oldName}, bson.M{"$set": bson.M{"app": newName}})
+	if err != nil {
+		return err
+	}
+	coll, err := logLimitCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpdateAll(bson.M{"app": oldName}, bson.M{"$set": bson.M{"app": newName}})
+	if err != nil {
+		return err
+	}
+	for _, hook := range renameHooks {
+		err = hook(oldName, newName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameAppLogs is a best effort action, losing the logs isn't a reason to
+// fail the rename.
+var renameAppLogs = action.Action{
+	Name: "rename-app-logs",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := renameLogsCollection(args.old.Name, args.app.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to rename logs collection: %s", args.old.Name, err)
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		err := renameLogsCollection(args.app.Name, args.old.Name)
+		if err != nil {
+			log.Errorf("[rename-app: %s] unable to restore logs collection: %s", args.old.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+func renameLogsCollection(oldName, newName string) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Logs(oldName)
+	target := fmt.Sprintf("%s.%s", coll.Database.Name, conn.Logs(newName).Name)
+	return coll.Database.Session.Run(bson.D{
+		{Name: "renameCollection", Value: coll.FullName},
+		{Name: "to", Value: target},
+		{Name: "dropTarget", Value: true},
+	}, nil)
+}
+
+// removeOldAppResources is the last action in the pipeline, it removes what
+// was left behind under the old name. Failures are only logged, as the app is
+// already fully working under the new name.
+var removeOldAppResources = action.Action{
+	Name: "remove-old-app-resources",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(*renamePipelineArgs)
+		logErr := func(msg string, err error) {
+			fmt.Fprintf(args.writer, "%s: %s\n", msg, err)
+			log.Errorf("[rename-app: %s] %s: %s", args.old.Name, msg, err)
+		}
+		fmt.Fprintf(args.writer, "---- Removing old resources of %q ----\n", args.old.Name)
+		err := image.RemoveAppImageNames(args.old.Name)
+		if err != nil {
+			logErr("Unable to remove old image names", err)
+		}
+		prov, err := args.old.getProvisioner()
+		if err == nil {
+			err = prov.Destroy(args.old)
+		}
+		if err != nil && err != provision.ErrEmptyApp {
+			logErr("Unable to destroy old units", err)
+		}
+		r, err := args.old.GetRouter()
+		if err == nil {
+			err = r.RemoveBackend(args.old.Name)
+		}
+		if err != nil && err != router.ErrBackendNotFound {
+			logErr("Unable to remove old router backend", err)
+		}
+		err = router.Remove(args.old.Name)
+		if err != nil {
+			logErr("Unable to remove old router backend from database", err)
+		}
+		err = AuthScheme.AppLogout(args.oldToken)
+		if err != nil {
+			logErr("Unable to remove old app token", err)
+		}
+		return nil, nil
+	},
+	MinParams: 1,
+}
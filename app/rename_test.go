@@ -0,0 +1,238 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router/routertest"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createRenameApp(c *check.C) *App {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 2, "web", nil)
+	err = image.AppendAppImageName(a.Name, "registry.tsuru.io/tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	return dbApp
+}
+
+func (s *S) TestRename(c *check.C) {
+	a := s.createRenameApp(c)
+	oldToken := a.Env["TSURU_APP_TOKEN"].Value
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, a.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = Rename(a, "yourapp", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Name, check.Equals, "yourapp")
+	c.Assert(buf.String(), check.Matches, `(?s)---- Renaming app "myapp" to "yourapp" ----.*`)
+	_, err = GetByName("myapp")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+	dbApp, err := GetByName("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["TSURU_APPNAME"].Value, check.Equals, "yourapp")
+	c.Assert(dbApp.Env["TSURU_APP_TOKEN"].Value, check.Not(check.Equals), oldToken)
+	c.Assert(dbApp.Ip, check.Equals, "yourapp.fakerouter.com")
+	_, err = repository.Manager().GetRepository("myapp")
+	c.Assert(err, check.Equals, repository.ErrRepositoryNotFound)
+	_, err = repository.Manager().GetRepository("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasBackend("yourapp"), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasCNameFor("yourapp", "myapp.example.com"), check.Equals, true)
+	c.Assert(s.provisioner.Provisioned(&App{Name: "myapp"}), check.Equals, false)
+	units, err := unitsByProcess(dbApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.DeepEquals, map[string]int{"web": 2})
+	routes, err := routertest.FakeRouter.Routes("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	for _, u := range s.provisioner.GetUnits(dbApp) {
+		c.Assert(routertest.FakeRouter.HasRoute("yourapp", u.Address.String()), check.Equals, true)
+	}
+	imgs, err := image.ListAppImages("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(imgs, check.DeepEquals, []string{"registry.tsuru.io/tsuru/app-myapp:v1"})
+	_, err = image.ListAppImages("myapp")
+	c.Assert(err, check.NotNil)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp, Value: "yourapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt.UniqueID)
+}
+
+func (s *S) TestRenameRetargetsRunningEvent(c *check.C) {
+	a := s.createRenameApp(c)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:     permission.PermAppUpdateRename,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, a.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	err = Rename(a, "yourapp", nil)
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp, Value: "yourapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(evts[0].Allowed.Contexts, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxApp, "yourapp"),
+	})
+}
+
+func (s *S) TestRenameMovesAppRecords(c *check.C) {
+	var renamed []string
+	defer func(hooks []RenameHook) { renameHooks = hooks }(renameHooks)
+	AddRenameHook(func(oldName, newName string) error {
+		renamed = append(renamed, oldName+" -> "+newName)
+		return nil
+	})
+	a := s.createRenameApp(c)
+	err := a.insertConfigRevision(a.configSnapshot(), nil, s.user.Email, "")
+	c.Assert(err, check.IsNil)
+	err = SetLogLimit(&LogLimit{App: a.Name, LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	err = Rename(a, "yourapp", nil)
+	c.Assert(err, check.IsNil)
+	revisions, err := ListConfigRevisions("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 1)
+	revisions, err = ListConfigRevisions("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(revisions, check.HasLen, 0)
+	limits, err := ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []LogLimit{{App: "yourapp", LinesPerSecond: 10}})
+	c.Assert(renamed, check.DeepEquals, []string{"myapp -> yourapp"})
+}
+
+func (s *S) TestRenameMovesServiceBinds(c *check.C) {
+	var reqs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"DATABASE_USER":"root"}`))
+	}))
+	defer server.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": server.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	a := s.createRenameApp(c)
+	instance := service.ServiceInstance{Name: "mydb", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = instance.Create()
+	c.Assert(err, check.IsNil)
+	err = instance.BindApp(a, false, nil)
+	c.Assert(err, check.IsNil)
+	reqs = nil
+	err = Rename(a, "yourapp", nil)
+	c.Assert(err, check.IsNil)
+	si, err := service.GetServiceInstance("mysql", "mydb")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.Apps, check.DeepEquals, []string{"yourapp"})
+	var unitIDs []string
+	for _, u := range s.provisioner.GetUnits(a) {
+		unitIDs = append(unitIDs, u.ID)
+	}
+	c.Assert(si.Units, check.DeepEquals, unitIDs)
+	c.Assert(reqs[0], check.Equals, "POST /resources/mydb/bind-app")
+	dbApp, err := GetByName("yourapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_USER"].InstanceName, check.Equals, "mydb")
+	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 1)
+}
+
+func (s *S) TestRenameRollback(c *check.C) {
+	a := s.createRenameApp(c)
+	oldToken := a.Env["TSURU_APP_TOKEN"].Value
+	s.provisioner.PrepareFailure("AddUnits", errors.New("my add units error"))
+	err := Rename(a, "yourapp", nil)
+	c.Assert(err, check.ErrorMatches, "my add units error")
+	c.Assert(a.Name, check.Equals, "myapp")
+	_, err = GetByName("yourapp")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+	dbApp, err := GetByName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["TSURU_APPNAME"].Value, check.Equals, "myapp")
+	c.Assert(dbApp.Env["TSURU_APP_TOKEN"].Value, check.Equals, oldToken)
+	c.Assert(dbApp.Ip, check.Equals, "myapp.fakerouter.com")
+	_, err = repository.Manager().GetRepository("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = repository.Manager().GetRepository("yourapp")
+	c.Assert(err, check.Equals, repository.ErrRepositoryNotFound)
+	c.Assert(routertest.FakeRouter.HasBackend("yourapp"), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasCNameFor("myapp", "myapp.example.com"), check.Equals, true)
+	c.Assert(s.provisioner.Provisioned(&App{Name: "yourapp"}), check.Equals, false)
+	c.Assert(s.provisioner.GetUnits(dbApp), check.HasLen, 2)
+	_, err = image.ListAppImages("yourapp")
+	c.Assert(err, check.NotNil)
+	imgs, err := image.ListAppImages("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(imgs, check.DeepEquals, []string{"registry.tsuru.io/tsuru/app-myapp:v1"})
+}
+
+func (s *S) TestRenameRollbackRestoresAppRecords(c *check.C) {
+	var renamed []string
+	defer func(hooks []RenameHook) { renameHooks = hooks }(renameHooks)
+	AddRenameHook(func(oldName, newName string) error {
+		renamed = append(renamed, oldName+" -> "+newName)
+		return nil
+	})
+	a := s.createRenameApp(c)
+	err := SetLogLimit(&LogLimit{App: a.Name, LinesPerSecond: 10})
+	c.Assert(err, check.IsNil)
+	AddRenameHook(func(oldName, newName string) error {
+		if newName == "yourapp" {
+			return errors.New("my hook error")
+		}
+		return nil
+	})
+	err = Rename(a, "yourapp", nil)
+	c.Assert(err, check.ErrorMatches, "my hook error")
+	limits, err := ListLogLimits()
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, []LogLimit{{App: "myapp", LinesPerSecond: 10}})
+	c.Assert(renamed, check.DeepEquals, []string{"myapp -> yourapp", "yourapp -> myapp"})
+	c.Assert(routertest.FakeRouter.HasCNameFor("myapp", "myapp.example.com"), check.Equals, true)
+}
+
+func (s *S) TestRenameInvalid(c *check.C) {
+	a := s.createRenameApp(c)
+	other := App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&other, s.user)
+	c.Assert(err, check.IsNil)
+	err = Rename(a, "myapp", nil)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	err = Rename(a, "My_App", nil)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	err = Rename(a, InternalAppName, nil)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	err = Rename(a, "otherapp", nil)
+	c.Assert(err, check.Equals, ErrAppAlreadyExists)
+}
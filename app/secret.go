@@ -0,0 +1,100 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RotateSecretEnvs encrypts again, using the current key, every secret
+// environment variable encrypted with another key, both in apps and in their
+// configuration revisions. It returns the number of app variables changed.
+func RotateSecretEnvs(w io.Writer) (int, error) {
+	provider, err := secret.GetProvider()
+	if err != nil {
+		return 0, err
+	}
+	currentID, _, err := provider.CurrentKey()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	iter := conn.Apps().Find(nil).Select(bson.M{"name": 1, "env": 1}).Iter()
+	var rotated int
+	for {
+		var a App
+		if !iter.Next(&a) {
+			break
+		}
+		changes, err := rotateEnvs(a.Env, currentID)
+		if err != nil {
+			return rotated, errors.Wrapf(err, "unable to rotate envs of app %s", a.Name)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		err = conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": changes})
+		if err != nil {
+			return rotated, err
+		}
+		rotated += len(changes)
+		fmt.Fprintf(w, "%s: %d secret envs encrypted with key %q\n", a.Name, len(changes), currentID)
+	}
+	err = iter.Close()
+	if err != nil {
+		return rotated, err
+	}
+	revIter := conn.AppConfigRevisions().Find(bson.M{"env": bson.M{"$exists": true}}).Select(bson.M{"app": 1, "version": 1, "env": 1}).Iter()
+	for {
+		var revision ConfigRevision
+		if !revIter.Next(&revision) {
+			break
+		}
+		changes, err := rotateEnvs(revision.Env, currentID)
+		if err != nil {
+			return rotated, errors.Wrapf(err, "unable to rotate envs of app %s in config version %d", revision.App, revision.Version)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		err = conn.AppConfigRevisions().UpdateId(revision.ID, bson.M{"$set": changes})
+		if err != nil {
+			return rotated, err
+		}
+	}
+	return rotated, revIter.Close()
+}
+
+// rotateEnvs returns the secret envs not encrypted with the key currentID,
+// encrypted again with it, keyed by their path in the document.
+func rotateEnvs(envs map[string]bind.EnvVar, currentID string) (bson.M, error) {
+	changes := bson.M{}
+	for name, env := range envs {
+		if !env.Secret {
+			continue
+		}
+		value, changed, err := secret.Rotate(env.Value, currentID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to rotate env %s", name)
+		}
+		if !changed {
+			continue
+		}
+		env.Value = value
+		changes["env."+name] = env
+	}
+	return changes, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/check.v1"
+)
+
+func setSecretKeys() {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:keys:k2", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	config.Set("secrets:current-key", "k1")
+}
+
+func (s *S) TestSetEnvsSecret(c *check.C) {
+	setSecretKeys()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_PASSWORD", Value: "123", Public: true, Secret: true},
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	stored := newApp.Env["DATABASE_PASSWORD"]
+	c.Assert(stored.Secret, check.Equals, true)
+	c.Assert(stored.Public, check.Equals, false)
+	c.Assert(secret.IsEncrypted(stored.Value), check.Equals, true)
+	envs, err := newApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["DATABASE_PASSWORD"], check.DeepEquals, bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "123", Secret: true})
+	c.Assert(envs["DATABASE_HOST"], check.DeepEquals, bind.EnvVar{Name: "DATABASE_HOST", Value: "localhost", Public: true})
+	c.Assert(newApp.Env["DATABASE_PASSWORD"].Value, check.Equals, stored.Value)
+}
+
+func (s *S) TestSetEnvsSecretWithoutKey(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_PASSWORD", Value: "123", Secret: true}},
+	}, nil)
+	c.Assert(err, check.ErrorMatches, "unable to encrypt secret env DATABASE_PASSWORD: no key available.*")
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	_, ok := newApp.Env["DATABASE_PASSWORD"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSetEnvsSecretWithEncryptedPrefix(c *check.C) {
+	setSecretKeys()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	value := "tsuru-secret:v1:k1:notencrypted"
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "DATABASE_PASSWORD", Value: value, Secret: true}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Env["DATABASE_PASSWORD"].Value, check.Not(check.Equals), value)
+	envs, err := newApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["DATABASE_PASSWORD"].Value, check.Equals, value)
+}
+
+func (s *S) TestEnvsUndecryptableSecret(c *check.C) {
+	setSecretKeys()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Env: map[string]bind.EnvVar{
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "tsuru-secret:v1:k1:invalid", Secret: true},
+	}}
+	envs, err := a.Envs()
+	c.Assert(err, check.ErrorMatches, "unable to decrypt secret env DATABASE_PASSWORD of app myapp: .*")
+	c.Assert(envs, check.IsNil)
+}
+
+func (s *S) TestRotateSecretEnvs(c *check.C) {
+	setSecretKeys()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{
+			{Name: "DATABASE_PASSWORD", Value: "123", Secret: true},
+			{Name: "DATABASE_HOST", Value: "localhost", Public: true},
+		},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:current-key", "k2")
+	var buf bytes.Buffer
+	rotated, err := RotateSecretEnvs(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 1)
+	c.Assert(buf.String(), check.Equals, "myapp: 1 secret envs encrypted with key \"k2\"\n")
+	config.Unset("secrets:keys:k1")
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	keyID, err := secret.KeyID(newApp.Env["DATABASE_PASSWORD"].Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k2")
+	envs, err := newApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["DATABASE_PASSWORD"].Value, check.Equals, "123")
+	c.Assert(newApp.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	revision, err := GetConfigRevision(a.Name, newApp.ConfigVersion)
+	c.Assert(err, check.IsNil)
+	keyID, err = secret.KeyID(revision.Env["DATABASE_PASSWORD"].Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k2")
+	c.Assert(revision.Env["DATABASE_HOST"].Value, check.Equals, "localhost")
+	rotated, err = RotateSecretEnvs(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
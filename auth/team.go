@@ -13,6 +13,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/validation"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -21,6 +22,8 @@ var (
 	ErrInvalidTeamName   = errors.New("invalid team name")
 	ErrTeamAlreadyExists = errors.New("team already exists")
 	ErrTeamNotFound      = errors.New("team not found")
+	ErrMemberNotFound    = errors.New("user is not a member of the team")
+	ErrInvalidTeamEmail  = errors.New("invalid team contact email")
 
 	teamNameRegexp = regexp.MustCompile(`^[a-zA-Z][-@_.+\w]+$`)
 )
@@ -28,19 +31,69 @@ var (
 type ErrTeamStillUsed struct {
 	Apps             []string
 	ServiceInstances []string
+	Members          []string
 }
 
 func (e *ErrTeamStillUsed) Error() string {
 	if len(e.Apps) > 0 {
 		return fmt.Sprintf("Apps: %s", strings.Join(e.Apps, ", "))
 	}
-	return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	if len(e.ServiceInstances) > 0 {
+		return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	}
+	return fmt.Sprintf("Members: %s", strings.Join(e.Members, ", "))
 }
 
-// Team represents a real world team, a team has one creating user and a name.
+// Team represents a real world team, a team has one creating user, a name,
+// some optional metadata and a list of members.
 type Team struct {
 	Name         string `bson:"_id" json:"name"`
 	CreatingUser string
+	Description  string       `json:"description,omitempty"`
+	Email        string       `json:"email,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	Members      []TeamMember `json:"members,omitempty"`
+}
+
+// TeamMember represents a user belonging to a team. Team admins are able to
+// manage the team membership.
+type TeamMember struct {
+	Email string `json:"email"`
+	Admin bool   `json:"admin"`
+}
+
+// Permissions returns the permissions granted to every member of the team, by
+// the roles associated with the team-member event.
+func (t *Team) Permissions() ([]permission.Permission, error) {
+	roles, err := permission.ListRolesForEvent(permission.RoleEventTeamMember)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []permission.Permission
+	for _, role := range roles {
+		permissions = append(permissions, role.PermissionsFor(t.Name)...)
+	}
+	return permissions, nil
+}
+
+// MemberEmails returns the email of every member in the team.
+func (t *Team) MemberEmails() []string {
+	emails := make([]string, len(t.Members))
+	for i, m := range t.Members {
+		emails[i] = m.Email
+	}
+	return emails
+}
+
+// IsAdmin returns whether the user identified by email is an admin member of
+// the team.
+func (t *Team) IsAdmin(email string) bool {
+	for _, m := range t.Members {
+		if m.Email == email {
+			return m.Admin
+		}
+	}
+	return false
 }
 
 // AllowedApps returns the apps that the team has access.
@@ -125,6 +178,105 @@ func GetTeamsNames(teams []Team) []string {
 	return tn
 }
 
+// ValidateMetadata checks the metadata set by UpdateTeam.
+func (t *Team) ValidateMetadata() error {
+	if t.Email != "" && !validation.ValidateEmail(t.Email) {
+		return ErrInvalidTeamEmail
+	}
+	return nil
+}
+
+// UpdateTeam updates the metadata (description, contact email and tags) of
+// the team.
+func UpdateTeam(t *Team) error {
+	if err := t.ValidateMetadata(); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(t.Name, bson.M{"$set": bson.M{
+		"description": t.Description,
+		"email":       t.Email,
+		"tags":        t.Tags,
+	}})
+	if err == mgo.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	return err
+}
+
+// AddTeamMember adds the user identified by email to the team. If the user is
+// already a member of the team, only the admin flag is updated.
+func AddTeamMember(teamName, email string, admin bool) error {
+	if _, err := GetUserByEmail(email); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// The member is only pushed if it's not in the team yet, so concurrent
+	// calls never add the same user twice, in that case the admin flag is
+	// updated by the next attempt.
+	for i := 0; i < 2; i++ {
+		err = conn.Teams().Update(
+			bson.M{"_id": teamName, "members.email": email},
+			bson.M{"$set": bson.M{"members.$.admin": admin}},
+		)
+		if err != mgo.ErrNotFound {
+			return err
+		}
+		err = conn.Teams().Update(
+			bson.M{"_id": teamName, "members.email": bson.M{"$ne": email}},
+			bson.M{"$push": bson.M{"members": TeamMember{Email: email, Admin: admin}}},
+		)
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return ErrTeamNotFound
+}
+
+// RemoveTeamMember removes the user identified by email from the team.
+func RemoveTeamMember(teamName, email string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Teams().Update(
+		bson.M{"_id": teamName, "members.email": email},
+		bson.M{"$pull": bson.M{"members": bson.M{"email": email}}},
+	)
+	if err == mgo.ErrNotFound {
+		if _, err = GetTeam(teamName); err != nil {
+			return err
+		}
+		return ErrMemberNotFound
+	}
+	return err
+}
+
+// ListTeamsByMember returns the teams the user identified by email is a
+// member of.
+func ListTeamsByMember(email string) ([]Team, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var teams []Team
+	err = conn.Teams().Find(bson.M{"members.email": email}).All(&teams)
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
 func RemoveTeam(teamName string) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -147,6 +299,17 @@ func RemoveTeam(teamName string) error {
 	if len(serviceInstances) > 0 {
 		return &ErrTeamStillUsed{ServiceInstances: serviceInstances}
 	}
+	var team Team
+	err = conn.Teams().FindId(teamName).One(&team)
+	if err == mgo.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if len(team.Members) > 0 {
+		return &ErrTeamStillUsed{Members: team.MemberEmails()}
+	}
 	err = conn.Teams().RemoveId(teamName)
 	if err == mgo.ErrNotFound {
 		return ErrTeamNotFound
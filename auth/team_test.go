@@ -6,7 +6,9 @@ package auth
 
 import (
 	"sort"
+	"sync"
 
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -38,6 +40,27 @@ func (s *S) TestTeamAllowedApps(c *check.C) {
 	c.Assert(alwdApps, check.DeepEquals, []string{a2.Name})
 }
 
+func (s *S) TestTeamPermissions(c *check.C) {
+	r1, err := permission.NewRole("member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.read.events")
+	c.Assert(err, check.IsNil)
+	err = r1.AddEvent(permission.RoleEventTeamMember.String())
+	c.Assert(err, check.IsNil)
+	r2, err := permission.NewRole("admin", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = r2.AddEvent(permission.RoleEventTeamAdmin.String())
+	c.Assert(err, check.IsNil)
+	team := Team{Name: "myteam"}
+	perms, err := team.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "myteam")},
+	})
+}
+
 func (s *S) TestCreateTeam(c *check.C) {
 	one := User{Email: "king@pos.com"}
 	err := CreateTeam("pos", &one)
@@ -148,3 +171,104 @@ func (s *S) TestListTeams(c *check.C) {
 	sort.Strings(names)
 	c.Assert(names, check.DeepEquals, []string{"cobrateam", "corrino", "fenring"})
 }
+
+func (s *S) TestRemoveTeamWithMembers(c *check.C) {
+	team := Team{Name: "fremen", Members: []TeamMember{{Email: "stilgar@arrakis.com"}}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	err = RemoveTeam(team.Name)
+	c.Assert(err, check.ErrorMatches, "Members: stilgar@arrakis.com")
+}
+
+func (s *S) TestRemoveTeamNotFound(c *check.C) {
+	err := RemoveTeam("unknown")
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestUpdateTeam(c *check.C) {
+	team := Team{Name: "ordos"}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	err = UpdateTeam(&Team{Name: "ordos", Description: "spice traders", Email: "ordos@ix.com", Tags: []string{"a", "b"}})
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam("ordos")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Description, check.Equals, "spice traders")
+	c.Assert(t.Email, check.Equals, "ordos@ix.com")
+	c.Assert(t.Tags, check.DeepEquals, []string{"a", "b"})
+}
+
+func (s *S) TestUpdateTeamInvalidEmail(c *check.C) {
+	err := UpdateTeam(&Team{Name: "cobrateam", Email: "not-an-email"})
+	c.Assert(err, check.Equals, ErrInvalidTeamEmail)
+}
+
+func (s *S) TestUpdateTeamNotFound(c *check.C) {
+	err := UpdateTeam(&Team{Name: "unknown"})
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestAddTeamMember(c *check.C) {
+	err := AddTeamMember(s.team.Name, s.user.Email, false)
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Members, check.DeepEquals, []TeamMember{{Email: s.user.Email}})
+	c.Assert(t.IsAdmin(s.user.Email), check.Equals, false)
+	err = AddTeamMember(s.team.Name, s.user.Email, true)
+	c.Assert(err, check.IsNil)
+	t, err = GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Members, check.DeepEquals, []TeamMember{{Email: s.user.Email, Admin: true}})
+	c.Assert(t.IsAdmin(s.user.Email), check.Equals, true)
+}
+
+func (s *S) TestAddTeamMemberConcurrently(c *check.C) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addErr := AddTeamMember(s.team.Name, s.user.Email, false)
+			c.Check(addErr, check.IsNil)
+		}()
+	}
+	wg.Wait()
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Members, check.DeepEquals, []TeamMember{{Email: s.user.Email}})
+}
+
+func (s *S) TestAddTeamMemberUserNotFound(c *check.C) {
+	err := AddTeamMember(s.team.Name, "unknown@tsuru.io", false)
+	c.Assert(err, check.Equals, ErrUserNotFound)
+}
+
+func (s *S) TestAddTeamMemberTeamNotFound(c *check.C) {
+	err := AddTeamMember("unknown", s.user.Email, false)
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestRemoveTeamMember(c *check.C) {
+	err := AddTeamMember(s.team.Name, s.user.Email, false)
+	c.Assert(err, check.IsNil)
+	err = RemoveTeamMember(s.team.Name, s.user.Email)
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Members, check.HasLen, 0)
+	err = RemoveTeamMember(s.team.Name, s.user.Email)
+	c.Assert(err, check.Equals, ErrMemberNotFound)
+	err = RemoveTeamMember("unknown", s.user.Email)
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestListTeamsByMember(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "corrino"})
+	c.Assert(err, check.IsNil)
+	err = AddTeamMember("corrino", s.user.Email, false)
+	c.Assert(err, check.IsNil)
+	teams, err := ListTeamsByMember(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(GetTeamsNames(teams), check.DeepEquals, []string{"corrino"})
+}
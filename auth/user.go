@@ -145,6 +145,12 @@ func (u *User) Delete() error {
 	if err != nil {
 		log.Errorf("failed to remove user %q from the database: %s", u.Email, err)
 	}
+	_, err = conn.Teams().UpdateAll(bson.M{"members.email": u.Email}, bson.M{
+		"$pull": bson.M{"members": bson.M{"email": u.Email}},
+	})
+	if err != nil {
+		log.Errorf("failed to remove user %q from teams: %s", u.Email, err)
+	}
 	err = repository.Manager().RemoveUser(u.Email)
 	if err != nil {
 		log.Errorf("failed to remove user %q from the repository manager: %s", u.Email, err)
@@ -248,6 +254,53 @@ func (u *User) Permissions() ([]permission.Permission, error) {
 		}
 		permissions = append(permissions, role.PermissionsFor(roleData.ContextValue)...)
 	}
+	teamPerms, err := u.teamMembershipPermissions()
+	if err != nil {
+		return nil, err
+	}
+	return append(permissions, teamPerms...), nil
+}
+
+// teamMembershipPermissions returns the permissions granted to the user by
+// being a member of teams: roles associated with the team-member and
+// team-admin events are applied using each team as context, and team admins
+// are always allowed to manage the team membership.
+func (u *User) teamMembershipPermissions() ([]permission.Permission, error) {
+	teams, err := ListTeamsByMember(u.Email)
+	if err != nil || len(teams) == 0 {
+		return nil, err
+	}
+	roles, err := permission.ListRolesForEvents(permission.RoleEventTeamMember, permission.RoleEventTeamAdmin)
+	if err != nil {
+		return nil, err
+	}
+	var memberRoles, adminRoles []permission.Role
+	for _, role := range roles {
+		for _, evt := range role.Events {
+			switch evt {
+			case permission.RoleEventTeamMember.String():
+				memberRoles = append(memberRoles, role)
+			case permission.RoleEventTeamAdmin.String():
+				adminRoles = append(adminRoles, role)
+			}
+		}
+	}
+	var permissions []permission.Permission
+	for _, t := range teams {
+		for _, role := range memberRoles {
+			permissions = append(permissions, role.PermissionsFor(t.Name)...)
+		}
+		if !t.IsAdmin(u.Email) {
+			continue
+		}
+		for _, role := range adminRoles {
+			permissions = append(permissions, role.PermissionsFor(t.Name)...)
+		}
+		permissions = append(permissions, permission.Permission{
+			Scheme:  permission.PermTeamUpdateMember,
+			Context: permission.Context(permission.CtxTeam, t.Name),
+		})
+	}
 	return permissions, nil
 }
 
@@ -291,6 +344,23 @@ func RemoveRoleFromAllUsers(roleName string) error {
 	return err
 }
 
+// UpdateRoleContextFromAllUsers changes the context value of every instance
+// of roleName with oldValue to newValue, in all users. It's used when the
+// value identifying a context changes, e.g. when an app is renamed.
+func UpdateRoleContextFromAllUsers(roleName, oldValue, newValue string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Users().UpdateAll(bson.M{
+		"roles": bson.M{"$elemMatch": bson.M{"name": roleName, "contextvalue": oldValue}},
+	}, bson.M{
+		"$set": bson.M{"roles.$.contextvalue": newValue},
+	})
+	return err
+}
+
 func (u *User) RemoveRole(roleName string, contextValue string) error {
 	conn, err := db.Conn()
 	if err != nil {
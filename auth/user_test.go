@@ -377,6 +377,32 @@ func (s *S) TestRemoveRoleFromAllUsers(c *check.C) {
 	c.Assert(uDB.Roles, check.DeepEquals, expected)
 }
 
+func (s *S) TestUpdateRoleContextFromAllUsers(c *check.C) {
+	u := User{
+		Email:    "me@tsuru.com",
+		Password: "123",
+		Roles: []RoleInstance{
+			{Name: "r1", ContextValue: "c1"},
+			{Name: "r1", ContextValue: "c2"},
+			{Name: "r2", ContextValue: "c1"},
+		},
+	}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	err = UpdateRoleContextFromAllUsers("r1", "c1", "c3")
+	c.Assert(err, check.IsNil)
+	expected := []RoleInstance{
+		{Name: "r1", ContextValue: "c3"},
+		{Name: "r1", ContextValue: "c2"},
+		{Name: "r2", ContextValue: "c1"},
+	}
+	sort.Sort(roleInstanceList(expected))
+	uDB, err := GetUserByEmail("me@tsuru.com")
+	c.Assert(err, check.IsNil)
+	sort.Sort(roleInstanceList(uDB.Roles))
+	c.Assert(uDB.Roles, check.DeepEquals, expected)
+}
+
 func (s *S) TestUserPermissions(c *check.C) {
 	u := User{Email: "me@tsuru.com", Password: "123"}
 	err := u.Create()
@@ -487,3 +513,45 @@ func (s *S) TestAddRolesForEvent(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "team1"}})
 }
+
+func (s *S) TestUserPermissionsFromTeamMembership(c *check.C) {
+	r1, err := permission.NewRole("member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = r1.AddEvent(permission.RoleEventTeamMember.String())
+	c.Assert(err, check.IsNil)
+	u := User{Email: "paul@atreides.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = AddTeamMember(s.team.Name, u.Email, false)
+	c.Assert(err, check.IsNil)
+	perms, err := u.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)},
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, s.team.Name)},
+	})
+	err = AddTeamMember(s.team.Name, u.Email, true)
+	c.Assert(err, check.IsNil)
+	perms, err = u.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)},
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, s.team.Name)},
+		{Scheme: permission.PermTeamUpdateMember, Context: permission.Context(permission.CtxTeam, s.team.Name)},
+	})
+}
+
+func (s *S) TestDeleteUserRemovesTeamMembership(c *check.C) {
+	u := User{Email: "leto@atreides.com", Password: "123"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	err = AddTeamMember(s.team.Name, u.Email, true)
+	c.Assert(err, check.IsNil)
+	err = u.Delete()
+	c.Assert(err, check.IsNil)
+	t, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Members, check.HasLen, 0)
+}
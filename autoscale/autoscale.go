@@ -243,7 +243,7 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 	var rule *Rule
 	defer func() {
 		if retErr != nil {
-			evt.Logf(retErr.Error())
+			evt.Logf("%s", retErr)
 		}
 		if (sResult == nil && retErr == nil) || (sResult != nil && sResult.NoAction()) {
 			evt.Logf("nothing to do for %q: %q", provision.PoolMetadataName, pool)
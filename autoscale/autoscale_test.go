@@ -92,6 +92,7 @@ func (s *S) SetUpTest(c *check.C) {
 
 func (s *S) TearDownTest(c *check.C) {
 	s.conn.Close()
+	config.Unset("autoscale:sleep:proxy-url")
 	config.Unset("docker:auto-scale:max-container-count")
 	config.Unset("docker:auto-scale:prevent-rebalance")
 	config.Unset("docker:auto-scale:metadata-filter")
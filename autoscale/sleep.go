@@ -0,0 +1,428 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	SleepEventKind = "autoscale.sleep"
+	WakeEventKind  = "autoscale.wake"
+
+	minIdleTimeout = time.Minute
+)
+
+var ErrSleepPolicyNotFound = errors.New("sleep policy not found")
+
+// SleepPolicy configures the automatic sleep of idle apps. Apps that receive
+// no requests for IdleTimeout are put to sleep, with their routes pointing to
+// the wake-up proxy served by tsurud.
+//
+// A policy is set either for a pool, applying to all apps in the pool, or for
+// a single app, in which case it takes precedence over the policy of the pool
+// of the app.
+type SleepPolicy struct {
+	Pool        string `json:",omitempty"`
+	App         string `json:",omitempty"`
+	IdleTimeout time.Duration
+	Enabled     bool
+}
+
+// appActivity holds the last time the app was active, either receiving
+// requests through its router or through the wake-up proxy.
+type appActivity struct {
+	App          string `bson:"_id"`
+	LastActivity time.Time
+}
+
+func (p *SleepPolicy) validate() error {
+	if (p.Pool == "") == (p.App == "") {
+		return &tsuruErrors.ValidationError{Message: "either a pool or an app is required"}
+	}
+	if p.IdleTimeout < minIdleTimeout {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("idle timeout must be at least %s", minIdleTimeout)}
+	}
+	if p.App == "" {
+		return nil
+	}
+	a, err := app.GetByName(p.App)
+	if err != nil {
+		return err
+	}
+	_, err = requestCountRouter(a)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	return nil
+}
+
+func sleepPolicyCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("autoscale_sleep_policies")
+	coll.EnsureIndex(mgo.Index{Key: []string{"pool", "app"}, Unique: true})
+	return coll, nil
+}
+
+func appActivityCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("autoscale_app_activity"), nil
+}
+
+func init() {
+	app.AddRenameHook(renameSleepPolicy)
+}
+
+func renameSleepPolicy(oldName, newName string) error {
+	coll, err := sleepPolicyCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpdateAll(bson.M{"app": oldName}, bson.M{"$set": bson.M{"app": newName}})
+	if err != nil {
+		return err
+	}
+	activity, err := getAppActivity(oldName)
+	if err != nil || activity == nil {
+		return err
+	}
+	err = setAppActivity(newName, activity.LastActivity)
+	if err != nil {
+		return err
+	}
+	activityColl, err := appActivityCollection()
+	if err != nil {
+		return err
+	}
+	defer activityColl.Close()
+	return activityColl.RemoveId(oldName)
+}
+
+// SetSleepPolicy creates or replaces the sleep policy of a pool or app.
+func SetSleepPolicy(policy *SleepPolicy) error {
+	err := policy.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := sleepPolicyCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"pool": policy.Pool, "app": policy.App}, policy)
+	return err
+}
+
+// ListSleepPolicies returns all sleep policies, pool policies first.
+func ListSleepPolicies() ([]SleepPolicy, error) {
+	coll, err := sleepPolicyCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var policies []SleepPolicy
+	err = coll.Find(nil).Sort("app", "pool").All(&policies)
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// DeleteSleepPolicy removes the sleep policy of a pool or app.
+func DeleteSleepPolicy(pool, appName string) error {
+	coll, err := sleepPolicyCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Remove(bson.M{"pool": pool, "app": appName})
+	if err == mgo.ErrNotFound {
+		return ErrSleepPolicyNotFound
+	}
+	return err
+}
+
+// RecordAppActivity marks the app as active, postponing its automatic sleep.
+func RecordAppActivity(appName string) error {
+	return setAppActivity(appName, time.Now().UTC())
+}
+
+func setAppActivity(appName string, now time.Time) error {
+	coll, err := appActivityCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(appName, bson.M{"$set": bson.M{"lastactivity": now}})
+	return err
+}
+
+func getAppActivity(appName string) (*appActivity, error) {
+	coll, err := appActivityCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var activity appActivity
+	err = coll.FindId(appName).One(&activity)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+func isAwake(units []provision.Unit) bool {
+	for _, u := range units {
+		if u.Status != provision.StatusAsleep && u.Status != provision.StatusStopped {
+			return true
+		}
+	}
+	return false
+}
+
+func isAsleep(units []provision.Unit) bool {
+	for _, u := range units {
+		if u.Status == provision.StatusAsleep {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepIfIdle puts the app to sleep when its router reported no requests to
+// it during the idle timeout of the policy. Each check asks the router for the
+// requests handled since the previous check, so any request postpones the
+// sleep. Apps are left awake when the router can't tell whether there were
+// requests in the period.
+func sleepIfIdle(a *app.App, policy *SleepPolicy, proxyURL *url.URL, now time.Time, w io.Writer) error {
+	countRouter, err := requestCountRouter(a)
+	if err != nil {
+		return err
+	}
+	requests, err := countRouter.RequestCount(a.Name)
+	if err == router.ErrRequestCountUnavailable {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	activity, err := getAppActivity(a.Name)
+	if err != nil {
+		return err
+	}
+	if activity == nil || requests > 0 {
+		return setAppActivity(a.Name, now)
+	}
+	if now.Sub(activity.LastActivity) < policy.IdleTimeout {
+		return nil
+	}
+	units, err := a.Units()
+	if err != nil {
+		return err
+	}
+	if !isAwake(units) {
+		return nil
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: SleepEventKind,
+		CustomData:   policy,
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, a.Name)),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil
+		}
+		return err
+	}
+	evt.SetLogWriter(w)
+	defer func() { evt.Done(err) }()
+	fmt.Fprintf(evt, "---- Putting app %q to sleep, idle since %s ----\n", a.Name, activity.LastActivity.Format(time.RFC3339))
+	err = a.Sleep(evt, "", proxyURL)
+	return err
+}
+
+// requestCountRouter returns the router of the app, which must be able to
+// report the requests handled by the app for it to be put to sleep.
+func requestCountRouter(a *app.App) (router.RequestCountRouter, error) {
+	r, err := a.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	countRouter, ok := r.(router.RequestCountRouter)
+	if !ok {
+		return nil, errors.Errorf("router of app %q doesn't report request counts, required for apps to sleep", a.Name)
+	}
+	return countRouter, nil
+}
+
+var appSleeperConfig *appSleeper
+
+type appSleeper struct {
+	runInterval time.Duration
+	proxyURL    *url.URL
+	done        chan bool
+	writer      io.Writer
+}
+
+func sleepProxyURL() (*url.URL, error) {
+	proxy, err := config.GetString("autoscale:sleep:proxy-url")
+	if err != nil {
+		return nil, errors.Wrap(err, "autoscale:sleep:proxy-url is required for apps to sleep")
+	}
+	return url.Parse(proxy)
+}
+
+// InitializeAppSleeper starts the routine that puts idle apps to sleep, if
+// it's enabled in the config.
+func InitializeAppSleeper() error {
+	enabled, _ := config.GetBool("autoscale:sleep:enabled")
+	if !enabled {
+		return nil
+	}
+	proxyURL, err := sleepProxyURL()
+	if err != nil {
+		return err
+	}
+	runInterval, _ := config.GetInt("autoscale:sleep:run-interval")
+	appSleeperConfig = &appSleeper{
+		runInterval: time.Duration(runInterval) * time.Second,
+		proxyURL:    proxyURL,
+		done:        make(chan bool),
+		writer:      ioutil.Discard,
+	}
+	if appSleeperConfig.runInterval == 0 {
+		appSleeperConfig.runInterval = time.Minute
+	}
+	shutdown.Register(appSleeperConfig)
+	go appSleeperConfig.run()
+	return nil
+}
+
+// RunAppSleeperOnce checks all apps covered by enabled sleep policies once,
+// putting the idle ones to sleep.
+func RunAppSleeperOnce(w io.Writer) error {
+	proxyURL, err := sleepProxyURL()
+	if err != nil {
+		return err
+	}
+	s := appSleeper{proxyURL: proxyURL, writer: w}
+	return s.runOnce()
+}
+
+func (s *appSleeper) run() {
+	for {
+		s.runOnce()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.runInterval):
+		}
+	}
+}
+
+func (s *appSleeper) runOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
+			log.Errorf("[apps autosleep] %s", retErr)
+		}
+	}()
+	policies, err := ListSleepPolicies()
+	if err != nil {
+		log.Errorf("[apps autosleep] unable to list policies: %s", err)
+		return err
+	}
+	appPolicies := map[string]SleepPolicy{}
+	poolPolicies := map[string]SleepPolicy{}
+	for _, p := range policies {
+		if p.App != "" {
+			appPolicies[p.App] = p
+		} else {
+			poolPolicies[p.Pool] = p
+		}
+	}
+	var apps []app.App
+	if len(poolPolicies) > 0 {
+		filter := &app.Filter{}
+		for pool := range poolPolicies {
+			filter.Pools = append(filter.Pools, pool)
+		}
+		apps, err = app.List(filter)
+		if err != nil {
+			log.Errorf("[apps autosleep] unable to list apps: %s", err)
+			return err
+		}
+	}
+	checked := map[string]bool{}
+	now := time.Now().UTC()
+	check := func(a *app.App) {
+		checked[a.Name] = true
+		policy, ok := appPolicies[a.Name]
+		if !ok {
+			policy = poolPolicies[a.Pool]
+		}
+		if !policy.Enabled {
+			return
+		}
+		err := sleepIfIdle(a, &policy, s.proxyURL, now, s.writer)
+		if err != nil {
+			log.Errorf("[apps autosleep] unable to check app %q: %s", a.Name, err)
+			retErr = err
+		}
+	}
+	for i := range apps {
+		check(&apps[i])
+	}
+	for name := range appPolicies {
+		if checked[name] {
+			continue
+		}
+		a, err := app.GetByName(name)
+		if err != nil {
+			log.Errorf("[apps autosleep] unable to get app %q: %s", name, err)
+			continue
+		}
+		check(a)
+	}
+	return retErr
+}
+
+func (s *appSleeper) Shutdown() {
+	s.done <- true
+}
+
+func (s *appSleeper) String() string {
+	return "apps autosleep"
+}
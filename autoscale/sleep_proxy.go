@@ -0,0 +1,141 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const defaultWakeTimeout = 2 * time.Minute
+
+// WakeUpProxy is an HTTP handler for the requests sent to apps that are
+// asleep. It holds the request, starts the app, restoring its routes, and
+// then forwards the request to one of the units of the app.
+//
+// The app is found by the Host header of the request, that must match the
+// address of the app or one of its cnames.
+type WakeUpProxy struct {
+	// Timeout is how long the proxy waits for the units of the app to be
+	// available.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewWakeUpProxy returns a WakeUpProxy configured with the
+// autoscale:sleep:wake-timeout config entry, in seconds.
+func NewWakeUpProxy() *WakeUpProxy {
+	timeout, _ := config.GetInt("autoscale:sleep:wake-timeout")
+	p := &WakeUpProxy{Timeout: time.Duration(timeout) * time.Second}
+	if p.Timeout == 0 {
+		p.Timeout = defaultWakeTimeout
+	}
+	return p
+}
+
+func (p *WakeUpProxy) appLock(appName string) *sync.Mutex {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.locks == nil {
+		p.locks = make(map[string]*sync.Mutex)
+	}
+	if _, ok := p.locks[appName]; !ok {
+		p.locks[appName] = &sync.Mutex{}
+	}
+	return p.locks[appName]
+}
+
+func (p *WakeUpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	a, err := app.GetByAddr(host)
+	if err == app.ErrAppNotFound {
+		http.Error(w, fmt.Sprintf("no app found for %q", host), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("[wake-up proxy] unable to find app for %q: %s", host, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target, err := p.wake(a)
+	if err != nil {
+		log.Errorf("[wake-up proxy] unable to wake up app %q: %s", a.Name, err)
+		http.Error(w, fmt.Sprintf("unable to wake up app %q", a.Name), http.StatusServiceUnavailable)
+		return
+	}
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+}
+
+// wake starts the app if it's asleep and returns the address of one of its
+// units once they're available.
+func (p *WakeUpProxy) wake(a *app.App) (*url.URL, error) {
+	lock := p.appLock(a.Name)
+	lock.Lock()
+	defer lock.Unlock()
+	err := RecordAppActivity(a.Name)
+	if err != nil {
+		log.Errorf("[wake-up proxy] unable to record activity of app %q: %s", a.Name, err)
+	}
+	units, err := a.Units()
+	if err != nil {
+		return nil, err
+	}
+	if isAsleep(units) {
+		err = startSleepingApp(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	timeout := time.After(p.Timeout)
+	for {
+		units, err = a.Units()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range units {
+			if u.Available() && u.Address != nil {
+				return &url.URL{Scheme: u.Address.Scheme, Host: u.Address.Host}, nil
+			}
+		}
+		select {
+		case <-timeout:
+			return nil, errors.Errorf("timeout after %s waiting for units", p.Timeout)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func startSleepingApp(a *app.App) (err error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: WakeEventKind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, a.Name)),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil
+		}
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.Start(evt, "")
+}
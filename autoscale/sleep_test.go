@@ -0,0 +1,186 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) prepareSleepApp(c *check.C) {
+	config.Set("routers:fake:type", "fake")
+	config.Set("autoscale:sleep:proxy-url", "http://tsuru.example.com:8081")
+	err := s.conn.Apps().Update(bson.M{"name": "myapp"}, bson.M{"$set": bson.M{"router": "fake", "ip": "myapp.fakerouter.com"}})
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestSetSleepPolicy(c *check.C) {
+	s.prepareSleepApp(c)
+	policy := SleepPolicy{Pool: "pool1", IdleTimeout: time.Hour, Enabled: true}
+	err := SetSleepPolicy(&policy)
+	c.Assert(err, check.IsNil)
+	policy.IdleTimeout = 2 * time.Hour
+	err = SetSleepPolicy(&policy)
+	c.Assert(err, check.IsNil)
+	err = SetSleepPolicy(&SleepPolicy{App: "myapp", IdleTimeout: 10 * time.Minute})
+	c.Assert(err, check.IsNil)
+	policies, err := ListSleepPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []SleepPolicy{
+		{Pool: "pool1", IdleTimeout: 2 * time.Hour, Enabled: true},
+		{App: "myapp", IdleTimeout: 10 * time.Minute},
+	})
+}
+
+func (s *S) TestSetSleepPolicyInvalid(c *check.C) {
+	policies := []SleepPolicy{
+		{IdleTimeout: time.Hour},
+		{Pool: "pool1", App: "myapp", IdleTimeout: time.Hour},
+		{Pool: "pool1", IdleTimeout: time.Second},
+	}
+	for i := range policies {
+		err := SetSleepPolicy(&policies[i])
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{}, check.Commentf("policy %d", i))
+	}
+}
+
+func (s *S) TestSetSleepPolicyAppNotFound(c *check.C) {
+	err := SetSleepPolicy(&SleepPolicy{App: "unknown", IdleTimeout: time.Hour})
+	c.Assert(err, check.Equals, app.ErrAppNotFound)
+}
+
+func (s *S) TestDeleteSleepPolicy(c *check.C) {
+	err := SetSleepPolicy(&SleepPolicy{Pool: "pool1", IdleTimeout: time.Hour})
+	c.Assert(err, check.IsNil)
+	err = DeleteSleepPolicy("pool1", "")
+	c.Assert(err, check.IsNil)
+	policies, err := ListSleepPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+	err = DeleteSleepPolicy("pool1", "")
+	c.Assert(err, check.Equals, ErrSleepPolicyNotFound)
+}
+
+func (s *S) TestRunAppSleeperOnce(c *check.C) {
+	s.prepareSleepApp(c)
+	_, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	err = SetSleepPolicy(&SleepPolicy{Pool: "pool1", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddRequests("myapp", 10)
+	err = RunAppSleeperOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 0)
+	err = setAppActivity("myapp", time.Now().UTC().Add(-2*time.Hour))
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = RunAppSleeperOnce(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 1)
+	c.Assert(routertest.FakeRouter.HasRoute("myapp", "http://tsuru.example.com:8081"), check.Equals, true)
+	c.Assert(buf.String(), check.Matches, `(?s)---- Putting app "myapp" to sleep, idle since .*`)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   SleepEventKind,
+	}, eventtest.HasEvent)
+	err = RunAppSleeperOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 1)
+}
+
+func (s *S) TestRunAppSleeperOnceWithRequests(c *check.C) {
+	s.prepareSleepApp(c)
+	_, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	err = SetSleepPolicy(&SleepPolicy{App: "myapp", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	err = setAppActivity("myapp", time.Now().UTC().Add(-2*time.Hour))
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddRequests("myapp", 1)
+	err = RunAppSleeperOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 0)
+	activity, err := getAppActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(time.Since(activity.LastActivity) < time.Minute, check.Equals, true)
+	err = setAppActivity("myapp", time.Now().UTC().Add(-30*time.Minute))
+	c.Assert(err, check.IsNil)
+	err = RunAppSleeperOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 0)
+	activity, err = getAppActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(time.Since(activity.LastActivity) > 29*time.Minute, check.Equals, true)
+}
+
+func (s *S) TestRunAppSleeperOnceAppPolicyOverridesPool(c *check.C) {
+	s.prepareSleepApp(c)
+	_, err := s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	err = SetSleepPolicy(&SleepPolicy{Pool: "pool1", IdleTimeout: time.Hour, Enabled: true})
+	c.Assert(err, check.IsNil)
+	err = SetSleepPolicy(&SleepPolicy{App: "myapp", IdleTimeout: time.Hour, Enabled: false})
+	c.Assert(err, check.IsNil)
+	err = setAppActivity("myapp", time.Now().UTC().Add(-2*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = RunAppSleeperOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Sleeps(s.appInstance, ""), check.Equals, 0)
+}
+
+func (s *S) TestWakeUpProxy(c *check.C) {
+	s.prepareSleepApp(c)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.Host)
+	}))
+	defer srv.Close()
+	addr, err := url.Parse(srv.URL)
+	c.Assert(err, check.IsNil)
+	s.p.AddUnit(s.appInstance, provision.Unit{ID: "myapp-1", AppName: "myapp", ProcessName: "web", Status: provision.StatusAsleep, Address: addr})
+	proxy := NewWakeUpProxy()
+	request, err := http.NewRequest("GET", "http://myapp.fakerouter.com:8081/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "hello from myapp.fakerouter.com:8081")
+	c.Assert(s.p.Starts(s.appInstance, ""), check.Equals, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   WakeEventKind,
+	}, eventtest.HasEvent)
+	activity, err := getAppActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(time.Since(activity.LastActivity) < time.Minute, check.Equals, true)
+	recorder = httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(s.p.Starts(s.appInstance, ""), check.Equals, 1)
+}
+
+func (s *S) TestWakeUpProxyAppNotFound(c *check.C) {
+	proxy := NewWakeUpProxy()
+	request, err := http.NewRequest("GET", "http://unknown.example.com/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
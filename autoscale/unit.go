@@ -0,0 +1,417 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	UnitEventKind = "autoscale.units"
+
+	defaultScaleUpCooldown   = 3 * time.Minute
+	defaultScaleDownCooldown = 5 * time.Minute
+	// unitScaleTolerance is how far from the target the usage may be, as a
+	// ratio, without causing the units to be scaled.
+	unitScaleTolerance = 0.1
+)
+
+var ErrUnitRuleNotFound = errors.New("unit autoscale rule not found")
+
+// UnitRule configures the horizontal autoscaling of the units of a process
+// of an app. The number of units is kept between MinUnits and MaxUnits, so
+// that the average usage of the units stays close to the targets.
+//
+// TargetCPU is a percentage of one CPU core and TargetMemory is a percentage
+// of the memory limit of the plan of the app. At least one of them must be
+// set.
+type UnitRule struct {
+	App               string
+	Process           string
+	MinUnits          int
+	MaxUnits          int
+	TargetCPU         float64
+	TargetMemory      float64
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+	Enabled           bool
+	LastScale         time.Time `json:",omitempty"`
+}
+
+type unitScaleResult struct {
+	Process string
+	From    int
+	To      int
+	Reason  string
+}
+
+func (r *UnitRule) validate() error {
+	if r.App == "" || r.Process == "" {
+		return &tsuruErrors.ValidationError{Message: "app and process are required"}
+	}
+	if r.MinUnits < 1 {
+		return &tsuruErrors.ValidationError{Message: "min units must be greater than zero"}
+	}
+	if r.MaxUnits < r.MinUnits {
+		return &tsuruErrors.ValidationError{Message: "max units must be greater than or equal to min units"}
+	}
+	if r.TargetCPU < 0 || r.TargetMemory < 0 || r.TargetCPU+r.TargetMemory == 0 {
+		return &tsuruErrors.ValidationError{Message: "either a cpu or a memory target must be set"}
+	}
+	if r.ScaleUpCooldown < 0 || r.ScaleDownCooldown < 0 {
+		return &tsuruErrors.ValidationError{Message: "cooldown periods can't be negative"}
+	}
+	if r.ScaleUpCooldown == 0 {
+		r.ScaleUpCooldown = defaultScaleUpCooldown
+	}
+	if r.ScaleDownCooldown == 0 {
+		r.ScaleDownCooldown = defaultScaleDownCooldown
+	}
+	return nil
+}
+
+func unitRuleCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("autoscale_unit_rules")
+	coll.EnsureIndex(mgo.Index{Key: []string{"app", "process"}, Unique: true})
+	return coll, nil
+}
+
+func init() {
+	app.AddRenameHook(renameUnitRules)
+	app.AddDeleteHook(removeUnitRules)
+}
+
+func removeUnitRules(appName string) error {
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": appName})
+	return err
+}
+
+func renameUnitRules(oldName, newName string) error {
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpdateAll(bson.M{"app": oldName}, bson.M{"$set": bson.M{"app": newName}})
+	return err
+}
+
+// SetUnitRule creates or replaces the autoscaling rule of a process.
+func SetUnitRule(rule *UnitRule) error {
+	err := rule.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"app": rule.App, "process": rule.Process}, bson.M{"$set": bson.M{
+		"minunits":          rule.MinUnits,
+		"maxunits":          rule.MaxUnits,
+		"targetcpu":         rule.TargetCPU,
+		"targetmemory":      rule.TargetMemory,
+		"scaleupcooldown":   rule.ScaleUpCooldown,
+		"scaledowncooldown": rule.ScaleDownCooldown,
+		"enabled":           rule.Enabled,
+	}})
+	return err
+}
+
+// ListUnitRules returns the autoscaling rules of an app, or of every app when
+// appName is empty.
+func ListUnitRules(appName string) ([]UnitRule, error) {
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{}
+	if appName != "" {
+		query["app"] = appName
+	}
+	var rules []UnitRule
+	err = coll.Find(query).Sort("app", "process").All(&rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func DeleteUnitRule(appName, process string) error {
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Remove(bson.M{"app": appName, "process": process})
+	if err == mgo.ErrNotFound {
+		return ErrUnitRuleNotFound
+	}
+	return err
+}
+
+// claimUnitRuleScale sets the last scale time of the rule, only if it wasn't
+// changed since the rule was loaded, so that a single tsuru instance scales
+// the process in each cooldown period. It returns false if the scale was
+// already claimed by someone else. Failed scale attempts also start the
+// cooldown, so they're not retried on every run.
+func claimUnitRuleScale(rule *UnitRule, t time.Time) (bool, error) {
+	coll, err := unitRuleCollection()
+	if err != nil {
+		return false, err
+	}
+	defer coll.Close()
+	query := bson.M{"app": rule.App, "process": rule.Process, "lastscale": rule.LastScale}
+	if rule.LastScale.IsZero() {
+		query["lastscale"] = nil
+	}
+	err = coll.Update(query, bson.M{"$set": bson.M{"lastscale": t}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	rule.LastScale = t
+	return true, nil
+}
+
+// desiredUnits returns the number of units the process should have, given
+// its current number of units and the usage of each of them.
+func (r *UnitRule) desiredUnits(current int, metrics []provision.UnitMetric, planMemory int64) (int, string, error) {
+	if current < r.MinUnits {
+		return r.MinUnits, fmt.Sprintf("number of units below the minimum of %d", r.MinUnits), nil
+	}
+	if current > r.MaxUnits {
+		return r.MaxUnits, fmt.Sprintf("number of units above the maximum of %d", r.MaxUnits), nil
+	}
+	var cpu, memory float64
+	var count int
+	for _, m := range metrics {
+		if m.ProcessName != r.Process {
+			continue
+		}
+		cpu += m.CPU
+		memory += float64(m.Memory)
+		count++
+	}
+	if count == 0 {
+		return current, "", nil
+	}
+	cpu /= float64(count)
+	memory /= float64(count)
+	var ratio float64
+	var reason string
+	if r.TargetCPU > 0 {
+		ratio = cpu / r.TargetCPU
+		reason = fmt.Sprintf("cpu usage %.1f%%, target %.1f%%", cpu, r.TargetCPU)
+	}
+	if r.TargetMemory > 0 {
+		if planMemory <= 0 {
+			return 0, "", errors.New("memory target requires a plan with a memory limit")
+		}
+		memoryPercent := memory / float64(planMemory) * 100
+		if memoryRatio := memoryPercent / r.TargetMemory; memoryRatio > ratio {
+			ratio = memoryRatio
+			reason = fmt.Sprintf("memory usage %.1f%%, target %.1f%%", memoryPercent, r.TargetMemory)
+		}
+	}
+	if math.Abs(ratio-1) <= unitScaleTolerance {
+		return current, "", nil
+	}
+	desired := int(math.Ceil(float64(current) * ratio))
+	if desired < r.MinUnits {
+		desired = r.MinUnits
+	}
+	if desired > r.MaxUnits {
+		desired = r.MaxUnits
+	}
+	return desired, reason, nil
+}
+
+func (r *UnitRule) inCooldown(current, desired int, now time.Time) bool {
+	if r.LastScale.IsZero() {
+		return false
+	}
+	cooldown := r.ScaleDownCooldown
+	if desired > current {
+		cooldown = r.ScaleUpCooldown
+	}
+	return now.Sub(r.LastScale) < cooldown
+}
+
+// scaleUnits applies the rule to its process, adding or removing units when
+// needed. Scaling is recorded as an event in the app.
+func scaleUnits(rule *UnitRule, w io.Writer) error {
+	a, err := app.GetByName(rule.App)
+	if err != nil {
+		return err
+	}
+	prov, err := a.GetProvisioner()
+	if err != nil {
+		return err
+	}
+	metricsProv, ok := prov.(provision.MetricsProvisioner)
+	if !ok {
+		return errors.Errorf("provisioner %q doesn't report unit metrics", prov.GetName())
+	}
+	units, err := a.Units()
+	if err != nil {
+		return err
+	}
+	var current int
+	for _, u := range units {
+		if u.ProcessName == rule.Process {
+			current++
+		}
+	}
+	metrics, err := metricsProv.UnitsMetrics(a)
+	if err != nil {
+		return err
+	}
+	desired, reason, err := rule.desiredUnits(current, metrics, a.PlanForProcess(rule.Process).Memory)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if desired == current || rule.inCooldown(current, desired, now) {
+		return nil
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: UnitEventKind,
+		CustomData:   rule,
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, a.Name)),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil
+		}
+		return err
+	}
+	claimed, err := claimUnitRuleScale(rule, now)
+	if err != nil || !claimed {
+		evt.Abort()
+		return err
+	}
+	evt.SetLogWriter(w)
+	result := unitScaleResult{Process: rule.Process, From: current, To: desired, Reason: reason}
+	defer func() { evt.DoneCustomData(err, result) }()
+	fmt.Fprintf(evt, "---- Scaling process %q of app %q from %d to %d units: %s ----\n", rule.Process, a.Name, current, desired, reason)
+	if desired > current {
+		err = a.AddUnits(uint(desired-current), rule.Process, evt)
+	} else {
+		err = a.RemoveUnits(uint(current-desired), rule.Process, evt)
+	}
+	return err
+}
+
+var unitScalerConfig *unitScaler
+
+type unitScaler struct {
+	runInterval time.Duration
+	done        chan bool
+	writer      io.Writer
+}
+
+// InitializeUnitScaler starts the routine that applies the autoscaling rules
+// of units, if it's enabled in the config.
+func InitializeUnitScaler() error {
+	enabled, _ := config.GetBool("autoscale:units:enabled")
+	if !enabled {
+		return nil
+	}
+	runInterval, _ := config.GetInt("autoscale:units:run-interval")
+	unitScalerConfig = &unitScaler{
+		runInterval: time.Duration(runInterval) * time.Second,
+		done:        make(chan bool),
+		writer:      ioutil.Discard,
+	}
+	if unitScalerConfig.runInterval == 0 {
+		unitScalerConfig.runInterval = time.Minute
+	}
+	shutdown.Register(unitScalerConfig)
+	go unitScalerConfig.run()
+	return nil
+}
+
+// RunUnitScalerOnce applies all enabled unit autoscaling rules once.
+func RunUnitScalerOnce(w io.Writer) error {
+	s := unitScaler{writer: w}
+	return s.runOnce()
+}
+
+func (s *unitScaler) run() {
+	for {
+		s.runOnce()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.runInterval):
+		}
+	}
+}
+
+func (s *unitScaler) runOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
+			log.Errorf("[units autoscale] %s", retErr)
+		}
+	}()
+	rules, err := ListUnitRules("")
+	if err != nil {
+		log.Errorf("[units autoscale] unable to list rules: %s", err)
+		return err
+	}
+	for i := range rules {
+		if !rules[i].Enabled {
+			continue
+		}
+		err = scaleUnits(&rules[i], s.writer)
+		if err != nil {
+			log.Errorf("[units autoscale] unable to scale process %q of app %q: %s", rules[i].Process, rules[i].App, err)
+			retErr = err
+		}
+	}
+	return retErr
+}
+
+func (s *unitScaler) Shutdown() {
+	s.done <- true
+}
+
+func (s *unitScaler) String() string {
+	return "units auto scale"
+}
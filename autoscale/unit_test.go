@@ -0,0 +1,211 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"bytes"
+	"time"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSetUnitRule(c *check.C) {
+	rule := UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err := SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	rule.MaxUnits = 10
+	err = SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	rules, err := ListUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []UnitRule{
+		{
+			App:               "myapp",
+			Process:           "web",
+			MinUnits:          1,
+			MaxUnits:          10,
+			TargetCPU:         50,
+			ScaleUpCooldown:   defaultScaleUpCooldown,
+			ScaleDownCooldown: defaultScaleDownCooldown,
+			Enabled:           true,
+		},
+	})
+}
+
+func (s *S) TestSetUnitRuleInvalid(c *check.C) {
+	rules := []UnitRule{
+		{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50},
+		{App: "myapp", Process: "web", MinUnits: 0, MaxUnits: 5, TargetCPU: 50},
+		{App: "myapp", Process: "web", MinUnits: 3, MaxUnits: 2, TargetCPU: 50},
+		{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5},
+		{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, ScaleUpCooldown: -time.Minute},
+	}
+	for i := range rules {
+		err := SetUnitRule(&rules[i])
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{}, check.Commentf("rule %d", i))
+	}
+	all, err := ListUnitRules("")
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 0)
+}
+
+func (s *S) TestListUnitRules(c *check.C) {
+	for _, r := range []UnitRule{
+		{App: "myapp", Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 50},
+		{App: "otherapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetMemory: 70},
+		{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50},
+	} {
+		err := SetUnitRule(&r)
+		c.Assert(err, check.IsNil)
+	}
+	rules, err := ListUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 2)
+	c.Assert(rules[0].Process, check.Equals, "web")
+	c.Assert(rules[1].Process, check.Equals, "worker")
+	rules, err = ListUnitRules("")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 3)
+}
+
+func (s *S) TestDeleteUnitRule(c *check.C) {
+	rule := UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50}
+	err := SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	err = DeleteUnitRule("myapp", "web")
+	c.Assert(err, check.IsNil)
+	rules, err := ListUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	err = DeleteUnitRule("myapp", "web")
+	c.Assert(err, check.Equals, ErrUnitRuleNotFound)
+}
+
+func (s *S) TestUnitRuleDesiredUnits(c *check.C) {
+	web := func(cpu float64, memory int64) provision.UnitMetric {
+		return provision.UnitMetric{ProcessName: "web", CPU: cpu, Memory: memory}
+	}
+	tests := []struct {
+		rule    UnitRule
+		current int
+		metrics []provision.UnitMetric
+		desired int
+	}{
+		{UnitRule{MinUnits: 2, MaxUnits: 5, TargetCPU: 50}, 1, nil, 2},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 7, nil, 5},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 2, nil, 2},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 2, []provision.UnitMetric{web(100, 0), web(80, 0)}, 4},
+		{UnitRule{MinUnits: 1, MaxUnits: 3, TargetCPU: 50}, 2, []provision.UnitMetric{web(100, 0), web(80, 0)}, 3},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 2, []provision.UnitMetric{web(52, 0), web(50, 0)}, 2},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 4, []provision.UnitMetric{web(10, 0), web(10, 0)}, 1},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50}, 2, []provision.UnitMetric{web(10, 0), {ProcessName: "worker", CPU: 500}}, 1},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetMemory: 50}, 2, []provision.UnitMetric{web(0, 800), web(0, 800)}, 4},
+		{UnitRule{MinUnits: 1, MaxUnits: 5, TargetCPU: 50, TargetMemory: 50}, 2, []provision.UnitMetric{web(100, 300), web(100, 300)}, 4},
+	}
+	for i, tt := range tests {
+		tt.rule.Process = "web"
+		desired, _, err := tt.rule.desiredUnits(tt.current, tt.metrics, 1000)
+		c.Assert(err, check.IsNil)
+		c.Assert(desired, check.Equals, tt.desired, check.Commentf("test %d", i))
+	}
+	rule := UnitRule{Process: "web", MinUnits: 1, MaxUnits: 5, TargetMemory: 50}
+	_, _, err := rule.desiredUnits(2, []provision.UnitMetric{web(0, 800)}, 0)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestUnitRuleInCooldown(c *check.C) {
+	now := time.Now()
+	rule := UnitRule{ScaleUpCooldown: time.Minute, ScaleDownCooldown: 5 * time.Minute}
+	c.Assert(rule.inCooldown(1, 2, now), check.Equals, false)
+	rule.LastScale = now.Add(-2 * time.Minute)
+	c.Assert(rule.inCooldown(1, 2, now), check.Equals, false)
+	c.Assert(rule.inCooldown(2, 1, now), check.Equals, true)
+}
+
+func (s *S) TestRunUnitScalerOnce(c *check.C) {
+	err := s.conn.Apps().Update(bson.M{"name": "myapp"}, bson.M{"$set": bson.M{"quota": quota.Unlimited}})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	s.p.PrepareUnitsMetrics(s.appInstance, 90, 0)
+	rule := UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 45, Enabled: true}
+	err = SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = RunUnitScalerOnce(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.GetUnits(s.appInstance), check.HasLen, 4)
+	c.Assert(buf.String(), check.Matches, `(?s)---- Scaling process "web" of app "myapp" from 2 to 4 units: cpu usage 90.0%, target 45.0% ----.*`)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   UnitEventKind,
+		EndCustomData: map[string]interface{}{
+			"process": "web",
+			"from":    2,
+			"to":      4,
+		},
+	}, eventtest.HasEvent)
+	rules, err := ListUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules[0].LastScale.IsZero(), check.Equals, false)
+	err = RunUnitScalerOnce(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.GetUnits(s.appInstance), check.HasLen, 4)
+}
+
+func (s *S) TestRunUnitScalerOnceAlreadyClaimed(c *check.C) {
+	err := s.conn.Apps().Update(bson.M{"name": "myapp"}, bson.M{"$set": bson.M{"quota": quota.Unlimited}})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	s.p.PrepareUnitsMetrics(s.appInstance, 90, 0)
+	rule := UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 45, Enabled: true}
+	err = SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	rules, err := ListUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	other := rules[0]
+	claimed, err := claimUnitRuleScale(&other, time.Now().UTC().Truncate(time.Millisecond))
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+	err = scaleUnits(&rules[0], nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.GetUnits(s.appInstance), check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   UnitEventKind,
+	}, check.Not(eventtest.HasEvent))
+}
+
+func (s *S) TestRemoveUnitRules(c *check.C) {
+	err := SetUnitRule(&UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 45})
+	c.Assert(err, check.IsNil)
+	err = SetUnitRule(&UnitRule{App: "otherapp", Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 45})
+	c.Assert(err, check.IsNil)
+	err = removeUnitRules("myapp")
+	c.Assert(err, check.IsNil)
+	rules, err := ListUnitRules("")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].App, check.Equals, "otherapp")
+}
+
+func (s *S) TestRunUnitScalerOnceDisabledRule(c *check.C) {
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	s.p.PrepareUnitsMetrics(s.appInstance, 90, 0)
+	rule := UnitRule{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 45}
+	err = SetUnitRule(&rule)
+	c.Assert(err, check.IsNil)
+	err = RunUnitScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.GetUnits(s.appInstance), check.HasLen, 2)
+}
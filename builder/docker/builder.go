@@ -102,7 +102,10 @@ func (b *dockerBuilder) Build(p provision.BuilderDeploy, app provision.App, evt
 		return "", err
 	}
 	defer client.RemoveImage(intermediateImageID)
-	cmds := dockercommon.ArchiveDeployCmds(app, fileURI)
+	cmds, err := dockercommon.ArchiveDeployCmds(app, fileURI)
+	if err != nil {
+		return "", err
+	}
 	imageID, err := b.buildPipeline(p, client, app, intermediateImageID, cmds, evt)
 	if err != nil {
 		return "", err
@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
 	check "gopkg.in/check.v1"
 )
 
@@ -452,3 +453,19 @@ func (s *S) TestBuilderErasesOldImages(c *check.C) {
 	expected = []string{"tsuru/app-myapp:v2-builder", "tsuru/python:latest"}
 	c.Assert(got, check.DeepEquals, expected)
 }
+
+func (s *S) TestContainerHostConfigProcessCPUShare(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.CpuShare = 50
+	a.ProcessResources = map[string]provision.UnitResources{
+		"worker": {CPUShare: 200},
+	}
+	cont := Container{AppName: a.GetName(), ProcessName: "worker"}
+	hostConfig, err := cont.hostConfig(a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.CPUShares, check.Equals, int64(200))
+	cont.ProcessName = ""
+	hostConfig, err = cont.hostConfig(a, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.CPUShares, check.Equals, int64(50))
+}
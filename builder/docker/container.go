@@ -113,7 +113,10 @@ func (c *Container) Create(args *CreateContainerArgs) error {
 		User:         user,
 		Labels:       labelSet.ToLabels(),
 	}
-	c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	err = c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	if err != nil {
+		return err
+	}
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &conf, HostConfig: hostConf}
 	cont, err := args.Client.CreateContainer(opts)
 	if err != nil {
@@ -124,8 +127,11 @@ func (c *Container) Create(args *CreateContainerArgs) error {
 	return nil
 }
 
-func (c *Container) addEnvsToConfig(args *CreateContainerArgs, port string, cfg *docker.Config) {
-	envs := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+func (c *Container) addEnvsToConfig(args *CreateContainerArgs, port string, cfg *docker.Config) error {
+	envs, err := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+	if err != nil {
+		return err
+	}
 	for _, envData := range envs {
 		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 	}
@@ -137,6 +143,7 @@ func (c *Container) addEnvsToConfig(args *CreateContainerArgs, port string, cfg
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	return nil
 }
 
 func (c *Container) user() string {
@@ -250,7 +257,7 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 	sharedIsolation, _ := config.GetBool("docker:sharedfs:app-isolation")
 	sharedSalt, _ := config.GetString("docker:sharedfs:salt")
 	hostConfig := docker.HostConfig{
-		CPUShares: int64(app.GetCpuShare()),
+		CPUShares: int64(app.GetUnitResources(c.ProcessName).CPUShare),
 	}
 	hostConfig.OomScoreAdj = 1000
 	hostConfig.SecurityOpt, _ = config.GetList("docker:security-opts")
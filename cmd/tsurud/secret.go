@@ -0,0 +1,46 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+)
+
+type secretKeyRotateCmd struct{}
+
+func (secretKeyRotateCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "secret-key-rotate",
+		Usage: "secret-key-rotate",
+		Desc: `Encrypts again every app secret environment variable, webhook secret and
+pending approval request that wasn't encrypted with the current key
+(secrets:current-key). Old keys must be kept in the configuration until this
+command finishes.`,
+	}
+}
+
+func (secretKeyRotateCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	rotated, err := app.RotateSecretEnvs(context.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d secret envs encrypted with the current key.\n", rotated)
+	rotated, err = webhook.RotateSecrets()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d webhook secrets encrypted with the current key.\n", rotated)
+	rotated, err = event.RotateApprovalRequests()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d approval requests encrypted with the current key.\n", rotated)
+	return nil
+}
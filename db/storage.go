@@ -96,6 +96,15 @@ func (s *Storage) Apps() *storage.Collection {
 	return c
 }
 
+// AppConfigRevisions returns the collection storing the configuration
+// revisions of apps.
+func (s *Storage) AppConfigRevisions() *storage.Collection {
+	versionIndex := mgo.Index{Key: []string{"app", "version"}, Unique: true}
+	c := s.Collection("app_config_revisions")
+	c.EnsureIndex(versionIndex)
+	return c
+}
+
 // Platforms returns the platforms collection from MongoDB.
 func (s *Storage) Platforms() *storage.Collection {
 	return s.Collection("platforms")
@@ -186,6 +195,7 @@ func (s *LogStorage) Logs(appName string) *storage.Collection {
 	}
 	c := s.Collection("logs_" + appName)
 	c.Create(&logCappedInfo)
+	c.EnsureIndexKey("date")
 	return c
 }
 
@@ -240,6 +250,14 @@ func (s *Storage) EventBlocks() *storage.Collection {
 	return c
 }
 
+func (s *Storage) EventApprovalRules() *storage.Collection {
+	return s.Collection("event_approval_rules")
+}
+
+func (s *Storage) EventThrottling() *storage.Collection {
+	return s.Collection("event_throttling")
+}
+
 func (s *Storage) InstallHosts() *storage.Collection {
 	nameIndex := mgo.Index{Key: []string{"name"}, Unique: true}
 	c := s.Collection("install_hosts")
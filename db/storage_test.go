@@ -194,6 +194,20 @@ func (s *S) TestLogs(c *check.C) {
 	c.Assert(logs, check.DeepEquals, logsc)
 }
 
+func (s *S) TestLogsDateIndex(c *check.C) {
+	strg, err := LogConn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	logs := strg.Logs("myapp")
+	indexes, err := logs.Indexes()
+	c.Assert(err, check.IsNil)
+	var keys [][]string
+	for _, idx := range indexes {
+		keys = append(keys, idx.Key)
+	}
+	c.Assert(keys, check.DeepEquals, [][]string{{"_id"}, {"date"}})
+}
+
 func (s *S) TestRoles(c *check.C) {
 	strg, err := Conn()
 	c.Assert(err, check.IsNil)
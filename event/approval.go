@@ -0,0 +1,398 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+
+	defaultApprovalExpire = 24 * time.Hour
+)
+
+var (
+	ErrApprovalRuleNotFound = errors.New("approval rule not found")
+	ErrApprovalNotFound     = errors.New("pending approval not found")
+	ErrInvalidApproval      = errors.New("approval does not match the operation or was already used")
+	ErrNoApprovalSchemes    = ErrValidation("approval rule requires at least one permission scheme")
+)
+
+type ErrApprovalRequired struct {
+	ID   bson.ObjectId
+	Kind Kind
+}
+
+func (e *ErrApprovalRequired) Error() string {
+	return fmt.Sprintf("%s requires approval from another user, pending approval id: %s", e.Kind, e.ID.Hex())
+}
+
+// ApprovalRule makes operations whose kind matches one of Schemes wait for
+// the approval of a second user. A scheme matches its own kind and every kind
+// below it, e.g. "app" matches "app.delete". When ContextType is set, only
+// events allowed in that context require approval.
+type ApprovalRule struct {
+	ID           bson.ObjectId `bson:"_id,omitempty"`
+	Schemes      []string
+	ContextType  string
+	ContextValue string
+	Expire       time.Duration `form:"-"`
+	Reason       string
+}
+
+func (r *ApprovalRule) matches(kind string, allowed *AllowedPermission) bool {
+	var kindMatch bool
+	for _, s := range r.Schemes {
+		if kind == s || strings.HasPrefix(kind, s+".") {
+			kindMatch = true
+			break
+		}
+	}
+	if !kindMatch {
+		return false
+	}
+	if r.ContextType == "" {
+		return true
+	}
+	for _, ctx := range allowed.Contexts {
+		if string(ctx.CtxType) == r.ContextType && ctx.Value == r.ContextValue {
+			return true
+		}
+	}
+	return false
+}
+
+// Approval holds the state of an operation waiting for approval. Request
+// is the information needed to run the operation again once approved.
+type Approval struct {
+	RuleID      bson.ObjectId
+	Status      string
+	ExpireTime  time.Time
+	Reviewer    string        `bson:",omitempty"`
+	ReviewTime  time.Time     `bson:",omitempty"`
+	Reason      string        `bson:",omitempty"`
+	ExecutionID bson.ObjectId `bson:",omitempty"`
+	Request     ApprovalRequest
+}
+
+// ApprovalRequest is the API request of an operation waiting for approval.
+// The request may hold secrets, like env values and passwords, so its body is
+// stored encrypted, see DecryptBody, and neither the URL nor the body are
+// serialized in API responses.
+type ApprovalRequest struct {
+	Method      string
+	URL         string `json:"-"`
+	ContentType string
+	Body        string `json:"-"`
+}
+
+// DecryptBody returns the body of the request, decrypted.
+func (r *ApprovalRequest) DecryptBody() (string, error) {
+	if r.Body == "" {
+		return "", nil
+	}
+	body, err := secret.Decrypt(r.Body)
+	return body, errors.Wrap(err, "unable to decrypt approval request body")
+}
+
+// ApprovedToken is implemented by tokens running an operation on behalf of
+// its original owner, after it has been approved.
+type ApprovedToken interface {
+	auth.Token
+	ApprovalID() bson.ObjectId
+}
+
+func AddApprovalRule(r *ApprovalRule) error {
+	if len(r.Schemes) == 0 {
+		return ErrNoApprovalSchemes
+	}
+	if r.Expire <= 0 {
+		r.Expire = defaultApprovalExpire
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.ID = bson.NewObjectId()
+	defer approvalRules.reset()
+	return conn.EventApprovalRules().Insert(r)
+}
+
+func RemoveApprovalRule(id bson.ObjectId) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer approvalRules.reset()
+	err = conn.EventApprovalRules().RemoveId(id)
+	if err == mgo.ErrNotFound {
+		return ErrApprovalRuleNotFound
+	}
+	return err
+}
+
+func ListApprovalRules() ([]ApprovalRule, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var rules []ApprovalRule
+	err = conn.EventApprovalRules().Find(nil).All(&rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// approvalRules caches the approval rules, checked for every new event.
+var approvalRules rulesCache
+
+func findApprovalRule(kind string, allowed *AllowedPermission) (*ApprovalRule, error) {
+	cached, err := approvalRules.get(func() (interface{}, error) {
+		return ListApprovalRules()
+	})
+	if err != nil {
+		return nil, err
+	}
+	rules := cached.([]ApprovalRule)
+	for i := range rules {
+		if rules[i].matches(kind, allowed) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// checkApproval is called before starting a new event. It returns whether
+// the event runs an approved operation, with the same kind and target of the
+// approval, or an ErrApprovalRequired, after storing the operation as a
+// pending event, if the operation must be approved first. Other events
+// created while running an approved operation are checked as usual.
+func checkApproval(coll *storage.Collection, evt *Event, opts *Opts) (bool, error) {
+	if opts.Owner == nil || evt.Kind.Type != KindTypePermission {
+		return false, nil
+	}
+	if approved, ok := opts.Owner.(ApprovedToken); ok {
+		n, err := coll.Find(bson.M{
+			"uniqueid":  approved.ApprovalID(),
+			"kind.name": evt.Kind.Name,
+			"target":    evt.Target,
+		}).Count()
+		if err != nil || n > 0 {
+			return n > 0, err
+		}
+	}
+	rule, err := findApprovalRule(evt.Kind.Name, &evt.Allowed)
+	if err != nil || rule == nil {
+		return false, err
+	}
+	pending := evt.eventData
+	pending.ID = eventID{ObjId: evt.UniqueID}
+	pending.Running = false
+	pending.Pending = true
+	pending.Approval = &Approval{
+		RuleID:     rule.ID,
+		Status:     ApprovalPending,
+		ExpireTime: evt.StartTime.Add(rule.Expire),
+	}
+	err = coll.Insert(pending)
+	if err != nil {
+		return false, err
+	}
+	return false, &ErrApprovalRequired{ID: evt.UniqueID, Kind: evt.Kind}
+}
+
+// useApproval links an approved operation to the event running it. Each
+// approval can only be used once.
+func useApproval(coll *storage.Collection, evt *Event, opts *Opts) error {
+	approved := opts.Owner.(ApprovedToken)
+	err := coll.Update(bson.M{
+		"uniqueid":             approved.ApprovalID(),
+		"kind.name":            evt.Kind.Name,
+		"target":               evt.Target,
+		"approval.status":      ApprovalApproved,
+		"approval.executionid": bson.M{"$exists": false},
+	}, bson.M{"$set": bson.M{"approval.executionid": evt.UniqueID}})
+	if err == mgo.ErrNotFound {
+		return ErrInvalidApproval
+	}
+	return err
+}
+
+// SetApprovalRequest stores how a pending operation must be run once it's
+// approved, encrypting the request body.
+func SetApprovalRequest(id bson.ObjectId, req ApprovalRequest) error {
+	if req.Body != "" {
+		var err error
+		req.Body, err = secret.Encrypt(req.Body)
+		if err != nil {
+			return errors.Wrap(err, "unable to encrypt approval request body")
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"uniqueid": id, "approval.status": ApprovalPending}, bson.M{
+		"$set": bson.M{"approval.request": req},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrApprovalNotFound
+	}
+	return err
+}
+
+// RotateApprovalRequests encrypts again, using the current key, the request
+// body of every pending approval encrypted with another key. It returns the
+// number of requests changed.
+func RotateApprovalRequests() (int, error) {
+	provider, err := secret.GetProvider()
+	if err != nil {
+		return 0, err
+	}
+	currentID, _, err := provider.CurrentKey()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var pending []eventData
+	err = conn.Events().Find(bson.M{
+		"approval.status":       ApprovalPending,
+		"approval.request.body": bson.M{"$nin": []interface{}{"", nil}},
+	}).Select(bson.M{"uniqueid": 1, "approval.request.body": 1}).All(&pending)
+	if err != nil {
+		return 0, err
+	}
+	var rotated int
+	for _, evt := range pending {
+		body, changed, err := secret.Rotate(evt.Approval.Request.Body, currentID)
+		if err != nil {
+			return rotated, errors.Wrapf(err, "unable to rotate request of approval %s", evt.UniqueID.Hex())
+		}
+		if !changed {
+			continue
+		}
+		err = conn.Events().Update(bson.M{"uniqueid": evt.UniqueID}, bson.M{
+			"$set": bson.M{"approval.request.body": body},
+		})
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+func expireApprovals(coll *storage.Collection) error {
+	now := time.Now().UTC()
+	_, err := coll.UpdateAll(bson.M{
+		"approval.status":     ApprovalPending,
+		"approval.expiretime": bson.M{"$lt": now},
+	}, bson.M{"$set": bson.M{
+		"approval.status": ApprovalExpired,
+		"pending":         false,
+		"endtime":         now,
+		"error":           "approval expired",
+	}})
+	return err
+}
+
+// ListPendingApprovals returns the operations waiting for approval, matching
+// the filter.
+func ListPendingApprovals(filter *Filter) ([]Event, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	err = expireApprovals(conn.Events())
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = &Filter{}
+	}
+	if filter.Raw == nil {
+		filter.Raw = bson.M{}
+	}
+	filter.Raw["approval.status"] = ApprovalPending
+	return List(filter)
+}
+
+// Approve marks a pending operation as approved by reviewer, returning the
+// updated event.
+func Approve(id bson.ObjectId, reviewer string) (*Event, error) {
+	return review(id, reviewer, ApprovalApproved, "")
+}
+
+// Reject marks a pending operation as rejected by reviewer, returning the
+// updated event.
+func Reject(id bson.ObjectId, reviewer, reason string) (*Event, error) {
+	return review(id, reviewer, ApprovalRejected, reason)
+}
+
+func review(id bson.ObjectId, reviewer, status, reason string) (*Event, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	err = expireApprovals(coll)
+	if err != nil {
+		return nil, err
+	}
+	var evtErr string
+	if status == ApprovalRejected {
+		evtErr = fmt.Sprintf("rejected by %s", reviewer)
+		if reason != "" {
+			evtErr += ": " + reason
+		}
+	}
+	now := time.Now().UTC()
+	change := mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"approval.status":     status,
+			"approval.reviewer":   reviewer,
+			"approval.reviewtime": now,
+			"approval.reason":     reason,
+			"pending":             false,
+			"endtime":             now,
+			"error":               evtErr,
+		}},
+		ReturnNew: true,
+	}
+	var evt Event
+	_, err = coll.Find(bson.M{"uniqueid": id, "approval.status": ApprovalPending}).Apply(change, &evt.eventData)
+	if err == mgo.ErrNotFound {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type approvedToken struct {
+	auth.Token
+	id bson.ObjectId
+}
+
+func (t *approvedToken) ApprovalID() bson.ObjectId {
+	return t.id
+}
+
+func (s *S) newPendingApproval(c *check.C) *ErrApprovalRequired {
+	err := AddApprovalRule(&ApprovalRule{Schemes: []string{"app.update"}})
+	c.Assert(err, check.IsNil)
+	_, err = New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.FitsTypeOf, &ErrApprovalRequired{})
+	return err.(*ErrApprovalRequired)
+}
+
+func (s *S) TestApprovalRuleMatches(c *check.C) {
+	allowed := Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxPool, "prod"))
+	rule := ApprovalRule{Schemes: []string{"app.update", "pool"}}
+	c.Assert(rule.matches("app.update.env.set", &allowed), check.Equals, true)
+	c.Assert(rule.matches("app.update", &allowed), check.Equals, true)
+	c.Assert(rule.matches("app.updatex", &allowed), check.Equals, false)
+	c.Assert(rule.matches("app.deploy", &allowed), check.Equals, false)
+	c.Assert(rule.matches("pool.delete", &allowed), check.Equals, true)
+	rule.ContextType = "pool"
+	rule.ContextValue = "prod"
+	c.Assert(rule.matches("app.update.env.set", &allowed), check.Equals, true)
+	rule.ContextValue = "dev"
+	c.Assert(rule.matches("app.update.env.set", &allowed), check.Equals, false)
+}
+
+func (s *S) TestAddApprovalRule(c *check.C) {
+	err := AddApprovalRule(&ApprovalRule{})
+	c.Assert(err, check.Equals, ErrNoApprovalSchemes)
+	rule := ApprovalRule{Schemes: []string{"app.delete"}, Reason: "production"}
+	err = AddApprovalRule(&rule)
+	c.Assert(err, check.IsNil)
+	rules, err := ListApprovalRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []ApprovalRule{
+		{ID: rule.ID, Schemes: []string{"app.delete"}, Expire: defaultApprovalExpire, Reason: "production"},
+	})
+	err = RemoveApprovalRule(rule.ID)
+	c.Assert(err, check.IsNil)
+	err = RemoveApprovalRule(rule.ID)
+	c.Assert(err, check.Equals, ErrApprovalRuleNotFound)
+}
+
+func (s *S) TestNewRequiresApproval(c *check.C) {
+	approvalErr := s.newPendingApproval(c)
+	c.Assert(approvalErr.Kind.Name, check.Equals, "app.update.env.set")
+	evts, err := ListPendingApprovals(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, approvalErr.ID)
+	c.Assert(evts[0].Running, check.Equals, false)
+	c.Assert(evts[0].Pending, check.Equals, true)
+	c.Assert(evts[0].EndTime.IsZero(), check.Equals, true)
+	c.Assert(evts[0].Approval.Status, check.Equals, ApprovalPending)
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Done(nil)
+}
+
+func (s *S) TestApproveAndRun(c *check.C) {
+	approvalErr := s.newPendingApproval(c)
+	token := &approvedToken{Token: s.token, id: approvalErr.ID}
+	opts := &Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	}
+	_, err := New(opts)
+	c.Assert(err, check.Equals, ErrInvalidApproval)
+	approved, err := Approve(approvalErr.ID, "other@me.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(approved.Approval.Status, check.Equals, ApprovalApproved)
+	c.Assert(approved.Approval.Reviewer, check.Equals, "other@me.com")
+	_, err = Approve(approvalErr.ID, "other@me.com")
+	c.Assert(err, check.Equals, ErrApprovalNotFound)
+	evt, err := New(opts)
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	approved, err = GetByID(approvalErr.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(approved.Approval.ExecutionID, check.Equals, evt.UniqueID)
+	c.Assert(approved.Pending, check.Equals, false)
+	c.Assert(approved.EndTime.IsZero(), check.Equals, false)
+	c.Assert(approved.Error, check.Equals, "")
+	_, err = New(opts)
+	c.Assert(err, check.Equals, ErrInvalidApproval)
+}
+
+func (s *S) TestApprovedTokenOtherEvents(c *check.C) {
+	approvalErr := s.newPendingApproval(c)
+	_, err := Approve(approvalErr.ID, "other@me.com")
+	c.Assert(err, check.IsNil)
+	token := &approvedToken{Token: s.token, id: approvalErr.ID}
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	other, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "otherapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+	_, err = New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "otherapp"},
+		Kind:    permission.PermAppUpdateEnvUnset,
+		Owner:   token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.FitsTypeOf, &ErrApprovalRequired{})
+}
+
+func (s *S) TestApprovalRulesCached(c *check.C) {
+	rulesCacheTTL = time.Minute
+	defer func() { rulesCacheTTL = 0 }()
+	rule := ApprovalRule{Schemes: []string{"app.update"}}
+	err := AddApprovalRule(&rule)
+	c.Assert(err, check.IsNil)
+	opts := &Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	}
+	_, err = New(opts)
+	c.Assert(err, check.FitsTypeOf, &ErrApprovalRequired{})
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.EventApprovalRules().RemoveId(rule.ID)
+	c.Assert(err, check.IsNil)
+	_, err = New(opts)
+	c.Assert(err, check.FitsTypeOf, &ErrApprovalRequired{})
+	err = AddApprovalRule(&ApprovalRule{Schemes: []string{"app.deploy"}})
+	c.Assert(err, check.IsNil)
+	evt, err := New(opts)
+	c.Assert(err, check.IsNil)
+	evt.Done(nil)
+}
+
+func (s *S) TestRejectApproval(c *check.C) {
+	approvalErr := s.newPendingApproval(c)
+	rejected, err := Reject(approvalErr.ID, "other@me.com", "not now")
+	c.Assert(err, check.IsNil)
+	c.Assert(rejected.Approval.Status, check.Equals, ApprovalRejected)
+	c.Assert(rejected.Approval.Reason, check.Equals, "not now")
+	c.Assert(rejected.Pending, check.Equals, false)
+	c.Assert(rejected.Error, check.Equals, "rejected by other@me.com: not now")
+	evts, err := ListPendingApprovals(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestExpiredApproval(c *check.C) {
+	approvalErr := s.newPendingApproval(c)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"uniqueid": approvalErr.ID}, bson.M{
+		"$set": bson.M{"approval.expiretime": time.Now().UTC().Add(-time.Minute)},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Approve(approvalErr.ID, "other@me.com")
+	c.Assert(err, check.Equals, ErrApprovalNotFound)
+	evt, err := GetByID(approvalErr.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Approval.Status, check.Equals, ApprovalExpired)
+	c.Assert(evt.Pending, check.Equals, false)
+	c.Assert(evt.Error, check.Equals, "approval expired")
+}
+
+func (s *S) TestRotateApprovalRequests(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:keys:k2", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	approvalErr := s.newPendingApproval(c)
+	err := SetApprovalRequest(approvalErr.ID, ApprovalRequest{Method: "POST", URL: "/apps/myapp/env", Body: "Envs.0.Value=1"})
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:current-key", "k2")
+	rotated, err := RotateApprovalRequests()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 1)
+	evt, err := GetByID(approvalErr.ID)
+	c.Assert(err, check.IsNil)
+	keyID, err := secret.KeyID(evt.Approval.Request.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k2")
+	body, err := evt.Approval.Request.DecryptBody()
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.Equals, "Envs.0.Value=1")
+	rotated, err = RotateApprovalRequests()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
+
+func (s *S) TestSetApprovalRequest(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	defer config.Unset("secrets")
+	approvalErr := s.newPendingApproval(c)
+	req := ApprovalRequest{Method: "POST", URL: "/apps/myapp/env", Body: "Envs.0.Name=A&Envs.0.Value=1"}
+	err := SetApprovalRequest(approvalErr.ID, req)
+	c.Assert(err, check.IsNil)
+	evt, err := GetByID(approvalErr.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Approval.Request.Method, check.Equals, req.Method)
+	c.Assert(evt.Approval.Request.URL, check.Equals, req.URL)
+	c.Assert(secret.IsEncrypted(evt.Approval.Request.Body), check.Equals, true)
+	body, err := evt.Approval.Request.DecryptBody()
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.Equals, req.Body)
+	data, err := json.Marshal(evt.Approval.Request)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, `{"Method":"POST","ContentType":""}`)
+	err = SetApprovalRequest(bson.NewObjectId(), req)
+	c.Assert(err, check.Equals, ErrApprovalNotFound)
+}
@@ -0,0 +1,232 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultArchiveCollection = "events_archive"
+
+// ArchiveBackend stores events removed from the database by retention
+// policies.
+type ArchiveBackend interface {
+	// Archive stores the events, which are removed from the database after it
+	// returns successfully.
+	Archive(evts []Event) error
+	// Get returns the archived event with the given unique id, or
+	// ErrEventNotFound.
+	Get(id bson.ObjectId) (*Event, error)
+}
+
+// ArchiveFactory creates an archive backend, reading its settings from the
+// configuration entries under prefix.
+type ArchiveFactory func(prefix string) (ArchiveBackend, error)
+
+var archiveBackends = map[string]ArchiveFactory{
+	"local":   createLocalArchive,
+	"mongodb": createMongodbArchive,
+}
+
+// RegisterArchiveBackend registers a new archive backend, which can be
+// selected with the events:archive:backend config entry.
+func RegisterArchiveBackend(name string, factory ArchiveFactory) {
+	archiveBackends[name] = factory
+}
+
+// getArchiveBackend returns the configured archive backend, or nil when
+// archiving is disabled.
+func getArchiveBackend() (ArchiveBackend, error) {
+	name, _ := config.GetString("events:archive:backend")
+	if name == "" {
+		return nil, nil
+	}
+	factory, ok := archiveBackends[name]
+	if !ok {
+		return nil, errors.Errorf("unknown event archive backend %q", name)
+	}
+	return factory("events:archive:" + name)
+}
+
+// mongodbArchive stores each event as gzipped JSON in a collection of the
+// tsuru database, shared by all tsuru instances.
+type mongodbArchive struct {
+	collection string
+}
+
+type archivedEvent struct {
+	ID   bson.ObjectId `bson:"_id"`
+	Data []byte
+}
+
+func createMongodbArchive(prefix string) (ArchiveBackend, error) {
+	collection, _ := config.GetString(prefix + ":collection")
+	if collection == "" {
+		collection = defaultArchiveCollection
+	}
+	return &mongodbArchive{collection: collection}, nil
+}
+
+func (a *mongodbArchive) Archive(evts []Event) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(a.collection)
+	for i := range evts {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		err = json.NewEncoder(gz).Encode(&evts[i])
+		if err != nil {
+			return err
+		}
+		err = gz.Close()
+		if err != nil {
+			return err
+		}
+		_, err = coll.UpsertId(evts[i].UniqueID, archivedEvent{ID: evts[i].UniqueID, Data: buf.Bytes()})
+		if err != nil {
+			return errors.Wrapf(err, "unable to archive event %s", evts[i].UniqueID.Hex())
+		}
+	}
+	return nil
+}
+
+func (a *mongodbArchive) Get(id bson.ObjectId) (*Event, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var archived archivedEvent
+	err = conn.Collection(a.collection).FindId(id).One(&archived)
+	if err == mgo.ErrNotFound {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(archived.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var evt Event
+	err = json.NewDecoder(gz).Decode(&evt)
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
+
+// localArchive stores events as gzipped JSON lines, one file per day, in a
+// local directory. Events are grouped by the creation time of their unique
+// id, so a single file has to be read to find an event. Archived events can
+// only be found by the tsuru instance that archived them, so it's meant for
+// installations running a single tsuru API instance.
+type localArchive struct {
+	path string
+}
+
+func createLocalArchive(prefix string) (ArchiveBackend, error) {
+	path, err := config.GetString(prefix + ":path")
+	if err != nil {
+		return nil, err
+	}
+	return &localArchive{path: path}, nil
+}
+
+func (a *localArchive) fileName(id bson.ObjectId) string {
+	return filepath.Join(a.path, id.Time().UTC().Format("2006-01-02")+".jsonl.gz")
+}
+
+func (a *localArchive) Archive(evts []Event) error {
+	err := os.MkdirAll(a.path, 0700)
+	if err != nil {
+		return err
+	}
+	byFile := map[string][]*Event{}
+	var files []string
+	for i := range evts {
+		name := a.fileName(evts[i].UniqueID)
+		if _, ok := byFile[name]; !ok {
+			files = append(files, name)
+		}
+		byFile[name] = append(byFile[name], &evts[i])
+	}
+	for _, name := range files {
+		err = appendGzipLines(name, byFile[name])
+		if err != nil {
+			return errors.Wrapf(err, "unable to archive events to %s", name)
+		}
+	}
+	return nil
+}
+
+// appendGzipLines appends a new gzip member to the file, gzip readers handle
+// files with multiple members as a single stream.
+func appendGzipLines(name string, evts []*Event) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	encoder := json.NewEncoder(gz)
+	for _, evt := range evts {
+		err = encoder.Encode(evt)
+		if err != nil {
+			return err
+		}
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (a *localArchive) Get(id bson.ObjectId) (*Event, error) {
+	f, err := os.Open(a.fileName(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	decoder := json.NewDecoder(gz)
+	for {
+		var evt Event
+		err = decoder.Decode(&evt)
+		if err == io.EOF {
+			return nil, ErrEventNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if evt.UniqueID == id {
+			return &evt, nil
+		}
+	}
+}
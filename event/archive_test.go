@@ -0,0 +1,101 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestGetArchiveBackend(c *check.C) {
+	backend, err := getArchiveBackend()
+	c.Assert(err, check.IsNil)
+	c.Assert(backend, check.IsNil)
+	config.Set("events:archive:backend", "unknown")
+	defer config.Unset("events:archive")
+	_, err = getArchiveBackend()
+	c.Assert(err, check.ErrorMatches, `unknown event archive backend "unknown"`)
+	config.Set("events:archive:backend", "local")
+	config.Set("events:archive:local:path", "/var/lib/tsuru/events")
+	backend, err = getArchiveBackend()
+	c.Assert(err, check.IsNil)
+	c.Assert(backend, check.DeepEquals, &localArchive{path: "/var/lib/tsuru/events"})
+	config.Set("events:archive:backend", "mongodb")
+	backend, err = getArchiveBackend()
+	c.Assert(err, check.IsNil)
+	c.Assert(backend, check.DeepEquals, &mongodbArchive{collection: "events_archive"})
+}
+
+func (s *S) TestMongodbArchive(c *check.C) {
+	archive := &mongodbArchive{collection: "events_archive_test"}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	defer conn.Collection(archive.collection).DropCollection()
+	evts := make([]Event, 3)
+	for i := range evts {
+		evt := &evts[i]
+		evt.UniqueID = bson.NewObjectId()
+		evt.ID = eventID{ObjId: evt.UniqueID}
+		evt.Target = Target{Type: TargetTypeApp, Value: "myapp"}
+		evt.Kind = Kind{Type: KindTypePermission, Name: permission.PermAppDeploy.FullName()}
+		evt.StartTime = time.Date(2017, 5, 1, 10, i, 0, 0, time.UTC)
+		evt.Log = "log line\n"
+	}
+	err = archive.Archive(evts[:2])
+	c.Assert(err, check.IsNil)
+	err = archive.Archive(evts[1:])
+	c.Assert(err, check.IsNil)
+	n, err := conn.Collection(archive.collection).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 3)
+	for i := range evts {
+		archived, err := archive.Get(evts[i].UniqueID)
+		c.Assert(err, check.IsNil)
+		c.Assert(archived.UniqueID, check.Equals, evts[i].UniqueID)
+		c.Assert(archived.ID, check.DeepEquals, evts[i].ID)
+		c.Assert(archived.StartTime.Equal(evts[i].StartTime), check.Equals, true)
+		c.Assert(archived.Kind, check.DeepEquals, evts[i].Kind)
+		c.Assert(archived.Log, check.Equals, "log line\n")
+	}
+	_, err = archive.Get(bson.NewObjectId())
+	c.Assert(err, check.Equals, ErrEventNotFound)
+}
+
+func (s *S) TestLocalArchive(c *check.C) {
+	archive := &localArchive{path: c.MkDir()}
+	evts := make([]Event, 3)
+	for i := range evts {
+		evt := &evts[i]
+		evt.UniqueID = bson.NewObjectId()
+		evt.ID = eventID{ObjId: evt.UniqueID}
+		evt.Target = Target{Type: TargetTypeApp, Value: "myapp"}
+		evt.Kind = Kind{Type: KindTypePermission, Name: permission.PermAppDeploy.FullName()}
+		evt.StartTime = time.Date(2017, 5, 1, 10, i, 0, 0, time.UTC)
+		evt.Log = "log line\n"
+	}
+	err := archive.Archive(evts[:2])
+	c.Assert(err, check.IsNil)
+	err = archive.Archive(evts[2:])
+	c.Assert(err, check.IsNil)
+	for i := range evts {
+		archived, err := archive.Get(evts[i].UniqueID)
+		c.Assert(err, check.IsNil)
+		c.Assert(archived.UniqueID, check.Equals, evts[i].UniqueID)
+		c.Assert(archived.ID, check.DeepEquals, evts[i].ID)
+		c.Assert(archived.StartTime.Equal(evts[i].StartTime), check.Equals, true)
+		c.Assert(archived.Kind, check.DeepEquals, evts[i].Kind)
+		c.Assert(archived.Log, check.Equals, "log line\n")
+	}
+	_, err = archive.Get(bson.NewObjectId())
+	c.Assert(err, check.Equals, ErrEventNotFound)
+	_, err = archive.Get(bson.NewObjectIdWithTime(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)))
+	c.Assert(err, check.Equals, ErrEventNotFound)
+}
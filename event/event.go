@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
@@ -27,6 +28,7 @@ import (
 var (
 	lockUpdateInterval = 30 * time.Second
 	lockExpireTimeout  = 5 * time.Minute
+	logFlushInterval   = time.Second
 	updater            = lockUpdater{
 		addCh:    make(chan *Target),
 		removeCh: make(chan *Target),
@@ -34,6 +36,7 @@ var (
 	}
 	throttlingInfo  = map[string]ThrottlingSpec{}
 	errInvalidQuery = errors.New("invalid query")
+	listeners       = listenerList{}
 
 	ErrNotCancelable     = errors.New("event is not cancelable")
 	ErrEventNotFound     = errors.New("event not found")
@@ -71,6 +74,10 @@ var (
 	TargetTypeInstallHost     = TargetType("install-host")
 	TargetTypeEventBlock      = TargetType("event-block")
 	TargetTypeCluster         = TargetType("cluster")
+	TargetTypeWebhook         = TargetType("webhook")
+	TargetTypeEventRetention  = TargetType("event-retention")
+	TargetTypeApprovalRule    = TargetType("approval-rule")
+	TargetTypeEventThrottling = TargetType("event-throttling")
 )
 
 const (
@@ -80,14 +87,25 @@ const (
 type ErrThrottled struct {
 	Spec   *ThrottlingSpec
 	Target Target
+	Reset  time.Duration
 }
 
 func (err ErrThrottled) Error() string {
-	var extra string
+	var extra, subject string
 	if err.Spec.KindName != "" {
 		extra = fmt.Sprintf(" %s on", err.Spec.KindName)
 	}
-	return fmt.Sprintf("event throttled, limit for%s %s %q is %d every %v", extra, err.Target.Type, err.Target.Value, err.Spec.Max, err.Spec.Time)
+	if !err.Spec.AllTargets {
+		subject = fmt.Sprintf("%s %q", err.Target.Type, err.Target.Value)
+	} else if err.Spec.TargetType != "" {
+		subject = fmt.Sprintf("all %s targets", err.Spec.TargetType)
+	} else {
+		subject = "all targets"
+	}
+	if err.Spec.OwnerName != "" {
+		subject += fmt.Sprintf(" by %q", err.Spec.OwnerName)
+	}
+	return fmt.Sprintf("event throttled, limit for%s %s is %d every %v, try again in %v", extra, subject, err.Spec.Max, err.Spec.Time, err.Reset)
 }
 
 type ErrValidation string
@@ -160,8 +178,10 @@ type eventData struct {
 	CancelInfo      cancelInfo
 	Cancelable      bool
 	Running         bool
+	Pending         bool `bson:",omitempty"`
 	Allowed         AllowedPermission
 	AllowedCancel   AllowedPermission
+	Approval        *Approval `bson:",omitempty"`
 }
 
 type cancelInfo struct {
@@ -219,11 +239,17 @@ func (k Kind) String() string {
 	return k.Name
 }
 
+// ThrottlingSpec limits how many events matching the spec may be started
+// within Time. Empty TargetType, KindName and OwnerName match every event.
+// Events are counted for each target, unless AllTargets is set.
 type ThrottlingSpec struct {
+	ID         bson.ObjectId `bson:"_id,omitempty" form:"-"`
 	TargetType TargetType
 	KindName   string
+	OwnerName  string
+	AllTargets bool
 	Max        int
-	Time       time.Duration
+	Time       time.Duration `form:"-"`
 }
 
 func SetThrottling(spec ThrottlingSpec) {
@@ -245,10 +271,41 @@ func getThrottling(t *Target, k *Kind) *ThrottlingSpec {
 	return nil
 }
 
+// Listener is a function called every time an event is started or finished.
+type Listener func(evt *Event)
+
+type listenerList struct {
+	sync.RWMutex
+	fns []Listener
+}
+
+// AddListener registers a listener which will be called, synchronously, after
+// an event is started and after it's marked as done. Listeners must not
+// block, long running work should be dispatched elsewhere.
+func AddListener(l Listener) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	listeners.fns = append(listeners.fns, l)
+}
+
+func notifyListeners(evt *Event) {
+	listeners.RLock()
+	defer listeners.RUnlock()
+	for _, l := range listeners.fns {
+		l(evt)
+	}
+}
+
 type Event struct {
 	eventData
-	logBuffer safe.Buffer
-	logWriter io.Writer
+	logBuffer    safe.Buffer
+	logWriter    io.Writer
+	flushMu      sync.Mutex
+	lastFlush    time.Time
+	flushPending bool
+	flushedSize  int
+	runningGauge prometheus.Gauge
+	lockedGauge  prometheus.Gauge
 }
 
 type Opts struct {
@@ -471,15 +528,26 @@ func GetByID(id bson.ObjectId) (*Event, error) {
 	err = coll.Find(bson.M{
 		"uniqueid": id,
 	}).One(&evt.eventData)
+	if err == mgo.ErrNotFound {
+		return getArchivedByID(id)
+	}
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			return nil, ErrEventNotFound
-		}
 		return nil, err
 	}
 	return &evt, nil
 }
 
+func getArchivedByID(id bson.ObjectId) (*Event, error) {
+	backend, err := getArchiveBackend()
+	if err != nil {
+		return nil, err
+	}
+	if backend == nil {
+		return nil, ErrEventNotFound
+	}
+	return backend.Get(id)
+}
+
 func All() ([]Event, error) {
 	return List(nil)
 }
@@ -534,6 +602,41 @@ func List(filter *Filter) ([]Event, error) {
 	return evts, nil
 }
 
+// Export calls fn for every event matching filter, oldest first. Unlike List,
+// Limit and Skip are ignored and events are not loaded in memory at once.
+// Archived events are not included.
+func Export(filter *Filter, fn func(*Event) error) error {
+	var query bson.M
+	if filter != nil {
+		var err error
+		query, err = filter.toQuery()
+		if err != nil {
+			if err == errInvalidQuery {
+				return nil
+			}
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	iter := conn.Events().Find(query).Sort("starttime", "uniqueid").Iter()
+	for {
+		var evt Event
+		if !iter.Next(&evt.eventData) {
+			break
+		}
+		err = fn(&evt)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
 func MarkAsRemoved(target Target) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -549,6 +652,36 @@ func MarkAsRemoved(target Target) error {
 	return err
 }
 
+// Retarget moves events from oldTarget to newTarget, replacing oldCtx with
+// newCtx in the contexts allowed to read them. It's used when the value
+// identifying a target changes, e.g. when an app is renamed. Running events
+// keep the lock on oldTarget until they're done, when they're stored with the
+// new target.
+func Retarget(oldTarget, newTarget Target, oldCtx, newCtx permission.PermissionContext) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	_, err = coll.UpdateAll(bson.M{
+		"target": oldTarget,
+	}, bson.M{"$set": bson.M{"target": newTarget}})
+	if err != nil {
+		return err
+	}
+	_, err = coll.UpdateAll(bson.M{
+		"allowed.contexts": bson.M{"$elemMatch": bson.M{
+			"ctxtype": oldCtx.CtxType,
+			"value":   oldCtx.Value,
+		}},
+	}, bson.M{"$set": bson.M{"allowed.contexts.$": bson.D{
+		{Name: "ctxtype", Value: newCtx.CtxType},
+		{Name: "value", Value: newCtx.Value},
+	}}})
+	return err
+}
+
 func New(opts *Opts) (*Event, error) {
 	if opts == nil {
 		return nil, ErrNoOpts
@@ -656,24 +789,9 @@ func newEvt(opts *Opts) (*Event, error) {
 	}
 	defer conn.Close()
 	coll := conn.Events()
-	tSpec := getThrottling(&opts.Target, &k)
-	if tSpec != nil && tSpec.Max > 0 && tSpec.Time > 0 {
-		query := bson.M{
-			"target.type":  opts.Target.Type,
-			"target.value": opts.Target.Value,
-			"starttime":    bson.M{"$gt": time.Now().UTC().Add(-tSpec.Time)},
-		}
-		if tSpec.KindName != "" {
-			query["kind.name"] = tSpec.KindName
-		}
-		var c int
-		c, err = coll.Find(query).Count()
-		if err != nil {
-			return nil, err
-		}
-		if c >= tSpec.Max {
-			return nil, ErrThrottled{Spec: tSpec, Target: opts.Target}
-		}
+	err = checkThrottling(coll, &opts.Target, &k, &o)
+	if err != nil {
+		return nil, err
 	}
 	now := time.Now().UTC()
 	raw, err := makeBSONRaw(opts.CustomData)
@@ -701,18 +819,31 @@ func newEvt(opts *Opts) (*Event, error) {
 		Allowed:         opts.Allowed,
 		AllowedCancel:   opts.AllowedCancel,
 	}}
+	approved, err := checkApproval(coll, &evt, opts)
+	if err != nil {
+		return nil, err
+	}
 	maxRetries := 1
 	for i := 0; i < maxRetries+1; i++ {
 		err = coll.Insert(evt.eventData)
 		if err == nil {
+			observeEventStart(&evt)
 			err = checkIsBlocked(&evt)
 			if err != nil {
 				evt.Done(err)
 				return nil, err
 			}
+			if approved {
+				err = useApproval(coll, &evt, opts)
+				if err != nil {
+					evt.Abort()
+					return nil, err
+				}
+			}
 			if !opts.DisableLock {
 				updater.addCh <- &opts.Target
 			}
+			notifyListeners(&evt)
 			return &evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -785,20 +916,83 @@ func (e *Event) SetOtherCustomData(data interface{}) error {
 	})
 }
 
+// Logger returns a logger attaching the ID, the kind and the target of the
+// event to every entry.
+func (e *Event) Logger() *log.FieldLogger {
+	return log.WithFields(log.Fields{
+		"event":  e.UniqueID.Hex(),
+		"kind":   e.Kind.String(),
+		"target": fmt.Sprintf("%s(%s)", e.Target.Type, e.Target.Value),
+	})
+}
+
 func (e *Event) Logf(format string, params ...interface{}) {
-	log.Debugf(fmt.Sprintf("%s(%s)[%s] %s", e.Target.Type, e.Target.Value, e.Kind, format), params...)
+	e.Logger().Debugf(format, params...)
 	format += "\n"
 	if e.logWriter != nil {
 		fmt.Fprintf(e.logWriter, format, params...)
 	}
 	fmt.Fprintf(&e.logBuffer, format, params...)
+	e.flushLog()
 }
 
 func (e *Event) Write(data []byte) (int, error) {
 	if e.logWriter != nil {
 		e.logWriter.Write(data)
 	}
-	return e.logBuffer.Write(data)
+	n, err := e.logBuffer.Write(data)
+	e.flushLog()
+	return n, err
+}
+
+// flushLog appends the log written since the last flush to the partial log of
+// a running event in the database, so it can be followed by other tsuru
+// instances before the event is done. Writes are batched, flushing at most
+// once every logFlushInterval.
+func (e *Event) flushLog() {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+	if !e.Running || e.flushPending {
+		return
+	}
+	if wait := logFlushInterval - time.Since(e.lastFlush); wait > 0 {
+		e.flushPending = true
+		time.AfterFunc(wait, e.flushPendingLog)
+		return
+	}
+	e.writePartialLog()
+}
+
+func (e *Event) flushPendingLog() {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+	e.flushPending = false
+	if e.Running {
+		e.writePartialLog()
+	}
+}
+
+func (e *Event) writePartialLog() {
+	e.lastFlush = time.Now()
+	data := e.logBuffer.String()
+	if len(data) <= e.flushedSize {
+		return
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[events] error getting db conn to flush log: %s", err)
+		return
+	}
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"_id": e.ID, "running": true}, bson.M{
+		"$push": bson.M{"partiallog": data[e.flushedSize:]},
+		"$inc":  bson.M{"logchunks": 1},
+	})
+	if err == nil {
+		e.flushedSize = len(data)
+	} else if err != mgo.ErrNotFound {
+		e.Logger().Errorf("[events] error flushing log: %s", err)
+	}
 }
 
 func (e *Event) TryCancel(reason, owner string) error {
@@ -882,7 +1076,17 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 			log.Errorf("[events] error marking event as done - %#v: %s", e, err)
 		}
 	}()
-	updater.removeCh <- &e.Target
+	lockTarget := e.Target
+	updater.removeCh <- &lockTarget
+	if !abort {
+		if evtErr != nil {
+			e.Error = evtErr.Error()
+		} else if e.CancelInfo.Canceled {
+			e.Error = "canceled by user request"
+		}
+		e.EndTime = time.Now().UTC()
+	}
+	observeEventDone(e, abort)
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -892,29 +1096,33 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 	if abort {
 		return coll.RemoveId(e.ID)
 	}
-	if evtErr != nil {
-		e.Error = evtErr.Error()
-	} else if e.CancelInfo.Canceled {
-		e.Error = "canceled by user request"
-	}
-	e.EndTime = time.Now().UTC()
 	e.EndCustomData, err = makeBSONRaw(customData)
 	if err != nil {
 		return err
 	}
+	e.flushMu.Lock()
 	e.Running = false
+	e.flushMu.Unlock()
 	e.Log = e.logBuffer.String()
 	var dbEvt Event
 	err = coll.FindId(e.ID).One(&dbEvt.eventData)
 	if err == nil {
 		e.OtherCustomData = dbEvt.OtherCustomData
+		// The event may have been retargeted while running.
+		e.Target = dbEvt.Target
+		e.Allowed = dbEvt.Allowed
 	}
 	if len(e.ID.ObjId) != 0 {
-		return coll.UpdateId(e.ID, e.eventData)
+		err = coll.UpdateId(e.ID, e.eventData)
+	} else {
+		defer coll.RemoveId(e.ID)
+		e.ID = eventID{ObjId: e.UniqueID}
+		err = coll.Insert(e.eventData)
 	}
-	defer coll.RemoveId(e.ID)
-	e.ID = eventID{ObjId: e.UniqueID}
-	return coll.Insert(e.eventData)
+	if err == nil {
+		notifyListeners(e)
+	}
+	return err
 }
 
 type lockUpdater struct {
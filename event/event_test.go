@@ -40,6 +40,9 @@ func (s *S) SetUpTest(c *check.C) {
 	config.Set("database:name", "tsuru_events_tests")
 	config.Set("auth:hash-cost", bcrypt.MinCost)
 	throttlingInfo = map[string]ThrottlingSpec{}
+	listeners = listenerList{}
+	rulesCacheTTL = 0
+	poolProvisioners.entries = map[string]cachedProvisioner{}
 	conn, err := db.Conn()
 	c.Assert(err, check.IsNil)
 	defer conn.Close()
@@ -575,6 +578,21 @@ func (s *S) TestEventDoneLogError(c *check.C) {
 	c.Assert(logBuf.String(), check.Matches, `(?s).*\[events\] error marking event as done - .*: no reachable servers.*`)
 }
 
+func (s *S) TestEventLogger(c *check.C) {
+	logBuf := safe.NewBuffer(nil)
+	log.SetLogger(log.NewWriterLogger(logBuf, true))
+	defer log.SetLogger(nil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("setting %d envs", 2)
+	c.Assert(logBuf.String(), check.Matches, `(?s).*DEBUG: setting 2 envs event=`+evt.UniqueID.Hex()+` kind=app.update.env.set target=app\(myapp\)\n`)
+}
+
 func (s *S) TestNewThrottledAllKinds(c *check.C) {
 	SetThrottling(ThrottlingSpec{
 		TargetType: TargetTypeApp,
@@ -606,7 +624,7 @@ func (s *S) TestNewThrottledAllKinds(c *check.C) {
 		Allowed: Allowed(permission.PermAppReadEvents),
 	})
 	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
-	c.Assert(err, check.ErrorMatches, "event throttled, limit for app \"myapp\" is 2 every 1h0m0s")
+	c.Assert(err, check.ErrorMatches, "event throttled, limit for app \"myapp\" is 2 every 1h0m0s, try again in .*")
 	_, err = New(&Opts{
 		Target:  Target{Type: "app", Value: "myapp"},
 		Kind:    permission.PermAppUpdateEnvUnset,
@@ -614,7 +632,7 @@ func (s *S) TestNewThrottledAllKinds(c *check.C) {
 		Allowed: Allowed(permission.PermAppReadEvents),
 	})
 	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
-	c.Assert(err, check.ErrorMatches, "event throttled, limit for app \"myapp\" is 2 every 1h0m0s")
+	c.Assert(err, check.ErrorMatches, "event throttled, limit for app \"myapp\" is 2 every 1h0m0s, try again in .*")
 	evt, err = New(&Opts{
 		Target:  Target{Type: "app", Value: "otherapp"},
 		Kind:    permission.PermAppUpdateEnvSet,
@@ -658,7 +676,7 @@ func (s *S) TestNewThrottledOneKind(c *check.C) {
 		Allowed: Allowed(permission.PermAppReadEvents),
 	})
 	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
-	c.Assert(err, check.ErrorMatches, "event throttled, limit for app.update.env.set on app \"myapp\" is 2 every 1h0m0s")
+	c.Assert(err, check.ErrorMatches, "event throttled, limit for app.update.env.set on app \"myapp\" is 2 every 1h0m0s, try again in .*")
 	evt, err = New(&Opts{
 		Target:  Target{Type: "app", Value: "myapp"},
 		Kind:    permission.PermAppUpdateEnvUnset,
@@ -910,3 +928,39 @@ func (s *S) TestNewCustomDataPtr(c *check.C) {
 	}}
 	c.Assert(evt, check.DeepEquals, expected)
 }
+
+func (s *S) TestListenersCalledOnStartAndDone(c *check.C) {
+	var calls []bool
+	AddListener(func(evt *Event) {
+		c.Assert(evt.Target, check.DeepEquals, Target{Type: "app", Value: "myapp"})
+		calls = append(calls, evt.Running)
+	})
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.DeepEquals, []bool{true})
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.DeepEquals, []bool{true, false})
+}
+
+func (s *S) TestListenersNotCalledOnAbort(c *check.C) {
+	var calls int
+	AddListener(func(evt *Event) {
+		calls++
+	})
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Abort()
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.Equals, 1)
+}
@@ -211,3 +211,48 @@ func (s *S) TestGetKinds(c *check.C) {
 	}
 	c.Assert(kinds, check.DeepEquals, expected)
 }
+
+func (s *S) TestRetarget(c *check.C) {
+	oldTarget := event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	newTarget := event.Target{Type: event.TargetTypeApp, Value: "yourapp"}
+	evt, err := event.New(&event.Opts{
+		Target:  oldTarget,
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "myapp"), permission.Context(permission.CtxPool, "pool1")),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	running, err := event.New(&event.Opts{
+		Target:  oldTarget,
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "myapp")),
+	})
+	c.Assert(err, check.IsNil)
+	err = event.Retarget(oldTarget, newTarget, permission.Context(permission.CtxApp, "myapp"), permission.Context(permission.CtxApp, "yourapp"))
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{Target: newTarget})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+	c.Assert(evts[0].UniqueID, check.Equals, running.UniqueID)
+	c.Assert(evts[1].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(evts[1].Allowed.Contexts, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxApp, "yourapp"),
+		permission.Context(permission.CtxPool, "pool1"),
+	})
+	err = running.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err = event.List(&event.Filter{Target: newTarget})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+	c.Assert(evts[0].UniqueID, check.Equals, running.UniqueID)
+	c.Assert(evts[0].Running, check.Equals, false)
+	c.Assert(evts[0].Allowed.Contexts, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxApp, "yourapp"),
+	})
+	evts, err = event.List(&event.Filter{Target: oldTarget})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
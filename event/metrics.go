@@ -0,0 +1,152 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// PoolProvisioner returns the name of the provisioner used by a pool. It's
+// set by the provision package and used to label event metrics.
+var PoolProvisioner func(pool string) string
+
+// poolProvisionerTTL is how long the provisioner of a pool is cached, avoiding
+// a pool lookup for every finished event.
+var poolProvisionerTTL = time.Minute
+
+var poolProvisioners = struct {
+	sync.Mutex
+	entries map[string]cachedProvisioner
+}{entries: map[string]cachedProvisioner{}}
+
+type cachedProvisioner struct {
+	name    string
+	expires time.Time
+}
+
+var (
+	finishedLabels = []string{"kind", "target_type", "pool", "provisioner", "result"}
+
+	eventsStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_events_started_total",
+		Help: "The total number of events started.",
+	}, []string{"kind", "target_type"})
+
+	eventsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_events_finished_total",
+		Help: "The total number of events finished, by result.",
+	}, finishedLabels)
+
+	eventDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsuru_events_duration_seconds",
+		Help:    "The events duration distributions.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2.5, 12),
+	}, finishedLabels)
+
+	eventsRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_events_running",
+		Help: "The number of events currently running in this tsuru instance.",
+	}, []string{"kind", "target_type"})
+
+	eventsLocked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_events_locked",
+		Help: "The number of targets currently locked by events running in this tsuru instance.",
+	}, []string{"target_type"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsStarted)
+	prometheus.MustRegister(eventsFinished)
+	prometheus.MustRegister(eventDuration)
+	prometheus.MustRegister(eventsRunning)
+	prometheus.MustRegister(eventsLocked)
+}
+
+func (e *Event) locksTarget() bool {
+	return len(e.ID.ObjId) == 0
+}
+
+// observeEventStart updates the metrics of a new event. The running and
+// locked gauges incremented are kept in the event, so they're only decremented
+// when the same event is done in this tsuru instance.
+func observeEventStart(e *Event) {
+	eventsStarted.WithLabelValues(e.Kind.Name, string(e.Target.Type)).Inc()
+	e.runningGauge = eventsRunning.WithLabelValues(e.Kind.Name, string(e.Target.Type))
+	e.runningGauge.Inc()
+	if e.locksTarget() {
+		e.lockedGauge = eventsLocked.WithLabelValues(string(e.Target.Type))
+		e.lockedGauge.Inc()
+	}
+}
+
+// observeEventDone updates the metrics of a finished event. Only the kind,
+// target type, pool and provisioner are used as labels, never the target
+// value, to keep the number of series bounded.
+func observeEventDone(e *Event, abort bool) {
+	if e.runningGauge != nil {
+		e.runningGauge.Dec()
+		e.runningGauge = nil
+	}
+	if e.lockedGauge != nil {
+		e.lockedGauge.Dec()
+		e.lockedGauge = nil
+	}
+	if abort {
+		return
+	}
+	result := "success"
+	if e.CancelInfo.Canceled {
+		result = "canceled"
+	} else if e.Error != "" {
+		result = "error"
+	}
+	pool, provisioner := e.metricsPool()
+	labels := prometheus.Labels{
+		"kind":        e.Kind.Name,
+		"target_type": string(e.Target.Type),
+		"pool":        pool,
+		"provisioner": provisioner,
+		"result":      result,
+	}
+	eventsFinished.With(labels).Inc()
+	eventDuration.With(labels).Observe(e.EndTime.Sub(e.StartTime).Seconds())
+}
+
+func (e *Event) metricsPool() (pool, provisioner string) {
+	if e.Target.Type == TargetTypePool {
+		pool = e.Target.Value
+	} else {
+		for _, ctx := range e.Allowed.Contexts {
+			if ctx.CtxType == permission.CtxPool {
+				pool = ctx.Value
+				break
+			}
+		}
+	}
+	return pool, poolProvisioner(pool)
+}
+
+func poolProvisioner(pool string) string {
+	if pool == "" || PoolProvisioner == nil {
+		return ""
+	}
+	poolProvisioners.Lock()
+	cached, ok := poolProvisioners.entries[pool]
+	poolProvisioners.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.name
+	}
+	// The lookup may hit the database, so it's done without holding the lock,
+	// at the cost of concurrent lookups of the same pool on expiration.
+	name := PoolProvisioner(pool)
+	poolProvisioners.Lock()
+	poolProvisioners.entries[pool] = cachedProvisioner{name: name, expires: time.Now().Add(poolProvisionerTTL)}
+	poolProvisioners.Unlock()
+	return name
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func metricValue(c *check.C, m prometheus.Metric) *dto.Metric {
+	var dtoMetric dto.Metric
+	err := m.Write(&dtoMetric)
+	c.Assert(err, check.IsNil)
+	return &dtoMetric
+}
+
+func (s *S) TestEventMetrics(c *check.C) {
+	oldProvisioner := PoolProvisioner
+	defer func() { PoolProvisioner = oldProvisioner }()
+	PoolProvisioner = func(pool string) string {
+		return "fake-" + pool
+	}
+	kind := "metrics-test"
+	running := eventsRunning.WithLabelValues(kind, string(TargetTypeApp))
+	locked := eventsLocked.WithLabelValues(string(TargetTypeApp))
+	lockedBefore := metricValue(c, locked).Gauge.GetValue()
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeApp, Value: "myapp"},
+		InternalKind: kind,
+		Allowed:      Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxPool, "pool1")),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 1.0)
+	c.Assert(metricValue(c, locked).Gauge.GetValue(), check.Equals, lockedBefore+1)
+	err = evt.Done(errors.New("fail"))
+	c.Assert(err, check.IsNil)
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 0.0)
+	c.Assert(metricValue(c, locked).Gauge.GetValue(), check.Equals, lockedBefore)
+	started := eventsStarted.WithLabelValues(kind, string(TargetTypeApp))
+	c.Assert(metricValue(c, started).Counter.GetValue(), check.Equals, 1.0)
+	finished := eventsFinished.WithLabelValues(kind, string(TargetTypeApp), "pool1", "fake-pool1", "error")
+	c.Assert(metricValue(c, finished).Counter.GetValue(), check.Equals, 1.0)
+	duration := eventDuration.WithLabelValues(kind, string(TargetTypeApp), "pool1", "fake-pool1", "error")
+	c.Assert(metricValue(c, duration).Histogram.GetSampleCount(), check.Equals, uint64(1))
+}
+
+func (s *S) TestEventMetricsAbort(c *check.C) {
+	kind := "metrics-abort-test"
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeNode, Value: "node1"},
+		InternalKind: kind,
+		DisableLock:  true,
+		Allowed:      Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	running := eventsRunning.WithLabelValues(kind, string(TargetTypeNode))
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 1.0)
+	err = evt.Abort()
+	c.Assert(err, check.IsNil)
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 0.0)
+	finished := eventsFinished.WithLabelValues(kind, string(TargetTypeNode), "", "", "success")
+	c.Assert(metricValue(c, finished).Counter.GetValue(), check.Equals, 0.0)
+}
+
+func (s *S) TestEventMetricsDoneByOtherInstance(c *check.C) {
+	kind := "metrics-other-instance-test"
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeNode, Value: "node1"},
+		InternalKind: kind,
+		Allowed:      Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	running := eventsRunning.WithLabelValues(kind, string(TargetTypeNode))
+	locked := eventsLocked.WithLabelValues(string(TargetTypeNode))
+	lockedBefore := metricValue(c, locked).Gauge.GetValue()
+	loaded, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	err = loaded.Done(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 1.0)
+	c.Assert(metricValue(c, locked).Gauge.GetValue(), check.Equals, lockedBefore)
+	// The event was already moved by the other instance, only the metrics
+	// matter here.
+	evt.Done(nil)
+	c.Assert(metricValue(c, running).Gauge.GetValue(), check.Equals, 0.0)
+	c.Assert(metricValue(c, locked).Gauge.GetValue(), check.Equals, lockedBefore-1)
+}
+
+func (s *S) TestEventMetricsPoolProvisionerCached(c *check.C) {
+	oldProvisioner := PoolProvisioner
+	defer func() { PoolProvisioner = oldProvisioner }()
+	calls := 0
+	PoolProvisioner = func(pool string) string {
+		calls++
+		return "fake-" + pool
+	}
+	c.Assert(poolProvisioner("pool1"), check.Equals, "fake-pool1")
+	c.Assert(poolProvisioner("pool1"), check.Equals, "fake-pool1")
+	c.Assert(poolProvisioner(""), check.Equals, "")
+	c.Assert(calls, check.Equals, 1)
+	poolProvisioners.entries["pool1"] = cachedProvisioner{name: "fake-pool1", expires: time.Now().Add(-time.Second)}
+	c.Assert(poolProvisioner("pool1"), check.Equals, "fake-pool1")
+	c.Assert(calls, check.Equals, 2)
+}
+
+func (s *S) TestEventMetricsPoolProvisionerSlowLookup(c *check.C) {
+	oldProvisioner := PoolProvisioner
+	defer func() { PoolProvisioner = oldProvisioner }()
+	release := make(chan struct{})
+	PoolProvisioner = func(pool string) string {
+		if pool == "slow" {
+			<-release
+		}
+		return "fake-" + pool
+	}
+	slowDone := make(chan string)
+	go func() {
+		slowDone <- poolProvisioner("slow")
+	}()
+	done := make(chan string)
+	go func() {
+		done <- poolProvisioner("fast")
+	}()
+	select {
+	case name := <-done:
+		c.Assert(name, check.Equals, "fake-fast")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for lookup of pool not blocked by slow lookup")
+	}
+	close(release)
+	c.Assert(<-slowDone, check.Equals, "fake-slow")
+}
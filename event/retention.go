@@ -0,0 +1,236 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	retentionEventKind      = "events-retention"
+	retentionBatchSize      = 100
+	defaultRetentionRunTime = time.Hour
+)
+
+// RetentionPolicy defines for how long finished events matching a kind and a
+// target type are kept in the database. Older events are either dropped or
+// sent to the configured archive backend. Empty KindName and TargetType
+// match every event.
+type RetentionPolicy struct {
+	Name       string
+	KindName   string
+	TargetType TargetType
+	MaxAge     time.Duration
+	Archive    bool
+}
+
+func (p *RetentionPolicy) matchQuery() bson.M {
+	query := bson.M{}
+	if p.KindName != "" {
+		query["kind.name"] = p.KindName
+	}
+	if p.TargetType != "" {
+		query["target.type"] = p.TargetType
+	}
+	return query
+}
+
+func (p *RetentionPolicy) specificity() int {
+	var n int
+	if p.KindName != "" {
+		n += 2
+	}
+	if p.TargetType != "" {
+		n++
+	}
+	return n
+}
+
+// precedes returns whether the policy is more specific than other and may
+// match the same events, in which case it's the one applied to them.
+func (p *RetentionPolicy) precedes(other *RetentionPolicy) bool {
+	return p.specificity() > other.specificity() &&
+		(p.KindName == "" || other.KindName == "" || p.KindName == other.KindName) &&
+		(p.TargetType == "" || other.TargetType == "" || p.TargetType == other.TargetType)
+}
+
+// RetentionPolicies returns the retention policies defined in the
+// events:retention:policies config entry.
+func RetentionPolicies() ([]RetentionPolicy, error) {
+	policiesConfig, err := config.Get("events:retention:policies")
+	if err != nil {
+		return nil, nil
+	}
+	policiesMap, _ := policiesConfig.(map[interface{}]interface{})
+	names := make([]string, 0, len(policiesMap))
+	for key := range policiesMap {
+		name, _ := key.(string)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	policies := make([]RetentionPolicy, len(names))
+	for i, name := range names {
+		prefix := "events:retention:policies:" + name
+		policies[i].Name = name
+		policies[i].KindName, _ = config.GetString(prefix + ":kind")
+		targetType, _ := config.GetString(prefix + ":target-type")
+		policies[i].TargetType = TargetType(targetType)
+		policies[i].MaxAge, err = config.GetDuration(prefix + ":max-age")
+		if err != nil || policies[i].MaxAge <= 0 {
+			return nil, errors.Errorf("invalid max-age for event retention policy %q", name)
+		}
+		action, _ := config.GetString(prefix + ":action")
+		switch action {
+		case "", "drop":
+		case "archive":
+			policies[i].Archive = true
+		default:
+			return nil, errors.Errorf("invalid action %q for event retention policy %q, must be drop or archive", action, name)
+		}
+	}
+	return policies, nil
+}
+
+// RunRetention applies every retention policy once. Only one tsuru instance
+// applies the policies at a time, others return immediately.
+func RunRetention() (err error) {
+	policies, err := RetentionPolicies()
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+	backend, err := getArchiveBackend()
+	if err != nil {
+		return err
+	}
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeEventRetention},
+		InternalKind: retentionEventKind,
+		Allowed:      Allowed(permission.PermAll),
+	})
+	if err != nil {
+		if _, ok := err.(ErrEventLocked); ok {
+			return nil
+		}
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	for i := range policies {
+		var removed int
+		removed, err = applyRetention(&policies[i], policies, backend)
+		if err != nil {
+			return errors.Wrapf(err, "unable to apply event retention policy %q", policies[i].Name)
+		}
+		evt.Logf("policy %q: %d events removed", policies[i].Name, removed)
+	}
+	return nil
+}
+
+func applyRetention(policy *RetentionPolicy, all []RetentionPolicy, backend ArchiveBackend) (int, error) {
+	if policy.Archive && backend == nil {
+		return 0, errors.New("archive action requires an archive backend")
+	}
+	query := policy.matchQuery()
+	query["running"] = false
+	query["pending"] = bson.M{"$ne": true}
+	query["starttime"] = bson.M{"$lt": time.Now().UTC().Add(-policy.MaxAge)}
+	var nor []bson.M
+	for i := range all {
+		if all[i].precedes(policy) {
+			nor = append(nor, all[i].matchQuery())
+		}
+	}
+	if len(nor) > 0 {
+		query["$nor"] = nor
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	var removed int
+	for {
+		var allData []eventData
+		err = coll.Find(query).Sort("starttime").Limit(retentionBatchSize).All(&allData)
+		if err != nil {
+			return removed, err
+		}
+		if len(allData) == 0 {
+			return removed, nil
+		}
+		evts := make([]Event, len(allData))
+		ids := make([]bson.ObjectId, len(allData))
+		for i := range allData {
+			evts[i].eventData = allData[i]
+			ids[i] = allData[i].UniqueID
+		}
+		if policy.Archive {
+			err = backend.Archive(evts)
+			if err != nil {
+				return removed, err
+			}
+		}
+		var info *mgo.ChangeInfo
+		info, err = coll.RemoveAll(bson.M{"uniqueid": bson.M{"$in": ids}, "running": false, "pending": bson.M{"$ne": true}})
+		if err != nil {
+			return removed, err
+		}
+		removed += info.Removed
+	}
+}
+
+type retentionRunner struct {
+	interval time.Duration
+	done     chan bool
+}
+
+// InitializeRetention starts applying the configured retention policies
+// periodically, every events:retention:run-interval.
+func InitializeRetention() error {
+	policies, err := RetentionPolicies()
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+	interval, _ := config.GetDuration("events:retention:run-interval")
+	if interval <= 0 {
+		interval = defaultRetentionRunTime
+	}
+	r := &retentionRunner{interval: interval, done: make(chan bool)}
+	shutdown.Register(r)
+	go r.run()
+	return nil
+}
+
+func (r *retentionRunner) run() {
+	for {
+		err := RunRetention()
+		if err != nil {
+			log.Errorf("[events] [retention] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *retentionRunner) Shutdown() {
+	r.done <- true
+}
+
+func (r *retentionRunner) String() string {
+	return "event retention"
+}
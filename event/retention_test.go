@@ -0,0 +1,171 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) newFinishedEvent(c *check.C, target Target, kind *permission.PermissionScheme, age time.Duration) *Event {
+	evt, err := New(&Opts{
+		Target:  target,
+		Kind:    kind,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("some log")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"uniqueid": evt.UniqueID}, bson.M{
+		"$set": bson.M{"starttime": time.Now().UTC().Add(-age)},
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestRetentionPolicies(c *check.C) {
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"deploys": map[interface{}]interface{}{
+			"kind":        "app.deploy",
+			"target-type": "app",
+			"max-age":     "720h",
+			"action":      "archive",
+		},
+		"all": map[interface{}]interface{}{
+			"max-age": "24h",
+		},
+	})
+	defer config.Unset("events:retention")
+	policies, err := RetentionPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []RetentionPolicy{
+		{Name: "all", MaxAge: 24 * time.Hour},
+		{Name: "deploys", KindName: "app.deploy", TargetType: TargetTypeApp, MaxAge: 720 * time.Hour, Archive: true},
+	})
+	c.Assert(policies[1].precedes(&policies[0]), check.Equals, true)
+	c.Assert(policies[0].precedes(&policies[1]), check.Equals, false)
+}
+
+func (s *S) TestRetentionPoliciesInvalid(c *check.C) {
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"p1": map[interface{}]interface{}{"max-age": "24h", "action": "explode"},
+	})
+	defer config.Unset("events:retention")
+	_, err := RetentionPolicies()
+	c.Assert(err, check.ErrorMatches, `invalid action "explode" for event retention policy "p1", must be drop or archive`)
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"p1": map[interface{}]interface{}{"kind": "app.deploy"},
+	})
+	_, err = RetentionPolicies()
+	c.Assert(err, check.ErrorMatches, `invalid max-age for event retention policy "p1"`)
+}
+
+func (s *S) TestRunRetention(c *check.C) {
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"deploys": map[interface{}]interface{}{
+			"kind":    "app.deploy",
+			"max-age": "720h",
+			"action":  "archive",
+		},
+		"all": map[interface{}]interface{}{
+			"max-age": "24h",
+		},
+	})
+	config.Set("events:archive:backend", "local")
+	config.Set("events:archive:local:path", c.MkDir())
+	defer config.Unset("events:retention")
+	defer config.Unset("events:archive")
+	app := Target{Type: TargetTypeApp, Value: "myapp"}
+	recentDeploy := s.newFinishedEvent(c, app, permission.PermAppDeploy, 48*time.Hour)
+	oldDeploy := s.newFinishedEvent(c, app, permission.PermAppDeploy, 800*time.Hour)
+	oldEnv := s.newFinishedEvent(c, app, permission.PermAppUpdateEnvSet, 48*time.Hour)
+	recentEnv := s.newFinishedEvent(c, app, permission.PermAppUpdateEnvSet, time.Hour)
+	running, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "otherapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer running.Done(nil)
+	err = RunRetention()
+	c.Assert(err, check.IsNil)
+	evts, err := List(&Filter{KindType: KindTypePermission})
+	c.Assert(err, check.IsNil)
+	var ids []bson.ObjectId
+	for i := range evts {
+		ids = append(ids, evts[i].UniqueID)
+	}
+	c.Assert(ids, check.HasLen, 3)
+	c.Assert(ids, check.DeepEquals, []bson.ObjectId{running.UniqueID, recentEnv.UniqueID, recentDeploy.UniqueID})
+	archived, err := GetByID(oldDeploy.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(archived.Kind.Name, check.Equals, "app.deploy")
+	c.Assert(archived.Log, check.Equals, "some log\n")
+	c.Assert(archived.Running, check.Equals, false)
+	_, err = GetByID(oldEnv.UniqueID)
+	c.Assert(err, check.Equals, ErrEventNotFound)
+	retentionEvts, err := List(&Filter{KindName: retentionEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(retentionEvts, check.HasLen, 1)
+	c.Assert(retentionEvts[0].Log, check.Equals, "policy \"all\": 1 events removed\npolicy \"deploys\": 1 events removed\n")
+}
+
+func (s *S) TestRunRetentionSkipsPendingApproval(c *check.C) {
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"all": map[interface{}]interface{}{"max-age": "24h"},
+	})
+	defer config.Unset("events:retention")
+	app := Target{Type: TargetTypeApp, Value: "myapp"}
+	pending := s.newFinishedEvent(c, app, permission.PermAppDeploy, 48*time.Hour)
+	old := s.newFinishedEvent(c, app, permission.PermAppDeploy, 48*time.Hour)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"uniqueid": pending.UniqueID}, bson.M{"$set": bson.M{"pending": true}})
+	c.Assert(err, check.IsNil)
+	err = RunRetention()
+	c.Assert(err, check.IsNil)
+	_, err = GetByID(pending.UniqueID)
+	c.Assert(err, check.IsNil)
+	_, err = GetByID(old.UniqueID)
+	c.Assert(err, check.Equals, ErrEventNotFound)
+}
+
+func (s *S) TestRunRetentionArchiveWithoutBackend(c *check.C) {
+	config.Set("events:retention:policies", map[interface{}]interface{}{
+		"deploys": map[interface{}]interface{}{"max-age": "24h", "action": "archive"},
+	})
+	defer config.Unset("events:retention")
+	evt := s.newFinishedEvent(c, Target{Type: TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, 48*time.Hour)
+	err := RunRetention()
+	c.Assert(err, check.ErrorMatches, `unable to apply event retention policy "deploys": archive action requires an archive backend`)
+	_, err = GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestExport(c *check.C) {
+	app := Target{Type: TargetTypeApp, Value: "myapp"}
+	first := s.newFinishedEvent(c, app, permission.PermAppDeploy, 2*time.Hour)
+	second := s.newFinishedEvent(c, app, permission.PermAppDeploy, time.Hour)
+	s.newFinishedEvent(c, Target{Type: TargetTypeApp, Value: "otherapp"}, permission.PermAppDeploy, time.Hour)
+	var ids []bson.ObjectId
+	err := Export(&Filter{Target: app, Limit: 1}, func(evt *Event) error {
+		ids = append(ids, evt.UniqueID)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(ids, check.DeepEquals, []bson.ObjectId{first.UniqueID, second.UniqueID})
+}
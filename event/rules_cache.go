@@ -0,0 +1,42 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// rulesCacheTTL is how long the rules checked for every new event are kept in
+// memory. The cache is reset when rules are changed in this process, changes
+// made in other tsuru instances are seen after the TTL.
+var rulesCacheTTL = 10 * time.Second
+
+type rulesCache struct {
+	sync.Mutex
+	rules   interface{}
+	expires time.Time
+}
+
+func (c *rulesCache) get(load func() (interface{}, error)) (interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.rules, nil
+	}
+	rules, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.rules = rules
+	c.expires = time.Now().Add(rulesCacheTTL)
+	return rules, nil
+}
+
+func (c *rulesCache) reset() {
+	c.Lock()
+	c.expires = time.Time{}
+	c.Unlock()
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrThrottlingRuleNotFound = errors.New("throttling rule not found")
+	ErrInvalidThrottlingRule  = ErrValidation("throttling rule requires max and time greater than zero")
+
+	throttledEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_events_throttled_total",
+		Help: "The total number of events refused by throttling rules.",
+	}, []string{"kind", "target_type"})
+)
+
+func init() {
+	prometheus.MustRegister(throttledEvents)
+}
+
+// matches reports whether the rule applies to a new event. Events managing the
+// throttling rules are never matched, so that a broad rule can't prevent its
+// own removal.
+func (s *ThrottlingSpec) matches(t *Target, k *Kind, o *Owner) bool {
+	if t.Type == TargetTypeEventThrottling {
+		return false
+	}
+	return (s.TargetType == "" || s.TargetType == t.Type) &&
+		(s.KindName == "" || s.KindName == k.Name) &&
+		(s.OwnerName == "" || s.OwnerName == o.Name)
+}
+
+func (s *ThrottlingSpec) query(t *Target) bson.M {
+	query := bson.M{
+		"starttime": bson.M{"$gt": time.Now().UTC().Add(-s.Time)},
+	}
+	if !s.AllTargets {
+		query["target.type"] = t.Type
+		query["target.value"] = t.Value
+	} else if s.TargetType != "" {
+		query["target.type"] = s.TargetType
+	}
+	if s.KindName != "" {
+		query["kind.name"] = s.KindName
+	}
+	if s.OwnerName != "" {
+		query["owner.name"] = s.OwnerName
+	}
+	return query
+}
+
+// AddThrottlingRule stores a new throttling rule, applied to every event
+// started afterwards, along with the rules set by SetThrottling.
+func AddThrottlingRule(s *ThrottlingSpec) error {
+	if s.Max <= 0 || s.Time <= 0 {
+		return ErrInvalidThrottlingRule
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer throttlingRules.reset()
+	s.ID = bson.NewObjectId()
+	return conn.EventThrottling().Insert(s)
+}
+
+func RemoveThrottlingRule(id bson.ObjectId) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer throttlingRules.reset()
+	err = conn.EventThrottling().RemoveId(id)
+	if err == mgo.ErrNotFound {
+		return ErrThrottlingRuleNotFound
+	}
+	return err
+}
+
+func ListThrottlingRules() ([]ThrottlingSpec, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var rules []ThrottlingSpec
+	err = conn.EventThrottling().Find(nil).All(&rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// throttlingRules caches the throttling rules, checked for every new event.
+var throttlingRules rulesCache
+
+// checkThrottling returns an ErrThrottled if any throttling rule matching the
+// new event was already reached.
+func checkThrottling(coll *storage.Collection, t *Target, k *Kind, o *Owner) error {
+	var specs []ThrottlingSpec
+	if spec := getThrottling(t, k); spec != nil {
+		specs = append(specs, *spec)
+	}
+	cached, err := throttlingRules.get(func() (interface{}, error) {
+		return ListThrottlingRules()
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range cached.([]ThrottlingSpec) {
+		if r.matches(t, k, o) {
+			specs = append(specs, r)
+		}
+	}
+	for i := range specs {
+		spec := &specs[i]
+		if spec.Max <= 0 || spec.Time <= 0 {
+			continue
+		}
+		query := spec.query(t)
+		count, err := coll.Find(query).Count()
+		if err != nil {
+			return err
+		}
+		if count < spec.Max {
+			continue
+		}
+		var oldest eventData
+		err = coll.Find(query).Sort("starttime").Skip(count - spec.Max).Select(bson.M{"starttime": 1}).One(&oldest)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		reset := oldest.StartTime.Add(spec.Time).Sub(time.Now().UTC())
+		if reset < 0 {
+			reset = 0
+		}
+		throttledEvents.WithLabelValues(k.Name, string(t.Type)).Inc()
+		return ErrThrottled{Spec: spec, Target: *t, Reset: reset.Round(time.Second)}
+	}
+	return nil
+}
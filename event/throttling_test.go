@@ -0,0 +1,115 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newThrottlingTestEvent(appName string, kind *permission.PermissionScheme) error {
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: appName},
+		Kind:    kind,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	return evt.Done(nil)
+}
+
+func (s *S) TestAddThrottlingRule(c *check.C) {
+	err := AddThrottlingRule(&ThrottlingSpec{KindName: "app.restart"})
+	c.Assert(err, check.Equals, ErrInvalidThrottlingRule)
+	rule := ThrottlingSpec{KindName: "app.restart", OwnerName: "me@me.com", AllTargets: true, Max: 10, Time: time.Minute}
+	err = AddThrottlingRule(&rule)
+	c.Assert(err, check.IsNil)
+	rules, err := ListThrottlingRules()
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []ThrottlingSpec{rule})
+	err = RemoveThrottlingRule(rule.ID)
+	c.Assert(err, check.IsNil)
+	err = RemoveThrottlingRule(rule.ID)
+	c.Assert(err, check.Equals, ErrThrottlingRuleNotFound)
+}
+
+func (s *S) TestThrottlingRulesCached(c *check.C) {
+	rulesCacheTTL = time.Minute
+	defer func() { rulesCacheTTL = 0 }()
+	rule := ThrottlingSpec{KindName: permission.PermAppUpdateRestart.FullName(), AllTargets: true, Max: 1, Time: time.Hour}
+	err := AddThrottlingRule(&rule)
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app1", permission.PermAppUpdateRestart)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.EventThrottling().RemoveId(rule.ID)
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app2", permission.PermAppUpdateRestart)
+	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
+	err = AddThrottlingRule(&ThrottlingSpec{KindName: permission.PermAppDeploy.FullName(), Max: 1, Time: time.Hour})
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app3", permission.PermAppUpdateRestart)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestThrottlingSpecMatches(c *check.C) {
+	target := Target{Type: TargetTypeApp, Value: "myapp"}
+	kind := Kind{Type: KindTypePermission, Name: "app.restart"}
+	owner := Owner{Type: OwnerTypeUser, Name: "me@me.com"}
+	c.Assert((&ThrottlingSpec{}).matches(&target, &kind, &owner), check.Equals, true)
+	c.Assert((&ThrottlingSpec{KindName: "app.restart", OwnerName: "me@me.com"}).matches(&target, &kind, &owner), check.Equals, true)
+	c.Assert((&ThrottlingSpec{OwnerName: "other@me.com"}).matches(&target, &kind, &owner), check.Equals, false)
+	c.Assert((&ThrottlingSpec{TargetType: TargetTypeNode}).matches(&target, &kind, &owner), check.Equals, false)
+	c.Assert((&ThrottlingSpec{KindName: "app.deploy"}).matches(&target, &kind, &owner), check.Equals, false)
+	throttlingTarget := Target{Type: TargetTypeEventThrottling}
+	throttlingKind := Kind{Type: KindTypePermission, Name: "event-throttling.remove"}
+	c.Assert((&ThrottlingSpec{}).matches(&throttlingTarget, &throttlingKind, &owner), check.Equals, false)
+	c.Assert((&ThrottlingSpec{TargetType: TargetTypeEventThrottling}).matches(&throttlingTarget, &throttlingKind, &owner), check.Equals, false)
+}
+
+func (s *S) TestNewThrottledByOwnerRule(c *check.C) {
+	err := AddThrottlingRule(&ThrottlingSpec{
+		KindName:   permission.PermAppUpdateRestart.FullName(),
+		OwnerName:  s.token.GetUserName(),
+		AllTargets: true,
+		Max:        2,
+		Time:       time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app1", permission.PermAppUpdateRestart)
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app2", permission.PermAppUpdateRestart)
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app3", permission.PermAppUpdateRestart)
+	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
+	c.Assert(err, check.ErrorMatches, `event throttled, limit for app.update.restart on all targets by "me@me.com" is 2 every 1h0m0s, try again in .*`)
+	reset := err.(ErrThrottled).Reset
+	c.Assert(reset > 59*time.Minute && reset <= time.Hour, check.Equals, true)
+	err = s.newThrottlingTestEvent("app3", permission.PermAppDeploy)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestNewThrottledByTargetRule(c *check.C) {
+	err := AddThrottlingRule(&ThrottlingSpec{
+		TargetType: TargetTypeApp,
+		Max:        1,
+		Time:       time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app1", permission.PermAppDeploy)
+	c.Assert(err, check.IsNil)
+	err = s.newThrottlingTestEvent("app1", permission.PermAppUpdateRestart)
+	c.Assert(err, check.FitsTypeOf, ErrThrottled{})
+	c.Assert(err, check.ErrorMatches, `event throttled, limit for app "app1" is 1 every 1h0m0s, try again in .*`)
+	err = s.newThrottlingTestEvent("app2", permission.PermAppDeploy)
+	c.Assert(err, check.IsNil)
+}
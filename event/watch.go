@@ -0,0 +1,245 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	WatchMessageStart = "start"
+	WatchMessageLog   = "log"
+	WatchMessageDone  = "done"
+)
+
+var (
+	watchPollInterval = time.Second
+	// watchOverlap is subtracted from the last poll time when looking for new
+	// events, covering clock differences between tsuru instances.
+	watchOverlap = 30 * time.Second
+)
+
+// WatchMessage is sent by a Watcher whenever a matching event starts, writes
+// to its log or finishes. Log messages only carry the new part of the log.
+type WatchMessage struct {
+	Type  string
+	ID    bson.ObjectId
+	Event *Event `json:",omitempty"`
+	Log   string `json:",omitempty"`
+}
+
+// watchedEvent is an event as read by the Watcher, without its log and with
+// the number of partial log chunks flushed while it's running.
+type watchedEvent struct {
+	Data      eventData `bson:",inline"`
+	LogChunks int
+}
+
+// watchedLog is how much of an event log was already sent by the Watcher.
+type watchedLog struct {
+	chunks int
+	size   int
+}
+
+// Watcher follows the events collection, reporting changes to events matching
+// a filter. As it only relies on the database it sees events from every tsuru
+// instance.
+type Watcher struct {
+	c       chan WatchMessage
+	quit    chan struct{}
+	closeMu sync.Mutex
+	filter  Filter
+	start   time.Time
+	since   time.Time
+	logs    map[bson.ObjectId]watchedLog
+	// finished holds when finished events were seen, so duplicates found
+	// while inside the overlap window are ignored.
+	finished map[bson.ObjectId]time.Time
+}
+
+// Watch starts a watcher for events matching filter, created or running from
+// now on. Limit, Skip and Sort are ignored.
+func Watch(filter *Filter) (*Watcher, error) {
+	if filter == nil {
+		filter = &Filter{}
+	}
+	_, err := filter.toQuery()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	w := &Watcher{
+		c:        make(chan WatchMessage, 10),
+		quit:     make(chan struct{}),
+		filter:   *filter,
+		start:    now,
+		since:    now,
+		logs:     map[bson.ObjectId]watchedLog{},
+		finished: map[bson.ObjectId]time.Time{},
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *Watcher) ListenChan() <-chan WatchMessage {
+	return w.c
+}
+
+func (w *Watcher) Close() {
+	w.closeMu.Lock()
+	defer w.closeMu.Unlock()
+	if w.quit != nil {
+		close(w.quit)
+		w.quit = nil
+	}
+}
+
+func (w *Watcher) run() {
+	defer close(w.c)
+	w.closeMu.Lock()
+	quit := w.quit
+	w.closeMu.Unlock()
+	if quit == nil {
+		return
+	}
+	for {
+		if !w.poll(quit) {
+			return
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(watchPollInterval):
+		}
+	}
+}
+
+func (w *Watcher) query(since time.Time) (bson.M, error) {
+	filterQuery, err := w.filter.toQuery()
+	if err != nil {
+		return nil, err
+	}
+	tracked := make([]bson.ObjectId, 0, len(w.logs))
+	for id := range w.logs {
+		tracked = append(tracked, id)
+	}
+	return bson.M{"$and": []bson.M{filterQuery, {
+		"$or": []bson.M{
+			{"starttime": bson.M{"$gte": since}},
+			{"running": true},
+			{"uniqueid": bson.M{"$in": tracked}},
+		},
+	}}}, nil
+}
+
+// poll looks for changes in the events collection and sends them to the
+// listener, returning false if the watcher was closed.
+func (w *Watcher) poll(quit chan struct{}) bool {
+	pollTime := time.Now().UTC()
+	since := w.since.Add(-watchOverlap)
+	if since.Before(w.start) {
+		since = w.start
+	}
+	query, err := w.query(since)
+	if err != nil {
+		log.Errorf("[events] [watch] invalid filter: %s", err)
+		return false
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[events] [watch] error getting db conn: %s", err)
+		return true
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	var events []watchedEvent
+	err = coll.Find(query).Select(bson.M{"log": 0, "partiallog": 0}).Sort("starttime").All(&events)
+	if err != nil {
+		log.Errorf("[events] [watch] error listing events: %s", err)
+		return true
+	}
+	seen := map[bson.ObjectId]struct{}{}
+	for i := range events {
+		evt := &events[i]
+		seen[evt.Data.UniqueID] = struct{}{}
+		if _, isFinished := w.finished[evt.Data.UniqueID]; isFinished {
+			continue
+		}
+		for _, msg := range w.changes(coll, evt) {
+			select {
+			case w.c <- msg:
+			case <-quit:
+				return false
+			}
+		}
+	}
+	for id := range w.logs {
+		if _, ok := seen[id]; !ok {
+			// The event was aborted or removed.
+			delete(w.logs, id)
+		}
+	}
+	for id, doneTime := range w.finished {
+		if doneTime.Before(since) {
+			delete(w.finished, id)
+		}
+	}
+	w.since = pollTime
+	return true
+}
+
+// changes returns the messages for a matching event, reading only the part
+// of its log not yet sent.
+func (w *Watcher) changes(coll *storage.Collection, evt *watchedEvent) []WatchMessage {
+	var msgs []WatchMessage
+	id := evt.Data.UniqueID
+	logPos, tracked := w.logs[id]
+	if !tracked {
+		msgs = append(msgs, WatchMessage{Type: WatchMessageStart, ID: id, Event: withoutLog(&evt.Data)})
+	}
+	if evt.Data.Running {
+		if evt.LogChunks > logPos.chunks {
+			var data struct{ PartialLog []string }
+			err := coll.Find(bson.M{"uniqueid": id}).Select(bson.M{
+				"partiallog": bson.M{"$slice": []int{logPos.chunks, evt.LogChunks - logPos.chunks}},
+				"log":        0,
+			}).One(&data)
+			if err != nil {
+				log.Errorf("[events] [watch] error reading log for event %s: %s", id.Hex(), err)
+			}
+			if newLog := strings.Join(data.PartialLog, ""); newLog != "" {
+				msgs = append(msgs, WatchMessage{Type: WatchMessageLog, ID: id, Log: newLog})
+				logPos.size += len(newLog)
+			}
+			logPos.chunks += len(data.PartialLog)
+		}
+		w.logs[id] = logPos
+		return msgs
+	}
+	var data struct{ Log string }
+	err := coll.Find(bson.M{"uniqueid": id}).Select(bson.M{"log": 1}).One(&data)
+	if err != nil {
+		log.Errorf("[events] [watch] error reading log for event %s: %s", id.Hex(), err)
+	}
+	if len(data.Log) > logPos.size {
+		msgs = append(msgs, WatchMessage{Type: WatchMessageLog, ID: id, Log: data.Log[logPos.size:]})
+	}
+	delete(w.logs, id)
+	w.finished[id] = time.Now().UTC()
+	return append(msgs, WatchMessage{Type: WatchMessageDone, ID: id, Event: withoutLog(&evt.Data)})
+}
+
+func withoutLog(data *eventData) *Event {
+	copied := Event{eventData: *data}
+	copied.Log = ""
+	return &copied
+}
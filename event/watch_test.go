@@ -0,0 +1,201 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func collectWatchMessages(c *check.C, w *Watcher, count int) []WatchMessage {
+	var msgs []WatchMessage
+	timeout := time.After(5 * time.Second)
+	for len(msgs) < count {
+		select {
+		case msg, ok := <-w.ListenChan():
+			c.Assert(ok, check.Equals, true)
+			msgs = append(msgs, msg)
+		case <-timeout:
+			c.Fatalf("timeout waiting for watch messages, got: %#v", msgs)
+		}
+	}
+	return msgs
+}
+
+func (s *S) TestWatch(c *check.C) {
+	defer func(d time.Duration) { watchPollInterval = d }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+	w, err := Watch(&Filter{Target: Target{Type: "app", Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	defer w.Close()
+	other, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "otherapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer other.Done(nil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	msgs := collectWatchMessages(c, w, 1)
+	c.Assert(msgs[0].Type, check.Equals, WatchMessageStart)
+	c.Assert(msgs[0].ID, check.Equals, evt.UniqueID)
+	c.Assert(msgs[0].Event.Running, check.Equals, true)
+	evt.Write([]byte("hello"))
+	msgs = collectWatchMessages(c, w, 1)
+	c.Assert(msgs[0].Type, check.Equals, WatchMessageLog)
+	c.Assert(msgs[0].Log, check.Equals, "hello")
+	evt.Write([]byte(" world"))
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	msgs = collectWatchMessages(c, w, 2)
+	c.Assert(msgs[0].Type, check.Equals, WatchMessageLog)
+	c.Assert(msgs[0].Log, check.Equals, " world")
+	c.Assert(msgs[1].Type, check.Equals, WatchMessageDone)
+	c.Assert(msgs[1].ID, check.Equals, evt.UniqueID)
+	c.Assert(msgs[1].Event.Running, check.Equals, false)
+	c.Assert(msgs[1].Event.Log, check.Equals, "")
+}
+
+func (s *S) TestWatchShortEvent(c *check.C) {
+	defer func(d time.Duration) { watchPollInterval = d }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+	w, err := Watch(nil)
+	c.Assert(err, check.IsNil)
+	defer w.Close()
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("quick")
+	err = evt.Done(errors.New("failed"))
+	c.Assert(err, check.IsNil)
+	msgs := collectWatchMessages(c, w, 3)
+	c.Assert(msgs[0].Type, check.Equals, WatchMessageStart)
+	c.Assert(msgs[1].Type, check.Equals, WatchMessageLog)
+	c.Assert(msgs[1].Log, check.Equals, "quick\n")
+	c.Assert(msgs[2].Type, check.Equals, WatchMessageDone)
+	c.Assert(msgs[2].Event.Error, check.Equals, "failed")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case msg := <-w.ListenChan():
+		c.Fatalf("unexpected message: %#v", msg)
+	default:
+	}
+}
+
+func (s *S) TestWatchClose(c *check.C) {
+	w, err := Watch(nil)
+	c.Assert(err, check.IsNil)
+	w.Close()
+	w.Close()
+	select {
+	case _, ok := <-w.ListenChan():
+		c.Assert(ok, check.Equals, false)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for channel to be closed")
+	}
+}
+
+func (s *S) TestWatchAllowedPermissions(c *check.C) {
+	defer func(d time.Duration) { watchPollInterval = d }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+	w, err := Watch(&Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "myteam")},
+	}})
+	c.Assert(err, check.IsNil)
+	defer w.Close()
+	hidden, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "hidden"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "otherteam")),
+	})
+	c.Assert(err, check.IsNil)
+	defer hidden.Done(nil)
+	visible, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "visible"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "myteam")),
+	})
+	c.Assert(err, check.IsNil)
+	defer visible.Done(nil)
+	msgs := collectWatchMessages(c, w, 1)
+	c.Assert(msgs[0].ID, check.Equals, visible.UniqueID)
+}
+
+func (s *S) TestEventWriteFlushesLog(c *check.C) {
+	defer func(d time.Duration) { logFlushInterval = d }(logFlushInterval)
+	logFlushInterval = 100 * time.Millisecond
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	var data struct {
+		PartialLog []string
+		LogChunks  int
+	}
+	evt.Write([]byte("partial log"))
+	err = conn.Events().Find(bson.M{"uniqueid": evt.UniqueID}).One(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.PartialLog, check.DeepEquals, []string{"partial log"})
+	c.Assert(data.LogChunks, check.Equals, 1)
+	evt.Write([]byte(" more"))
+	evt.Logf("and more")
+	err = conn.Events().Find(bson.M{"uniqueid": evt.UniqueID}).One(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.LogChunks, check.Equals, 1)
+	time.Sleep(200 * time.Millisecond)
+	err = conn.Events().Find(bson.M{"uniqueid": evt.UniqueID}).One(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.PartialLog, check.DeepEquals, []string{"partial log", " moreand more\n"})
+	c.Assert(data.LogChunks, check.Equals, 2)
+}
+
+func (s *S) TestEventDoneRemovesPartialLog(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Write([]byte("full log"))
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	var data bson.M
+	err = conn.Events().Find(bson.M{"uniqueid": evt.UniqueID}).One(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data["log"], check.Equals, "full log")
+	_, ok := data["partiallog"]
+	c.Assert(ok, check.Equals, false)
+	_, ok = data["logchunks"]
+	c.Assert(ok, check.Equals, false)
+}
@@ -0,0 +1,430 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	webhookTaskName       = "event-webhook-delivery"
+	deliveryListLimit     = 50
+	signatureHeader       = "X-Tsuru-Signature"
+	eventIDHeader         = "X-Tsuru-Event-Id"
+	defaultMaxAttempts    = 5
+	notificationQueueSize = 1000
+	defaultDeliveryTTL    = 7 * 24 * time.Hour
+)
+
+var (
+	retryBaseInterval = time.Second
+	retryWaitSlice    = time.Second
+	webhooksCacheTTL  = 10 * time.Second
+	notifications     chan notification
+	dispatcherOnce    sync.Once
+	insecureClient    = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: time.Minute,
+	}
+)
+
+// Payload is the body sent to webhooks for each event. It only holds the
+// identification and the status of the event, receivers must use the events
+// API to get the event details.
+type Payload struct {
+	UniqueID  string
+	Kind      event.Kind
+	Target    event.Target
+	Owner     event.Owner
+	StartTime time.Time
+	EndTime   time.Time
+	Error     string
+	Running   bool
+}
+
+// Delivery records one attempt to deliver an event to a webhook.
+type Delivery struct {
+	ID         bson.ObjectId `bson:"_id"`
+	Webhook    string
+	EventID    string
+	Running    bool
+	Attempt    int
+	Time       time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+}
+
+type webhookTask struct{}
+
+func (t *webhookTask) Name() string {
+	return webhookTaskName
+}
+
+// Run makes one attempt to deliver an event. Failed attempts are enqueued
+// again, to run after an exponential backoff, until the maximum number of
+// attempts is reached.
+func (t *webhookTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	name, _ := params["webhook"].(string)
+	eventID, _ := params["eventID"].(string)
+	payload, _ := params["payload"].(string)
+	running, _ := params["running"].(bool)
+	attempt := intParam(params["attempt"])
+	if name == "" || payload == "" {
+		job.Error(errors.New("invalid parameters, expected webhook and payload"))
+		return
+	}
+	if attempt <= 0 {
+		attempt = 1
+	}
+	notBefore := time.Unix(0, int64(intParam(params["notBefore"])))
+	if wait := time.Until(notBefore); wait > 0 {
+		// Jobs waiting for their backoff interval are enqueued again after
+		// a while, so they don't hold a queue worker for long.
+		if wait > retryWaitSlice {
+			time.Sleep(retryWaitSlice)
+			err := enqueue(name, eventID, running, attempt, notBefore, []byte(payload))
+			if err != nil {
+				log.Errorf("[webhooks] unable to enqueue retry of event %s to webhook %q: %s", eventID, name, err)
+				job.Error(err)
+				return
+			}
+			job.Success(nil)
+			return
+		}
+		time.Sleep(wait)
+	}
+	err := deliver(name, eventID, running, attempt, []byte(payload))
+	if err != nil {
+		if attempt < maxAttempts() {
+			notBefore = time.Now().Add(retryBaseInterval * time.Duration(1<<uint(attempt-1)))
+			if retryErr := enqueue(name, eventID, running, attempt+1, notBefore, []byte(payload)); retryErr != nil {
+				log.Errorf("[webhooks] unable to enqueue retry of event %s to webhook %q: %s", eventID, name, retryErr)
+			}
+		} else {
+			err = errors.Wrapf(err, "giving up after %d attempts", attempt)
+		}
+		log.Errorf("[webhooks] unable to deliver event %s to webhook %q: %s", eventID, name, err)
+		job.Error(err)
+		return
+	}
+	job.Success(nil)
+}
+
+func intParam(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func maxAttempts() int {
+	max, _ := config.GetInt("events:webhooks:max-attempts")
+	if max <= 0 {
+		max = defaultMaxAttempts
+	}
+	return max
+}
+
+func deliveryTTL() time.Duration {
+	ttl, err := config.GetDuration("events:webhooks:delivery-ttl")
+	if err != nil || ttl <= 0 {
+		ttl = defaultDeliveryTTL
+	}
+	return ttl
+}
+
+// Initialize registers the webhook delivery task in tsuru's queue and
+// starts listening to events.
+func Initialize() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	err = q.RegisterTask(&webhookTask{})
+	if err != nil {
+		return err
+	}
+	dispatcherOnce.Do(func() {
+		notifications = make(chan notification, notificationQueueSize)
+		go dispatch(notifications)
+	})
+	event.AddListener(notify)
+	return nil
+}
+
+// notification holds what is needed to deliver an event: a copy of the
+// fields matched by filters and the payload, taken when the listener is
+// called as the event keeps changing afterwards.
+type notification struct {
+	evt     *event.Event
+	payload []byte
+}
+
+// notify hands the event over to the dispatcher, which finds the webhooks
+// interested in it and enqueues their deliveries. Events are dropped when the
+// dispatcher falls behind, so events are never slowed down by webhooks.
+func notify(evt *event.Event) {
+	payload, err := json.Marshal(Payload{
+		UniqueID:  evt.UniqueID.Hex(),
+		Kind:      evt.Kind,
+		Target:    evt.Target,
+		Owner:     evt.Owner,
+		StartTime: evt.StartTime,
+		EndTime:   evt.EndTime,
+		Error:     evt.Error,
+		Running:   evt.Running,
+	})
+	if err != nil {
+		log.Errorf("[webhooks] unable to serialize event %s: %s", evt.UniqueID.Hex(), err)
+		return
+	}
+	snapshot := &event.Event{}
+	snapshot.UniqueID = evt.UniqueID
+	snapshot.Target = evt.Target
+	snapshot.Kind = evt.Kind
+	snapshot.Owner = evt.Owner
+	snapshot.Running = evt.Running
+	snapshot.Error = evt.Error
+	snapshot.Allowed = evt.Allowed
+	select {
+	case notifications <- notification{evt: snapshot, payload: payload}:
+	default:
+		log.Errorf("[webhooks] too many pending notifications, dropping event %s", evt.UniqueID.Hex())
+	}
+}
+
+func dispatch(ch <-chan notification) {
+	for n := range ch {
+		webhooks, teamPerms, err := cachedWebhooks()
+		if err != nil {
+			log.Errorf("[webhooks] unable to list webhooks: %s", err)
+			continue
+		}
+		for _, w := range webhooks {
+			if !w.EventFilter.Matches(n.evt) || !canRead(teamPerms[w.TeamOwner], n.evt) {
+				continue
+			}
+			err = enqueue(w.Name, n.evt.UniqueID.Hex(), n.evt.Running, 1, time.Time{}, n.payload)
+			if err != nil {
+				log.Errorf("[webhooks] unable to enqueue delivery of event %s to webhook %q: %s", n.evt.UniqueID.Hex(), w.Name, err)
+			}
+		}
+	}
+}
+
+// canRead returns whether the permissions of the team owning the webhook
+// allow reading the event.
+func canRead(perms []permission.Permission, evt *event.Event) bool {
+	scheme, err := permission.SafeGet(evt.Allowed.Scheme)
+	if err != nil {
+		return false
+	}
+	return permission.CheckFromPermList(perms, scheme, evt.Allowed.Contexts...)
+}
+
+// webhooksCache keeps the list of webhooks used by the dispatcher, and the
+// permissions of the teams owning them, so events don't require database
+// queries each. It's reset when webhooks are changed in this process and
+// expires after webhooksCacheTTL for changes made in other tsuru instances.
+var webhooksCache struct {
+	sync.Mutex
+	webhooks  []Webhook
+	teamPerms map[string][]permission.Permission
+	expires   time.Time
+}
+
+func cachedWebhooks() ([]Webhook, map[string][]permission.Permission, error) {
+	webhooksCache.Lock()
+	defer webhooksCache.Unlock()
+	if time.Now().Before(webhooksCache.expires) {
+		return webhooksCache.webhooks, webhooksCache.teamPerms, nil
+	}
+	webhooks, err := List(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	teamPerms := make(map[string][]permission.Permission)
+	for _, w := range webhooks {
+		if _, ok := teamPerms[w.TeamOwner]; ok {
+			continue
+		}
+		team := auth.Team{Name: w.TeamOwner}
+		teamPerms[w.TeamOwner], err = team.Permissions()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	webhooksCache.webhooks = webhooks
+	webhooksCache.teamPerms = teamPerms
+	webhooksCache.expires = time.Now().Add(webhooksCacheTTL)
+	return webhooks, teamPerms, nil
+}
+
+func resetWebhooksCache() {
+	webhooksCache.Lock()
+	webhooksCache.expires = time.Time{}
+	webhooksCache.Unlock()
+}
+
+// enqueue adds a delivery attempt to the queue, which must not run before
+// notBefore, unless it's zero.
+func enqueue(name, eventID string, running bool, attempt int, notBefore time.Time, payload []byte) error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	params := monsterqueue.JobParams{
+		"webhook": name,
+		"eventID": eventID,
+		"running": running,
+		"attempt": attempt,
+		"payload": string(payload),
+	}
+	if !notBefore.IsZero() {
+		params["notBefore"] = notBefore.UnixNano()
+	}
+	_, err = q.Enqueue(webhookTaskName, params)
+	return err
+}
+
+// deliver sends the payload to the webhook, recording the attempt in the
+// webhook delivery log.
+func deliver(name, eventID string, running bool, attempt int, payload []byte) error {
+	w, err := Find(name)
+	if err == ErrWebhookNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d := Delivery{
+		ID:      bson.NewObjectId(),
+		Webhook: name,
+		EventID: eventID,
+		Running: running,
+		Attempt: attempt,
+		Time:    time.Now().UTC(),
+	}
+	d.StatusCode, err = w.send(eventID, payload)
+	d.Duration = time.Since(d.Time)
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if logErr := addDelivery(&d); logErr != nil {
+		log.Errorf("[webhooks] unable to store delivery log for webhook %q: %s", name, logErr)
+	}
+	return err
+}
+
+func (w *Webhook) send(eventID string, payload []byte) (int, error) {
+	var body io.Reader
+	if w.Method != http.MethodGet {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(w.Method, w.URL, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range w.Headers {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(eventIDHeader, eventID)
+	if w.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+Sign(w.Secret, payload))
+	}
+	client := tsuruNet.Dial5Full60ClientNoKeepAlive
+	if w.Insecure {
+		client = insecureClient
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 400 {
+		data, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return rsp.StatusCode, errors.Errorf("invalid status code %d: %s", rsp.StatusCode, data)
+	}
+	return rsp.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the payload using secret as key.
+// Webhook receivers can use it to validate the X-Tsuru-Signature header.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliveriesCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	c := conn.Collection("webhook_deliveries")
+	c.EnsureIndex(mgo.Index{Key: []string{"webhook", "-time"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"time"}, ExpireAfter: deliveryTTL()})
+	return c, nil
+}
+
+func addDelivery(d *Delivery) error {
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Insert(d)
+}
+
+// ListDeliveries returns the most recent delivery attempts for a webhook.
+func ListDeliveries(name string) ([]Delivery, error) {
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var deliveries []Delivery
+	err = coll.Find(bson.M{"webhook": name}).Sort("-time").Limit(deliveryListLimit).All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
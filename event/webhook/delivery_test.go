@@ -0,0 +1,257 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestDeliver(c *check.C) {
+	var req *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+	err := Create(Webhook{
+		Name:      "wh1",
+		TeamOwner: "team1",
+		URL:       srv.URL,
+		Secret:    "abc",
+		Headers:   http.Header{"X-Custom": {"val"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = deliver("wh1", "evt1", true, 1, []byte(`{"a":1}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Method, check.Equals, http.MethodPost)
+	c.Assert(string(body), check.Equals, `{"a":1}`)
+	c.Assert(req.Header.Get("X-Custom"), check.Equals, "val")
+	c.Assert(req.Header.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(req.Header.Get(eventIDHeader), check.Equals, "evt1")
+	c.Assert(req.Header.Get(signatureHeader), check.Equals, "sha256="+Sign("abc", []byte(`{"a":1}`)))
+	deliveries, err := ListDeliveries("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].EventID, check.Equals, "evt1")
+	c.Assert(deliveries[0].Running, check.Equals, true)
+	c.Assert(deliveries[0].Attempt, check.Equals, 1)
+	c.Assert(deliveries[0].StatusCode, check.Equals, http.StatusOK)
+	c.Assert(deliveries[0].Error, check.Equals, "")
+}
+
+func waitJobsDone(c *check.C, n int) []monsterqueue.Job {
+	q, err := queue.Queue()
+	c.Assert(err, check.IsNil)
+	timeout := time.After(10 * time.Second)
+	for {
+		jobs, err := q.ListJobs()
+		c.Assert(err, check.IsNil)
+		done := 0
+		for _, j := range jobs {
+			if j.Status().State == monsterqueue.JobStateDone {
+				done++
+			}
+		}
+		if done >= n {
+			sort.Slice(jobs, func(i, j int) bool {
+				return jobs[i].Status().Enqueued.Before(jobs[j].Status().Enqueued)
+			})
+			return jobs
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for %d jobs, %d done", n, done)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *S) TestDeliverRetries(c *check.C) {
+	config.Set("events:webhooks:max-attempts", 3)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("my error"))
+		}
+	}))
+	defer srv.Close()
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	err = Initialize()
+	c.Assert(err, check.IsNil)
+	err = enqueue("wh1", "evt1", false, 1, time.Time{}, []byte(`{}`))
+	c.Assert(err, check.IsNil)
+	jobs := waitJobsDone(c, 3)
+	c.Assert(jobs, check.HasLen, 3)
+	for i, j := range jobs {
+		c.Assert(intParam(j.Parameters()["attempt"]), check.Equals, i+1)
+	}
+	_, err = jobs[1].Result()
+	c.Assert(err, check.ErrorMatches, "invalid status code 500: my error")
+	_, err = jobs[2].Result()
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(3))
+	deliveries, err := ListDeliveries("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 3)
+	c.Assert(deliveries[2].StatusCode, check.Equals, http.StatusInternalServerError)
+	c.Assert(deliveries[2].Error, check.Equals, "invalid status code 500: my error")
+	c.Assert(deliveries[0].Attempt, check.Equals, 3)
+	c.Assert(deliveries[0].Error, check.Equals, "")
+}
+
+func (s *S) TestDeliverGivesUp(c *check.C) {
+	config.Set("events:webhooks:max-attempts", 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	err = Initialize()
+	c.Assert(err, check.IsNil)
+	err = enqueue("wh1", "evt1", false, 1, time.Time{}, []byte(`{}`))
+	c.Assert(err, check.IsNil)
+	jobs := waitJobsDone(c, 2)
+	c.Assert(jobs, check.HasLen, 2)
+	_, err = jobs[1].Result()
+	c.Assert(err, check.ErrorMatches, "giving up after 2 attempts: invalid status code 502: ")
+	time.Sleep(50 * time.Millisecond)
+	jobs, err = jobs[1].Queue().ListJobs()
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.HasLen, 2)
+}
+
+func (s *S) TestDeliverWebhookRemoved(c *check.C) {
+	err := deliver("unknown", "evt1", false, 1, []byte(`{}`))
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestEventsDeliveredThroughQueue(c *check.C) {
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&data)
+		mu.Lock()
+		received = append(received, data)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	role, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.read.events")
+	c.Assert(err, check.IsNil)
+	err = role.AddEvent(permission.RoleEventTeamMember.String())
+	c.Assert(err, check.IsNil)
+	err = Create(Webhook{
+		Name:        "wh1",
+		TeamOwner:   "team1",
+		URL:         srv.URL,
+		EventFilter: EventFilter{TargetTypes: []string{"app"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = Initialize()
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "team1")),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	otherTeamEvt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "otherapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "team2")),
+	})
+	c.Assert(err, check.IsNil)
+	err = otherTeamEvt.Done(nil)
+	c.Assert(err, check.IsNil)
+	nodeEvt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeNode, Value: "n1"},
+		Kind:    permission.PermNodeCreate,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents, permission.Context(permission.CtxTeam, "team1")),
+	})
+	c.Assert(err, check.IsNil)
+	err = nodeEvt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = queue.TestingWaitQueueTasks(2, 10*time.Second)
+	c.Assert(err, check.IsNil)
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(received, check.HasLen, 2)
+	for _, data := range received {
+		c.Assert(data["UniqueID"], check.Equals, evt.UniqueID.Hex())
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		c.Assert(keys, check.DeepEquals, []string{"EndTime", "Error", "Kind", "Owner", "Running", "StartTime", "Target", "UniqueID"})
+	}
+}
+
+func (s *S) TestCanRead(c *check.C) {
+	teamPerms := []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "team1")},
+	}
+	globalPerms := []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxGlobal, "")},
+	}
+	teamEvt := &event.Event{}
+	teamEvt.Allowed = event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "team1"))
+	otherTeamEvt := &event.Event{}
+	otherTeamEvt.Allowed = event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "team2"))
+	globalEvt := &event.Event{}
+	globalEvt.Allowed = event.Allowed(permission.PermAppReadEvents)
+	poolEvt := &event.Event{}
+	poolEvt.Allowed = event.Allowed(permission.PermPoolReadEvents, permission.Context(permission.CtxTeam, "team1"))
+	c.Assert(canRead(teamPerms, teamEvt), check.Equals, true)
+	c.Assert(canRead(teamPerms, otherTeamEvt), check.Equals, false)
+	c.Assert(canRead(teamPerms, globalEvt), check.Equals, false)
+	c.Assert(canRead(teamPerms, poolEvt), check.Equals, false)
+	c.Assert(canRead(globalPerms, globalEvt), check.Equals, true)
+	c.Assert(canRead(globalPerms, otherTeamEvt), check.Equals, true)
+	c.Assert(canRead(nil, teamEvt), check.Equals, false)
+}
+
+func (s *S) TestRunWaitsRetryInterval(c *check.C) {
+	var received time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = time.Now()
+	}))
+	defer srv.Close()
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	err = Initialize()
+	c.Assert(err, check.IsNil)
+	notBefore := time.Now().Add(100 * time.Millisecond)
+	err = enqueue("wh1", "evt1", false, 2, notBefore, []byte(`{}`))
+	c.Assert(err, check.IsNil)
+	jobs := waitJobsDone(c, 1)
+	c.Assert(jobs, check.HasLen, 1)
+	c.Assert(received.Before(notBefore), check.Equals, false)
+}
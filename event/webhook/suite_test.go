@@ -0,0 +1,65 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/queue"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn  *db.Storage
+	token auth.Token
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_events_webhook_tests")
+	config.Set("queue:mongo-url", "127.0.0.1:27017")
+	config.Set("queue:mongo-database", "queue_events_webhook_tests")
+	config.Set("queue:mongo-polling-interval", 0.01)
+	config.Set("auth:hash-cost", bcrypt.MinCost)
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:current-key", "k1")
+	retryBaseInterval = time.Millisecond
+	webhooksCacheTTL = 0
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Events().Database)
+	c.Assert(err, check.IsNil)
+	queue.ResetQueue()
+	config.Unset("events:webhooks:max-attempts")
+	nativeScheme := auth.ManagedScheme(native.NativeScheme{})
+	user := &auth.User{Email: "me@me.com", Password: "123456"}
+	_, err = nativeScheme.Create(user)
+	c.Assert(err, check.IsNil)
+	s.token, err = nativeScheme.Login(map[string]string{"email": user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	queue.ResetQueue()
+	s.conn.Events().Database.DropDatabase()
+	s.conn.Close()
+}
@@ -0,0 +1,297 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook implements outgoing webhooks notifying external services
+// about events happening on tsuru.
+package webhook
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookAlreadyExists = errors.New("webhook already exists")
+	ErrInvalidName          = errors.New("webhook name is required")
+	ErrInvalidTeamOwner     = errors.New("webhook team owner is required")
+	ErrInvalidURL           = errors.New("webhook url must be a valid http or https url")
+)
+
+// Webhook represents a subscription to tsuru events. Every event matching
+// EventFilter and readable by TeamOwner, when started and when finished, is
+// sent to URL. Secret is stored encrypted.
+type Webhook struct {
+	Name        string `bson:"_id"`
+	Description string
+	TeamOwner   string
+	EventFilter EventFilter
+	URL         string
+	Secret      string `json:"-"`
+	Headers     http.Header
+	Method      string
+	Insecure    bool
+}
+
+// EventFilter describes which events are delivered to a webhook. Empty fields
+// match every event.
+type EventFilter struct {
+	TargetTypes  []string
+	TargetValues []string
+	KindTypes    []string
+	KindNames    []string
+	OwnerTypes   []string
+	OwnerNames   []string
+	ErrorOnly    bool
+	SuccessOnly  bool
+}
+
+// Matches returns whether the event is accepted by the filter. ErrorOnly and
+// SuccessOnly filters only match finished events.
+func (f *EventFilter) Matches(evt *event.Event) bool {
+	if (f.ErrorOnly || f.SuccessOnly) && evt.Running {
+		return false
+	}
+	if f.ErrorOnly && evt.Error == "" {
+		return false
+	}
+	if f.SuccessOnly && evt.Error != "" {
+		return false
+	}
+	return matchAny(f.TargetTypes, string(evt.Target.Type)) &&
+		matchAny(f.TargetValues, evt.Target.Value) &&
+		matchAny(f.KindTypes, string(evt.Kind.Type)) &&
+		matchAny(f.KindNames, evt.Kind.Name) &&
+		matchAny(f.OwnerTypes, string(evt.Owner.Type)) &&
+		matchAny(f.OwnerNames, evt.Owner.Name)
+}
+
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) validate() error {
+	if w.Name == "" {
+		return ErrInvalidName
+	}
+	if w.TeamOwner == "" {
+		return ErrInvalidTeamOwner
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if w.Method == "" {
+		w.Method = http.MethodPost
+	}
+	return nil
+}
+
+func webhooksCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	c := conn.Collection("webhooks")
+	c.EnsureIndex(mgo.Index{Key: []string{"teamowner"}})
+	return c, nil
+}
+
+// encryptSecret encrypts the secret of the webhook before it's stored.
+func (w *Webhook) encryptSecret() error {
+	if w.Secret == "" {
+		return nil
+	}
+	var err error
+	w.Secret, err = secret.Encrypt(w.Secret)
+	return errors.Wrap(err, "unable to encrypt webhook secret")
+}
+
+// decryptSecret decrypts the secret of a stored webhook. Secrets stored
+// before they were encrypted are kept as is.
+func (w *Webhook) decryptSecret() error {
+	if !secret.IsEncrypted(w.Secret) {
+		return nil
+	}
+	var err error
+	w.Secret, err = secret.Decrypt(w.Secret)
+	return errors.Wrapf(err, "unable to decrypt secret of webhook %q", w.Name)
+}
+
+// RotateSecrets encrypts again, using the current key, every webhook secret
+// encrypted with another key. It returns the number of secrets changed.
+func RotateSecrets() (int, error) {
+	provider, err := secret.GetProvider()
+	if err != nil {
+		return 0, err
+	}
+	currentID, _, err := provider.CurrentKey()
+	if err != nil {
+		return 0, err
+	}
+	coll, err := webhooksCollection()
+	if err != nil {
+		return 0, err
+	}
+	defer coll.Close()
+	defer resetWebhooksCache()
+	var webhooks []Webhook
+	err = coll.Find(bson.M{"secret": bson.M{"$ne": ""}}).Select(bson.M{"secret": 1}).All(&webhooks)
+	if err != nil {
+		return 0, err
+	}
+	var rotated int
+	for _, w := range webhooks {
+		if !secret.IsEncrypted(w.Secret) {
+			continue
+		}
+		value, changed, err := secret.Rotate(w.Secret, currentID)
+		if err != nil {
+			return rotated, errors.Wrapf(err, "unable to rotate secret of webhook %q", w.Name)
+		}
+		if !changed {
+			continue
+		}
+		err = coll.UpdateId(w.Name, bson.M{"$set": bson.M{"secret": value}})
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// Create stores a new webhook.
+func Create(w Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	err = w.encryptSecret()
+	if err != nil {
+		return err
+	}
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	defer resetWebhooksCache()
+	err = coll.Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+// Update replaces an existing webhook.
+func Update(w Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	err = w.encryptSecret()
+	if err != nil {
+		return err
+	}
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	defer resetWebhooksCache()
+	err = coll.UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// Delete removes a webhook along with its delivery log.
+func Delete(name string) error {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	defer resetWebhooksCache()
+	err = coll.RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	deliveries, err := deliveriesCollection()
+	if err != nil {
+		return err
+	}
+	defer deliveries.Close()
+	_, err = deliveries.RemoveAll(bson.M{"webhook": name})
+	return err
+}
+
+// Find returns the webhook with the given name.
+func Find(name string) (*Webhook, error) {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var w Webhook
+	err = coll.FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = w.decryptSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns the webhooks owned by the given teams. A nil teams slice
+// returns every webhook.
+func List(teams []string) ([]Webhook, error) {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{}
+	if teams != nil {
+		query["teamowner"] = bson.M{"$in": teams}
+	}
+	var webhooks []Webhook
+	err = coll.Find(query).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		err = webhooks[i].decryptSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return webhooks, nil
+}
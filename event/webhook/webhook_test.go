@@ -0,0 +1,192 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/secret"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCreateAndFind(c *check.C) {
+	w := Webhook{
+		Name:      "wh1",
+		TeamOwner: "team1",
+		URL:       "http://example.com/hook",
+		Secret:    "s3cr3t",
+		Headers:   http.Header{"X-Abc": {"1"}},
+		EventFilter: EventFilter{
+			KindNames: []string{"app.deploy"},
+		},
+	}
+	err := Create(w)
+	c.Assert(err, check.IsNil)
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	w.Method = http.MethodPost
+	c.Assert(*dbW, check.DeepEquals, w)
+}
+
+func (s *S) TestCreateEncryptsSecret(c *check.C) {
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com", Secret: "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	coll, err := webhooksCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var stored Webhook
+	err = coll.FindId("wh1").One(&stored)
+	c.Assert(err, check.IsNil)
+	c.Assert(secret.IsEncrypted(stored.Secret), check.Equals, true)
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Secret, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestFindLegacyPlainSecret(c *check.C) {
+	coll, err := webhooksCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com", Secret: "plain"})
+	c.Assert(err, check.IsNil)
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Secret, check.Equals, "plain")
+}
+
+func (s *S) TestRotateSecrets(c *check.C) {
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com", Secret: "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	err = Create(Webhook{Name: "wh2", TeamOwner: "team1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:keys:k2", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	config.Set("secrets:current-key", "k2")
+	defer func() {
+		config.Set("secrets:current-key", "k1")
+		config.Unset("secrets:keys:k2")
+	}()
+	rotated, err := RotateSecrets()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 1)
+	coll, err := webhooksCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var stored Webhook
+	err = coll.FindId("wh1").One(&stored)
+	c.Assert(err, check.IsNil)
+	keyID, err := secret.KeyID(stored.Secret)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k2")
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Secret, check.Equals, "s3cr3t")
+	rotated, err = RotateSecrets()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
+
+func (s *S) TestCreateDuplicated(c *check.C) {
+	w := Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com"}
+	err := Create(w)
+	c.Assert(err, check.IsNil)
+	err = Create(w)
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+}
+
+func (s *S) TestCreateInvalid(c *check.C) {
+	tests := []struct {
+		w   Webhook
+		err error
+	}{
+		{Webhook{TeamOwner: "t", URL: "http://a.com"}, ErrInvalidName},
+		{Webhook{Name: "w", URL: "http://a.com"}, ErrInvalidTeamOwner},
+		{Webhook{Name: "w", TeamOwner: "t"}, ErrInvalidURL},
+		{Webhook{Name: "w", TeamOwner: "t", URL: "ftp://a.com"}, ErrInvalidURL},
+		{Webhook{Name: "w", TeamOwner: "t", URL: "http://"}, ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		c.Check(Create(tt.w), check.Equals, tt.err)
+	}
+}
+
+func (s *S) TestUpdate(c *check.C) {
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	err = Update(Webhook{Name: "wh1", TeamOwner: "team2", URL: "https://other.com", Method: http.MethodPut})
+	c.Assert(err, check.IsNil)
+	w, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(w.TeamOwner, check.Equals, "team2")
+	c.Assert(w.URL, check.Equals, "https://other.com")
+	c.Assert(w.Method, check.Equals, http.MethodPut)
+	err = Update(Webhook{Name: "unknown", TeamOwner: "team2", URL: "https://other.com"})
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestDelete(c *check.C) {
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	err = Delete("wh1")
+	c.Assert(err, check.IsNil)
+	_, err = Find("wh1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	err = Delete("wh1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestList(c *check.C) {
+	err := Create(Webhook{Name: "wh1", TeamOwner: "team1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	err = Create(Webhook{Name: "wh2", TeamOwner: "team2", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	webhooks, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 2)
+	webhooks, err = List([]string{"team2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 1)
+	c.Assert(webhooks[0].Name, check.Equals, "wh2")
+	webhooks, err = List([]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 0)
+}
+
+func (s *S) TestEventFilterMatches(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		f        EventFilter
+		expected bool
+	}{
+		{EventFilter{}, true},
+		{EventFilter{TargetTypes: []string{"app"}}, true},
+		{EventFilter{TargetTypes: []string{"node"}}, false},
+		{EventFilter{TargetTypes: []string{"app"}, TargetValues: []string{"otherapp", "myapp"}}, true},
+		{EventFilter{TargetValues: []string{"otherapp"}}, false},
+		{EventFilter{KindNames: []string{"app.deploy"}}, true},
+		{EventFilter{KindTypes: []string{"internal"}}, false},
+		{EventFilter{OwnerNames: []string{s.token.GetUserName()}}, true},
+		{EventFilter{OwnerTypes: []string{"app"}}, false},
+		{EventFilter{ErrorOnly: true}, false},
+		{EventFilter{SuccessOnly: true}, false},
+	}
+	for i, tt := range tests {
+		c.Check(tt.f.Matches(evt), check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+	evt.Running = false
+	evt.Error = "failed"
+	c.Assert((&EventFilter{ErrorOnly: true}).Matches(evt), check.Equals, true)
+	c.Assert((&EventFilter{SuccessOnly: true}).Matches(evt), check.Equals, false)
+}
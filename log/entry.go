@@ -0,0 +1,205 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatText writes entries as text, with the fields in the key=value
+	// format after the message. It's the default format.
+	FormatText = "text"
+
+	// FormatJSON writes each entry as a JSON object, with the time, level
+	// and message in the "time", "level" and "msg" keys.
+	FormatJSON = "json"
+)
+
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+func (l Level) String() string {
+	if l < DebugLevel || int(l) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, errors.Errorf("invalid log level %q", name)
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case "", FormatText, FormatJSON:
+		return nil
+	}
+	return errors.Errorf("invalid log format %q, it must be %q or %q", format, FormatText, FormatJSON)
+}
+
+// Fields are the key/value pairs attached to a log entry.
+type Fields map[string]interface{}
+
+// Entry is a structured log entry.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// StructuredLogger is a Logger able to write structured entries. Loggers not
+// implementing it receive entries through their printf style methods, with
+// the fields appended to the message.
+type StructuredLogger interface {
+	Logger
+	Log(Entry)
+}
+
+// Text returns the message of the entry followed by its fields, sorted by
+// name, in the key=value format.
+func (e *Entry) Text() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{e.Message}
+	for _, name := range names {
+		value := fmt.Sprint(fieldValue(e.Fields[name]))
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// JSON returns the entry encoded as a JSON object. Fields named time, level
+// or msg are overridden by the attributes of the entry.
+func (e *Entry) JSON() ([]byte, error) {
+	data := make(map[string]interface{}, len(e.Fields)+3)
+	for name, value := range e.Fields {
+		data[name] = fieldValue(value)
+	}
+	entryTime := e.Time
+	if entryTime.IsZero() {
+		entryTime = time.Now()
+	}
+	data["time"] = entryTime.Format(time.RFC3339Nano)
+	data["level"] = e.Level.String()
+	data["msg"] = e.Message
+	return json.Marshal(data)
+}
+
+func fieldValue(value interface{}) interface{} {
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	return value
+}
+
+// writeEntry writes the entry to the logger, using the printf style methods
+// when the logger is not a StructuredLogger.
+func writeEntry(l Logger, e Entry) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Log(e)
+		return
+	}
+	msg := e.Text()
+	switch e.Level {
+	case DebugLevel, InfoLevel:
+		l.Debug(msg)
+	case FatalLevel:
+		l.Fatal(msg)
+	default:
+		l.Error(msg)
+	}
+}
+
+// FieldLogger writes entries with a set of fields to a Target.
+type FieldLogger struct {
+	target *Target
+	fields Fields
+}
+
+// WithFields returns a FieldLogger with the fields of l and the given ones.
+func (l *FieldLogger) WithFields(fields Fields) *FieldLogger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &FieldLogger{target: l.target, fields: merged}
+}
+
+// WithField returns a FieldLogger with the fields of l and the given one.
+func (l *FieldLogger) WithField(key string, value interface{}) *FieldLogger {
+	return l.WithFields(Fields{key: value})
+}
+
+func (l *FieldLogger) log(level Level, msg string) {
+	l.target.Log(Entry{Level: level, Message: msg, Fields: l.fields})
+}
+
+func (l *FieldLogger) Debug(msg string) {
+	l.log(DebugLevel, msg)
+}
+
+func (l *FieldLogger) Debugf(format string, v ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, v...))
+}
+
+func (l *FieldLogger) Info(msg string) {
+	l.log(InfoLevel, msg)
+}
+
+func (l *FieldLogger) Infof(format string, v ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, v...))
+}
+
+func (l *FieldLogger) Warn(msg string) {
+	l.log(WarnLevel, msg)
+}
+
+func (l *FieldLogger) Warnf(format string, v ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, v...))
+}
+
+func (l *FieldLogger) Error(msg string) {
+	l.log(ErrorLevel, msg)
+}
+
+func (l *FieldLogger) Errorf(format string, v ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"log"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type plainLogger struct {
+	debug, errors []string
+}
+
+func (l *plainLogger) Error(o string)                         { l.errors = append(l.errors, o) }
+func (l *plainLogger) Errorf(format string, o ...interface{}) {}
+func (l *plainLogger) Fatal(o string)                         {}
+func (l *plainLogger) Fatalf(format string, o ...interface{}) {}
+func (l *plainLogger) Debug(o string)                         { l.debug = append(l.debug, o) }
+func (l *plainLogger) Debugf(format string, o ...interface{}) {}
+func (l *plainLogger) GetStdLogger() *log.Logger              { return nil }
+
+func (s *S) TestParseLevel(c *check.C) {
+	level, err := ParseLevel("WARN")
+	c.Assert(err, check.IsNil)
+	c.Assert(level, check.Equals, WarnLevel)
+	c.Assert(level.String(), check.Equals, "warn")
+	_, err = ParseLevel("verbose")
+	c.Assert(err, check.ErrorMatches, `invalid log level "verbose"`)
+}
+
+func (s *S) TestEntryText(c *check.C) {
+	e := Entry{Message: "request failed", Fields: Fields{
+		"status": 500,
+		"user":   "admin@example.com",
+		"path":   "/a b",
+		"err":    stderrors.New("timeout"),
+	}}
+	c.Assert(e.Text(), check.Equals, `request failed err=timeout path="/a b" status=500 user=admin@example.com`)
+	e = Entry{Message: "no fields"}
+	c.Assert(e.Text(), check.Equals, "no fields")
+}
+
+func (s *S) TestEntryJSON(c *check.C) {
+	e := Entry{
+		Time:    time.Date(2017, 6, 16, 15, 0, 0, 0, time.UTC),
+		Level:   ErrorLevel,
+		Message: "request failed",
+		Fields:  Fields{"status": 500, "msg": "ignored", "err": stderrors.New("timeout")},
+	}
+	data, err := e.JSON()
+	c.Assert(err, check.IsNil)
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, map[string]interface{}{
+		"time":   "2017-06-16T15:00:00Z",
+		"level":  "error",
+		"msg":    "request failed",
+		"status": float64(500),
+		"err":    "timeout",
+	})
+}
+
+func (s *S) TestWithFieldsTextLogger(c *check.C) {
+	buf := newFakeLogger()
+	defer buf.Reset()
+	logger := WithFields(Fields{"request_id": "abc"})
+	logger.WithField("app", "myapp").Infof("deploy %d started", 1)
+	logger.Warn("slow")
+	c.Assert(buf.String(), check.Equals, "INFO: deploy 1 started app=myapp request_id=abc\nWARN: slow request_id=abc\n")
+}
+
+func (s *S) TestWithFieldsJSONLogger(c *check.C) {
+	var buf bytes.Buffer
+	SetLogger(NewWriterLoggerWithFormat(&buf, false, FormatJSON))
+	defer SetLogger(nil)
+	WithField("user", "admin@example.com").Error("failure")
+	Debug("hidden")
+	var result map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["time"], check.NotNil)
+	delete(result, "time")
+	c.Assert(result, check.DeepEquals, map[string]interface{}{
+		"level": "error",
+		"msg":   "failure",
+		"user":  "admin@example.com",
+	})
+}
+
+func (s *S) TestJSONLoggerStdLogger(c *check.C) {
+	var buf bytes.Buffer
+	logger := NewWriterLoggerWithFormat(&buf, false, FormatJSON)
+	logger.GetStdLogger().Printf("from std %s", "log")
+	var result map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["level"], check.Equals, "info")
+	c.Assert(result["msg"], check.Equals, "from std log")
+}
+
+func (s *S) TestLogWithPlainLogger(c *check.C) {
+	l := &plainLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+	WithField("app", "myapp").Info("info")
+	Warnf("warn %d", 1)
+	c.Assert(l.debug, check.DeepEquals, []string{"info app=myapp"})
+	c.Assert(l.errors, check.DeepEquals, []string{"warn 1"})
+}
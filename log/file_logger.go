@@ -9,23 +9,35 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 )
 
-var (
-	errorPrefix = "ERROR: %s"
-	fatalPrefix = "FATAL: %s"
-	debugPrefix = "DEBUG: %s"
-)
+var fatalPrefix = "FATAL: %s"
 
 func NewFileLogger(fileName string, debug bool) Logger {
+	return NewFileLoggerWithFormat(fileName, debug, FormatText)
+}
+
+// NewFileLoggerWithFormat returns a logger appending entries to the given
+// file in the given format, either FormatText or FormatJSON.
+func NewFileLoggerWithFormat(fileName string, debug bool, format string) Logger {
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
 		panic(err)
 	}
-	return NewWriterLogger(file, debug)
+	return NewWriterLoggerWithFormat(file, debug, format)
 }
 
 func NewWriterLogger(writer io.Writer, debug bool) Logger {
+	return NewWriterLoggerWithFormat(writer, debug, FormatText)
+}
+
+// NewWriterLoggerWithFormat returns a logger writing entries to the given
+// writer in the given format, either FormatText or FormatJSON.
+func NewWriterLoggerWithFormat(writer io.Writer, debug bool, format string) Logger {
+	if format == FormatJSON {
+		return &fileLogger{logger: log.New(writer, "", 0), debug: debug, json: true}
+	}
 	logger := log.New(writer, "", log.LstdFlags)
 	return &fileLogger{logger: logger, debug: debug}
 }
@@ -33,10 +45,29 @@ func NewWriterLogger(writer io.Writer, debug bool) Logger {
 type fileLogger struct {
 	logger *log.Logger
 	debug  bool
+	json   bool
+}
+
+func (l *fileLogger) Log(e Entry) {
+	if e.Level == DebugLevel && !l.debug {
+		return
+	}
+	if l.json {
+		data, err := e.JSON()
+		if err != nil {
+			data, _ = (&Entry{Time: e.Time, Level: e.Level, Message: e.Text()}).JSON()
+		}
+		l.logger.Print(string(data))
+	} else {
+		l.logger.Print(strings.ToUpper(e.Level.String()) + ": " + e.Text())
+	}
+	if e.Level == FatalLevel {
+		os.Exit(1)
+	}
 }
 
 func (l *fileLogger) Error(o string) {
-	l.logger.Printf(errorPrefix, o)
+	l.Log(Entry{Level: ErrorLevel, Message: o})
 }
 
 func (l *fileLogger) Errorf(format string, o ...interface{}) {
@@ -44,8 +75,7 @@ func (l *fileLogger) Errorf(format string, o ...interface{}) {
 }
 
 func (l *fileLogger) Fatal(o string) {
-	l.logger.Printf(fmt.Sprintf(fatalPrefix, o))
-	os.Exit(1)
+	l.Log(Entry{Level: FatalLevel, Message: o})
 }
 
 func (l *fileLogger) Fatalf(format string, o ...interface{}) {
@@ -53,9 +83,7 @@ func (l *fileLogger) Fatalf(format string, o ...interface{}) {
 }
 
 func (l *fileLogger) Debug(o string) {
-	if l.debug {
-		l.logger.Printf(debugPrefix, o)
-	}
+	l.Log(Entry{Level: DebugLevel, Message: o})
 }
 
 func (l *fileLogger) Debugf(format string, o ...interface{}) {
@@ -63,5 +91,19 @@ func (l *fileLogger) Debugf(format string, o ...interface{}) {
 }
 
 func (l *fileLogger) GetStdLogger() *log.Logger {
+	if l.json {
+		return log.New(&entryWriter{logger: l}, "", 0)
+	}
 	return l.logger
 }
+
+// entryWriter writes each line it receives as an info entry, allowing
+// packages using the standard log package to write JSON entries.
+type entryWriter struct {
+	logger StructuredLogger
+}
+
+func (w *entryWriter) Write(p []byte) (int, error) {
+	w.logger.Log(Entry{Level: InfoLevel, Message: strings.TrimSuffix(string(p), "\n")})
+	return len(p), nil
+}
@@ -15,6 +15,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
@@ -33,8 +34,12 @@ type Logger interface {
 func Init() {
 	var loggers []Logger
 	debug, _ := config.GetBool("debug")
+	format, _ := config.GetString("log:format")
+	if err := validateFormat(format); err != nil {
+		panic(fmt.Sprintf("%s please see http://docs.tsuru.io/en/latest/reference/config.html#log-format", err))
+	}
 	if logFileName, err := config.GetString("log:file"); err == nil {
-		loggers = append(loggers, NewFileLogger(logFileName, debug))
+		loggers = append(loggers, NewFileLoggerWithFormat(logFileName, debug, format))
 	} else if err == config.ErrMismatchConf {
 		panic(fmt.Sprintf("%s please see http://docs.tsuru.io/en/latest/reference/config.html#log-file", err))
 	}
@@ -46,7 +51,10 @@ func Init() {
 		loggers = append(loggers, NewSyslogLogger(tag, debug))
 	}
 	if useStderr, _ := config.GetBool("log:use-stderr"); useStderr {
-		loggers = append(loggers, NewWriterLogger(os.Stderr, debug))
+		loggers = append(loggers, NewWriterLoggerWithFormat(os.Stderr, debug, format))
+	}
+	if useStdout, _ := config.GetBool("log:use-stdout"); useStdout {
+		loggers = append(loggers, NewWriterLoggerWithFormat(os.Stdout, debug, format))
 	}
 	SetLogger(NewMultiLogger(loggers...))
 }
@@ -135,6 +143,46 @@ func (t *Target) Debugf(format string, v ...interface{}) {
 	}
 }
 
+// Info writes the value to the Target logger with the info level.
+func (t *Target) Info(v string) {
+	t.Log(Entry{Level: InfoLevel, Message: v})
+}
+
+// Infof writes the formatted string to the Target logger with the info
+// level.
+func (t *Target) Infof(format string, v ...interface{}) {
+	t.Log(Entry{Level: InfoLevel, Message: fmt.Sprintf(format, v...)})
+}
+
+// Warn writes the value to the Target logger with the warn level.
+func (t *Target) Warn(v string) {
+	t.Log(Entry{Level: WarnLevel, Message: v})
+}
+
+// Warnf writes the formatted string to the Target logger with the warn
+// level.
+func (t *Target) Warnf(format string, v ...interface{}) {
+	t.Log(Entry{Level: WarnLevel, Message: fmt.Sprintf(format, v...)})
+}
+
+// Log writes the structured entry to the Target logger.
+func (t *Target) Log(e Entry) {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	if t.logger != nil {
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		writeEntry(t.logger, e)
+	}
+}
+
+// WithFields returns a FieldLogger writing entries with the given fields to
+// the Target logger.
+func (t *Target) WithFields(fields Fields) *FieldLogger {
+	return (&FieldLogger{target: t}).WithFields(fields)
+}
+
 // GetStdLogger returns a standard Logger instance
 // useful for configuring log in external packages.
 func (t *Target) GetStdLogger() *log.Logger {
@@ -178,6 +226,37 @@ func Debugf(format string, v ...interface{}) {
 	DefaultTarget.Debugf(format, v...)
 }
 
+// Info is a wrapper for DefaultTarget.Info.
+func Info(v string) {
+	DefaultTarget.Info(v)
+}
+
+// Infof is a wrapper for DefaultTarget.Infof.
+func Infof(format string, v ...interface{}) {
+	DefaultTarget.Infof(format, v...)
+}
+
+// Warn is a wrapper for DefaultTarget.Warn.
+func Warn(v string) {
+	DefaultTarget.Warn(v)
+}
+
+// Warnf is a wrapper for DefaultTarget.Warnf.
+func Warnf(format string, v ...interface{}) {
+	DefaultTarget.Warnf(format, v...)
+}
+
+// WithFields is a wrapper for DefaultTarget.WithFields.
+func WithFields(fields Fields) *FieldLogger {
+	return DefaultTarget.WithFields(fields)
+}
+
+// WithField returns a FieldLogger writing entries with the given field to
+// DefaultTarget.
+func WithField(key string, value interface{}) *FieldLogger {
+	return DefaultTarget.WithFields(Fields{key: value})
+}
+
 // GetStdLogger is a wrapper for DefaultTarget.GetStdLogger.
 func GetStdLogger() *log.Logger {
 	return DefaultTarget.GetStdLogger()
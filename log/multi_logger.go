@@ -17,6 +17,19 @@ type multiLogger struct {
 	loggers []Logger
 }
 
+func (m *multiLogger) Log(e Entry) {
+	fatal := e.Level == FatalLevel
+	if fatal {
+		e.Level = ErrorLevel
+	}
+	for _, logger := range m.loggers {
+		writeEntry(logger, e)
+	}
+	if fatal {
+		os.Exit(1)
+	}
+}
+
 func (m *multiLogger) Debug(message string) {
 	for _, logger := range m.loggers {
 		logger.Debug(message)
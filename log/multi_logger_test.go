@@ -52,3 +52,9 @@ func (s *MultiLoggerSuite) TestErrorf(c *check.C) {
 	c.Check(s.buf1.String(), check.Matches, `(?m)^.*ERROR: something went wrong: "this"$`)
 	c.Check(s.buf1.String(), check.Matches, `(?m)^.*ERROR: something went wrong: "this"$`)
 }
+
+func (s *MultiLoggerSuite) TestLog(c *check.C) {
+	s.logger.(StructuredLogger).Log(Entry{Level: WarnLevel, Message: "slow request", Fields: Fields{"app": "myapp"}})
+	c.Check(s.buf1.String(), check.Matches, `(?m)^.*WARN: slow request app=myapp$`)
+	c.Check(s.buf2.String(), check.Matches, `(?m)^.*WARN: slow request app=myapp$`)
+}
@@ -26,6 +26,22 @@ type syslogLogger struct {
 	debug bool
 }
 
+func (l *syslogLogger) Log(e Entry) {
+	msg := e.Text()
+	switch e.Level {
+	case DebugLevel:
+		l.Debug(msg)
+	case InfoLevel:
+		l.w.Info(msg)
+	case WarnLevel:
+		l.w.Warning(msg)
+	case FatalLevel:
+		l.Fatal(msg)
+	default:
+		l.w.Err(msg)
+	}
+}
+
 func (l *syslogLogger) Error(o string) {
 	l.w.Err(o)
 }
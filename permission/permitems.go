@@ -25,11 +25,15 @@ var (
 	PermAppDeployUpload                  = PermissionRegistry.get("app.deploy.upload")                   // [global app team pool]
 	PermAppRead                          = PermissionRegistry.get("app.read")                            // [global app team pool]
 	PermAppReadCertificate               = PermissionRegistry.get("app.read.certificate")                // [global app team pool]
+	PermAppReadConfig                    = PermissionRegistry.get("app.read.config")                     // [global app team pool]
 	PermAppReadDeploy                    = PermissionRegistry.get("app.read.deploy")                     // [global app team pool]
 	PermAppReadEnv                       = PermissionRegistry.get("app.read.env")                        // [global app team pool]
 	PermAppReadEvents                    = PermissionRegistry.get("app.read.events")                     // [global app team pool]
 	PermAppReadLog                       = PermissionRegistry.get("app.read.log")                        // [global app team pool]
+	PermAppReadManifest                  = PermissionRegistry.get("app.read.manifest")                   // [global app team pool]
 	PermAppReadMetric                    = PermissionRegistry.get("app.read.metric")                     // [global app team pool]
+	PermAppReadUnit                      = PermissionRegistry.get("app.read.unit")                       // [global app team pool]
+	PermAppReadUnitAutoscale             = PermissionRegistry.get("app.read.unit.autoscale")             // [global app team pool]
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
@@ -40,6 +44,8 @@ var (
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")                    // [global app team pool]
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
+	PermAppUpdateConfig                  = PermissionRegistry.get("app.update.config")                   // [global app team pool]
+	PermAppUpdateConfigRollback          = PermissionRegistry.get("app.update.config.rollback")          // [global app team pool]
 	PermAppUpdateDescription             = PermissionRegistry.get("app.update.description")              // [global app team pool]
 	PermAppUpdateEnv                     = PermissionRegistry.get("app.update.env")                      // [global app team pool]
 	PermAppUpdateEnvSet                  = PermissionRegistry.get("app.update.env.set")                  // [global app team pool]
@@ -48,12 +54,18 @@ var (
 	PermAppUpdateGrant                   = PermissionRegistry.get("app.update.grant")                    // [global app team pool]
 	PermAppUpdateImageReset              = PermissionRegistry.get("app.update.image-reset")              // [global app team pool]
 	PermAppUpdateLog                     = PermissionRegistry.get("app.update.log")                      // [global app team pool]
+	PermAppUpdateLogFormat               = PermissionRegistry.get("app.update.log.format")               // [global app team pool]
+	PermAppUpdateLogLimit                = PermissionRegistry.get("app.update.log.limit")                // [global app team pool]
+	PermAppUpdateManifest                = PermissionRegistry.get("app.update.manifest")                 // [global app team pool]
+	PermAppUpdateMetadata                = PermissionRegistry.get("app.update.metadata")                 // [global app team pool]
 	PermAppUpdatePlan                    = PermissionRegistry.get("app.update.plan")                     // [global app team pool]
 	PermAppUpdatePool                    = PermissionRegistry.get("app.update.pool")                     // [global app team pool]
+	PermAppUpdateRename                  = PermissionRegistry.get("app.update.rename")                   // [global app team pool]
 	PermAppUpdateRestart                 = PermissionRegistry.get("app.update.restart")                  // [global app team pool]
 	PermAppUpdateRevoke                  = PermissionRegistry.get("app.update.revoke")                   // [global app team pool]
 	PermAppUpdateRouter                  = PermissionRegistry.get("app.update.router")                   // [global app team pool]
 	PermAppUpdateSleep                   = PermissionRegistry.get("app.update.sleep")                    // [global app team pool]
+	PermAppUpdateSleepPolicy             = PermissionRegistry.get("app.update.sleep.policy")             // [global app team pool]
 	PermAppUpdateStart                   = PermissionRegistry.get("app.update.start")                    // [global app team pool]
 	PermAppUpdateStop                    = PermissionRegistry.get("app.update.stop")                     // [global app team pool]
 	PermAppUpdateSwap                    = PermissionRegistry.get("app.update.swap")                     // [global app team pool]
@@ -62,6 +74,9 @@ var (
 	PermAppUpdateUnbind                  = PermissionRegistry.get("app.update.unbind")                   // [global app team pool]
 	PermAppUpdateUnit                    = PermissionRegistry.get("app.update.unit")                     // [global app team pool]
 	PermAppUpdateUnitAdd                 = PermissionRegistry.get("app.update.unit.add")                 // [global app team pool]
+	PermAppUpdateUnitAutoscale           = PermissionRegistry.get("app.update.unit.autoscale")           // [global app team pool]
+	PermAppUpdateUnitAutoscaleRemove     = PermissionRegistry.get("app.update.unit.autoscale.remove")    // [global app team pool]
+	PermAppUpdateUnitAutoscaleSet        = PermissionRegistry.get("app.update.unit.autoscale.set")       // [global app team pool]
 	PermAppUpdateUnitRegister            = PermissionRegistry.get("app.update.unit.register")            // [global app team pool]
 	PermAppUpdateUnitRemove              = PermissionRegistry.get("app.update.unit.remove")              // [global app team pool]
 	PermAppUpdateUnitStatus              = PermissionRegistry.get("app.update.unit.status")              // [global app team pool]
@@ -71,11 +86,21 @@ var (
 	PermClusterReadEvents                = PermissionRegistry.get("cluster.read.events")                 // [global]
 	PermClusterUpdate                    = PermissionRegistry.get("cluster.update")                      // [global]
 	PermDebug                            = PermissionRegistry.get("debug")                               // [global]
+	PermEventApprovalRule                = PermissionRegistry.get("event-approval-rule")                 // [global]
+	PermEventApprovalRuleAdd             = PermissionRegistry.get("event-approval-rule.add")             // [global]
+	PermEventApprovalRuleRead            = PermissionRegistry.get("event-approval-rule.read")            // [global]
+	PermEventApprovalRuleReadEvents      = PermissionRegistry.get("event-approval-rule.read.events")     // [global]
+	PermEventApprovalRuleRemove          = PermissionRegistry.get("event-approval-rule.remove")          // [global]
 	PermEventBlock                       = PermissionRegistry.get("event-block")                         // [global]
 	PermEventBlockAdd                    = PermissionRegistry.get("event-block.add")                     // [global]
 	PermEventBlockRead                   = PermissionRegistry.get("event-block.read")                    // [global]
 	PermEventBlockReadEvents             = PermissionRegistry.get("event-block.read.events")             // [global]
 	PermEventBlockRemove                 = PermissionRegistry.get("event-block.remove")                  // [global]
+	PermEventThrottling                  = PermissionRegistry.get("event-throttling")                    // [global]
+	PermEventThrottlingAdd               = PermissionRegistry.get("event-throttling.add")                // [global]
+	PermEventThrottlingRead              = PermissionRegistry.get("event-throttling.read")               // [global]
+	PermEventThrottlingReadEvents        = PermissionRegistry.get("event-throttling.read.events")        // [global]
+	PermEventThrottlingRemove            = PermissionRegistry.get("event-throttling.remove")             // [global]
 	PermHealing                          = PermissionRegistry.get("healing")                             // [global pool]
 	PermHealingDelete                    = PermissionRegistry.get("healing.delete")                      // [global pool]
 	PermHealingRead                      = PermissionRegistry.get("healing.read")                        // [global pool]
@@ -128,10 +153,18 @@ var (
 	PermPoolRead                         = PermissionRegistry.get("pool.read")                           // [global pool]
 	PermPoolReadConstraints              = PermissionRegistry.get("pool.read.constraints")               // [global pool]
 	PermPoolReadEvents                   = PermissionRegistry.get("pool.read.events")                    // [global pool]
+	PermPoolReadLog                      = PermissionRegistry.get("pool.read.log")                       // [global pool]
+	PermPoolReadLogLimit                 = PermissionRegistry.get("pool.read.log.limit")                 // [global pool]
+	PermPoolReadSleep                    = PermissionRegistry.get("pool.read.sleep")                     // [global pool]
+	PermPoolReadSleepPolicy              = PermissionRegistry.get("pool.read.sleep.policy")              // [global pool]
 	PermPoolUpdate                       = PermissionRegistry.get("pool.update")                         // [global pool]
 	PermPoolUpdateConstraints            = PermissionRegistry.get("pool.update.constraints")             // [global pool]
 	PermPoolUpdateConstraintsSet         = PermissionRegistry.get("pool.update.constraints.set")         // [global pool]
+	PermPoolUpdateLog                    = PermissionRegistry.get("pool.update.log")                     // [global pool]
+	PermPoolUpdateLogLimit               = PermissionRegistry.get("pool.update.log.limit")               // [global pool]
 	PermPoolUpdateLogs                   = PermissionRegistry.get("pool.update.logs")                    // [global pool]
+	PermPoolUpdateSleep                  = PermissionRegistry.get("pool.update.sleep")                   // [global pool]
+	PermPoolUpdateSleepPolicy            = PermissionRegistry.get("pool.update.sleep.policy")            // [global pool]
 	PermPoolUpdateTeam                   = PermissionRegistry.get("pool.update.team")                    // [global pool]
 	PermPoolUpdateTeamAdd                = PermissionRegistry.get("pool.update.team.add")                // [global pool]
 	PermPoolUpdateTeamRemove             = PermissionRegistry.get("pool.update.team.remove")             // [global pool]
@@ -176,10 +209,20 @@ var (
 	PermServiceUpdateProxy               = PermissionRegistry.get("service.update.proxy")                // [global service team]
 	PermServiceUpdateRevokeAccess        = PermissionRegistry.get("service.update.revoke-access")        // [global service team]
 	PermTeam                             = PermissionRegistry.get("team")                                // [global team]
+	PermTeamAdmin                        = PermissionRegistry.get("team.admin")                          // [global team]
+	PermTeamAdminQuota                   = PermissionRegistry.get("team.admin.quota")                    // [global team]
 	PermTeamCreate                       = PermissionRegistry.get("team.create")                         // [global]
 	PermTeamDelete                       = PermissionRegistry.get("team.delete")                         // [global team]
 	PermTeamRead                         = PermissionRegistry.get("team.read")                           // [global team]
 	PermTeamReadEvents                   = PermissionRegistry.get("team.read.events")                    // [global team]
+	PermTeamReadQuota                    = PermissionRegistry.get("team.read.quota")                     // [global team]
+	PermTeamUpdate                       = PermissionRegistry.get("team.update")                         // [global team]
+	PermTeamUpdateInfo                   = PermissionRegistry.get("team.update.info")                    // [global team]
+	PermTeamUpdateMember                 = PermissionRegistry.get("team.update.member")                  // [global team]
+	PermTeamUpdateMemberAdd              = PermissionRegistry.get("team.update.member.add")              // [global team]
+	PermTeamUpdateMemberRemove           = PermissionRegistry.get("team.update.member.remove")           // [global team]
+	PermUsage                            = PermissionRegistry.get("usage")                               // [global team]
+	PermUsageRead                        = PermissionRegistry.get("usage.read")                          // [global team]
 	PermUser                             = PermissionRegistry.get("user")                                // [global user]
 	PermUserCreate                       = PermissionRegistry.get("user.create")                         // [global]
 	PermUserDelete                       = PermissionRegistry.get("user.delete")                         // [global user]
@@ -193,4 +236,10 @@ var (
 	PermUserUpdateQuota                  = PermissionRegistry.get("user.update.quota")                   // [global user]
 	PermUserUpdateReset                  = PermissionRegistry.get("user.update.reset")                   // [global user]
 	PermUserUpdateToken                  = PermissionRegistry.get("user.update.token")                   // [global user]
+	PermWebhook                          = PermissionRegistry.get("webhook")                             // [global team]
+	PermWebhookCreate                    = PermissionRegistry.get("webhook.create")                      // [global team]
+	PermWebhookDelete                    = PermissionRegistry.get("webhook.delete")                      // [global team]
+	PermWebhookRead                      = PermissionRegistry.get("webhook.read")                        // [global team]
+	PermWebhookReadEvents                = PermissionRegistry.get("webhook.read.events")                 // [global team]
+	PermWebhookUpdate                    = PermissionRegistry.get("webhook.update")                      // [global team]
 )
@@ -12,17 +12,26 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.create", []contextType{CtxTeam},
 ).add(
 	"app.update.description",
+	"app.update.rename",
 	"app.update.tags",
+	"app.update.metadata",
 	"app.update.log",
 	"app.update.pool",
 	"app.update.unit.add",
 	"app.update.unit.remove",
 	"app.update.unit.register",
 	"app.update.unit.status",
+	"app.update.unit.autoscale.set",
+	"app.update.unit.autoscale.remove",
 	"app.update.env.set",
 	"app.update.env.unset",
+	"app.update.config.rollback",
+	"app.update.manifest",
 	"app.update.restart",
 	"app.update.sleep",
+	"app.update.sleep.policy",
+	"app.update.log.limit",
+	"app.update.log.format",
 	"app.update.start",
 	"app.update.stop",
 	"app.update.swap",
@@ -49,6 +58,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.read",
 	"app.read.deploy",
 	"app.read.env",
+	"app.read.config",
+	"app.read.manifest",
+	"app.read.unit.autoscale",
 	"app.read.events",
 	"app.read.metric",
 	"app.read.log",
@@ -91,6 +103,11 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.create", []contextType{},
 ).add(
 	"team.read.events",
+	"team.read.quota",
+	"team.admin.quota",
+	"team.update.info",
+	"team.update.member.add",
+	"team.update.member.remove",
 	"team.delete",
 ).addWithCtx(
 	"user", []contextType{CtxUser},
@@ -163,7 +180,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"pool.update.constraints.set",
 	"pool.read.constraints",
 	"pool.update.logs",
+	"pool.update.sleep.policy",
+	"pool.read.sleep.policy",
+	"pool.update.log.limit",
+	"pool.read.log.limit",
 	"pool.delete",
+).addWithCtx(
+	"usage", []contextType{CtxTeam},
+).add(
+	"usage.read",
 ).add(
 	"debug",
 ).add(
@@ -189,6 +214,24 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"event-block.read.events",
 	"event-block.add",
 	"event-block.remove",
+).add(
+	"event-approval-rule.read",
+	"event-approval-rule.read.events",
+	"event-approval-rule.add",
+	"event-approval-rule.remove",
+).add(
+	"event-throttling.read",
+	"event-throttling.read.events",
+	"event-throttling.add",
+	"event-throttling.remove",
+).addWithCtx(
+	"webhook", []contextType{CtxTeam},
+).add(
+	"webhook.create",
+	"webhook.read",
+	"webhook.read.events",
+	"webhook.update",
+	"webhook.delete",
 ).add(
 	"cluster.read.events",
 	"cluster.update",
@@ -33,10 +33,22 @@ var (
 		context:     CtxTeam,
 		Description: "role added to user when a new team is created",
 	}
+	RoleEventTeamMember = &RoleEvent{
+		name:        "team-member",
+		context:     CtxTeam,
+		Description: "role granted to every member of a team",
+	}
+	RoleEventTeamAdmin = &RoleEvent{
+		name:        "team-admin",
+		context:     CtxTeam,
+		Description: "role granted to every admin member of a team",
+	}
 
 	RoleEventMap = map[string]*RoleEvent{
 		RoleEventUserCreate.name: RoleEventUserCreate,
 		RoleEventTeamCreate.name: RoleEventTeamCreate,
+		RoleEventTeamMember.name: RoleEventTeamMember,
+		RoleEventTeamAdmin.name:  RoleEventTeamAdmin,
 	}
 )
 
@@ -141,8 +153,18 @@ func ListRolesWithEvents() ([]Role, error) {
 }
 
 func ListRolesForEvent(evt *RoleEvent) ([]Role, error) {
-	if evt == nil {
-		return nil, errors.New("invalid role event")
+	return ListRolesForEvents(evt)
+}
+
+// ListRolesForEvents returns the roles associated with any of the events,
+// using a single query.
+func ListRolesForEvents(evts ...*RoleEvent) ([]Role, error) {
+	names := make([]string, len(evts))
+	for i, evt := range evts {
+		if evt == nil {
+			return nil, errors.New("invalid role event")
+		}
+		names[i] = evt.name
 	}
 	var roles []Role
 	coll, err := rolesCollection()
@@ -150,7 +172,7 @@ func ListRolesForEvent(evt *RoleEvent) ([]Role, error) {
 		return roles, err
 	}
 	defer coll.Close()
-	err = coll.Find(bson.M{"events": evt.name}).All(&roles)
+	err = coll.Find(bson.M{"events": bson.M{"$in": names}}).All(&roles)
 	if err != nil {
 		return nil, err
 	}
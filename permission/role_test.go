@@ -208,3 +208,24 @@ func (s *S) TestListRolesForEvent(c *check.C) {
 	c.Assert(roles, check.HasLen, 1)
 	c.Assert(roles[0].Name, check.Equals, "myrole2")
 }
+
+func (s *S) TestListRolesForEvents(c *check.C) {
+	_, err := NewRole("myrole1", "team", "")
+	c.Assert(err, check.IsNil)
+	r2, err := NewRole("myrole2", "team", "")
+	c.Assert(err, check.IsNil)
+	r3, err := NewRole("myrole3", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddEvent("team-member")
+	c.Assert(err, check.IsNil)
+	err = r3.AddEvent("team-admin")
+	c.Assert(err, check.IsNil)
+	roles, err := ListRolesForEvents(RoleEventTeamMember, RoleEventTeamAdmin)
+	c.Assert(err, check.IsNil)
+	c.Assert(roles, check.HasLen, 2)
+	names := []string{roles[0].Name, roles[1].Name}
+	sort.Strings(names)
+	c.Assert(names, check.DeepEquals, []string{"myrole2", "myrole3"})
+	_, err = ListRolesForEvents(RoleEventTeamMember, nil)
+	c.Assert(err, check.NotNil)
+}
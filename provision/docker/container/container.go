@@ -10,6 +10,7 @@ import (
 	"io"
 	"math/rand"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -126,9 +127,12 @@ func (c *Container) Create(args *CreateArgs) error {
 		CPUShares:    hostConf.CPUShares,
 		SecurityOpts: hostConf.SecurityOpt,
 		User:         user,
-		Labels:       labelSet.ToLabels(),
+		Labels:       labelSet.ToContainerLabels(),
+	}
+	err = c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	if err != nil {
+		return err
 	}
-	c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &conf, HostConfig: hostConf}
 	var nodeList []string
 	if len(args.DestinationHosts) > 0 {
@@ -158,8 +162,11 @@ func (c *Container) Create(args *CreateArgs) error {
 	return nil
 }
 
-func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) {
-	envs := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) error {
+	envs, err := provision.EnvsForApp(args.App, c.ProcessName, args.Deploy)
+	if err != nil {
+		return err
+	}
 	for _, envData := range envs {
 		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 	}
@@ -171,6 +178,7 @@ func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.C
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	return nil
 }
 
 type NetworkInfo struct {
@@ -420,6 +428,10 @@ func (c *Container) Stop(p DockerProvisioner) error {
 	return nil
 }
 
+// cpuPeriod is the CFS period, in microseconds, used to enforce the CPU limit
+// of units.
+const cpuPeriod = 100000
+
 type StartArgs struct {
 	Provisioner DockerProvisioner
 	App         provision.App
@@ -431,13 +443,24 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 	sharedMount, _ := config.GetString("docker:sharedfs:mountpoint")
 	sharedIsolation, _ := config.GetBool("docker:sharedfs:app-isolation")
 	sharedSalt, _ := config.GetString("docker:sharedfs:salt")
+	res := app.GetUnitResources(c.ProcessName)
 	hostConfig := docker.HostConfig{
-		CPUShares: int64(app.GetCpuShare()),
+		CPUShares: int64(res.CPUShare),
 	}
 
 	if !isDeploy {
-		hostConfig.Memory = app.GetMemory()
-		hostConfig.MemorySwap = app.GetMemory() + app.GetSwap()
+		hostConfig.Memory = res.Memory
+		hostConfig.MemorySwap = res.Memory + res.Swap
+		hostConfig.MemoryReservation = res.MemoryRequest
+		if res.CPULimit > 0 {
+			hostConfig.CPUPeriod = cpuPeriod
+			hostConfig.CPUQuota = int64(res.CPULimit) * cpuPeriod / 1000
+		}
+		if res.EphemeralStorage > 0 {
+			if limitDisk, _ := config.GetBool("docker:limit-ephemeral-storage"); limitDisk {
+				hostConfig.StorageOpt = map[string]string{"size": strconv.FormatInt(res.EphemeralStorage, 10)}
+			}
+		}
 		hostConfig.RestartPolicy = docker.AlwaysRestart()
 		hostConfig.PortBindings = map[docker.Port][]docker.PortBinding{
 			docker.Port(c.ExposedPort): {{HostIP: "", HostPort: ""}},
@@ -1037,3 +1037,49 @@ func (s *S) TestContainerValidAddr(c *check.C) {
 	c.Assert((&Container{Container: types.Container{HostAddr: "1.1.1.1", HostPort: "0"}}).ValidAddr(), check.Equals, false)
 	c.Assert((&Container{Container: types.Container{HostAddr: "1.1.1.1", HostPort: "123"}}).ValidAddr(), check.Equals, true)
 }
+
+func (s *S) TestContainerHostConfigResources(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.Memory = 512
+	app.MemoryRequest = 256
+	app.CPULimit = 1500
+	app.EphemeralStorage = 1024
+	cont := Container{AppName: app.GetName(), ExposedPort: "8888/tcp"}
+	hostConfig, err := cont.hostConfig(app, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.MemoryReservation, check.Equals, int64(256))
+	c.Assert(hostConfig.CPUPeriod, check.Equals, int64(100000))
+	c.Assert(hostConfig.CPUQuota, check.Equals, int64(150000))
+	c.Assert(hostConfig.StorageOpt, check.IsNil)
+	config.Set("docker:limit-ephemeral-storage", true)
+	defer config.Unset("docker:limit-ephemeral-storage")
+	hostConfig, err = cont.hostConfig(app, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.StorageOpt, check.DeepEquals, map[string]string{"size": "1024"})
+	hostConfig, err = cont.hostConfig(app, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.CPUQuota, check.Equals, int64(0))
+	c.Assert(hostConfig.StorageOpt, check.IsNil)
+}
+
+func (s *S) TestContainerHostConfigProcessResources(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.Memory = 512
+	app.CpuShare = 50
+	app.ProcessResources = map[string]provision.UnitResources{
+		"worker": {Memory: 2048, Swap: 1024, CPUShare: 200, CPULimit: 2000},
+	}
+	cont := Container{AppName: app.GetName(), ProcessName: "worker", ExposedPort: "8888/tcp"}
+	hostConfig, err := cont.hostConfig(app, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.Memory, check.Equals, int64(2048))
+	c.Assert(hostConfig.MemorySwap, check.Equals, int64(3072))
+	c.Assert(hostConfig.CPUShares, check.Equals, int64(200))
+	c.Assert(hostConfig.CPUQuota, check.Equals, int64(200000))
+	cont.ProcessName = "web"
+	hostConfig, err = cont.hostConfig(app, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(hostConfig.Memory, check.Equals, int64(512))
+	c.Assert(hostConfig.CPUShares, check.Equals, int64(50))
+	c.Assert(hostConfig.CPUQuota, check.Equals, int64(0))
+}
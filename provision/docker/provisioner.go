@@ -880,6 +880,44 @@ func (p *dockerProvisioner) Units(app provision.App) ([]provision.Unit, error) {
 	return units, nil
 }
 
+func (p *dockerProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetric, error) {
+	containers, err := p.listRunnableContainersByApp(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	clients := map[string]*docker.Client{}
+	reqs := make([]dockercommon.MetricsRequest, len(containers))
+	for i, c := range containers {
+		client, ok := clients[c.HostAddr]
+		if !ok {
+			node, err := p.GetNodeByHost(c.HostAddr)
+			if err != nil {
+				return nil, err
+			}
+			client, err = node.Client()
+			if err != nil {
+				return nil, err
+			}
+			clients[c.HostAddr] = client
+		}
+		reqs[i] = dockercommon.MetricsRequest{Client: client, ContainerID: c.ID}
+	}
+	usages, err := dockercommon.ContainersMetrics(reqs)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]provision.UnitMetric, len(containers))
+	for i, c := range containers {
+		metrics[i] = provision.UnitMetric{
+			ID:          c.ID,
+			ProcessName: c.ProcessName,
+			CPU:         usages[i].CPU,
+			Memory:      usages[i].Memory,
+		}
+	}
+	return metrics, nil
+}
+
 func (p *dockerProvisioner) RoutableAddresses(app provision.App) ([]url.URL, error) {
 	imageId, err := image.AppCurrentImageName(app.GetName())
 	if err != nil && err != image.ErrNoImagesAvailable {
@@ -2302,6 +2302,26 @@ func (s *S) TestProvisionerUnits(c *check.C) {
 	c.Assert(units, check.DeepEquals, expected)
 }
 
+func (s *S) TestProvisionerUnitsMetrics(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStarted.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	s.server.PrepareStats(cont.ID, func(id string) docker.Stats {
+		var stats docker.Stats
+		stats.PreCPUStats.CPUUsage.TotalUsage = 100
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.CPUStats.CPUUsage.TotalUsage = 200
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.MemoryStats.Usage = 1024
+		return stats
+	})
+	metrics, err := s.p.UnitsMetrics(&app.App{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: cont.ID, ProcessName: "web", CPU: 10, Memory: 1024},
+	})
+}
+
 func (s *S) TestProvisionerGetAppFromUnitID(c *check.C) {
 	app := app.App{Name: "myapplication"}
 	err := s.storage.Apps().Insert(app)
@@ -59,7 +59,8 @@ func (s *S) TestArchiveDeployCmds(c *check.C) {
 	archiveURL := "https://s3.amazonaws.com/wat/archive.tar.gz"
 	expectedPart1 := fmt.Sprintf("/var/lib/tsuru/deploy archive %s", archiveURL)
 	expectedAgent := fmt.Sprintf(`tsuru_unit_agent tsuru_host app_token app-name "%s" deploy`, expectedPart1)
-	cmds := ArchiveDeployCmds(app, archiveURL)
+	cmds, err := ArchiveDeployCmds(app, archiveURL)
+	c.Assert(err, check.IsNil)
 	c.Assert(cmds, check.DeepEquals, []string{"/bin/sh", "-lc", expectedAgent})
 }
 
@@ -0,0 +1,108 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dockercommon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+const (
+	statsTimeout = 10 * time.Second
+	// maxConcurrentStats limits how many container stats are requested at
+	// the same time by ContainersMetrics.
+	maxConcurrentStats = 10
+)
+
+// MetricsRequest identifies a container whose usage is requested by
+// ContainersMetrics.
+type MetricsRequest struct {
+	Client      *docker.Client
+	ContainerID string
+}
+
+// ContainerUsage is the CPU and memory usage of a container, as returned by
+// ContainerMetric.
+type ContainerUsage struct {
+	CPU    float64
+	Memory int64
+}
+
+// ContainersMetrics returns the usage of many containers, requesting their
+// stats concurrently. Results are in the same order as the requests.
+func ContainersMetrics(reqs []MetricsRequest) ([]ContainerUsage, error) {
+	usages := make([]ContainerUsage, len(reqs))
+	errs := make([]error, len(reqs))
+	limiter := make(chan struct{}, maxConcurrentStats)
+	var wg sync.WaitGroup
+	for i := range reqs {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			usages[i].CPU, usages[i].Memory, errs[i] = ContainerMetric(reqs[i].Client, reqs[i].ContainerID)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
+
+// ContainerMetric returns the CPU usage, as a percentage of one core, and the
+// memory used, in bytes, by a container. Memory used by the page cache is not
+// taken into account.
+func ContainerMetric(client *docker.Client, containerID string) (float64, int64, error) {
+	statsCh := make(chan *docker.Stats, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Stats(docker.StatsOptions{
+			ID:                containerID,
+			Stats:             statsCh,
+			Stream:            false,
+			Timeout:           statsTimeout,
+			InactivityTimeout: statsTimeout,
+		})
+	}()
+	stats, ok := <-statsCh
+	err := <-errCh
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	if !ok || stats == nil {
+		return 0, 0, errors.Errorf("no stats available for container %s", containerID)
+	}
+	return cpuPercent(stats), memoryUsage(stats), nil
+}
+
+func cpuPercent(stats *docker.Stats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cores := float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	if cores == 0 {
+		cores = 1
+	}
+	return cpuDelta / systemDelta * cores * 100
+}
+
+func memoryUsage(stats *docker.Stats) int64 {
+	usage := stats.MemoryStats.Usage
+	if cache := stats.MemoryStats.Stats.Cache; cache < usage {
+		usage -= cache
+	}
+	return int64(usage)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dockercommon
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestContainerMetric(c *check.C) {
+	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Stop()
+	cli, err := docker.NewClient(srv.URL())
+	c.Assert(err, check.IsNil)
+	err = cli.PullImage(docker.PullImageOptions{Repository: "myimg"}, docker.AuthConfiguration{})
+	c.Assert(err, check.IsNil)
+	cont, err := cli.CreateContainer(docker.CreateContainerOptions{Config: &docker.Config{Image: "myimg"}})
+	c.Assert(err, check.IsNil)
+	srv.PrepareStats(cont.ID, func(id string) docker.Stats {
+		var stats docker.Stats
+		stats.PreCPUStats.CPUUsage.TotalUsage = 1000
+		stats.PreCPUStats.SystemCPUUsage = 10000
+		stats.CPUStats.CPUUsage.TotalUsage = 1500
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{750, 750}
+		stats.CPUStats.SystemCPUUsage = 12000
+		stats.MemoryStats.Usage = 300
+		stats.MemoryStats.Stats.Cache = 100
+		return stats
+	})
+	cpu, memory, err := ContainerMetric(cli, cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(cpu, check.Equals, 50.0)
+	c.Assert(memory, check.Equals, int64(200))
+}
+
+func (s *S) TestContainerMetricNotFound(c *check.C) {
+	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Stop()
+	cli, err := docker.NewClient(srv.URL())
+	c.Assert(err, check.IsNil)
+	_, _, err = ContainerMetric(cli, "notfound")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestContainersMetrics(c *check.C) {
+	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Stop()
+	cli, err := docker.NewClient(srv.URL())
+	c.Assert(err, check.IsNil)
+	err = cli.PullImage(docker.PullImageOptions{Repository: "myimg"}, docker.AuthConfiguration{})
+	c.Assert(err, check.IsNil)
+	var reqs []MetricsRequest
+	for i := 0; i < 15; i++ {
+		cont, createErr := cli.CreateContainer(docker.CreateContainerOptions{Config: &docker.Config{Image: "myimg"}})
+		c.Assert(createErr, check.IsNil)
+		memory := uint64(100 * (i + 1))
+		srv.PrepareStats(cont.ID, func(id string) docker.Stats {
+			var stats docker.Stats
+			stats.MemoryStats.Usage = memory
+			return stats
+		})
+		reqs = append(reqs, MetricsRequest{Client: cli, ContainerID: cont.ID})
+	}
+	usages, err := ContainersMetrics(reqs)
+	c.Assert(err, check.IsNil)
+	c.Assert(usages, check.HasLen, 15)
+	for i, u := range usages {
+		c.Assert(u.Memory, check.Equals, int64(100*(i+1)))
+	}
+	reqs = append(reqs, MetricsRequest{Client: cli, ContainerID: "notfound"})
+	_, err = ContainersMetrics(reqs)
+	c.Assert(err, check.NotNil)
+}
@@ -19,10 +19,14 @@ func WebProcessDefaultPort() string {
 	return fmt.Sprint(port)
 }
 
-func EnvsForApp(a App, process string, isDeploy bool) []bind.EnvVar {
+func EnvsForApp(a App, process string, isDeploy bool) ([]bind.EnvVar, error) {
 	var envs []bind.EnvVar
 	if !isDeploy {
-		for _, envData := range a.Envs() {
+		appEnvs, err := a.Envs()
+		if err != nil {
+			return nil, err
+		}
+		for _, envData := range appEnvs {
 			envs = append(envs, envData)
 		}
 		envs = append(envs, bind.EnvVar{Name: "TSURU_PROCESSNAME", Value: process})
@@ -36,5 +40,5 @@ func EnvsForApp(a App, process string, isDeploy bool) []bind.EnvVar {
 			{Name: "PORT", Value: port},
 		}...)
 	}
-	return envs
+	return envs, nil
 }
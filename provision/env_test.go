@@ -27,7 +27,8 @@ func (s *S) TestWebProcessDefaultPortWithConfig(c *check.C) {
 func (s *S) TestEnvsForApp(c *check.C) {
 	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
 	a.SetEnv(bind.EnvVar{Name: "e1", Value: "v1"})
-	envs := provision.EnvsForApp(a, "p1", false)
+	envs, err := provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "e1", Value: "v1"},
 		{Name: "TSURU_PROCESSNAME", Value: "p1"},
@@ -35,7 +36,8 @@ func (s *S) TestEnvsForApp(c *check.C) {
 		{Name: "port", Value: "8888"},
 		{Name: "PORT", Value: "8888"},
 	})
-	envs = provision.EnvsForApp(a, "p1", true)
+	envs, err = provision.EnvsForApp(a, "p1", true)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "TSURU_HOST", Value: ""},
 	})
@@ -48,7 +50,8 @@ func (s *S) TestEnvsForAppCustomConfig(c *check.C) {
 	defer config.Unset("docker:run-cmd:port")
 	a := provisiontest.NewFakeApp("myapp", "crystal", 1)
 	a.SetEnv(bind.EnvVar{Name: "e1", Value: "v1"})
-	envs := provision.EnvsForApp(a, "p1", false)
+	envs, err := provision.EnvsForApp(a, "p1", false)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "e1", Value: "v1"},
 		{Name: "TSURU_PROCESSNAME", Value: "p1"},
@@ -56,7 +59,8 @@ func (s *S) TestEnvsForAppCustomConfig(c *check.C) {
 		{Name: "port", Value: "8989"},
 		{Name: "PORT", Value: "8989"},
 	})
-	envs = provision.EnvsForApp(a, "p1", true)
+	envs, err = provision.EnvsForApp(a, "p1", true)
+	c.Assert(err, check.IsNil)
 	c.Assert(envs, check.DeepEquals, []bind.EnvVar{
 		{Name: "TSURU_HOST", Value: "cloud.tsuru.io"},
 	})
@@ -115,7 +115,10 @@ func createBuildPod(params buildPodParams) error {
 	}
 	buildImageLabel := &provision.LabelSet{}
 	buildImageLabel.SetBuildImage(params.destinationImage)
-	appEnvs := provision.EnvsForApp(params.app, "", true)
+	appEnvs, err := provision.EnvsForApp(params.app, "", true)
+	if err != nil {
+		return err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
@@ -211,7 +214,7 @@ func createBuildPod(params buildPodParams) error {
 	return waitForPod(params.client, pod.Name, false, defaultRunPodReadyTimeout)
 }
 
-func extraRegisterCmds(a provision.App) string {
+func extraRegisterCmds(a provision.App) (string, error) {
 	host, _ := config.GetString("host")
 	if !strings.HasPrefix(host, "http") {
 		host = "http://" + host
@@ -219,8 +222,12 @@ func extraRegisterCmds(a provision.App) string {
 	if !strings.HasSuffix(host, "/") {
 		host += "/"
 	}
-	token := a.Envs()["TSURU_APP_TOKEN"].Value
-	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, a.GetName())
+	envs, err := a.Envs()
+	if err != nil {
+		return "", err
+	}
+	token := envs["TSURU_APP_TOKEN"].Value
+	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, a.GetName()), nil
 }
 
 func probeFromHC(hc provision.TsuruYamlHealthcheck, port int) (*v1.Probe, error) {
@@ -241,18 +248,57 @@ func probeFromHC(hc provision.TsuruYamlHealthcheck, port int) (*v1.Probe, error)
 	}, nil
 }
 
+// resourceEphemeralStorage is the name of the local disk resource, not
+// available as a constant in the vendored client.
+const resourceEphemeralStorage = v1.ResourceName("ephemeral-storage")
+
+// containerResources returns the resource limits and requests of the units
+// of the process, according to its plan.
+func containerResources(a provision.App, process string) v1.ResourceRequirements {
+	res := a.GetUnitResources(process)
+	limits := v1.ResourceList{}
+	if res.Memory != 0 {
+		limits[v1.ResourceMemory] = *resource.NewQuantity(res.Memory, resource.BinarySI)
+	}
+	if res.CPULimit != 0 {
+		limits[v1.ResourceCPU] = *resource.NewMilliQuantity(int64(res.CPULimit), resource.DecimalSI)
+	}
+	if res.EphemeralStorage != 0 {
+		limits[resourceEphemeralStorage] = *resource.NewQuantity(res.EphemeralStorage, resource.BinarySI)
+	}
+	resources := v1.ResourceRequirements{Limits: limits}
+	requests := v1.ResourceList{}
+	if res.MemoryRequest != 0 {
+		requests[v1.ResourceMemory] = *resource.NewQuantity(res.MemoryRequest, resource.BinarySI)
+	}
+	if res.CPURequest != 0 {
+		requests[v1.ResourceCPU] = *resource.NewMilliQuantity(int64(res.CPURequest), resource.DecimalSI)
+	}
+	if len(requests) > 0 {
+		resources.Requests = requests
+	}
+	return resources
+}
+
 func createAppDeployment(client *clusterClient, oldDeployment *extensions.Deployment, a provision.App, process, imageName string, replicas int, labels *provision.LabelSet) (*extensions.Deployment, *provision.LabelSet, error) {
 	provision.ExtendServiceLabels(labels, provision.ServiceLabelExtendedOpts{
 		Provisioner: provisionerName,
 		Prefix:      tsuruLabelPrefix,
 	})
 	realReplicas := int32(replicas)
-	extra := []string{extraRegisterCmds(a)}
+	registerCmds, err := extraRegisterCmds(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	extra := []string{registerCmds}
 	cmds, _, err := dockercommon.LeanContainerCmdsWithExtra(process, imageName, a, extra)
 	if err != nil {
 		return nil, nil, errors.WithStack(err)
 	}
-	appEnvs := provision.EnvsForApp(a, process, false)
+	appEnvs, err := provision.EnvsForApp(a, process, false)
+	if err != nil {
+		return nil, nil, err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
@@ -282,15 +328,13 @@ func createAppDeployment(client *clusterClient, oldDeployment *extensions.Deploy
 		Pool: a.GetPool(),
 	}).ToNodeByPoolSelector()
 	_, uid := dockercommon.UserForContainer()
-	resourceLimits := v1.ResourceList{}
-	memory := a.GetMemory()
-	if memory != 0 {
-		resourceLimits[v1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
-	}
+	resources := containerResources(a, process)
 	deployment := extensions.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      depName,
-			Namespace: client.Namespace(),
+			Name:        depName,
+			Namespace:   client.Namespace(),
+			Labels:      labels.ToLabels(),
+			Annotations: labels.ToAnnotations(),
 		},
 		Spec: extensions.DeploymentSpec{
 			Strategy: extensions.DeploymentStrategy{
@@ -307,7 +351,8 @@ func createAppDeployment(client *clusterClient, oldDeployment *extensions.Deploy
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels.ToLabels(),
+					Labels:      labels.ToLabels(),
+					Annotations: labels.ToAnnotations(),
 				},
 				Spec: v1.PodSpec{
 					SecurityContext: &v1.PodSecurityContext{
@@ -322,9 +367,7 @@ func createAppDeployment(client *clusterClient, oldDeployment *extensions.Deploy
 							Command:        cmds,
 							Env:            envs,
 							ReadinessProbe: probe,
-							Resources: v1.ResourceRequirements{
-								Limits: resourceLimits,
-							},
+							Resources:      resources,
 						},
 					},
 				},
@@ -49,11 +49,29 @@ func (s *S) TestServiceManagerDeployService(c *check.C) {
 	ten := int32(10)
 	maxSurge := intstr.FromString("100%")
 	maxUnavailable := intstr.FromInt(0)
+	expectedLabels := map[string]string{
+		"tsuru.io/is-tsuru":             "true",
+		"tsuru.io/is-service":           "true",
+		"tsuru.io/is-build":             "false",
+		"tsuru.io/is-stopped":           "false",
+		"tsuru.io/is-deploy":            "false",
+		"tsuru.io/is-isolated-run":      "false",
+		"tsuru.io/app-name":             "myapp",
+		"tsuru.io/app-process":          "p1",
+		"tsuru.io/app-process-replicas": "1",
+		"tsuru.io/app-platform":         "",
+		"tsuru.io/app-pool":             "test-default",
+		"tsuru.io/router-type":          "fake",
+		"tsuru.io/router-name":          "fake",
+		"tsuru.io/provisioner":          "kubernetes",
+		"tsuru.io/builder":              "",
+	}
 	expectedUID := int64(1000)
 	c.Assert(dep, check.DeepEquals, &extensions.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "myapp-p1",
 			Namespace: s.client.Namespace(),
+			Labels:    expectedLabels,
 		},
 		Status: extensions.DeploymentStatus{
 			UpdatedReplicas: 1,
@@ -79,23 +97,7 @@ func (s *S) TestServiceManagerDeployService(c *check.C) {
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"tsuru.io/is-tsuru":             "true",
-						"tsuru.io/is-service":           "true",
-						"tsuru.io/is-build":             "false",
-						"tsuru.io/is-stopped":           "false",
-						"tsuru.io/is-deploy":            "false",
-						"tsuru.io/is-isolated-run":      "false",
-						"tsuru.io/app-name":             "myapp",
-						"tsuru.io/app-process":          "p1",
-						"tsuru.io/app-process-replicas": "1",
-						"tsuru.io/app-platform":         "",
-						"tsuru.io/app-pool":             "test-default",
-						"tsuru.io/router-type":          "fake",
-						"tsuru.io/router-name":          "fake",
-						"tsuru.io/provisioner":          "kubernetes",
-						"tsuru.io/builder":              "",
-					},
+					Labels: expectedLabels,
 				},
 				Spec: v1.PodSpec{
 					SecurityContext: &v1.PodSecurityContext{
@@ -172,6 +174,37 @@ func (s *S) TestServiceManagerDeployService(c *check.C) {
 	})
 }
 
+func (s *S) TestServiceManagerDeployServiceWithMetadata(c *check.C) {
+	waitDep := s.deploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.client.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Metadata: provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "example.com/team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/cost-center", Value: "42"}},
+	}}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("myimg", map[string]interface{}{
+		"processes": map[string]interface{}{
+			"p1": "cm1",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = servicecommon.RunServicePipeline(&m, a, "myimg", servicecommon.ProcessSpec{
+		"p1": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.Extensions().Deployments(s.client.Namespace()).Get("myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	expectedAnnotations := map[string]string{"example.com/cost-center": "42"}
+	c.Assert(dep.Labels["example.com/team"], check.Equals, "payments")
+	c.Assert(dep.Annotations, check.DeepEquals, expectedAnnotations)
+	c.Assert(dep.Spec.Template.Labels["example.com/team"], check.Equals, "payments")
+	c.Assert(dep.Spec.Template.Labels["tsuru.io/app-name"], check.Equals, "myapp")
+	c.Assert(dep.Spec.Template.Annotations, check.DeepEquals, expectedAnnotations)
+	c.Assert(dep.Spec.Selector.MatchLabels["example.com/team"], check.Equals, "")
+}
+
 func (s *S) TestServiceManagerDeployServiceUpdateStates(c *check.C) {
 	waitDep := s.deploymentReactions(c)
 	defer waitDep()
@@ -609,3 +642,35 @@ func (s *S) TestServiceManagerRemoveServiceMiddleFailure(c *check.C) {
 }
 
 // func (s *S) Test
+
+func (s *S) TestContainerResources(c *check.C) {
+	a := &app.App{Name: "myapp"}
+	c.Assert(containerResources(a, "web"), check.DeepEquals, v1.ResourceRequirements{Limits: v1.ResourceList{}})
+	a.Plan = app.Plan{
+		Memory:           1024,
+		CPULimit:         1500,
+		CPURequest:       250,
+		MemoryRequest:    512,
+		EphemeralStorage: 2048,
+	}
+	c.Assert(containerResources(a, "web"), check.DeepEquals, v1.ResourceRequirements{
+		Limits: v1.ResourceList{
+			v1.ResourceMemory:        *resource.NewQuantity(1024, resource.BinarySI),
+			v1.ResourceCPU:           *resource.NewMilliQuantity(1500, resource.DecimalSI),
+			resourceEphemeralStorage: *resource.NewQuantity(2048, resource.BinarySI),
+		},
+		Requests: v1.ResourceList{
+			v1.ResourceMemory: *resource.NewQuantity(512, resource.BinarySI),
+			v1.ResourceCPU:    *resource.NewMilliQuantity(250, resource.DecimalSI),
+		},
+	})
+	a.ProcessPlans = map[string]app.Plan{
+		"worker": {Memory: 4096, CPULimit: 2000},
+	}
+	c.Assert(containerResources(a, "worker"), check.DeepEquals, v1.ResourceRequirements{
+		Limits: v1.ResourceList{
+			v1.ResourceMemory: *resource.NewQuantity(4096, resource.BinarySI),
+			v1.ResourceCPU:    *resource.NewMilliQuantity(2000, resource.DecimalSI),
+		},
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const metricsAPIPath = "/apis/metrics.k8s.io/v1beta1/namespaces"
+
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	Metadata   metav1.ObjectMeta  `json:"metadata"`
+	Containers []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string            `json:"name"`
+	Usage map[string]string `json:"usage"`
+}
+
+func (p *kubernetesProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetric, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return nil, err
+	}
+	l, err := provision.ServiceLabels(provision.ServiceLabelsOpts{
+		App: a,
+		ServiceLabelExtendedOpts: provision.ServiceLabelExtendedOpts{
+			Prefix:      tsuruLabelPrefix,
+			Provisioner: provisionerName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	selector := labels.SelectorFromSet(labels.Set(l.ToAppSelector())).String()
+	pods, err := client.Core().Pods(client.Namespace()).List(metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	processes := map[string]string{}
+	for _, pod := range pods.Items {
+		processes[pod.Name] = labelSetFromMeta(&pod.ObjectMeta).AppProcess()
+	}
+	data, err := client.Core().RESTClient().Get().
+		AbsPath(metricsAPIPath, client.Namespace(), "pods").
+		Param("labelSelector", selector).
+		DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get metrics from the metrics API")
+	}
+	return podMetricsToUnitMetrics(data, processes)
+}
+
+// podMetricsToUnitMetrics converts the response of the metrics API to unit
+// metrics, summing the usage of every container in each pod. Pods not in
+// processes are ignored.
+func podMetricsToUnitMetrics(data []byte, processes map[string]string) ([]provision.UnitMetric, error) {
+	var list podMetricsList
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse metrics")
+	}
+	metrics := make([]provision.UnitMetric, 0, len(list.Items))
+	for _, item := range list.Items {
+		process, ok := processes[item.Metadata.Name]
+		if !ok {
+			continue
+		}
+		metric := provision.UnitMetric{ID: item.Metadata.Name, ProcessName: process}
+		for _, cont := range item.Containers {
+			cpu, err := resource.ParseQuantity(cont.Usage["cpu"])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid cpu usage for pod %s", item.Metadata.Name)
+			}
+			memory, err := resource.ParseQuantity(cont.Usage["memory"])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid memory usage for pod %s", item.Metadata.Name)
+			}
+			metric.CPU += float64(cpu.MilliValue()) / 10
+			metric.Memory += memory.Value()
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
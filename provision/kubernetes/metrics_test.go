@@ -0,0 +1,47 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPodMetricsToUnitMetrics(c *check.C) {
+	data := []byte(`{
+	"kind": "PodMetricsList",
+	"items": [
+		{
+			"metadata": {"name": "myapp-web-1"},
+			"containers": [
+				{"name": "myapp-web", "usage": {"cpu": "250m", "memory": "64Mi"}},
+				{"name": "sidecar", "usage": {"cpu": "50m", "memory": "1Mi"}}
+			]
+		},
+		{
+			"metadata": {"name": "myapp-worker-1"},
+			"containers": [{"name": "myapp-worker", "usage": {"cpu": "1", "memory": "1Gi"}}]
+		},
+		{
+			"metadata": {"name": "otherapp-web-1"},
+			"containers": [{"name": "otherapp-web", "usage": {"cpu": "1", "memory": "1Gi"}}]
+		}
+	]
+}`)
+	metrics, err := podMetricsToUnitMetrics(data, map[string]string{
+		"myapp-web-1":    "web",
+		"myapp-worker-1": "worker",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: "myapp-web-1", ProcessName: "web", CPU: 30, Memory: 65 * 1024 * 1024},
+		{ID: "myapp-worker-1", ProcessName: "worker", CPU: 100, Memory: 1024 * 1024 * 1024},
+	})
+}
+
+func (s *S) TestPodMetricsToUnitMetricsInvalid(c *check.C) {
+	_, err := podMetricsToUnitMetrics([]byte(`{"items": [{"metadata": {"name": "p1"}, "containers": [{"usage": {"cpu": "x"}}]}]}`), map[string]string{"p1": "web"})
+	c.Assert(err, check.ErrorMatches, `invalid cpu usage for pod p1.*`)
+}
@@ -26,6 +26,7 @@ import (
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/pkg/api/v1"
 	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
 	"k8s.io/kubernetes/pkg/util/term"
@@ -41,15 +42,16 @@ const (
 type kubernetesProvisioner struct{}
 
 var (
-	_ provision.Provisioner              = &kubernetesProvisioner{}
-	_ provision.UploadDeployer           = &kubernetesProvisioner{}
-	_ provision.ShellProvisioner         = &kubernetesProvisioner{}
-	_ provision.NodeProvisioner          = &kubernetesProvisioner{}
-	_ provision.NodeContainerProvisioner = &kubernetesProvisioner{}
-	_ provision.ExecutableProvisioner    = &kubernetesProvisioner{}
-	_ provision.MessageProvisioner       = &kubernetesProvisioner{}
-	_ provision.SleepableProvisioner     = &kubernetesProvisioner{}
-	_ provision.ImageDeployer            = &kubernetesProvisioner{}
+	_ provision.Provisioner                  = &kubernetesProvisioner{}
+	_ provision.UploadDeployer               = &kubernetesProvisioner{}
+	_ provision.ShellProvisioner             = &kubernetesProvisioner{}
+	_ provision.NodeProvisioner              = &kubernetesProvisioner{}
+	_ provision.NodeContainerProvisioner     = &kubernetesProvisioner{}
+	_ provision.ExecutableProvisioner        = &kubernetesProvisioner{}
+	_ provision.MessageProvisioner           = &kubernetesProvisioner{}
+	_ provision.SleepableProvisioner         = &kubernetesProvisioner{}
+	_ provision.ImageDeployer                = &kubernetesProvisioner{}
+	_ provision.MetadataValidatorProvisioner = &kubernetesProvisioner{}
 	// _ provision.ArchiveDeployer          = &kubernetesProvisioner{}
 	// _ provision.InitializableProvisioner = &kubernetesProvisioner{}
 	// _ provision.RollbackableDeployer     = &kubernetesProvisioner{}
@@ -71,6 +73,27 @@ func (p *kubernetesProvisioner) GetName() string {
 	return provisionerName
 }
 
+func (p *kubernetesProvisioner) ValidateMetadata(m provision.AppMetadata) error {
+	err := m.Validate(tsuruLabelPrefix)
+	if err != nil {
+		return err
+	}
+	for _, item := range m.Labels {
+		if errs := validation.IsQualifiedName(item.Name); len(errs) > 0 {
+			return errors.Errorf("invalid label name %q: %s", item.Name, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(item.Value); len(errs) > 0 {
+			return errors.Errorf("invalid value for label %q: %s", item.Name, strings.Join(errs, "; "))
+		}
+	}
+	for _, item := range m.Annotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(item.Name)); len(errs) > 0 {
+			return errors.Errorf("invalid annotation name %q: %s", item.Name, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
 func (p *kubernetesProvisioner) Provision(provision.App) error {
 	return nil
 }
@@ -603,7 +626,10 @@ func (p *kubernetesProvisioner) UploadDeploy(a provision.App, archiveFile io.Rea
 		return "", err
 	}
 	defer cleanupPod(client, deployPodName)
-	cmds := dockercommon.ArchiveDeployCmds(a, "file:///home/application/archive.tar.gz")
+	cmds, err := dockercommon.ArchiveDeployCmds(a, "file:///home/application/archive.tar.gz")
+	if err != nil {
+		return "", err
+	}
 	if len(cmds) != 3 {
 		return "", errors.Errorf("unexpected cmds list: %#v", cmds)
 	}
@@ -728,7 +754,10 @@ func runIsolatedCmdPod(client *clusterClient, a provision.App, out io.Writer, cm
 	if err != nil {
 		return err
 	}
-	appEnvs := provision.EnvsForApp(a, "", false)
+	appEnvs, err := provision.EnvsForApp(a, "", false)
+	if err != nil {
+		return err
+	}
 	var envs []v1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, v1.EnvVar{Name: envData.Name, Value: envData.Value})
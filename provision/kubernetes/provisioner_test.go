@@ -31,6 +31,30 @@ import (
 	"k8s.io/kubernetes/pkg/util/term"
 )
 
+func (s *S) TestValidateMetadata(c *check.C) {
+	err := s.p.ValidateMetadata(provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "example.com/team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/Owner", Value: "some free text"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.p.ValidateMetadata(provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "tsuru.io/team", Value: "payments"}},
+	})
+	c.Assert(err, check.ErrorMatches, `label "tsuru.io/team" is reserved for internal use`)
+	err = s.p.ValidateMetadata(provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "not valid"}},
+	})
+	c.Assert(err, check.ErrorMatches, `invalid value for label "team": .*`)
+	err = s.p.ValidateMetadata(provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "-team", Value: "x"}},
+	})
+	c.Assert(err, check.ErrorMatches, `invalid label name "-team": .*`)
+	err = s.p.ValidateMetadata(provision.AppMetadata{
+		Annotations: []provision.MetadataItem{{Name: "a/b/c", Value: "x"}},
+	})
+	c.Assert(err, check.ErrorMatches, `invalid annotation name "a/b/c": .*`)
+}
+
 func (s *S) TestListNodes(c *check.C) {
 	s.mockfakeNodes(c)
 	nodes, err := s.p.ListNodes([]string{})
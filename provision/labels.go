@@ -50,10 +50,44 @@ var (
 type LabelSet struct {
 	Labels map[string]string
 	Prefix string
+
+	// CustomLabels and Annotations hold the metadata defined by users in the
+	// app. They are never prefixed and never override internal labels.
+	CustomLabels map[string]string
+	Annotations  map[string]string
 }
 
 func (s *LabelSet) ToLabels() map[string]string {
-	return withPrefix(s.Labels, s.Prefix)
+	result := withPrefix(s.Labels, s.Prefix)
+	for k, v := range s.CustomLabels {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func (s *LabelSet) ToAnnotations() map[string]string {
+	if len(s.Annotations) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(s.Annotations))
+	for k, v := range s.Annotations {
+		result[k] = v
+	}
+	return result
+}
+
+// ToContainerLabels returns the labels merged with the annotations, for
+// provisioners in which containers have no other place to hold metadata.
+func (s *LabelSet) ToContainerLabels() map[string]string {
+	result := s.ToLabels()
+	for k, v := range s.Annotations {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
 }
 
 func (s *LabelSet) ToSelector() map[string]string {
@@ -247,6 +281,7 @@ func ProcessLabels(opts ProcessLabelsOpts) (*LabelSet, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	metadata := opts.App.GetMetadata()
 	return &LabelSet{
 		Labels: map[string]string{
 			labelIsTsuru:     strconv.FormatBool(true),
@@ -260,7 +295,9 @@ func ProcessLabels(opts ProcessLabelsOpts) (*LabelSet, error) {
 			labelProvisioner: opts.Provisioner,
 			labelBuilder:     opts.Builder,
 		},
-		Prefix: opts.Prefix,
+		Prefix:       opts.Prefix,
+		CustomLabels: metadata.LabelsMap(),
+		Annotations:  metadata.AnnotationsMap(),
 	}, nil
 }
 
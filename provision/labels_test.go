@@ -22,6 +22,29 @@ func (s *S) TestLabelSetConversion(c *check.C) {
 	})
 }
 
+func (s *S) TestLabelSetConversionWithCustomMetadata(c *check.C) {
+	ls := provision.LabelSet{
+		Labels:       map[string]string{"l1": "v1"},
+		Prefix:       "tsuru.io/",
+		CustomLabels: map[string]string{"team": "payments", "tsuru.io/l1": "other"},
+		Annotations:  map[string]string{"example.com/owner": "me", "team": "ignored"},
+	}
+	c.Assert(ls.ToLabels(), check.DeepEquals, map[string]string{
+		"tsuru.io/l1": "v1",
+		"team":        "payments",
+	})
+	c.Assert(ls.ToAnnotations(), check.DeepEquals, map[string]string{
+		"example.com/owner": "me",
+		"team":              "ignored",
+	})
+	c.Assert(ls.ToContainerLabels(), check.DeepEquals, map[string]string{
+		"tsuru.io/l1":       "v1",
+		"team":              "payments",
+		"example.com/owner": "me",
+	})
+	c.Assert(ls.ToSelector(), check.DeepEquals, map[string]string{})
+}
+
 func (s *S) TestLabelSetSelectors(c *check.C) {
 	ls := provision.LabelSet{
 		Labels: map[string]string{
@@ -70,6 +93,26 @@ func (s *S) TestProcessLabels(c *check.C) {
 	})
 }
 
+func (s *S) TestProcessLabelsWithMetadata(c *check.C) {
+	config.Set("routers:fake:type", "fake")
+	defer config.Unset("routers")
+	a := provisiontest.NewFakeApp("myapp", "cobol", 0)
+	a.Metadata = provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "tier", Value: "backend"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/cost-center", Value: "42"}},
+	}
+	ls, err := provision.ProcessLabels(provision.ProcessLabelsOpts{
+		App:     a,
+		Process: "p1",
+		Prefix:  "tsuru.io/",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(ls.CustomLabels, check.DeepEquals, map[string]string{"tier": "backend"})
+	c.Assert(ls.Annotations, check.DeepEquals, map[string]string{"example.com/cost-center": "42"})
+	c.Assert(ls.ToLabels()["tier"], check.Equals, "backend")
+	c.Assert(ls.ToLabels()["tsuru.io/app-name"], check.Equals, "myapp")
+}
+
 func (s *S) TestServiceLabels(c *check.C) {
 	config.Set("routers:fake:type", "fake")
 	defer config.Unset("routers")
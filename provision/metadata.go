@@ -0,0 +1,145 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/tsuru/set"
+)
+
+var internalLabelNames = set.FromValues(
+	labelIsTsuru,
+	labelIsStopped,
+	labelIsAsleep,
+	labelIsBuild,
+	labelIsDeploy,
+	labelIsIsolatedRun,
+	labelIsNodeContainer,
+	labelIsService,
+	labelAppName,
+	labelAppProcess,
+	labelAppProcessReplicas,
+	labelAppPool,
+	labelAppPlatform,
+	labelNodeContainerName,
+	labelNodeContainerPool,
+	LabelNodePool,
+	labelRouterName,
+	labelRouterType,
+	labelBuildImage,
+	labelRestarts,
+	labelProvisioner,
+	labelBuilder,
+)
+
+// MetadataItem is a single key/value pair attached to an app, either as a
+// label or as an annotation.
+//
+// Items are stored as a list instead of a map because keys usually contain
+// dots (e.g. "example.com/team"), which are not allowed in document keys.
+type MetadataItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AppMetadata holds the custom labels and annotations of an app. Labels are
+// meant to identify and select apps, while annotations carry arbitrary
+// information for external tools. Both are passed to the provisioners along
+// with the internal tsuru labels.
+type AppMetadata struct {
+	Labels      []MetadataItem `json:"labels,omitempty" bson:",omitempty"`
+	Annotations []MetadataItem `json:"annotations,omitempty" bson:",omitempty"`
+}
+
+// MetadataValidatorProvisioner is a provisioner that enforces its own rules
+// on the labels and annotations of apps.
+type MetadataValidatorProvisioner interface {
+	ValidateMetadata(AppMetadata) error
+}
+
+// LabelsMap returns the labels as a map.
+func (m AppMetadata) LabelsMap() map[string]string {
+	return metadataItemsMap(m.Labels)
+}
+
+// AnnotationsMap returns the annotations as a map.
+func (m AppMetadata) AnnotationsMap() map[string]string {
+	return metadataItemsMap(m.Annotations)
+}
+
+// Validate checks the rules common to every provisioner: names must not be
+// empty or duplicated and must not clash with labels managed by tsuru, with
+// or without the given prefix.
+func (m AppMetadata) Validate(prefix string) error {
+	err := validateMetadataItems("label", m.Labels, prefix)
+	if err != nil {
+		return err
+	}
+	return validateMetadataItems("annotation", m.Annotations, prefix)
+}
+
+func validateMetadataItems(kind string, items []MetadataItem, prefix string) error {
+	names := set.Set{}
+	for _, item := range items {
+		if item.Name == "" {
+			return fmt.Errorf("%s name must not be empty", kind)
+		}
+		if names.Includes(item.Name) {
+			return fmt.Errorf("duplicated %s %q", kind, item.Name)
+		}
+		names.Add(item.Name)
+		if isReservedLabel(item.Name, prefix) {
+			return fmt.Errorf("%s %q is reserved for internal use", kind, item.Name)
+		}
+	}
+	return nil
+}
+
+// ParseMetadataItems parses a list of "name=value" strings into metadata
+// items sorted by name. Later values override earlier ones with the same
+// name, and empty strings are ignored.
+func ParseMetadataItems(values []string) ([]MetadataItem, error) {
+	parsed := make(map[string]string)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid metadata item %q, it must be in the form name=value", v)
+		}
+		parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	items := make([]MetadataItem, 0, len(parsed))
+	for k, v := range parsed {
+		items = append(items, MetadataItem{Name: k, Value: v})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+func isReservedLabel(name, prefix string) bool {
+	if prefix != "" && strings.HasPrefix(name, prefix) {
+		return true
+	}
+	return internalLabelNames.Includes(name) || strings.HasPrefix(name, labelNodeInternalPrefix)
+}
+
+func metadataItemsMap(items []MetadataItem) map[string]string {
+	if len(items) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(items))
+	for _, item := range items {
+		result[item.Name] = item.Value
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision_test
+
+import (
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppMetadataMaps(c *check.C) {
+	m := provision.AppMetadata{
+		Labels:      []provision.MetadataItem{{Name: "team", Value: "payments"}},
+		Annotations: []provision.MetadataItem{{Name: "example.com/owner", Value: "me"}},
+	}
+	c.Assert(m.LabelsMap(), check.DeepEquals, map[string]string{"team": "payments"})
+	c.Assert(m.AnnotationsMap(), check.DeepEquals, map[string]string{"example.com/owner": "me"})
+	c.Assert(provision.AppMetadata{}.LabelsMap(), check.IsNil)
+}
+
+func (s *S) TestAppMetadataValidate(c *check.C) {
+	tests := []struct {
+		metadata provision.AppMetadata
+		prefix   string
+		err      string
+	}{
+		{metadata: provision.AppMetadata{Labels: []provision.MetadataItem{{Name: "team", Value: "a"}}}},
+		{metadata: provision.AppMetadata{Labels: []provision.MetadataItem{{Name: "tsuru.io/team"}}}},
+		{
+			metadata: provision.AppMetadata{Labels: []provision.MetadataItem{{Name: "", Value: "a"}}},
+			err:      "label name must not be empty",
+		},
+		{
+			metadata: provision.AppMetadata{Labels: []provision.MetadataItem{{Name: "a"}, {Name: "a"}}},
+			err:      `duplicated label "a"`,
+		},
+		{
+			metadata: provision.AppMetadata{Labels: []provision.MetadataItem{{Name: "app-name", Value: "x"}}},
+			err:      `label "app-name" is reserved for internal use`,
+		},
+		{
+			metadata: provision.AppMetadata{Annotations: []provision.MetadataItem{{Name: "tsuru.io/team"}}},
+			prefix:   "tsuru.io/",
+			err:      `annotation "tsuru.io/team" is reserved for internal use`,
+		},
+		{
+			metadata: provision.AppMetadata{Annotations: []provision.MetadataItem{{Name: "tsuru-internal-x"}}},
+			err:      `annotation "tsuru-internal-x" is reserved for internal use`,
+		},
+	}
+	for i, tt := range tests {
+		err := tt.metadata.Validate(tt.prefix)
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s *S) TestParseMetadataItems(c *check.C) {
+	items, err := provision.ParseMetadataItems([]string{"team=payments", "", " tier = backend", "team=core", "empty="})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.DeepEquals, []provision.MetadataItem{
+		{Name: "empty", Value: ""},
+		{Name: "team", Value: "core"},
+		{Name: "tier", Value: "backend"},
+	})
+	items, err = provision.ParseMetadataItems([]string{""})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.DeepEquals, []provision.MetadataItem{})
+	_, err = provision.ParseMetadataItems([]string{"invalid"})
+	c.Assert(err, check.ErrorMatches, `invalid metadata item "invalid", it must be in the form name=value`)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/router"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -29,7 +30,7 @@ var (
 	ErrPoolHasNoRouter                = errors.New("no router found for pool")
 
 	ErrInvalidConstraintType = errors.Errorf("invalid constraint type. Valid types are: %s", strings.Join(validConstraintTypes, ","))
-	validConstraintTypes     = []string{"team", "router"}
+	validConstraintTypes     = []string{"team", "router", "plan"}
 )
 
 type Pool struct {
@@ -56,6 +57,27 @@ type UpdatePoolOptions struct {
 	Builder     string
 }
 
+func init() {
+	event.PoolProvisioner = poolProvisionerName
+}
+
+func poolProvisionerName(name string) string {
+	if name == "" {
+		return ""
+	}
+	p, err := GetPoolByName(name)
+	if err != nil {
+		return ""
+	}
+	if p.Provisioner != "" {
+		return p.Provisioner
+	}
+	if DefaultProvisioner == "" {
+		return defaultDockerProvisioner
+	}
+	return DefaultProvisioner
+}
+
 func (p *Pool) GetProvisioner() (Provisioner, error) {
 	if p.Provisioner != "" {
 		return Get(p.Provisioner)
@@ -85,6 +107,20 @@ func (p *Pool) GetRouters() ([]string, error) {
 	return nil, ErrPoolHasNoRouter
 }
 
+// AllowsPlan returns whether apps in the pool may use the plan. Pools without
+// a plan constraint allow every plan.
+func (p *Pool) AllowsPlan(plan string) (bool, error) {
+	constraints, err := getConstraintsForPool(p.Name, "plan")
+	if err != nil {
+		return false, err
+	}
+	constraint := constraints["plan"]
+	if constraint == nil {
+		return true, nil
+	}
+	return constraint.check(plan), nil
+}
+
 func (p *Pool) GetDefaultRouter() (string, error) {
 	constraints, err := getConstraintsForPool(p.Name, "router")
 	if err != nil {
@@ -126,11 +162,16 @@ func (p *Pool) allowedValues() (map[string][]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	plans, err := plansNames()
+	if err != nil {
+		return nil, err
+	}
 	resolved := map[string][]string{
 		"router": routers,
 		"team":   teams,
+		"plan":   plans,
 	}
-	constraints, err := getConstraintsForPool(p.Name, "team", "router")
+	constraints, err := getConstraintsForPool(p.Name, "team", "router", "plan")
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +182,8 @@ func (p *Pool) allowedValues() (map[string][]string, error) {
 			names = teams
 		case "router":
 			names = routers
+		case "plan":
+			names = plans
 		}
 		var validNames []string
 		for _, n := range names {
@@ -165,6 +208,26 @@ func routersNames() ([]string, error) {
 	return names, nil
 }
 
+func plansNames() ([]string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var plans []struct {
+		Name string `bson:"_id"`
+	}
+	err = conn.Plans().Find(nil).Select(bson.M{"_id": 1}).Sort("_id").All(&plans)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range plans {
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
+
 func teamsNames() ([]string, error) {
 	teams, err := auth.ListTeams()
 	if err != nil {
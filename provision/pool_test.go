@@ -635,6 +635,7 @@ func (s *S) TestPoolAllowedValues(c *check.C) {
 	c.Assert(constraints, check.DeepEquals, map[string][]string{
 		"team":   {"team1"},
 		"router": {"router1", "router2"},
+		"plan":   nil,
 	})
 	pool.Name = "other"
 	constraints, err = pool.allowedValues()
@@ -642,5 +643,29 @@ func (s *S) TestPoolAllowedValues(c *check.C) {
 	c.Assert(constraints, check.DeepEquals, map[string][]string{
 		"team":   {"ateam", "test", "pteam", "pubteam", "team1"},
 		"router": {"router", "router1", "router2"},
+		"plan":   nil,
 	})
 }
+
+func (s *S) TestPoolAllowsPlan(c *check.C) {
+	pool := Pool{Name: "pool1"}
+	allowed, err := pool.AllowsPlan("small")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	err = SetPoolConstraint(&PoolConstraint{PoolExpr: "pool*", Field: "plan", Values: []string{"small", "medium"}})
+	c.Assert(err, check.IsNil)
+	allowed, err = pool.AllowsPlan("small")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	allowed, err = pool.AllowsPlan("large")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+	err = SetPoolConstraint(&PoolConstraint{PoolExpr: "pool1", Field: "plan", Values: []string{"large"}, Blacklist: true})
+	c.Assert(err, check.IsNil)
+	allowed, err = pool.AllowsPlan("medium")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	allowed, err = pool.AllowsPlan("large")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+}
@@ -193,6 +193,19 @@ type RunArgs struct {
 	Isolated bool
 }
 
+// UnitResources are the resources allocated to each unit of a process. Memory,
+// MemoryRequest and EphemeralStorage are in bytes, CPULimit and CPURequest in
+// millicores. Zero values, except for CPUShare, mean unset.
+type UnitResources struct {
+	Memory           int64
+	Swap             int64
+	CPUShare         int
+	CPULimit         int
+	CPURequest       int
+	MemoryRequest    int64
+	EphemeralStorage int64
+}
+
 // App represents a tsuru app.
 //
 // It contains only relevant information for provisioning.
@@ -209,12 +222,16 @@ type App interface {
 	// GetDeploy returns the deploys that an app has.
 	GetDeploys() uint
 
-	Envs() map[string]bind.EnvVar
+	Envs() (map[string]bind.EnvVar, error)
 
 	GetMemory() int64
 	GetSwap() int64
 	GetCpuShare() int
 
+	// GetUnitResources returns the resources allocated to each unit of the
+	// given process, according to the plan of the process.
+	GetUnitResources(process string) UnitResources
+
 	SetUpdatePlatform(bool) error
 	GetUpdatePlatform() bool
 
@@ -222,6 +239,9 @@ type App interface {
 
 	GetPool() string
 
+	// GetMetadata returns the custom labels and annotations of the app.
+	GetMetadata() AppMetadata
+
 	SetQuotaInUse(int) error
 }
 
@@ -388,6 +408,22 @@ type UnitStatusProvisioner interface {
 	SetUnitStatus(Unit, Status) error
 }
 
+// UnitMetric is a sample of the resources used by a unit.
+type UnitMetric struct {
+	ID          string
+	ProcessName string
+	// CPU is the usage of CPU as a percentage of one core.
+	CPU float64
+	// Memory is the memory used by the unit, in bytes.
+	Memory int64
+}
+
+// MetricsProvisioner is a provisioner that reports the resources currently
+// used by the units of an app.
+type MetricsProvisioner interface {
+	UnitsMetrics(App) ([]UnitMetric, error)
+}
+
 type AddNodeOptions struct {
 	Address    string
 	Metadata   map[string]string
@@ -52,28 +52,34 @@ func init() {
 
 // Fake implementation for provision.App.
 type FakeApp struct {
-	name           string
-	cname          []string
-	Ip             string
-	platform       string
-	units          []provision.Unit
-	logs           []string
-	logMut         sync.Mutex
-	Commands       []string
-	Memory         int64
-	Swap           int64
-	CpuShare       int
-	commMut        sync.Mutex
-	Deploys        uint
-	env            map[string]bind.EnvVar
-	bindCalls      []*provision.Unit
-	bindLock       sync.Mutex
-	instances      map[string][]bind.ServiceInstance
-	instancesLock  sync.Mutex
-	Pool           string
-	UpdatePlatform bool
-	TeamOwner      string
-	Teams          []string
+	name             string
+	cname            []string
+	Ip               string
+	platform         string
+	units            []provision.Unit
+	logs             []string
+	logMut           sync.Mutex
+	Commands         []string
+	Memory           int64
+	Swap             int64
+	CpuShare         int
+	CPULimit         int
+	CPURequest       int
+	MemoryRequest    int64
+	EphemeralStorage int64
+	ProcessResources map[string]provision.UnitResources
+	commMut          sync.Mutex
+	Deploys          uint
+	env              map[string]bind.EnvVar
+	bindCalls        []*provision.Unit
+	bindLock         sync.Mutex
+	instances        map[string][]bind.ServiceInstance
+	instancesLock    sync.Mutex
+	Pool             string
+	UpdatePlatform   bool
+	TeamOwner        string
+	Teams            []string
+	Metadata         provision.AppMetadata
 	quota.Quota
 }
 
@@ -119,6 +125,21 @@ func (a *FakeApp) GetCpuShare() int {
 	return a.CpuShare
 }
 
+func (a *FakeApp) GetUnitResources(process string) provision.UnitResources {
+	if res, ok := a.ProcessResources[process]; ok {
+		return res
+	}
+	return provision.UnitResources{
+		Memory:           a.Memory,
+		Swap:             a.Swap,
+		CPUShare:         a.CpuShare,
+		CPULimit:         a.CPULimit,
+		CPURequest:       a.CPURequest,
+		MemoryRequest:    a.MemoryRequest,
+		EphemeralStorage: a.EphemeralStorage,
+	}
+}
+
 func (a *FakeApp) HasBind(unit *provision.Unit) bool {
 	a.bindLock.Lock()
 	defer a.bindLock.Unlock()
@@ -258,6 +279,10 @@ func (a *FakeApp) GetPool() string {
 	return a.Pool
 }
 
+func (a *FakeApp) GetMetadata() provision.AppMetadata {
+	return a.Metadata
+}
+
 func (a *FakeApp) GetPlatform() string {
 	return a.platform
 }
@@ -316,8 +341,8 @@ func (a *FakeApp) InstanceEnv(env string) map[string]bind.EnvVar {
 }
 
 // Env returns app.Env
-func (a *FakeApp) Envs() map[string]bind.EnvVar {
-	return a.env
+func (a *FakeApp) Envs() (map[string]bind.EnvVar, error) {
+	return a.env, nil
 }
 
 func (a *FakeApp) SerializeEnvVars() error {
@@ -733,6 +758,36 @@ func (p *FakeProvisioner) GetAppFromUnitID(unitID string) (provision.App, error)
 	return nil, errors.New("app not found")
 }
 
+// PrepareUnitsMetrics sets the CPU and memory usage reported by UnitsMetrics
+// for every unit of the given app.
+func (p *FakeProvisioner) PrepareUnitsMetrics(app provision.App, cpu float64, memory int64) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp := p.apps[app.GetName()]
+	pApp.cpu = cpu
+	pApp.memory = memory
+	p.apps[app.GetName()] = pApp
+}
+
+// UnitsMetrics returns, for every unit of the app, the usage set by
+// PrepareUnitsMetrics.
+func (p *FakeProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetric, error) {
+	if err := p.getError("UnitsMetrics"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return nil, errNotProvisioned
+	}
+	metrics := make([]provision.UnitMetric, len(pApp.units))
+	for i, u := range pApp.units {
+		metrics[i] = provision.UnitMetric{ID: u.ID, ProcessName: u.ProcessName, CPU: pApp.cpu, Memory: pApp.memory}
+	}
+	return metrics, nil
+}
+
 // PrepareOutput sends the given slice of bytes to a queue of outputs.
 //
 // Each prepared output will be used in the ExecuteCommand. It might be sent to
@@ -957,6 +1012,10 @@ func (p *FakeProvisioner) Start(app provision.App, process string) error {
 		return errNotProvisioned
 	}
 	pApp.starts[process]++
+	for i, u := range pApp.units {
+		u.Status = provision.StatusStarted
+		pApp.units[i] = u
+	}
 	p.apps[app.GetName()] = pApp
 	return nil
 }
@@ -1538,6 +1597,8 @@ type provisionedApp struct {
 	unitLen     int
 	lastData    map[string]interface{}
 	image       string
+	cpu         float64
+	memory      int64
 }
 
 type provisionedPlatform struct {
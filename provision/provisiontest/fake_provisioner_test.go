@@ -413,6 +413,31 @@ func (s *S) TestGetUnits(c *check.C) {
 	c.Assert(units, check.DeepEquals, list)
 }
 
+func (s *S) TestUnitsMetrics(c *check.C) {
+	list := []provision.Unit{
+		{ID: "chain-lighting-0", AppName: "chain-lighting", ProcessName: "web"},
+		{ID: "chain-lighting-1", AppName: "chain-lighting", ProcessName: "worker"},
+	}
+	app := NewFakeApp("chain-lighting", "rush", 1)
+	p := NewFakeProvisioner()
+	p.apps = map[string]provisionedApp{
+		app.GetName(): {app: app, units: list},
+	}
+	p.PrepareUnitsMetrics(app, 42.5, 1024)
+	metrics, err := p.UnitsMetrics(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: "chain-lighting-0", ProcessName: "web", CPU: 42.5, Memory: 1024},
+		{ID: "chain-lighting-1", ProcessName: "worker", CPU: 42.5, Memory: 1024},
+	})
+}
+
+func (s *S) TestUnitsMetricsNotProvisioned(c *check.C) {
+	p := NewFakeProvisioner()
+	_, err := p.UnitsMetrics(NewFakeApp("chain-lighting", "rush", 1))
+	c.Assert(err, check.Equals, errNotProvisioned)
+}
+
 func (s *S) TestPrepareOutput(c *check.C) {
 	output := []byte("the body eletric")
 	p := NewFakeProvisioner()
@@ -631,6 +656,24 @@ func (s *S) TestStart(c *check.C) {
 	c.Assert(p.Starts(app, "web"), check.Equals, 1)
 }
 
+func (s *S) TestStartSleepingUnits(c *check.C) {
+	app := NewFakeApp("kid-gloves", "rush", 1)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	err := p.AddUnits(app, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = p.Sleep(app, "")
+	c.Assert(err, check.IsNil)
+	err = p.Start(app, "")
+	c.Assert(err, check.IsNil)
+	units, err := p.Units(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.Status, check.Equals, provision.StatusStarted)
+	}
+}
+
 func (s *S) TestStop(c *check.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
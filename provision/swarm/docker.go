@@ -288,7 +288,7 @@ type tsuruServiceOpts struct {
 	replicas      int
 }
 
-func extraRegisterCmds(app provision.App) string {
+func extraRegisterCmds(app provision.App) (string, error) {
 	host, _ := config.GetString("host")
 	if !strings.HasPrefix(host, "http") {
 		host = "http://" + host
@@ -296,18 +296,24 @@ func extraRegisterCmds(app provision.App) string {
 	if !strings.HasSuffix(host, "/") {
 		host += "/"
 	}
-	token := app.Envs()["TSURU_APP_TOKEN"].Value
-	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, app.GetName())
+	envs, err := app.Envs()
+	if err != nil {
+		return "", err
+	}
+	token := envs["TSURU_APP_TOKEN"].Value
+	return fmt.Sprintf(`curl -fsSL -m15 -XPOST -d"hostname=$(hostname)" -o/dev/null -H"Content-Type:application/x-www-form-urlencoded" -H"Authorization:bearer %s" %sapps/%s/units/register`, token, host, app.GetName()), nil
 }
 
 func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 	var envs []string
-	appEnvs := provision.EnvsForApp(opts.app, opts.process, opts.isDeploy)
+	appEnvs, err := provision.EnvsForApp(opts.app, opts.process, opts.isDeploy)
+	if err != nil {
+		return nil, err
+	}
 	for _, envData := range appEnvs {
 		envs = append(envs, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 	}
 	var cmds []string
-	var err error
 	var endpointSpec *swarm.EndpointSpec
 	var networks []swarm.NetworkAttachmentConfig
 	var healthConfig *container.HealthConfig
@@ -323,7 +329,12 @@ func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 		networks = []swarm.NetworkAttachmentConfig{
 			{Target: networkNameForApp(opts.app)},
 		}
-		extra := []string{extraRegisterCmds(opts.app)}
+		var registerCmds string
+		registerCmds, err = extraRegisterCmds(opts.app)
+		if err != nil {
+			return nil, err
+		}
+		extra := []string{registerCmds}
 		cmds, _, err = dockercommon.LeanContainerCmdsWithExtra(opts.process, opts.image, opts.app, extra)
 		if err != nil {
 			return nil, errors.WithStack(err)
@@ -368,7 +379,7 @@ func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 			ContainerSpec: swarm.ContainerSpec{
 				Image:       opts.image,
 				Env:         envs,
-				Labels:      opts.labels.ToLabels(),
+				Labels:      opts.labels.ToContainerLabels(),
 				Command:     cmds,
 				User:        user,
 				Healthcheck: healthConfig,
@@ -385,7 +396,7 @@ func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 		EndpointSpec: endpointSpec,
 		Annotations: swarm.Annotations{
 			Name:   srvName,
-			Labels: opts.labels.ToLabels(),
+			Labels: opts.labels.ToContainerLabels(),
 		},
 		Mode: swarm.ServiceMode{
 			Replicated: &swarm.ReplicatedService{
@@ -393,9 +404,38 @@ func serviceSpecForApp(opts tsuruServiceOpts) (*swarm.ServiceSpec, error) {
 			},
 		},
 	}
+	if !opts.isDeploy {
+		spec.TaskTemplate.Resources = serviceResources(opts.app, opts.process)
+	}
 	return &spec, nil
 }
 
+// serviceResources returns the resource limits and reservations of the tasks
+// of the process, according to its plan, or nil when the plan sets none.
+// Swarm has no ephemeral storage limit, so it's ignored.
+func serviceResources(a provision.App, process string) *swarm.ResourceRequirements {
+	res := a.GetUnitResources(process)
+	limits := swarm.Resources{
+		NanoCPUs:    int64(res.CPULimit) * 1e6,
+		MemoryBytes: res.Memory,
+	}
+	reservations := swarm.Resources{
+		NanoCPUs:    int64(res.CPURequest) * 1e6,
+		MemoryBytes: res.MemoryRequest,
+	}
+	var resources swarm.ResourceRequirements
+	if limits != (swarm.Resources{}) {
+		resources.Limits = &limits
+	}
+	if reservations != (swarm.Resources{}) {
+		resources.Reservations = &reservations
+	}
+	if resources.Limits == nil && resources.Reservations == nil {
+		return nil
+	}
+	return &resources
+}
+
 func removeServiceAndLog(client *docker.Client, id string) {
 	err := client.RemoveService(docker.RemoveServiceOptions{
 		ID: id,
@@ -19,6 +19,7 @@ import (
 	"github.com/fsouza/go-dockerclient/testing"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/nodecontainer"
+	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/provision/servicecommon"
 	"gopkg.in/check.v1"
 )
@@ -300,3 +301,25 @@ func tmpFileWith(c *check.C, contents []byte) string {
 	c.Assert(err, check.IsNil)
 	return f.Name()
 }
+
+func (s *S) TestServiceResources(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	c.Assert(serviceResources(a, "web"), check.IsNil)
+	a.Memory = 512
+	a.CPULimit = 1500
+	c.Assert(serviceResources(a, "web"), check.DeepEquals, &swarm.ResourceRequirements{
+		Limits: &swarm.Resources{NanoCPUs: 1500000000, MemoryBytes: 512},
+	})
+	a.CPURequest = 250
+	a.MemoryRequest = 256
+	c.Assert(serviceResources(a, "web"), check.DeepEquals, &swarm.ResourceRequirements{
+		Limits:       &swarm.Resources{NanoCPUs: 1500000000, MemoryBytes: 512},
+		Reservations: &swarm.Resources{NanoCPUs: 250000000, MemoryBytes: 256},
+	})
+	a.ProcessResources = map[string]provision.UnitResources{
+		"worker": {Memory: 2048, CPULimit: 2000},
+	}
+	c.Assert(serviceResources(a, "worker"), check.DeepEquals, &swarm.ResourceRequirements{
+		Limits: &swarm.Resources{NanoCPUs: 2000000000, MemoryBytes: 2048},
+	})
+}
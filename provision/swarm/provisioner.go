@@ -38,15 +38,16 @@ var swarmConfig swarmProvisionerConfig
 type swarmProvisioner struct{}
 
 var (
-	_ provision.Provisioner              = &swarmProvisioner{}
-	_ provision.ShellProvisioner         = &swarmProvisioner{}
-	_ provision.ExecutableProvisioner    = &swarmProvisioner{}
-	_ provision.MessageProvisioner       = &swarmProvisioner{}
-	_ provision.InitializableProvisioner = &swarmProvisioner{}
-	_ provision.NodeProvisioner          = &swarmProvisioner{}
-	_ provision.NodeContainerProvisioner = &swarmProvisioner{}
-	_ provision.SleepableProvisioner     = &swarmProvisioner{}
-	_ provision.BuilderDeploy            = &swarmProvisioner{}
+	_ provision.Provisioner                  = &swarmProvisioner{}
+	_ provision.ShellProvisioner             = &swarmProvisioner{}
+	_ provision.ExecutableProvisioner        = &swarmProvisioner{}
+	_ provision.MessageProvisioner           = &swarmProvisioner{}
+	_ provision.InitializableProvisioner     = &swarmProvisioner{}
+	_ provision.NodeProvisioner              = &swarmProvisioner{}
+	_ provision.NodeContainerProvisioner     = &swarmProvisioner{}
+	_ provision.SleepableProvisioner         = &swarmProvisioner{}
+	_ provision.BuilderDeploy                = &swarmProvisioner{}
+	_ provision.MetadataValidatorProvisioner = &swarmProvisioner{}
 	// _ provision.RollbackableDeployer     = &swarmProvisioner{}
 	// _ provision.RebuildableDeployer      = &swarmProvisioner{}
 	// _ provision.OptionalLogsProvisioner  = &swarmProvisioner{}
@@ -79,6 +80,10 @@ func (p *swarmProvisioner) GetName() string {
 	return provisionerName
 }
 
+func (p *swarmProvisioner) ValidateMetadata(m provision.AppMetadata) error {
+	return m.Validate(tsuruLabelPrefix)
+}
+
 func (p *swarmProvisioner) Provision(a provision.App) error {
 	client, err := chooseDBSwarmNode()
 	if err != nil {
@@ -277,6 +282,48 @@ func (p *swarmProvisioner) Units(app provision.App) ([]provision.Unit, error) {
 	return tasksToUnits(client, tasks)
 }
 
+func (p *swarmProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetric, error) {
+	client, err := chooseDBSwarmNode()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := runningTasksForApp(client, a, "")
+	if err != nil {
+		return nil, err
+	}
+	nodeClients := map[string]*docker.Client{}
+	var reqs []dockercommon.MetricsRequest
+	var metrics []provision.UnitMetric
+	for _, t := range tasks {
+		if t.Status.ContainerStatus.ContainerID == "" {
+			continue
+		}
+		nodeClient, ok := nodeClients[t.NodeID]
+		if !ok {
+			nodeClient, err = clientForNode(client, t.NodeID)
+			if err != nil {
+				return nil, err
+			}
+			nodeClients[t.NodeID] = nodeClient
+		}
+		reqs = append(reqs, dockercommon.MetricsRequest{Client: nodeClient, ContainerID: t.Status.ContainerStatus.ContainerID})
+		labels := provision.LabelSet{Labels: t.Spec.ContainerSpec.Labels, Prefix: tsuruLabelPrefix}
+		metrics = append(metrics, provision.UnitMetric{
+			ID:          t.ID,
+			ProcessName: labels.AppProcess(),
+		})
+	}
+	usages, err := dockercommon.ContainersMetrics(reqs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range metrics {
+		metrics[i].CPU = usages[i].CPU
+		metrics[i].Memory = usages[i].Memory
+	}
+	return metrics, nil
+}
+
 func (p *swarmProvisioner) RoutableAddresses(a provision.App) ([]url.URL, error) {
 	client, err := chooseDBSwarmNode()
 	if err != nil {
@@ -51,6 +51,17 @@ func (s *S) TestInitialize(c *check.C) {
 	// TODO(cezarsa): check TLSConfig loading
 }
 
+func (s *S) TestValidateMetadata(c *check.C) {
+	err := s.p.ValidateMetadata(provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "team", Value: "any value"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.p.ValidateMetadata(provision.AppMetadata{
+		Labels: []provision.MetadataItem{{Name: "tsuru.team", Value: "payments"}},
+	})
+	c.Assert(err, check.ErrorMatches, `label "tsuru.team" is reserved for internal use`)
+}
+
 func (s *S) TestProvision(c *check.C) {
 	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
 	c.Assert(err, check.IsNil)
@@ -1294,12 +1305,14 @@ func (s *S) TestDeploy(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := cli.InspectContainer(task.Status.ContainerStatus.ContainerID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(cont.Config.Entrypoint, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec python myapp.py",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 	})
 }
@@ -1358,12 +1371,14 @@ func (s *S) TestDeployServiceBind(c *check.C) {
 	})
 	task, err := cli.InspectTask(units[0].ID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(task.Spec.ContainerSpec.Command, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec python myapp.py",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 	})
 	c.Assert(serviceBodies, check.HasLen, 1)
@@ -1424,12 +1439,14 @@ func (s *S) TestDeployImageID(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := cli.InspectContainer(task.Status.ContainerStatus.ContainerID)
 	c.Assert(err, check.IsNil)
+	registerCmds, err := extraRegisterCmds(a)
+	c.Assert(err, check.IsNil)
 	c.Assert(cont.Config.Entrypoint, check.DeepEquals, []string{
 		"/bin/sh",
 		"-lc",
 		fmt.Sprintf(
 			"[ -d /home/application/current ] && cd /home/application/current; %s && exec $0 \"$@\"",
-			extraRegisterCmds(a),
+			registerCmds,
 		),
 		"/bin/sh", "-c", "python test.py",
 	})
@@ -1672,6 +1689,50 @@ func (s *S) TestExecuteCommandNoRunningTask(c *check.C) {
 	c.Assert(err, check.DeepEquals, provision.ErrEmptyApp)
 }
 
+func (s *S) TestUnitsMetrics(c *check.C) {
+	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Stop()
+	err = s.p.AddNode(provision.AddNodeOptions{Address: srv.URL()})
+	c.Assert(err, check.IsNil)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err = app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	client, _ := docker.NewClient(srv.URL())
+	task, err := client.InspectTask(units[0].ID)
+	c.Assert(err, check.IsNil)
+	task.DesiredState = swarm.TaskStateRunning
+	err = srv.MutateTask(task.ID, *task)
+	c.Assert(err, check.IsNil)
+	srv.PrepareStats(task.Status.ContainerStatus.ContainerID, func(id string) docker.Stats {
+		var stats docker.Stats
+		stats.PreCPUStats.CPUUsage.TotalUsage = 100
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.CPUStats.CPUUsage.TotalUsage = 300
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.MemoryStats.Usage = 2048
+		return stats
+	})
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: task.ID, ProcessName: "web", CPU: 20, Memory: 2048},
+	})
+}
+
 func (s *S) TestExecuteCommandOnce(c *check.C) {
 	srv, err := testing.NewServer("127.0.0.1:0", nil, nil)
 	c.Assert(err, check.IsNil)
@@ -19,10 +19,16 @@ func (q *Quota) Unlimited() bool {
 }
 
 type QuotaExceededError struct {
+	// Resource is the exceeded resource of team quotas, it's empty for unit
+	// and app quotas.
+	Resource  string
 	Requested uint
 	Available uint
 }
 
 func (err *QuotaExceededError) Error() string {
+	if err.Resource != "" {
+		return fmt.Sprintf("Quota exceeded for %s. Available: %d. Requested: %d.", err.Resource, err.Available, err.Requested)
+	}
 	return fmt.Sprintf("Quota exceeded. Available: %d. Requested: %d.", err.Available, err.Requested)
 }
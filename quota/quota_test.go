@@ -30,3 +30,21 @@ func (Suite) TestQuotaUnlimited(c *check.C) {
 	q.Limit = 4
 	c.Assert(q.Unlimited(), check.Equals, false)
 }
+
+func (Suite) TestQuotaExceededErrorWithResource(c *check.C) {
+	err := QuotaExceededError{Resource: ResourceMemory, Requested: 10, Available: 9}
+	c.Assert(err.Error(), check.Equals, "Quota exceeded for memory. Available: 9. Requested: 10.")
+}
+
+func (Suite) TestTeamQuotaCheck(c *check.C) {
+	q := TeamQuota{Team: "team1", Limits: map[string]int64{ResourceMemory: 100}}
+	c.Assert(q.Limit(ResourceMemory), check.Equals, int64(100))
+	c.Assert(q.Limit(ResourceCPUShare), check.Equals, int64(-1))
+	c.Assert(q.Check(ResourceMemory, 50, 50), check.IsNil)
+	c.Assert(q.Check(ResourceMemory, 150, -10), check.IsNil)
+	c.Assert(q.Check(ResourceCPUShare, 1000, 1000), check.IsNil)
+	err := q.Check(ResourceMemory, 50, 60)
+	c.Assert(err, check.DeepEquals, &QuotaExceededError{Resource: ResourceMemory, Requested: 60, Available: 50})
+	err = q.Check(ResourceMemory, 150, 10)
+	c.Assert(err, check.DeepEquals, &QuotaExceededError{Resource: ResourceMemory, Requested: 10, Available: 0})
+}
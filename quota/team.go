@@ -0,0 +1,216 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quota
+
+import (
+	"fmt"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Resources limited by team quotas. Memory, in bytes, and CPU shares are
+// allocated by the units of the apps of the team, according to their plans.
+const (
+	ResourceMemory           = "memory"
+	ResourceCPUShare         = "cpushare"
+	ResourceServiceInstances = "service-instances"
+)
+
+// TeamResources are the resources that can be limited in team quotas.
+var TeamResources = []string{ResourceMemory, ResourceCPUShare, ResourceServiceInstances}
+
+// TeamQuota holds the limits of the resources allocated by a team and the
+// amount of them in use. Resources without a limit are unlimited.
+type TeamQuota struct {
+	Team   string           `bson:"_id" json:"team"`
+	Limits map[string]int64 `bson:"limits,omitempty" json:"limits"`
+	InUse  map[string]int64 `bson:"inuse,omitempty" json:"inUse"`
+}
+
+// ResourceUsage reports the limit and the allocated amount of a resource. A
+// Limit of -1 means the resource is unlimited.
+type ResourceUsage struct {
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	InUse    int64  `json:"inUse"`
+}
+
+func teamQuotaCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("team_quotas"), nil
+}
+
+func validateResource(resource string) error {
+	for _, r := range TeamResources {
+		if r == resource {
+			return nil
+		}
+	}
+	msg := fmt.Sprintf("invalid quota resource %q, it must be one of %v", resource, TeamResources)
+	return &tsuruErrors.ValidationError{Message: msg}
+}
+
+// GetTeamQuota returns the quota of the team. Teams without limits get an
+// empty quota.
+func GetTeamQuota(team string) (*TeamQuota, error) {
+	coll, err := teamQuotaCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	q := TeamQuota{Team: team}
+	err = coll.FindId(team).One(&q)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// SetTeamLimit sets the limit of the resource for the team. A negative limit
+// removes the limit, making the resource unlimited.
+func SetTeamLimit(team, resource string, limit int64) error {
+	err := validateResource(resource)
+	if err != nil {
+		return err
+	}
+	coll, err := teamQuotaCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	update := bson.M{"$set": bson.M{"limits." + resource: limit}}
+	if limit < 0 {
+		update = bson.M{"$unset": bson.M{"limits." + resource: ""}}
+	}
+	_, err = coll.UpsertId(team, update)
+	return err
+}
+
+// ReserveTeamResources allocates the given amounts of resources to the team,
+// failing with a QuotaExceededError if any of them exceeds its limit. The
+// amounts in use are updated with a conditional $inc, retried whenever they
+// are changed concurrently, so concurrent reservations can't exceed the
+// limits. Negative amounts release resources.
+func ReserveTeamResources(team string, amounts map[string]int64) error {
+	coll, err := teamQuotaCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	for {
+		var q TeamQuota
+		err = coll.FindId(team).One(&q)
+		if err == mgo.ErrNotFound {
+			err = coll.Insert(TeamQuota{Team: team})
+			if err != nil && !mgo.IsDup(err) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		query := bson.M{"_id": team}
+		inc := bson.M{}
+		for resource, amount := range amounts {
+			if amount == 0 {
+				continue
+			}
+			inUse := q.InUse[resource]
+			err = q.Check(resource, inUse, amount)
+			if err != nil {
+				return err
+			}
+			if inUse == 0 {
+				query["inuse."+resource] = bson.M{"$in": []interface{}{0, nil}}
+			} else {
+				query["inuse."+resource] = inUse
+			}
+			inc["inuse."+resource] = amount
+		}
+		if len(inc) == 0 {
+			return nil
+		}
+		err = coll.Update(query, bson.M{"$inc": inc})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+}
+
+// ReleaseTeamResources releases the given amounts of resources allocated to
+// the team. Releasing is never limited, so negative amounts may be used to
+// give back resources released before.
+func ReleaseTeamResources(team string, amounts map[string]int64) error {
+	inc := bson.M{}
+	for resource, amount := range amounts {
+		if amount != 0 {
+			inc["inuse."+resource] = -amount
+		}
+	}
+	if len(inc) == 0 {
+		return nil
+	}
+	coll, err := teamQuotaCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(team, bson.M{"$inc": inc})
+	return err
+}
+
+// SetTeamUsage replaces the amounts of resources in use by the team.
+func SetTeamUsage(team string, usage map[string]int64) error {
+	set := bson.M{}
+	for resource, amount := range usage {
+		set["inuse."+resource] = amount
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	coll, err := teamQuotaCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(team, bson.M{"$set": set})
+	return err
+}
+
+// Limit returns the limit of the resource, -1 meaning it's unlimited.
+func (q *TeamQuota) Limit(resource string) int64 {
+	if limit, ok := q.Limits[resource]; ok {
+		return limit
+	}
+	return -1
+}
+
+// Check returns a QuotaExceededError naming the resource when allocating the
+// requested amount of it, in addition to the amount already in use, exceeds
+// its limit. Releasing resources, with a negative requested amount, is always
+// allowed.
+func (q *TeamQuota) Check(resource string, inUse, requested int64) error {
+	limit := q.Limit(resource)
+	if limit < 0 || requested <= 0 || inUse+requested <= limit {
+		return nil
+	}
+	available := limit - inUse
+	if available < 0 {
+		available = 0
+	}
+	return &QuotaExceededError{
+		Resource:  resource,
+		Requested: uint(requested),
+		Available: uint(available),
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quota
+
+import (
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+type TeamQuotaSuite struct{}
+
+var _ = check.Suite(&TeamQuotaSuite{})
+
+func (s *TeamQuotaSuite) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_quota_test")
+}
+
+func (s *TeamQuotaSuite) SetUpTest(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Apps().Database)
+}
+
+func (s *TeamQuotaSuite) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *TeamQuotaSuite) TestGetTeamQuotaWithoutLimits(c *check.C) {
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, &TeamQuota{Team: "team1"})
+	c.Assert(q.Limit(ResourceMemory), check.Equals, int64(-1))
+}
+
+func (s *TeamQuotaSuite) TestSetTeamLimit(c *check.C) {
+	err := SetTeamLimit("team1", ResourceMemory, 1024)
+	c.Assert(err, check.IsNil)
+	err = SetTeamLimit("team1", ResourceServiceInstances, 2)
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, &TeamQuota{Team: "team1", Limits: map[string]int64{
+		ResourceMemory:           1024,
+		ResourceServiceInstances: 2,
+	}})
+	err = SetTeamLimit("team1", ResourceMemory, -1)
+	c.Assert(err, check.IsNil)
+	q, err = GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Limits, check.DeepEquals, map[string]int64{ResourceServiceInstances: 2})
+}
+
+func (s *TeamQuotaSuite) TestSetTeamLimitInvalidResource(c *check.C) {
+	err := SetTeamLimit("team1", "disk", 10)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `invalid quota resource "disk", it must be one of \[memory cpushare service-instances\]`)
+}
+
+func (s *TeamQuotaSuite) TestReserveTeamResources(c *check.C) {
+	err := ReserveTeamResources("team1", map[string]int64{ResourceMemory: 512, ResourceCPUShare: 0})
+	c.Assert(err, check.IsNil)
+	err = SetTeamLimit("team1", ResourceMemory, 1024)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamResources("team1", map[string]int64{ResourceMemory: 512, ResourceCPUShare: 10})
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamResources("team1", map[string]int64{ResourceMemory: 1, ResourceCPUShare: 10})
+	c.Assert(err, check.DeepEquals, &QuotaExceededError{Resource: ResourceMemory, Requested: 1, Available: 0})
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{ResourceMemory: 1024, ResourceCPUShare: 10})
+	err = ReserveTeamResources("team1", map[string]int64{ResourceMemory: -256})
+	c.Assert(err, check.IsNil)
+	q, err = GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse[ResourceMemory], check.Equals, int64(768))
+}
+
+func (s *TeamQuotaSuite) TestReserveTeamResourcesConcurrently(c *check.C) {
+	err := SetTeamLimit("team1", ResourceServiceInstances, 5)
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- ReserveTeamResources("team1", map[string]int64{ResourceServiceInstances: 1})
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	var failures int
+	for err := range errCh {
+		if err != nil {
+			c.Assert(err, check.FitsTypeOf, &QuotaExceededError{})
+			failures++
+		}
+	}
+	c.Assert(failures, check.Equals, 5)
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse[ResourceServiceInstances], check.Equals, int64(5))
+}
+
+func (s *TeamQuotaSuite) TestReleaseTeamResources(c *check.C) {
+	err := SetTeamLimit("team1", ResourceMemory, 1024)
+	c.Assert(err, check.IsNil)
+	err = ReserveTeamResources("team1", map[string]int64{ResourceMemory: 1024})
+	c.Assert(err, check.IsNil)
+	err = ReleaseTeamResources("team1", map[string]int64{ResourceMemory: 512})
+	c.Assert(err, check.IsNil)
+	err = ReleaseTeamResources("team1", map[string]int64{ResourceMemory: -1024})
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{ResourceMemory: 1536})
+}
+
+func (s *TeamQuotaSuite) TestSetTeamUsage(c *check.C) {
+	err := SetTeamUsage("team1", map[string]int64{ResourceMemory: 2048, ResourceServiceInstances: 3})
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota("team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, &TeamQuota{Team: "team1", InUse: map[string]int64{
+		ResourceMemory:           2048,
+		ResourceServiceInstances: 3,
+	}})
+}
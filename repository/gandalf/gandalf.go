@@ -11,9 +11,13 @@
 package gandalf
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
@@ -172,6 +176,40 @@ func (m gandalfManager) RemoveRepository(name string) error {
 	return err
 }
 
+// RenameRepository renames a repository in Gandalf. The Gandalf client
+// doesn't support updating repositories, so the request is issued directly.
+func (m gandalfManager) RenameRepository(oldName, newName string) error {
+	serverURL, err := config.GetString(endpointConfig)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"name": newName})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/repository/%s", strings.TrimRight(serverURL, "/"), oldName)
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to Gandalf server (%s)", serverURL)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return repository.ErrRepositoryNotFound
+	case http.StatusConflict:
+		return repository.ErrRepositoryAlreadExists
+	}
+	data, _ := ioutil.ReadAll(response.Body)
+	return &gandalf.HTTPError{Code: response.StatusCode, Reason: string(data)}
+}
+
 func (m gandalfManager) GetRepository(name string) (repository.Repository, error) {
 	client, err := m.client()
 	if err != nil {
@@ -6,7 +6,9 @@ package gandalf
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/tsuru/config"
@@ -230,6 +232,37 @@ func (s *GandalfSuite) TestRemoveRepositoryNotFound(c *check.C) {
 	c.Assert(err, check.Equals, repository.ErrRepositoryNotFound)
 }
 
+func (s *GandalfSuite) TestRenameRepository(c *check.C) {
+	var gotPath, gotMethod string
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotMethod = r.Method
+		json.NewDecoder(r.Body).Decode(&gotBody)
+	}))
+	defer srv.Close()
+	config.Set("git:api-server", srv.URL)
+	defer config.Set("git:api-server", s.server.URL())
+	var manager gandalfManager
+	err := manager.RenameRepository("myrepo", "yourrepo")
+	c.Assert(err, check.IsNil)
+	c.Assert(gotMethod, check.Equals, "PUT")
+	c.Assert(gotPath, check.Equals, "/repository/myrepo")
+	c.Assert(gotBody, check.DeepEquals, map[string]string{"name": "yourrepo"})
+}
+
+func (s *GandalfSuite) TestRenameRepositoryNotFound(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "repository not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	config.Set("git:api-server", srv.URL)
+	defer config.Set("git:api-server", s.server.URL())
+	var manager gandalfManager
+	err := manager.RenameRepository("myrepo", "yourrepo")
+	c.Assert(err, check.Equals, repository.ErrRepositoryNotFound)
+}
+
 func (s *GandalfSuite) TestGetRepository(c *check.C) {
 	var manager gandalfManager
 	err := manager.CreateUser("user1")
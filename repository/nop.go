@@ -34,6 +34,10 @@ func (nopManager) RemoveRepository(name string) error {
 	return nil
 }
 
+func (nopManager) RenameRepository(oldName, newName string) error {
+	return nil
+}
+
 func (nopManager) GetRepository(name string) (Repository, error) {
 	return Repository{}, nil
 }
@@ -47,6 +47,7 @@ type RepositoryManager interface {
 
 	CreateRepository(name string, users []string) error
 	RemoveRepository(name string) error
+	RenameRepository(oldName, newName string) error
 	GetRepository(name string) (Repository, error)
 
 	Diff(repositoryName, fromVersion, toVersion string) (string, error)
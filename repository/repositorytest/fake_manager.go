@@ -87,6 +87,21 @@ func (m *fakeManager) RemoveRepository(name string) error {
 	return nil
 }
 
+func (m *fakeManager) RenameRepository(oldName, newName string) error {
+	m.grantsLock.Lock()
+	defer m.grantsLock.Unlock()
+	grants, ok := m.grants[oldName]
+	if !ok {
+		return repository.ErrRepositoryNotFound
+	}
+	if _, ok := m.grants[newName]; ok {
+		return repository.ErrRepositoryAlreadExists
+	}
+	m.grants[newName] = grants
+	delete(m.grants, oldName)
+	return nil
+}
+
 func (m *fakeManager) GetRepository(name string) (repository.Repository, error) {
 	m.grantsLock.Lock()
 	defer m.grantsLock.Unlock()
@@ -62,6 +62,26 @@ func (Suite) TestManagerRepository(c *check.C) {
 	c.Check(err, check.Equals, repository.ErrRepositoryNotFound)
 }
 
+func (Suite) TestManagerRenameRepository(c *check.C) {
+	err := manager.CreateUser("gopher")
+	c.Check(err, check.IsNil)
+	err = manager.CreateRepository("myrepo", []string{"gopher"})
+	c.Check(err, check.IsNil)
+	err = manager.CreateRepository("otherrepo", nil)
+	c.Check(err, check.IsNil)
+	err = manager.RenameRepository("myrepo", "otherrepo")
+	c.Check(err, check.Equals, repository.ErrRepositoryAlreadExists)
+	err = manager.RenameRepository("myrepo", "yourrepo")
+	c.Check(err, check.IsNil)
+	_, err = manager.GetRepository("myrepo")
+	c.Check(err, check.Equals, repository.ErrRepositoryNotFound)
+	grants, err := Granted("yourrepo")
+	c.Check(err, check.IsNil)
+	c.Check(grants, check.DeepEquals, []string{"gopher"})
+	err = manager.RenameRepository("myrepo", "newrepo")
+	c.Check(err, check.Equals, repository.ErrRepositoryNotFound)
+}
+
 func (Suite) TestManagerGrants(c *check.C) {
 	err := manager.CreateUser("gopher")
 	c.Check(err, check.IsNil)
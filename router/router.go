@@ -34,6 +34,10 @@ var (
 	ErrCNameNotAllowed       = errors.New("CName as router subdomain not allowed")
 	ErrCertificateNotFound   = errors.New("Certificate not found")
 	ErrDefaultRouterNotFound = errors.New("No default router found")
+
+	// ErrRequestCountUnavailable is returned by RequestCountRouter when the
+	// router can't account for all requests handled since the previous call.
+	ErrRequestCountUnavailable = errors.New("Request count unavailable since the previous call")
 )
 
 type ErrRouterNotFound struct {
@@ -153,6 +157,16 @@ type TLSRouter interface {
 	GetCertificate(cname string) (string, error)
 }
 
+// RequestCountRouter is a router that is able to report the number of
+// requests handled by the backend of an app since the previous call to
+// RequestCount for the same app. The count may include requests handled
+// before the previous call, but must not miss any request handled after it;
+// routers unable to guarantee that must return ErrRequestCountUnavailable. It's
+// used to detect idle apps.
+type RequestCountRouter interface {
+	RequestCount(name string) (int64, error)
+}
+
 type HealthcheckData struct {
 	Path   string
 	Status int
@@ -45,7 +45,7 @@ func createTLSRouter(name, prefix string) (router.Router, error) {
 }
 
 func newFakeRouter() fakeRouter {
-	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), mutex: &sync.Mutex{}}
+	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), requests: make(map[string]int64), mutex: &sync.Mutex{}}
 }
 
 type fakeRouter struct {
@@ -53,6 +53,7 @@ type fakeRouter struct {
 	cnames       map[string]string
 	failuresByIp map[string]bool
 	healthcheck  map[string]router.HealthcheckData
+	requests     map[string]int64
 	mutex        *sync.Mutex
 }
 
@@ -343,6 +344,7 @@ func (r *fakeRouter) Reset() {
 	r.failuresByIp = make(map[string]bool)
 	r.cnames = make(map[string]string)
 	r.healthcheck = make(map[string]router.HealthcheckData)
+	r.requests = make(map[string]int64)
 }
 
 func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
@@ -360,6 +362,32 @@ func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
 	return result, nil
 }
 
+// AddRequests increases the number of requests handled by a backend, as
+// reported by the next call to RequestCount.
+func (r *fakeRouter) AddRequests(name string, count int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests[name] += count
+}
+
+// RequestCount returns the number of requests added to the backend since the
+// previous call, resetting the count, as required by
+// router.RequestCountRouter.
+func (r *fakeRouter) RequestCount(name string) (int64, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return 0, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return 0, router.ErrBackendNotFound
+	}
+	count := r.requests[backendName]
+	delete(r.requests, backendName)
+	return count, nil
+}
+
 func (r *fakeRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
 	return router.Swap(r, backend1, backend2, cnameOnly)
 }
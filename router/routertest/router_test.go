@@ -204,6 +204,25 @@ func (s *S) TestReset(c *check.C) {
 	c.Assert(r.HasBackend("name"), check.Equals, false)
 }
 
+func (s *S) TestRequestCount(c *check.C) {
+	r := newFakeRouter()
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	count, err := r.RequestCount("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, int64(0))
+	r.AddRequests("name", 3)
+	r.AddRequests("name", 2)
+	count, err = r.RequestCount("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, int64(5))
+	count, err = r.RequestCount("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, int64(0))
+	_, err = r.RequestCount("unknown")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
 func (s *S) TestRoutes(c *check.C) {
 	r := newFakeRouter()
 	err := r.AddBackend("name")
@@ -11,6 +11,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/hc"
@@ -389,6 +391,57 @@ func (r *vulcandRouter) Routes(name string) (routes []*url.URL, err error) {
 	return routes, nil
 }
 
+// requestCountCalls holds the time of the last call to RequestCount for each
+// backend, used to tell whether the rolling window of vulcand metrics covers
+// the period since then.
+var requestCountCalls = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: map[string]time.Time{}}
+
+// RequestCount returns the number of requests handled by the frontends of
+// the app in the rolling window of vulcand metrics. Requests older than the
+// window are not reported by vulcand, so it returns
+// router.ErrRequestCountUnavailable when the previous call for the app is
+// older than the window, or unknown.
+func (r *vulcandRouter) RequestCount(name string) (count int64, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return 0, err
+	}
+	backendName := r.backendName(usedName)
+	now := time.Now()
+	frontends, err := r.client.TopFrontends(&engine.BackendKey{Id: backendName}, 0)
+	if err != nil {
+		return 0, &router.RouterError{Err: err, Op: "request count"}
+	}
+	var window time.Duration
+	for _, f := range frontends {
+		if f.Stats != nil {
+			count += f.Stats.Counters.Total
+			if window == 0 || f.Stats.Counters.Period < window {
+				window = f.Stats.Counters.Period
+			}
+		}
+	}
+	key := r.routerName + "/" + backendName
+	requestCountCalls.Lock()
+	last, ok := requestCountCalls.last[key]
+	requestCountCalls.last[key] = now
+	requestCountCalls.Unlock()
+	if len(frontends) == 0 {
+		return 0, nil
+	}
+	if !ok || now.Sub(last) > window {
+		return 0, router.ErrRequestCountUnavailable
+	}
+	return count, nil
+}
+
 func (r *vulcandRouter) StartupMessage() (string, error) {
 	message := fmt.Sprintf("vulcand router %q with API at %q", r.domain, r.client.Addr)
 	return message, nil
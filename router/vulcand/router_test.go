@@ -433,6 +433,39 @@ func (s *S) TestRoutes(c *check.C) {
 	c.Assert(routes, check.DeepEquals, []*url.URL{u1, u2})
 }
 
+func (s *S) TestRequestCount(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	var backendID string
+	statsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/top/frontends")
+		backendID = r.URL.Query().Get("backendId")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"Frontends": [
+			{"Id": "f1", "Type": "http", "BackendId": "tsuru_myapp", "Route": "Host(\"myapp.vulcand.example.com\")", "Stats": {"Counters": {"Total": 7, "Period": 10000000000}}},
+			{"Id": "f2", "Type": "http", "BackendId": "tsuru_myapp", "Route": "Host(\"myapp.example.com\")", "Stats": {"Counters": {"Total": 3, "Period": 10000000000}}}
+		]}`)
+	}))
+	defer statsServer.Close()
+	config.Set("routers:vulcand:api-url", statsServer.URL)
+	vRouter, err = router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	countRouter := vRouter.(router.RequestCountRouter)
+	_, err = countRouter.RequestCount("myapp")
+	c.Assert(err, check.Equals, router.ErrRequestCountUnavailable)
+	count, err := countRouter.RequestCount("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, int64(10))
+	c.Assert(backendID, check.Equals, "tsuru_myapp")
+	requestCountCalls.Lock()
+	requestCountCalls.last["vulcand/tsuru_myapp"] = time.Now().Add(-time.Minute)
+	requestCountCalls.Unlock()
+	_, err = countRouter.RequestCount("myapp")
+	c.Assert(err, check.Equals, router.ErrRequestCountUnavailable)
+}
+
 func (s *S) TestStartupMessage(c *check.C) {
 	got, err := router.Get("vulcand")
 	c.Assert(err, check.IsNil)
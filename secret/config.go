@@ -0,0 +1,48 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+func init() {
+	RegisterProvider("config", newConfigProvider)
+}
+
+// configProvider reads base64 encoded keys from the secrets:keys config
+// entry, encrypting new values with the one named by secrets:current-key.
+type configProvider struct{}
+
+func newConfigProvider() (KeyProvider, error) {
+	return &configProvider{}, nil
+}
+
+func (p *configProvider) CurrentKey() (string, []byte, error) {
+	id, _ := config.GetString("secrets:current-key")
+	if id == "" {
+		return "", nil, ErrNoCurrentKey
+	}
+	key, err := p.Key(id)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, key, nil
+}
+
+func (p *configProvider) Key(id string) ([]byte, error) {
+	encoded, err := config.GetString("secrets:keys:" + id)
+	if err != nil {
+		return nil, errors.Errorf("secrets key %q not found", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid secrets key %q", id)
+	}
+	return key, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secret provides encryption at rest for sensitive values, like app
+// secret environment variables. Keys are obtained from a KeyProvider, chosen
+// by the secrets:provider config entry, allowing external key management
+// services to be plugged in.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+const (
+	encryptedPrefix = "tsuru-secret:v1:"
+	defaultProvider = "config"
+)
+
+var (
+	ErrNoCurrentKey = errors.New("no key available to encrypt secrets, please set secrets:current-key")
+	ErrInvalidValue = errors.New("invalid encrypted secret value")
+)
+
+// KeyProvider provides the keys used to encrypt and decrypt secrets. Keys
+// must have 16, 24 or 32 bytes.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new values and its id.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given id, used to decrypt values
+	// encrypted with it.
+	Key(id string) ([]byte, error)
+}
+
+type providerFactory func() (KeyProvider, error)
+
+var providers = map[string]providerFactory{}
+
+// RegisterProvider registers a new key provider, which can be used by
+// setting secrets:provider to name.
+func RegisterProvider(name string, factory providerFactory) {
+	providers[name] = factory
+}
+
+// GetProvider returns the configured key provider.
+func GetProvider() (KeyProvider, error) {
+	name, _ := config.GetString("secrets:provider")
+	if name == "" {
+		name = defaultProvider
+	}
+	factory, ok := providers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown secrets key provider: %q", name)
+	}
+	return factory()
+}
+
+// IsEncrypted returns whether value was returned by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// KeyID returns the id of the key used to encrypt value.
+func KeyID(value string) (string, error) {
+	keyID, _, err := parse(value)
+	return keyID, err
+}
+
+// Encrypt encrypts value using the current key of the configured provider.
+func Encrypt(value string) (string, error) {
+	provider, err := GetProvider()
+	if err != nil {
+		return "", err
+	}
+	keyID, key, err := provider.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid secrets key %q", keyID)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(value), []byte(keyID))
+	return encryptedPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt.
+func Decrypt(value string) (string, error) {
+	keyID, data, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	provider, err := GetProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := provider.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid secrets key %q", keyID)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrInvalidValue
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data, []byte(keyID))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(plain), nil
+}
+
+// Rotate returns value encrypted again with the current key, whose id is
+// currentID, and whether it was changed, when value was encrypted with
+// another key.
+func Rotate(value, currentID string) (string, bool, error) {
+	keyID, err := KeyID(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == currentID {
+		return value, false, nil
+	}
+	plain, err := Decrypt(value)
+	if err != nil {
+		return "", false, err
+	}
+	value, err = Encrypt(plain)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func parse(value string) (string, []byte, error) {
+	if !IsEncrypted(value) {
+		return "", nil, ErrInvalidValue
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", nil, ErrInvalidValue
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, ErrInvalidValue
+	}
+	return parts[0], data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	config.Set("secrets:keys:k2", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	config.Set("secrets:current-key", "k1")
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("secrets")
+}
+
+func (s *S) TestEncryptDecrypt(c *check.C) {
+	encrypted, err := Encrypt("my secret")
+	c.Assert(err, check.IsNil)
+	c.Assert(IsEncrypted(encrypted), check.Equals, true)
+	c.Assert(strings.Contains(encrypted, "my secret"), check.Equals, false)
+	keyID, err := KeyID(encrypted)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k1")
+	other, err := Encrypt("my secret")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), encrypted)
+	config.Set("secrets:current-key", "k2")
+	plain, err := Decrypt(encrypted)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "my secret")
+}
+
+func (s *S) TestRotate(c *check.C) {
+	encrypted, err := Encrypt("my secret")
+	c.Assert(err, check.IsNil)
+	value, changed, err := Rotate(encrypted, "k1")
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, false)
+	c.Assert(value, check.Equals, encrypted)
+	config.Set("secrets:current-key", "k2")
+	value, changed, err = Rotate(encrypted, "k2")
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, true)
+	keyID, err := KeyID(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(keyID, check.Equals, "k2")
+	plain, err := Decrypt(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "my secret")
+	_, _, err = Rotate("plain", "k2")
+	c.Assert(err, check.Equals, ErrInvalidValue)
+}
+
+func (s *S) TestEncryptNoCurrentKey(c *check.C) {
+	config.Unset("secrets:current-key")
+	_, err := Encrypt("my secret")
+	c.Assert(err, check.Equals, ErrNoCurrentKey)
+}
+
+func (s *S) TestEncryptInvalidKey(c *check.C) {
+	config.Set("secrets:keys:k1", base64.StdEncoding.EncodeToString([]byte("short")))
+	_, err := Encrypt("my secret")
+	c.Assert(err, check.ErrorMatches, `invalid secrets key "k1": .*`)
+}
+
+func (s *S) TestDecryptInvalid(c *check.C) {
+	_, err := Decrypt("my secret")
+	c.Assert(err, check.Equals, ErrInvalidValue)
+	encrypted, err := Encrypt("my secret")
+	c.Assert(err, check.IsNil)
+	_, err = Decrypt(strings.Replace(encrypted, "tsuru-secret:v1:k1:", "tsuru-secret:v1:k2:", 1))
+	c.Assert(err, check.Equals, ErrInvalidValue)
+	config.Unset("secrets:keys:k1")
+	_, err = Decrypt(encrypted)
+	c.Assert(err, check.ErrorMatches, `secrets key "k1" not found`)
+}
+
+func (s *S) TestGetProviderUnknown(c *check.C) {
+	config.Set("secrets:provider", "kms")
+	_, err := GetProvider()
+	c.Assert(err, check.ErrorMatches, `unknown secrets key provider: "kms"`)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -62,7 +63,12 @@ func DeleteInstance(si *ServiceInstance, requestID string) error {
 		return err
 	}
 	defer conn.Close()
-	return conn.ServiceInstances().Remove(bson.M{"name": si.Name, "service_name": si.ServiceName})
+	err = conn.ServiceInstances().Remove(bson.M{"name": si.Name, "service_name": si.ServiceName})
+	if err != nil {
+		return err
+	}
+	releaseTeamInstance(si.TeamOwner)
+	return nil
 }
 
 func (si *ServiceInstance) GetIdentifier() string {
@@ -152,7 +158,22 @@ func (si *ServiceInstance) Update(updateData ServiceInstance) error {
 	} else {
 		updateData.Tags = tags
 	}
-	return conn.ServiceInstances().Update(bson.M{"name": si.Name, "service_name": si.ServiceName}, updateData)
+	teamChanged := updateData.TeamOwner != "" && updateData.TeamOwner != si.TeamOwner
+	if teamChanged {
+		err = reserveTeamInstance(updateData.TeamOwner)
+		if err != nil {
+			return err
+		}
+	}
+	err = conn.ServiceInstances().Update(bson.M{"name": si.Name, "service_name": si.ServiceName}, updateData)
+	if teamChanged {
+		if err != nil {
+			releaseTeamInstance(updateData.TeamOwner)
+		} else {
+			releaseTeamInstance(si.TeamOwner)
+		}
+	}
+	return err
 }
 
 func (si *ServiceInstance) updateData(update bson.M) error {
@@ -263,6 +284,56 @@ func (si *ServiceInstance) UnbindUnit(app bind.App, unit bind.Unit) error {
 	return nil
 }
 
+// RenameApp moves the bind of oldApp to newApp, which must be the same app
+// under a new name. The new name is bound in the service endpoint before the
+// old one is unbound, so the service is never left without the bind. It
+// returns the environment variables sent by the service for the new bind.
+func (si *ServiceInstance) RenameApp(oldApp, newApp bind.App) (map[string]string, error) {
+	index := si.FindApp(oldApp.GetName())
+	if index == -1 {
+		return nil, ErrAppNotBound
+	}
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	envs, err := endpoint.BindApp(si, newApp)
+	if err != nil {
+		return nil, err
+	}
+	err = si.renameAppInDB(oldApp.GetName(), newApp.GetName())
+	if err == nil {
+		err = endpoint.UnbindApp(si, oldApp)
+		if err != nil {
+			rollbackErr := si.renameAppInDB(newApp.GetName(), oldApp.GetName())
+			if rollbackErr != nil {
+				log.Errorf("[rename app] could not restore app %q in db after failure: %s", oldApp.GetName(), rollbackErr)
+			}
+		}
+	}
+	if err != nil {
+		rollbackErr := endpoint.UnbindApp(si, newApp)
+		if rollbackErr != nil {
+			log.Errorf("[rename app] could not unbind app %q after failure: %s", newApp.GetName(), rollbackErr)
+		}
+		return nil, err
+	}
+	si.Apps[index] = newApp.GetName()
+	return envs, nil
+}
+
+func (si *ServiceInstance) renameAppInDB(oldName, newName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ServiceInstances().Update(
+		bson.M{"name": si.Name, "service_name": si.ServiceName, "apps": oldName},
+		bson.M{"$set": bson.M{"apps.$": newName}},
+	)
+}
+
 // Status returns the service instance status.
 func (si *ServiceInstance) Status(requestID string) (string, error) {
 	endpoint, err := si.Service().getClient("production")
@@ -332,11 +403,43 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 	if instance.TeamOwner == "" {
 		return ErrTeamMandatory
 	}
+	err = reserveTeamInstance(instance.TeamOwner)
+	if err != nil {
+		return err
+	}
 	instance.Teams = []string{instance.TeamOwner}
 	instance.Tags = processTags(instance.Tags)
 	actions := []*action.Action{&createServiceInstance, &insertServiceInstance}
 	pipeline := action.NewPipeline(actions...)
-	return pipeline.Execute(*service, instance, user.Email, requestID)
+	err = pipeline.Execute(*service, instance, user.Email, requestID)
+	if err != nil {
+		releaseTeamInstance(instance.TeamOwner)
+	}
+	return err
+}
+
+// CountTeamInstances returns the number of service instances owned by the
+// team.
+func CountTeamInstances(team string) (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ServiceInstances().Find(bson.M{"teamowner": team}).Count()
+}
+
+// reserveTeamInstance reserves one service instance in the quota of the
+// team.
+func reserveTeamInstance(team string) error {
+	return quota.ReserveTeamResources(team, map[string]int64{quota.ResourceServiceInstances: 1})
+}
+
+func releaseTeamInstance(team string) {
+	err := quota.ReleaseTeamResources(team, map[string]int64{quota.ResourceServiceInstances: 1})
+	if err != nil {
+		log.Errorf("unable to release service instance of team %q: %s", team, err)
+	}
 }
 
 func GetServiceInstancesByServices(services []Service) ([]ServiceInstance, error) {
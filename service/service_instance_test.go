@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/quota"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -356,6 +357,54 @@ func (s *InstanceSuite) TestCreateServiceInstance(c *check.C) {
 	c.Assert(si.Tags, check.DeepEquals, []string{"tag1", "tag2"})
 }
 
+func (s *InstanceSuite) TestCreateServiceInstanceTeamQuotaExceeded(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit(s.team.Name, quota.ResourceServiceInstances, 1)
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "instance1", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.IsNil)
+	count, err := CountTeamInstances(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	instance = ServiceInstance{Name: "instance2", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: quota.ResourceServiceInstances, Available: 0, Requested: 1})
+	_, err = GetServiceInstance("mongodb", "instance2")
+	c.Assert(err, check.Equals, ErrServiceInstanceNotFound)
+}
+
+func (s *InstanceSuite) TestDeleteInstanceReleasesTeamQuota(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	err = quota.SetTeamLimit(s.team.Name, quota.ResourceServiceInstances, 1)
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "instance1", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.IsNil)
+	si, err := GetServiceInstance("mongodb", "instance1")
+	c.Assert(err, check.IsNil)
+	err = DeleteInstance(si, "")
+	c.Assert(err, check.IsNil)
+	instance = ServiceInstance{Name: "instance2", TeamOwner: s.team.Name}
+	err = CreateServiceInstance(instance, &srv, s.user, "")
+	c.Assert(err, check.IsNil)
+	q, err := quota.GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.InUse, check.DeepEquals, map[string]int64{quota.ResourceServiceInstances: 1})
+}
+
 func (s *InstanceSuite) TestCreateServiceInstanceWithSameInstanceName(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -821,6 +870,78 @@ func (s *InstanceSuite) TestUnbindAppFailureInAppEnvSet(c *check.C) {
 	c.Assert(siDB.Apps, check.DeepEquals, []string{"myapp"})
 }
 
+func (s *InstanceSuite) TestRenameApp(c *check.C) {
+	var reqs []*http.Request
+	var mut sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		reqs = append(reqs, r)
+		if r.Method == "POST" {
+			w.Write([]byte(`{"ENV1": "VAL1"}`))
+		}
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	oldApp := provisiontest.NewFakeApp("myapp", "static", 0)
+	newApp := provisiontest.NewFakeApp("yourapp", "static", 0)
+	si := ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		Apps:        []string{"otherapp", oldApp.GetName()},
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	envs, err := si.RenameApp(oldApp, newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]string{"ENV1": "VAL1"})
+	c.Assert(si.Apps, check.DeepEquals, []string{"otherapp", "yourapp"})
+	c.Assert(reqs, check.HasLen, 2)
+	c.Assert(reqs[0].Method, check.Equals, "POST")
+	c.Assert(reqs[0].URL.Path, check.Equals, "/resources/my-mysql/bind-app")
+	c.Assert(reqs[1].Method, check.Equals, "DELETE")
+	c.Assert(reqs[1].URL.Path, check.Equals, "/resources/my-mysql/bind-app")
+	siDB, err := GetServiceInstance(si.ServiceName, si.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(siDB.Apps, check.DeepEquals, []string{"otherapp", "yourapp"})
+}
+
+func (s *InstanceSuite) TestRenameAppRollbackOnUnbindFailure(c *check.C) {
+	var reqs []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r)
+		if r.Method == "DELETE" && len(reqs) == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	oldApp := provisiontest.NewFakeApp("myapp", "static", 0)
+	newApp := provisiontest.NewFakeApp("yourapp", "static", 0)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Apps: []string{oldApp.GetName()}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	_, err = si.RenameApp(oldApp, newApp)
+	c.Assert(err, check.NotNil)
+	c.Assert(reqs, check.HasLen, 3)
+	c.Assert(reqs[1].Method, check.Equals, "DELETE")
+	c.Assert(reqs[2].Method, check.Equals, "DELETE")
+	siDB, err := GetServiceInstance(si.ServiceName, si.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(siDB.Apps, check.DeepEquals, []string{"myapp"})
+}
+
+func (s *InstanceSuite) TestRenameAppNotBound(c *check.C) {
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	_, err := si.RenameApp(provisiontest.NewFakeApp("myapp", "static", 0), provisiontest.NewFakeApp("yourapp", "static", 0))
+	c.Assert(err, check.Equals, ErrAppNotBound)
+}
+
 func (s *InstanceSuite) TestBindAppFullPipeline(c *check.C) {
 	var reqs []*http.Request
 	var mut sync.Mutex
@@ -0,0 +1,277 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	GroupByTeam = "team"
+	GroupByApp  = "app"
+	GroupByPool = "pool"
+)
+
+var groupByFields = []string{GroupByTeam, GroupByApp, GroupByPool}
+
+// PlanPrice is the price of an hour of a unit of apps using a plan. Units
+// are charged for both their count and their memory.
+type PlanPrice struct {
+	UnitHour     float64
+	MemoryGBHour float64
+}
+
+// Prices are the prices of app plans, by plan name, and of service plans, by
+// service and plan name.
+type Prices struct {
+	Plans    map[string]PlanPrice
+	Services map[string]map[string]float64
+}
+
+// ReportOptions select the usage included in a report and how it's grouped.
+// Start and End are days, both included. Usage is grouped by the fields in
+// GroupBy, all of them when it's empty. When Teams is not nil, only the usage
+// of the given teams is included.
+type ReportOptions struct {
+	Start   time.Time
+	End     time.Time
+	GroupBy []string
+	Teams   []string
+}
+
+// ReportRow is the usage of a group of apps or service instances. App rows
+// have an empty Service, service instance rows are grouped only by team.
+type ReportRow struct {
+	Team          string  `json:"team,omitempty"`
+	App           string  `json:"app,omitempty"`
+	Pool          string  `json:"pool,omitempty"`
+	Service       string  `json:"service,omitempty"`
+	ServicePlan   string  `json:"servicePlan,omitempty"`
+	UnitHours     float64 `json:"unitHours"`
+	MemoryGBHours float64 `json:"memoryGBHours"`
+	CPUShareHours float64 `json:"cpuShareHours"`
+	InstanceHours float64 `json:"instanceHours"`
+	Cost          float64 `json:"cost"`
+}
+
+// Report is the usage of a date range, with its cost according to the
+// configured prices.
+type Report struct {
+	Start time.Time   `json:"start"`
+	End   time.Time   `json:"end"`
+	Rows  []ReportRow `json:"rows"`
+	Cost  float64     `json:"cost"`
+}
+
+func (o *ReportOptions) validate() error {
+	if o.Start.IsZero() || o.End.IsZero() {
+		return &tsuruErrors.ValidationError{Message: "start and end dates are required"}
+	}
+	if o.End.Before(o.Start) {
+		return &tsuruErrors.ValidationError{Message: "end date must not be before start date"}
+	}
+	for _, field := range o.GroupBy {
+		var valid bool
+		for _, f := range groupByFields {
+			valid = valid || f == field
+		}
+		if !valid {
+			msg := fmt.Sprintf("invalid group %q, it must be one of %v", field, groupByFields)
+			return &tsuruErrors.ValidationError{Message: msg}
+		}
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, errors.Errorf("invalid price %v", value)
+}
+
+func configMap(key string) map[string]interface{} {
+	value, err := config.Get(key)
+	if err != nil {
+		return nil
+	}
+	raw, _ := value.(map[interface{}]interface{})
+	result := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		name, _ := k.(string)
+		result[name] = v
+	}
+	return result
+}
+
+// ConfiguredPrices returns the prices defined in the usage:prices config
+// entry. Plans without a price and services without a price for a plan are
+// free.
+func ConfiguredPrices() (*Prices, error) {
+	prices := Prices{Plans: map[string]PlanPrice{}, Services: map[string]map[string]float64{}}
+	for plan := range configMap("usage:prices:plans") {
+		var price PlanPrice
+		for name, value := range configMap("usage:prices:plans:" + plan) {
+			v, err := toFloat(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s price for plan %q", name, plan)
+			}
+			switch name {
+			case "unit-hour":
+				price.UnitHour = v
+			case "memory-gb-hour":
+				price.MemoryGBHour = v
+			default:
+				return nil, errors.Errorf("invalid price %q for plan %q, it must be unit-hour or memory-gb-hour", name, plan)
+			}
+		}
+		prices.Plans[plan] = price
+	}
+	for svc := range configMap("usage:prices:services") {
+		prices.Services[svc] = map[string]float64{}
+		for plan, value := range configMap("usage:prices:services:" + svc) {
+			v, err := toFloat(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid price for plan %q of service %q", plan, svc)
+			}
+			prices.Services[svc][plan] = v
+		}
+	}
+	return &prices, nil
+}
+
+func (p *Prices) cost(u *DailyUsage) float64 {
+	if u.Kind == KindServiceInstance {
+		return u.InstanceHours * p.Services[u.Service][u.ServicePlan]
+	}
+	price := p.Plans[u.Plan]
+	return u.UnitHours*price.UnitHour + u.MemoryGBHours*price.MemoryGBHour
+}
+
+// GenerateReport aggregates the daily usage in the range of the options,
+// grouping it and pricing it with the given prices.
+func GenerateReport(opts ReportOptions, prices *Prices) (*Report, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	groupBy := opts.GroupBy
+	if len(groupBy) == 0 {
+		groupBy = groupByFields
+	}
+	groups := map[string]bool{}
+	for _, field := range groupBy {
+		groups[field] = true
+	}
+	query := bson.M{"day": bson.M{"$gte": day(opts.Start), "$lte": day(opts.End)}}
+	if opts.Teams != nil {
+		query["team"] = bson.M{"$in": opts.Teams}
+	}
+	coll, err := dailyCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var usages []DailyUsage
+	err = coll.Find(query).All(&usages)
+	if err != nil {
+		return nil, err
+	}
+	report := Report{Start: day(opts.Start), End: day(opts.End), Rows: []ReportRow{}}
+	index := map[ReportRow]int{}
+	for i := range usages {
+		u := &usages[i]
+		var key ReportRow
+		if groups[GroupByTeam] {
+			key.Team = u.Team
+		}
+		if u.Kind == KindServiceInstance {
+			key.Service = u.Service
+			key.ServicePlan = u.ServicePlan
+		} else {
+			if groups[GroupByApp] {
+				key.App = u.App
+			}
+			if groups[GroupByPool] {
+				key.Pool = u.Pool
+			}
+		}
+		pos, ok := index[key]
+		if !ok {
+			pos = len(report.Rows)
+			index[key] = pos
+			report.Rows = append(report.Rows, key)
+		}
+		row := &report.Rows[pos]
+		cost := prices.cost(u)
+		row.UnitHours += u.UnitHours
+		row.MemoryGBHours += u.MemoryGBHours
+		row.CPUShareHours += u.CPUShareHours
+		row.InstanceHours += u.InstanceHours
+		row.Cost += cost
+		report.Cost += cost
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Team != b.Team {
+			return a.Team < b.Team
+		}
+		if (a.Service == "") != (b.Service == "") {
+			return a.Service == ""
+		}
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.ServicePlan < b.ServicePlan
+	})
+	return &report, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// WriteCSV writes the rows of the report as CSV, with a header line.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"team", "app", "pool", "service", "service_plan", "unit_hours", "memory_gb_hours", "cpushare_hours", "instance_hours", "cost"})
+	for _, row := range r.Rows {
+		writer.Write([]string{
+			row.Team,
+			row.App,
+			row.Pool,
+			row.Service,
+			row.ServicePlan,
+			formatFloat(row.UnitHours),
+			formatFloat(row.MemoryGBHours),
+			formatFloat(row.CPUShareHours),
+			formatFloat(row.InstanceHours),
+			formatFloat(row.Cost),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestConfiguredPrices(c *check.C) {
+	config.Set("usage:prices", map[interface{}]interface{}{
+		"plans": map[interface{}]interface{}{
+			"c1": map[interface{}]interface{}{"unit-hour": 0.5, "memory-gb-hour": 1},
+			"c2": map[interface{}]interface{}{"unit-hour": "2"},
+		},
+		"services": map[interface{}]interface{}{
+			"mysql": map[interface{}]interface{}{"small": 0.25},
+		},
+	})
+	prices, err := ConfiguredPrices()
+	c.Assert(err, check.IsNil)
+	c.Assert(prices, check.DeepEquals, &Prices{
+		Plans: map[string]PlanPrice{
+			"c1": {UnitHour: 0.5, MemoryGBHour: 1},
+			"c2": {UnitHour: 2},
+		},
+		Services: map[string]map[string]float64{"mysql": {"small": 0.25}},
+	})
+}
+
+func (s *S) TestConfiguredPricesInvalid(c *check.C) {
+	config.Set("usage:prices:plans:c1:disk-hour", 1)
+	_, err := ConfiguredPrices()
+	c.Assert(err, check.ErrorMatches, `invalid price "disk-hour" for plan "c1", it must be unit-hour or memory-gb-hour`)
+	config.Unset("usage")
+	config.Set("usage:prices:plans:c1:unit-hour", "abc")
+	_, err = ConfiguredPrices()
+	c.Assert(err, check.ErrorMatches, `invalid unit-hour price for plan "c1": .*`)
+}
+
+func (s *S) insertUsage(c *check.C) {
+	d1 := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	d2 := d1.AddDate(0, 0, 1)
+	err := storeUsage(d1, []DailyUsage{
+		{Kind: KindApp, Team: "team1", App: "app1", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 24, MemoryGBHours: 12},
+		{Kind: KindApp, Team: "team1", App: "app2", Pool: "pool2", Plan: "c2", Process: "web", UnitHours: 10, MemoryGBHours: 10},
+		{Kind: KindApp, Team: "team2", App: "app3", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 2, MemoryGBHours: 1},
+		{Kind: KindServiceInstance, Team: "team1", Service: "mysql", ServicePlan: "small", InstanceHours: 24},
+	})
+	c.Assert(err, check.IsNil)
+	err = storeUsage(d2, []DailyUsage{
+		{Kind: KindApp, Team: "team1", App: "app1", Pool: "pool1", Plan: "c1", Process: "worker", UnitHours: 6, MemoryGBHours: 3},
+	})
+	c.Assert(err, check.IsNil)
+	err = storeUsage(d2.AddDate(0, 0, 1), []DailyUsage{
+		{Kind: KindApp, Team: "team1", App: "app1", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 100},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestGenerateReport(c *check.C) {
+	s.insertUsage(c)
+	prices := &Prices{
+		Plans:    map[string]PlanPrice{"c1": {UnitHour: 0.5, MemoryGBHour: 1}},
+		Services: map[string]map[string]float64{"mysql": {"small": 0.25}},
+	}
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2017, 6, 2, 0, 0, 0, 0, time.UTC)
+	report, err := GenerateReport(ReportOptions{Start: start, End: end}, prices)
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, &Report{
+		Start: start,
+		End:   end,
+		Rows: []ReportRow{
+			{Team: "team1", App: "app1", Pool: "pool1", UnitHours: 30, MemoryGBHours: 15, Cost: 30},
+			{Team: "team1", App: "app2", Pool: "pool2", UnitHours: 10, MemoryGBHours: 10},
+			{Team: "team1", Service: "mysql", ServicePlan: "small", InstanceHours: 24, Cost: 6},
+			{Team: "team2", App: "app3", Pool: "pool1", UnitHours: 2, MemoryGBHours: 1, Cost: 2},
+		},
+		Cost: 38,
+	})
+}
+
+func (s *S) TestGenerateReportGroupAndTeams(c *check.C) {
+	s.insertUsage(c)
+	prices := &Prices{}
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC)
+	report, err := GenerateReport(ReportOptions{Start: start, End: end, GroupBy: []string{GroupByPool}}, prices)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Rows, check.DeepEquals, []ReportRow{
+		{Pool: "pool1", UnitHours: 132, MemoryGBHours: 16},
+		{Pool: "pool2", UnitHours: 10, MemoryGBHours: 10},
+		{Service: "mysql", ServicePlan: "small", InstanceHours: 24},
+	})
+	report, err = GenerateReport(ReportOptions{Start: start, End: end, GroupBy: []string{GroupByTeam}, Teams: []string{"team2"}}, prices)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Rows, check.DeepEquals, []ReportRow{
+		{Team: "team2", UnitHours: 2, MemoryGBHours: 1},
+	})
+}
+
+func (s *S) TestGenerateReportInvalidOptions(c *check.C) {
+	start := time.Date(2017, 6, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		opts ReportOptions
+		msg  string
+	}{
+		{ReportOptions{Start: start}, "start and end dates are required"},
+		{ReportOptions{Start: start, End: start.AddDate(0, 0, -1)}, "end date must not be before start date"},
+		{ReportOptions{Start: start, End: start, GroupBy: []string{"plan"}}, `invalid group "plan", it must be one of \[team app pool\]`},
+	}
+	for _, tt := range tests {
+		_, err := GenerateReport(tt.opts, &Prices{})
+		c.Check(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+		c.Check(err, check.ErrorMatches, tt.msg)
+	}
+}
+
+func (s *S) TestReportWriteCSV(c *check.C) {
+	report := Report{Rows: []ReportRow{
+		{Team: "team1", App: "app1", Pool: "pool1", UnitHours: 30, MemoryGBHours: 15, CPUShareHours: 1.5, Cost: 30},
+		{Team: "team1", Service: "mysql", ServicePlan: "small", InstanceHours: 24, Cost: 6},
+	}}
+	var buf bytes.Buffer
+	err := report.WriteCSV(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, `team,app,pool,service,service_plan,unit_hours,memory_gb_hours,cpushare_hours,instance_hours,cost
+team1,app1,pool1,,,30.0000,15.0000,1.5000,0.0000,30.0000
+team1,,,mysql,small,0.0000,0.0000,0.0000,24.0000,6.0000
+`)
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package usage samples the resources allocated by apps and service
+// instances, storing them as daily aggregates used in chargeback reports.
+package usage
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	KindApp             = "app"
+	KindServiceInstance = "service-instance"
+
+	defaultSampleInterval = 10 * time.Minute
+	samplerID             = "sampler"
+	gigabyte              = 1024 * 1024 * 1024
+)
+
+// DailyUsage is the usage aggregated in a day. App usage is aggregated by
+// app, pool, plan and process, service instance usage by team, service and
+// service plan.
+type DailyUsage struct {
+	Day           time.Time
+	Kind          string
+	Team          string
+	App           string
+	Pool          string
+	Plan          string
+	Process       string
+	Service       string
+	ServicePlan   string
+	UnitHours     float64
+	MemoryGBHours float64
+	CPUShareHours float64
+	InstanceHours float64
+}
+
+type samplerState struct {
+	ID   string `bson:"_id"`
+	Last time.Time
+}
+
+func dailyCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("usage_daily")
+	coll.EnsureIndex(mgo.Index{Key: []string{"day", "team"}})
+	return coll, nil
+}
+
+func samplerCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("usage_sampler"), nil
+}
+
+func sampleInterval() time.Duration {
+	interval, _ := config.GetDuration("usage:sample-interval")
+	if interval <= 0 {
+		interval = defaultSampleInterval
+	}
+	return interval
+}
+
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// claimSample marks a sample as taken at now, returning for how long the
+// sampled resources are accounted. It returns zero when another tsuru
+// instance took a sample less than interval ago. The accounted period is the
+// time elapsed since the previous sample, capped at twice the interval so
+// downtimes of the sampler aren't charged.
+func claimSample(now time.Time, interval time.Duration) (time.Duration, error) {
+	coll, err := samplerCollection()
+	if err != nil {
+		return 0, err
+	}
+	defer coll.Close()
+	var previous samplerState
+	_, err = coll.Find(bson.M{"_id": samplerID, "last": bson.M{"$lte": now.Add(-interval)}}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{"last": now}},
+		Upsert: true,
+	}, &previous)
+	if err != nil {
+		if mgo.IsDup(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if previous.Last.IsZero() {
+		return interval, nil
+	}
+	elapsed := now.Sub(previous.Last)
+	if elapsed > 2*interval {
+		elapsed = 2 * interval
+	}
+	return elapsed, nil
+}
+
+// Sample accounts the units of all apps and all service instances for the
+// period since the previous sample. Only one tsuru instance samples the
+// usage in each interval, others return immediately.
+func Sample() error {
+	now := time.Now().UTC()
+	period, err := claimSample(now, sampleInterval())
+	if err != nil || period == 0 {
+		return err
+	}
+	usages, err := appsUsage(period)
+	if err != nil {
+		return err
+	}
+	instances, err := serviceInstancesUsage(period)
+	if err != nil {
+		return err
+	}
+	return storeUsage(day(now), append(usages, instances...))
+}
+
+// isAllocated returns whether the unit allocates the resources of the plan
+// of its process. Stopped and sleeping units aren't charged.
+func isAllocated(u *provision.Unit) bool {
+	return u.Status != provision.StatusStopped && u.Status != provision.StatusAsleep
+}
+
+func appsUsage(period time.Duration) ([]DailyUsage, error) {
+	apps, err := app.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	hours := period.Hours()
+	var usages []DailyUsage
+	for i := range apps {
+		a := &apps[i]
+		units, err := a.Units()
+		if err != nil {
+			log.Errorf("[usage] unable to list units of app %q: %s", a.Name, err)
+			continue
+		}
+		byProcess := map[string]int{}
+		var processes []string
+		for j := range units {
+			if !isAllocated(&units[j]) {
+				continue
+			}
+			if _, ok := byProcess[units[j].ProcessName]; !ok {
+				processes = append(processes, units[j].ProcessName)
+			}
+			byProcess[units[j].ProcessName]++
+		}
+		for _, process := range processes {
+			unitHours := float64(byProcess[process]) * hours
+			plan := a.PlanForProcess(process)
+			usages = append(usages, DailyUsage{
+				Kind:          KindApp,
+				Team:          a.TeamOwner,
+				App:           a.Name,
+				Pool:          a.Pool,
+				Plan:          plan.Name,
+				Process:       process,
+				UnitHours:     unitHours,
+				MemoryGBHours: unitHours * float64(plan.Memory) / gigabyte,
+				CPUShareHours: unitHours * float64(plan.CpuShare),
+			})
+		}
+	}
+	return usages, nil
+}
+
+func serviceInstancesUsage(period time.Duration) ([]DailyUsage, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var instances []service.ServiceInstance
+	err = conn.ServiceInstances().Find(nil).Select(bson.M{"service_name": 1, "plan_name": 1, "teamowner": 1}).All(&instances)
+	if err != nil {
+		return nil, err
+	}
+	usages := make([]DailyUsage, len(instances))
+	for i, si := range instances {
+		usages[i] = DailyUsage{
+			Kind:          KindServiceInstance,
+			Team:          si.TeamOwner,
+			Service:       si.ServiceName,
+			ServicePlan:   si.PlanName,
+			InstanceHours: period.Hours(),
+		}
+	}
+	return usages, nil
+}
+
+func storeUsage(d time.Time, usages []DailyUsage) error {
+	coll, err := dailyCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	for _, u := range usages {
+		key := bson.M{
+			"day":         d,
+			"kind":        u.Kind,
+			"team":        u.Team,
+			"app":         u.App,
+			"pool":        u.Pool,
+			"plan":        u.Plan,
+			"process":     u.Process,
+			"service":     u.Service,
+			"serviceplan": u.ServicePlan,
+		}
+		_, err = coll.Upsert(key, bson.M{"$inc": bson.M{
+			"unithours":     u.UnitHours,
+			"memorygbhours": u.MemoryGBHours,
+			"cpusharehours": u.CPUShareHours,
+			"instancehours": u.InstanceHours,
+		}})
+		if err != nil {
+			return errors.Wrapf(err, "unable to store usage of team %q", u.Team)
+		}
+	}
+	return nil
+}
+
+type sampler struct {
+	interval time.Duration
+	done     chan bool
+}
+
+// Initialize starts sampling the usage periodically, every
+// usage:sample-interval, if it's enabled in the config.
+func Initialize() error {
+	enabled, _ := config.GetBool("usage:enabled")
+	if !enabled {
+		return nil
+	}
+	s := &sampler{interval: sampleInterval(), done: make(chan bool)}
+	shutdown.Register(s)
+	go s.run()
+	return nil
+}
+
+func (s *sampler) run() {
+	for {
+		err := Sample()
+		if err != nil {
+			log.Errorf("[usage] unable to sample usage: %s", err)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+func (s *sampler) Shutdown() {
+	s.done <- true
+}
+
+func (s *sampler) String() string {
+	return "usage sampler"
+}
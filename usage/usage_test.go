@@ -0,0 +1,80 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestClaimSample(c *check.C) {
+	now := time.Now().UTC()
+	period, err := claimSample(now, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(period, check.Equals, time.Minute)
+	period, err = claimSample(now.Add(30*time.Second), time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(period, check.Equals, time.Duration(0))
+	period, err = claimSample(now.Add(90*time.Second), time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(period, check.Equals, 90*time.Second)
+	period, err = claimSample(now.Add(time.Hour), time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(period, check.Equals, 2*time.Minute)
+}
+
+func (s *S) TestIsAllocated(c *check.C) {
+	c.Assert(isAllocated(&provision.Unit{Status: provision.StatusStarted}), check.Equals, true)
+	c.Assert(isAllocated(&provision.Unit{Status: provision.StatusError}), check.Equals, true)
+	c.Assert(isAllocated(&provision.Unit{Status: provision.StatusStopped}), check.Equals, false)
+	c.Assert(isAllocated(&provision.Unit{Status: provision.StatusAsleep}), check.Equals, false)
+}
+
+func (s *S) TestSample(c *check.C) {
+	config.Set("usage:sample-interval", "30m")
+	a := app.App{
+		Name:      "myapp",
+		TeamOwner: "team1",
+		Pool:      "pool1",
+		Plan:      app.Plan{Name: "c1", Memory: 512 * 1024 * 1024, CpuShare: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.p.Provision(&a)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(&a, 1, "worker", nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Insert(service.ServiceInstance{
+		Name:        "mydb",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		TeamOwner:   "team2",
+	})
+	c.Assert(err, check.IsNil)
+	err = Sample()
+	c.Assert(err, check.IsNil)
+	err = Sample()
+	c.Assert(err, check.IsNil)
+	var usages []DailyUsage
+	err = s.conn.Collection("usage_daily").Find(nil).Select(bson.M{"_id": 0}).Sort("kind", "process").All(&usages)
+	c.Assert(err, check.IsNil)
+	for i := range usages {
+		usages[i].Day = usages[i].Day.UTC()
+	}
+	today := day(time.Now())
+	c.Assert(usages, check.DeepEquals, []DailyUsage{
+		{Day: today, Kind: KindApp, Team: "team1", App: "myapp", Pool: "pool1", Plan: "c1", Process: "web", UnitHours: 1, MemoryGBHours: 0.5, CPUShareHours: 10},
+		{Day: today, Kind: KindApp, Team: "team1", App: "myapp", Pool: "pool1", Plan: "c1", Process: "worker", UnitHours: 0.5, MemoryGBHours: 0.25, CPUShareHours: 5},
+		{Day: today, Kind: KindServiceInstance, Team: "team2", Service: "mysql", ServicePlan: "small", InstanceHours: 0.5},
+	})
+}